@@ -0,0 +1,177 @@
+// Package client is the Go client of the receipt processor API. It wraps the /v1 endpoints in typed
+// methods that take a context, retries transient failures with backoff and reports API errors as *Error.
+//
+//	c := client.New("http://localhost:8080", client.WithTenant("acme"))
+//	processed, err := c.ProcessReceipt(ctx, receipt)
+//	if errors.Is(err, client.ErrDuplicate) { ... }
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls one receipt processor server; it is safe for concurrent use
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	tenant     string
+	apiKey     string
+	retries    int
+	backoff    time.Duration
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client requests are sent with (default: one with a 30s timeout)
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithTenant sends requests on behalf of a tenant, as the X-Tenant-ID header
+func WithTenant(tenant string) Option {
+	return func(c *Client) { c.tenant = tenant }
+}
+
+// WithAPIKey authenticates requests with an API key of the server's AUTH_API_KEYS, as a bearer token
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithRetries sets how many times a request is retried after a transient failure (default 3, 0 disables)
+func WithRetries(retries int) Option {
+	return func(c *Client) { c.retries = retries }
+}
+
+// WithBackoff sets the delay before the first retry, doubled for every later one (default 200ms).
+// A Retry-After header from the server takes precedence.
+func WithBackoff(backoff time.Duration) Option {
+	return func(c *Client) { c.backoff = backoff }
+}
+
+// New creates a client for the server at baseURL, e.g. "http://localhost:8080"
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/") + "/v1",
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		retries:    3,
+		backoff:    200 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// request is one API call; header is sent on every attempt, so retries of a POST carry the same
+// Idempotency-Key
+type request struct {
+	method string
+	path   string
+	// body is sent as JSON, unless raw is set, which is sent as is with contentType
+	body        interface{}
+	raw         []byte
+	contentType string
+	header      http.Header
+	// once disables retries, for requests that are not safe to repeat
+	once bool
+}
+
+// do sends a request, retrying network errors and 429, 502, 503 and 504 answers, and returns the
+// successful response for the caller to decode and close
+func (c *Client) do(ctx context.Context, r request) (*http.Response, error) {
+	body := r.raw
+	if r.body != nil {
+		var err error
+		if body, err = json.Marshal(r.body); err != nil {
+			return nil, err
+		}
+		r.contentType = "application/json"
+	}
+
+	delay := c.backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, r, body)
+		if err == nil && resp.StatusCode < 400 {
+			return resp, nil
+		}
+		var wait time.Duration
+		if err == nil {
+			apiErr := newError(resp)
+			resp.Body.Close()
+			err, wait = apiErr, apiErr.RetryAfter
+			// A retry that overtakes the first attempt of an idempotent request is told to wait for it
+			inProgress := apiErr.StatusCode == http.StatusConflict && apiErr.DuplicateOf == "" && r.header.Get("Idempotency-Key") != ""
+			if !apiErr.temporary() && !inProgress {
+				return nil, err
+			}
+		} else if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if r.once || attempt >= c.retries {
+			return nil, err
+		}
+
+		if wait == 0 {
+			// Jitter keeps clients that failed together from retrying together
+			wait = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+			delay *= 2
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// send makes one attempt at a request
+func (c *Client) send(ctx context.Context, r request, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, r.method, c.baseURL+r.path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range r.header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if r.contentType != "" {
+		req.Header.Set("Content-Type", r.contentType)
+	}
+	if c.tenant != "" {
+		req.Header.Set("X-Tenant-ID", c.tenant)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	return c.httpClient.Do(req)
+}
+
+// decode reads a JSON response into v and closes it
+func decode(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// retryAfter reads a Retry-After header given in seconds
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Errors an *Error matches with errors.Is, by the status the server answered with
+var (
+	// ErrNotFound: the receipt does not exist (404)
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate: the receipt was already submitted (409 with X-Duplicate-Of); see Error.DuplicateOf
+	ErrDuplicate = errors.New("duplicate receipt")
+	// ErrUnauthorized: the server requires an API key and none or a wrong one was sent (401); see WithAPIKey
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrInvalid: the server rejected the request as malformed (400 or 422)
+	ErrInvalid = errors.New("invalid request")
+	// ErrUnavailable: the server or its store is down (503), even after retrying
+	ErrUnavailable = errors.New("service unavailable")
+)
+
+// Error is a non-successful answer from the server
+type Error struct {
+	StatusCode int
+	// Message is the plain-text body the server answered with
+	Message string
+	// DuplicateOf is the ID of the receipt a rejected duplicate matched
+	DuplicateOf string
+	// RetryAfter is how long the server asked clients to wait, if it did
+	RetryAfter time.Duration
+}
+
+// newError reads an error answer
+func newError(resp *http.Response) *Error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return &Error{
+		StatusCode:  resp.StatusCode,
+		Message:     strings.TrimSpace(string(body)),
+		DuplicateOf: resp.Header.Get("X-Duplicate-Of"),
+		RetryAfter:  retryAfter(resp),
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return "receipt processor: " + http.StatusText(e.StatusCode)
+	}
+	return "receipt processor: " + http.StatusText(e.StatusCode) + ": " + e.Message
+}
+
+// Is matches the sentinel error of the status code
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrDuplicate:
+		return e.StatusCode == http.StatusConflict && e.DuplicateOf != ""
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrInvalid:
+		return e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity
+	case ErrUnavailable:
+		return e.StatusCode == http.StatusServiceUnavailable
+	}
+	return false
+}
+
+// temporary reports whether the request may succeed when retried
+func (e *Error) temporary() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
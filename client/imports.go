@@ -0,0 +1,63 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// ImportResult is the outcome of one receipt of a bulk import; Row is its starting row or line
+type ImportResult struct {
+	Row       int    `json:"row"`
+	ID        string `json:"id,omitempty"`
+	ShortCode string `json:"shortCode,omitempty"`
+	Points    *int   `json:"points,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ImportCSV imports the receipts of a CSV file in either of the layouts the server accepts and returns
+// the outcome of every receipt. Imports are not idempotent, so they are never retried.
+func (c *Client) ImportCSV(ctx context.Context, csv io.Reader) ([]ImportResult, error) {
+	data, err := io.ReadAll(csv)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(ctx, request{method: http.MethodPost, path: "/receipts/import/csv", raw: data, contentType: "text/csv", once: true})
+	if err != nil {
+		return nil, err
+	}
+	var summary struct {
+		Results []ImportResult `json:"results"`
+	}
+	if err := decode(resp, &summary); err != nil {
+		return nil, err
+	}
+	return summary.Results, nil
+}
+
+// ImportNDJSON streams newline-delimited receipt JSON to the bulk endpoint and returns the outcome of
+// every line. Like ImportCSV it is never retried.
+func (c *Client) ImportNDJSON(ctx context.Context, ndjson io.Reader) ([]ImportResult, error) {
+	data, err := io.ReadAll(ndjson)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(ctx, request{method: http.MethodPost, path: "/receipts/bulk", raw: data, contentType: "application/x-ndjson", once: true})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var results []ImportResult
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var result ImportResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, scanner.Err()
+}
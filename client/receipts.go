@@ -0,0 +1,202 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Item is one line of a receipt
+type Item struct {
+	ShortDescription string `json:"shortDescription"`
+	Price            string `json:"price"`
+}
+
+// Receipt is a receipt as submitted, and as the server returns it with the fields it assigns
+type Receipt struct {
+	Retailer     string `json:"retailer"`
+	PurchaseDate string `json:"purchaseDate"`
+	PurchaseTime string `json:"purchaseTime"`
+	Items        []Item `json:"items"`
+	Total        string `json:"total"`
+	// UserID credits the receipt's points to a loyalty member
+	UserID string `json:"userId,omitempty"`
+	// Currency is the ISO 4217 code of the amounts; empty means the server's base currency
+	Currency string `json:"currency,omitempty"`
+	Tax      string `json:"tax,omitempty"`
+	Tip      string `json:"tip,omitempty"`
+
+	// Assigned by the server
+	ID           string   `json:"id,omitempty"`
+	ShortCode    string   `json:"shortCode,omitempty"`
+	Points       int      `json:"points,omitempty"`
+	RulesVersion string   `json:"rulesVersion,omitempty"`
+	Channel      string   `json:"channel,omitempty"`
+	State        string   `json:"state,omitempty"`
+	Flags        []string `json:"flags,omitempty"`
+}
+
+// Processed is the result of processing a receipt
+type Processed struct {
+	ID        string `json:"id"`
+	ShortCode string `json:"shortCode"`
+	Points    int    `json:"points"`
+}
+
+// htmlReceiptID and htmlShortCode find the receipt ID and short code on the HTML page servers that
+// predate JSON responses answer with
+var (
+	htmlReceiptID = regexp.MustCompile(`ID: ([0-9a-fA-F-]{36})`)
+	htmlShortCode = regexp.MustCompile(`Short code: ([0-9A-Z]+)`)
+)
+
+// ProcessReceipt submits a receipt and returns its ID and points. It is sent with an Idempotency-Key,
+// so retrying it after a timeout or an outage never processes the receipt twice. A receipt the server
+// already has fails with an error matching ErrDuplicate.
+func (c *Client) ProcessReceipt(ctx context.Context, receipt Receipt) (*Processed, error) {
+	// Points are the server's to award; the server rejects fields of a receipt it does not know
+	receipt.Points = 0
+	header := http.Header{}
+	header.Set("Idempotency-Key", uuid.New().String())
+	resp, err := c.do(ctx, request{method: http.MethodPost, path: "/receipts/process", body: receipt, header: header})
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		var processed Processed
+		if err := decode(resp, &processed); err != nil {
+			return nil, err
+		}
+		return &processed, nil
+	}
+
+	page, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	match := htmlReceiptID.FindSubmatch(page)
+	if match == nil {
+		return nil, fmt.Errorf("receipt processor: unexpected %s response", resp.Header.Get("Content-Type"))
+	}
+	processed := &Processed{ID: string(match[1])}
+	if match := htmlShortCode.FindSubmatch(page); match != nil {
+		processed.ShortCode = string(match[1])
+	}
+	if processed.Points, err = c.GetPoints(ctx, processed.ID); err != nil {
+		return nil, err
+	}
+	return processed, nil
+}
+
+// GetPoints returns the points awarded for a receipt, by ID or short code
+func (c *Client) GetPoints(ctx context.Context, id string) (int, error) {
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: "/receipts/" + url.PathEscape(id) + "/points"})
+	if err != nil {
+		return 0, err
+	}
+	var body struct {
+		Points int `json:"points"`
+	}
+	if err := decode(resp, &body); err != nil {
+		return 0, err
+	}
+	return body.Points, nil
+}
+
+// GetReceipt returns a stored receipt, by ID or short code
+func (c *Client) GetReceipt(ctx context.Context, id string) (*Receipt, error) {
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: "/receipts/" + url.PathEscape(id)})
+	if err != nil {
+		return nil, err
+	}
+	var body struct {
+		Receipt Receipt `json:"receipt"`
+		Points  int     `json:"points"`
+	}
+	if err := decode(resp, &body); err != nil {
+		return nil, err
+	}
+	body.Receipt.Points = body.Points
+	return &body.Receipt, nil
+}
+
+// ListOptions filters, sorts and pages ListReceipts; zero values are left to the server's defaults
+type ListOptions struct {
+	Limit  int
+	Offset int
+	// Sort is a comma-separated list of id, retailer, purchaseDate, total or points, "-" for descending
+	Sort     string
+	Retailer string
+	// From and To are inclusive YYYY-MM-DD purchase dates
+	From     string
+	To       string
+	Channel  string
+	State    string
+	Category string
+	// MinTotal and MaxTotal are inclusive amounts such as "10.00"
+	MinTotal  string
+	MaxTotal  string
+	MinPoints *int
+}
+
+// values encodes the options as query parameters
+func (o ListOptions) values() url.Values {
+	values := url.Values{}
+	set := func(name, value string) {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	if o.Limit > 0 {
+		values.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Offset > 0 {
+		values.Set("offset", strconv.Itoa(o.Offset))
+	}
+	set("sort", o.Sort)
+	set("retailer", o.Retailer)
+	set("from", o.From)
+	set("to", o.To)
+	set("channel", o.Channel)
+	set("state", o.State)
+	set("category", o.Category)
+	set("minTotal", o.MinTotal)
+	set("maxTotal", o.MaxTotal)
+	if o.MinPoints != nil {
+		values.Set("minPoints", strconv.Itoa(*o.MinPoints))
+	}
+	return values
+}
+
+// ReceiptPage is one page of ListReceipts; Total counts every receipt matching the filters
+type ReceiptPage struct {
+	Receipts []Receipt `json:"receipts"`
+	Total    int       `json:"total"`
+	Limit    int       `json:"limit"`
+	Offset   int       `json:"offset"`
+}
+
+// ListReceipts returns a page of the stored receipts matching the options
+func (c *Client) ListReceipts(ctx context.Context, opts ListOptions) (*ReceiptPage, error) {
+	path := "/receipts"
+	if query := opts.values().Encode(); query != "" {
+		path += "?" + query
+	}
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: path})
+	if err != nil {
+		return nil, err
+	}
+	var page ReceiptPage
+	if err := decode(resp, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
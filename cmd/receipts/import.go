@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"receipt-processor/client"
+)
+
+// importJob is one unit of work of an import: a single receipt, or a whole CSV file, which the server
+// parses
+type importJob struct {
+	source  string
+	receipt *client.Receipt
+	csv     []byte
+}
+
+// importFailure is a receipt, or a file, that was not imported
+type importFailure struct {
+	Source string `json:"source"`
+	Error  string `json:"error"`
+}
+
+// importSummary is the report printed once an import is done
+type importSummary struct {
+	Files      int             `json:"files"`
+	Imported   int             `json:"imported"`
+	Duplicates int             `json:"duplicates"`
+	Failed     int             `json:"failed"`
+	Points     int             `json:"points"`
+	Duration   string          `json:"duration"`
+	Failures   []importFailure `json:"failures,omitempty"`
+}
+
+// add records the outcome of one receipt
+func (s *importSummary) add(source string, points int, err error) {
+	switch {
+	case err == nil:
+		s.Imported++
+		s.Points += points
+	case errors.Is(err, client.ErrDuplicate):
+		s.Duplicates++
+	default:
+		s.Failed++
+		s.Failures = append(s.Failures, importFailure{Source: source, Error: err.Error()})
+	}
+}
+
+// receiptFiles lists the receipt files of a file or directory argument, sorted by name
+func receiptFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	var files []string
+	err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".json", ".ndjson", ".jsonl", ".csv":
+			if !entry.IsDir() {
+				files = append(files, file)
+			}
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// readJobs turns a receipt file into jobs. A .json file holds one receipt or an array of them, an
+// .ndjson or .jsonl file (or standard input) one receipt per line, and a .csv file is one job.
+func readJobs(cmd *cobra.Command, file string) ([]importJob, error) {
+	data, err := readInput(cmd, file)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".csv":
+		return []importJob{{source: file, csv: data}}, nil
+	case ".json":
+		trimmed := bytes.TrimSpace(data)
+		if len(trimmed) > 0 && trimmed[0] == '[' {
+			var receipts []client.Receipt
+			if err := json.Unmarshal(trimmed, &receipts); err != nil {
+				return nil, err
+			}
+			jobs := make([]importJob, len(receipts))
+			for i := range receipts {
+				jobs[i] = importJob{source: fmt.Sprintf("%s[%d]", file, i), receipt: &receipts[i]}
+			}
+			return jobs, nil
+		}
+		var receipt client.Receipt
+		if err := json.Unmarshal(trimmed, &receipt); err != nil {
+			return nil, err
+		}
+		return []importJob{{source: file, receipt: &receipt}}, nil
+	}
+
+	var jobs []importJob
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var receipt client.Receipt
+		if err := json.Unmarshal(scanner.Bytes(), &receipt); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		jobs = append(jobs, importJob{source: fmt.Sprintf("%s:%d", file, line), receipt: &receipt})
+	}
+	return jobs, scanner.Err()
+}
+
+func newImportCommand(s *settings) *cobra.Command {
+	var workers int
+	cmd := &cobra.Command{
+		Use:   "import <dir|file|->",
+		Short: "Bulk import receipt files, concurrently",
+		Long: "Import every .json, .ndjson, .jsonl and .csv file of a directory (recursively), or a single file.\n" +
+			"A .json file holds one receipt or an array of them, .ndjson and .jsonl files (and \"-\", standard\n" +
+			"input) one receipt per line, and .csv files go to the server's CSV import as a whole. Receipts are\n" +
+			"submitted by --workers concurrent workers, each request limited by --timeout. A summary of the\n" +
+			"imported, duplicate and failed receipts and the points awarded is printed at the end; the command\n" +
+			"fails if any receipt did.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if workers < 1 {
+				return fmt.Errorf("--workers must be at least 1")
+			}
+			files := []string{args[0]}
+			if args[0] != "-" {
+				var err error
+				if files, err = receiptFiles(args[0]); err != nil {
+					return err
+				}
+			}
+
+			start := time.Now()
+			summary := importSummary{Files: len(files)}
+			var mu sync.Mutex
+			record := func(source string, points int, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				summary.add(source, points, err)
+			}
+
+			jobs := make(chan importJob)
+			var wg sync.WaitGroup
+			c := s.newClient()
+			for i := 0; i < workers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for job := range jobs {
+						runImportJob(cmd.Context(), c, s.timeout, job, record)
+					}
+				}()
+			}
+		feed:
+			for _, file := range files {
+				fileJobs, err := readJobs(cmd, file)
+				if err != nil {
+					record(file, 0, err)
+					continue
+				}
+				for _, job := range fileJobs {
+					select {
+					case jobs <- job:
+					case <-cmd.Context().Done():
+						break feed
+					}
+				}
+			}
+			close(jobs)
+			wg.Wait()
+			summary.Duration = time.Since(start).Round(time.Millisecond).String()
+
+			if s.output == "json" {
+				if err := printJSON(cmd.OutOrStdout(), summary); err != nil {
+					return err
+				}
+			} else {
+				for _, failure := range summary.Failures {
+					fmt.Fprintf(cmd.ErrOrStderr(), "%s: %s\n", failure.Source, failure.Error)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%d files: %d imported, %d duplicates, %d failed, %d points in %s\n",
+					summary.Files, summary.Imported, summary.Duplicates, summary.Failed, summary.Points, summary.Duration)
+			}
+			if err := cmd.Context().Err(); err != nil {
+				return err
+			}
+			if summary.Failed > 0 {
+				return fmt.Errorf("%d receipts failed", summary.Failed)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().IntVarP(&workers, "workers", "w", 4, "receipts submitted concurrently")
+	return cmd
+}
+
+// runImportJob submits one job and records the outcome of each of its receipts
+func runImportJob(ctx context.Context, c *client.Client, timeout time.Duration, job importJob, record func(string, int, error)) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if job.receipt != nil {
+		processed, err := c.ProcessReceipt(ctx, *job.receipt)
+		if err != nil {
+			record(job.source, 0, err)
+			return
+		}
+		record(job.source, processed.Points, nil)
+		return
+	}
+
+	results, err := c.ImportCSV(ctx, bytes.NewReader(job.csv))
+	if err != nil {
+		record(job.source, 0, err)
+		return
+	}
+	for _, result := range results {
+		source := fmt.Sprintf("%s:%d", job.source, result.Row)
+		if result.Error != "" {
+			record(source, 0, errors.New(result.Error))
+		} else {
+			record(source, *result.Points, nil)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"receipt-processor/client"
+)
+
+// loadRetailers and loadItems are what synthetic receipts are made of
+var (
+	loadRetailers = []string{"Target", "Walmart", "M&M Corner Market", "Costco", "Whole Foods", "Trader Joe's", "Aldi", "Safeway"}
+	loadItems     = []string{"Mountain Dew 12PK", "Emils Cheese Pizza", "Knorr Creamy Chicken", "Doritos Nacho Cheese", "Klarbrunn 12-PK 12 FL OZ", "Gatorade", "Pepsi", "Bananas"}
+)
+
+// syntheticReceipt makes a valid receipt; n is part of every item description, so no two receipts of a
+// run are duplicates of each other
+func syntheticReceipt(rng *rand.Rand, n int) client.Receipt {
+	receipt := client.Receipt{
+		Retailer:     loadRetailers[rng.Intn(len(loadRetailers))],
+		PurchaseDate: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, rng.Intn(365)).Format("2006-01-02"),
+		PurchaseTime: fmt.Sprintf("%02d:%02d", rng.Intn(24), rng.Intn(60)),
+	}
+	cents := 0
+	for i := 0; i < 1+rng.Intn(6); i++ {
+		price := 25 + rng.Intn(2000)
+		cents += price
+		receipt.Items = append(receipt.Items, client.Item{
+			ShortDescription: fmt.Sprintf("%s #%d", loadItems[rng.Intn(len(loadItems))], n),
+			Price:            fmt.Sprintf("%d.%02d", price/100, price%100),
+		})
+	}
+	receipt.Total = fmt.Sprintf("%d.%02d", cents/100, cents%100)
+	return receipt
+}
+
+// loadReport is the outcome of a load test
+type loadReport struct {
+	Target   string  `json:"target"`
+	Duration string  `json:"duration"`
+	Rate     float64 `json:"targetRps"`
+	Achieved float64 `json:"achievedRps"`
+	Requests int     `json:"requests"`
+	// Skipped counts requests not sent because --concurrency were already in flight
+	Skipped   int               `json:"skipped"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	ErrorRate float64           `json:"errorRate"`
+	Errors    map[string]int    `json:"errors,omitempty"`
+	Latency   map[string]string `json:"latency"`
+}
+
+// errorKind names a failed request's error for the report: its status code, or timeout or network
+func errorKind(err error) string {
+	var apiErr *client.Error
+	switch {
+	case errors.As(err, &apiErr):
+		return strconv.Itoa(apiErr.StatusCode)
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+	return "network"
+}
+
+// percentile returns the p-th percentile of sorted latencies, by the nearest-rank method
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func newLoadTestCommand(s *settings) *cobra.Command {
+	var (
+		rate        float64
+		duration    time.Duration
+		concurrency int
+	)
+	cmd := &cobra.Command{
+		Use:   "loadtest",
+		Short: "Submit synthetic receipts at a fixed rate and report latencies and errors",
+		Long: "Submit unique synthetic receipts to the server at --rps for --duration and report the latency\n" +
+			"percentiles and error rate. Requests are sent on schedule whether or not earlier ones finished, up\n" +
+			"to --concurrency in flight; beyond that they are skipped and counted, which means the server fell\n" +
+			"behind. Failed requests are not retried unless --retries is given, so errors show as they happen.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if rate <= 0 || duration <= 0 || concurrency < 1 {
+				return fmt.Errorf("--rps, --duration and --concurrency must be positive")
+			}
+			retries := s.retries
+			if !cmd.Flags().Changed("retries") {
+				retries = 0
+			}
+			c := client.New(s.server, client.WithTenant(s.tenant), client.WithAPIKey(s.apiKey), client.WithRetries(retries))
+
+			var (
+				mu        sync.Mutex
+				latencies []time.Duration
+				report    = loadReport{Target: s.server, Rate: rate, Errors: map[string]int{}}
+			)
+			inFlight := make(chan struct{}, concurrency)
+			var wg sync.WaitGroup
+			rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), duration)
+			defer cancel()
+			ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+			defer ticker.Stop()
+			start := time.Now()
+		run:
+			for n := 0; ; n++ {
+				select {
+				case <-ctx.Done():
+					break run
+				case <-ticker.C:
+				}
+				select {
+				case inFlight <- struct{}{}:
+				default:
+					report.Skipped++
+					continue
+				}
+				report.Requests++
+				receipt := syntheticReceipt(rng, n)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer func() { <-inFlight }()
+					// Requests still running at the end may finish, within --timeout
+					reqCtx, cancel := context.WithTimeout(cmd.Context(), s.timeout)
+					defer cancel()
+					sent := time.Now()
+					_, err := c.ProcessReceipt(reqCtx, receipt)
+					elapsed := time.Since(sent)
+
+					mu.Lock()
+					defer mu.Unlock()
+					latencies = append(latencies, elapsed)
+					if err != nil {
+						report.Failed++
+						report.Errors[errorKind(err)]++
+					} else {
+						report.Succeeded++
+					}
+				}()
+			}
+			wg.Wait()
+			elapsed := time.Since(start)
+
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			report.Duration = elapsed.Round(time.Millisecond).String()
+			report.Achieved = float64(report.Requests) / elapsed.Seconds()
+			if report.Requests > 0 {
+				report.ErrorRate = float64(report.Failed) / float64(report.Requests)
+			}
+			report.Latency = map[string]string{}
+			for _, p := range []float64{50, 90, 95, 99, 100} {
+				name := "p" + strconv.FormatFloat(p, 'f', -1, 64)
+				if p == 100 {
+					name = "max"
+				}
+				report.Latency[name] = percentile(latencies, p).Round(10 * time.Microsecond).String()
+			}
+
+			if s.output == "json" {
+				return printJSON(cmd.OutOrStdout(), report)
+			}
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "Target:    %s\n", report.Target)
+			fmt.Fprintf(out, "Requests:  %d in %s (%.1f/s of %.1f/s), %d skipped\n", report.Requests, report.Duration, report.Achieved, rate, report.Skipped)
+			fmt.Fprintf(out, "Succeeded: %d\n", report.Succeeded)
+			fmt.Fprintf(out, "Failed:    %d (%.2f%%)\n", report.Failed, 100*report.ErrorRate)
+			kinds := make([]string, 0, len(report.Errors))
+			for kind := range report.Errors {
+				kinds = append(kinds, kind)
+			}
+			sort.Strings(kinds)
+			for _, kind := range kinds {
+				fmt.Fprintf(out, "  %-8s %d\n", kind+":", report.Errors[kind])
+			}
+			fmt.Fprintf(out, "Latency:   p50 %s  p90 %s  p95 %s  p99 %s  max %s\n",
+				report.Latency["p50"], report.Latency["p90"], report.Latency["p95"], report.Latency["p99"], report.Latency["max"])
+			return nil
+		},
+	}
+	flags := cmd.Flags()
+	flags.Float64Var(&rate, "rps", 50, "receipts submitted per second")
+	flags.DurationVarP(&duration, "duration", "d", 30*time.Second, "how long to submit receipts")
+	flags.IntVar(&concurrency, "concurrency", 100, "most requests in flight at once")
+	return cmd
+}
@@ -0,0 +1,92 @@
+// Command receipts is a command-line client of the receipt processor API: it submits receipts, looks up
+// points, lists receipts and runs bulk imports against the server named by --server.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"receipt-processor/client"
+)
+
+// settings are the global flags every subcommand shares
+type settings struct {
+	server  string
+	tenant  string
+	apiKey  string
+	timeout time.Duration
+	retries int
+	output  string
+}
+
+// envOr returns an environment variable, or fallback when it is unset
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// newClient creates the API client the flags describe
+func (s *settings) newClient() *client.Client {
+	return client.New(s.server, client.WithTenant(s.tenant), client.WithAPIKey(s.apiKey), client.WithRetries(s.retries))
+}
+
+// printJSON writes v to out as indented JSON
+func printJSON(out io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func newRootCommand() *cobra.Command {
+	s := &settings{}
+	root := &cobra.Command{
+		Use:           "receipts",
+		Short:         "Command-line client of the receipt processor API",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if s.output != "table" && s.output != "json" {
+				return fmt.Errorf("--output must be table or json, not %q", s.output)
+			}
+			return nil
+		},
+	}
+	flags := root.PersistentFlags()
+	flags.StringVar(&s.server, "server", envOr("RECEIPTS_SERVER", "http://localhost:8080"), "base URL of the server (env RECEIPTS_SERVER)")
+	flags.StringVar(&s.tenant, "tenant", os.Getenv("RECEIPTS_TENANT"), "tenant to act for, sent as X-Tenant-ID (env RECEIPTS_TENANT)")
+	flags.StringVar(&s.apiKey, "api-key", os.Getenv("RECEIPTS_API_KEY"), "API key of a server with AUTH_API_KEYS set (env RECEIPTS_API_KEY)")
+	flags.DurationVar(&s.timeout, "timeout", time.Minute, "how long each request may take, retries included")
+	flags.IntVar(&s.retries, "retries", 3, "how often transient failures are retried")
+	flags.StringVarP(&s.output, "output", "o", "table", "output format: table or json")
+
+	root.AddCommand(
+		newSubmitCommand(s),
+		newPointsCommand(s),
+		newGetCommand(s),
+		newListCommand(s),
+		newImportCommand(s),
+		newLoadTestCommand(s),
+	)
+	return root
+}
+
+func main() {
+	// An interrupted import stops handing out receipts and still prints its summary
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := newRootCommand().ExecuteContext(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "receipts:", err)
+		stop()
+		os.Exit(1)
+	}
+}
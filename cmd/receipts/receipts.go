@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"receipt-processor/client"
+)
+
+// readInput reads a file, or standard input for "-"
+func readInput(cmd *cobra.Command, path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(cmd.InOrStdin())
+	}
+	return os.ReadFile(path)
+}
+
+func newSubmitCommand(s *settings) *cobra.Command {
+	return &cobra.Command{
+		Use:   "submit <file|->",
+		Short: "Submit a receipt from a JSON file and print its ID and points",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := readInput(cmd, args[0])
+			if err != nil {
+				return err
+			}
+			var receipt client.Receipt
+			if err := json.Unmarshal(data, &receipt); err != nil {
+				return fmt.Errorf("%s: %w", args[0], err)
+			}
+			ctx, cancel := context.WithTimeout(cmd.Context(), s.timeout)
+			defer cancel()
+			processed, err := s.newClient().ProcessReceipt(ctx, receipt)
+			if err != nil {
+				return err
+			}
+			if s.output == "json" {
+				return printJSON(cmd.OutOrStdout(), processed)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s\t%d points\n", processed.ID, processed.Points)
+			return nil
+		},
+	}
+}
+
+func newPointsCommand(s *settings) *cobra.Command {
+	return &cobra.Command{
+		Use:   "points <id|short code>",
+		Short: "Print the points awarded for a receipt",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(cmd.Context(), s.timeout)
+			defer cancel()
+			points, err := s.newClient().GetPoints(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			if s.output == "json" {
+				return printJSON(cmd.OutOrStdout(), map[string]int{"points": points})
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), points)
+			return nil
+		},
+	}
+}
+
+func newGetCommand(s *settings) *cobra.Command {
+	return &cobra.Command{
+		Use:   "get <id|short code>",
+		Short: "Print a stored receipt",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(cmd.Context(), s.timeout)
+			defer cancel()
+			receipt, err := s.newClient().GetReceipt(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			// A receipt has no useful table form beyond its fields
+			return printJSON(cmd.OutOrStdout(), receipt)
+		},
+	}
+}
+
+func newListCommand(s *settings) *cobra.Command {
+	var opts client.ListOptions
+	var minPoints int
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List stored receipts, filtered and sorted by the flags",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cmd.Flags().Changed("min-points") {
+				opts.MinPoints = &minPoints
+			}
+			ctx, cancel := context.WithTimeout(cmd.Context(), s.timeout)
+			defer cancel()
+			page, err := s.newClient().ListReceipts(ctx, opts)
+			if err != nil {
+				return err
+			}
+			if s.output == "json" {
+				return printJSON(cmd.OutOrStdout(), page)
+			}
+			table := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(table, "ID\tRETAILER\tDATE\tTOTAL\tPOINTS\tSTATE")
+			for _, r := range page.Receipts {
+				fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%d\t%s\n", r.ID, r.Retailer, r.PurchaseDate, r.Total, r.Points, r.State)
+			}
+			table.Flush()
+			if shown := page.Offset + len(page.Receipts); shown < page.Total {
+				fmt.Fprintf(cmd.ErrOrStderr(), "%d-%d of %d receipts; use --offset %d for more\n", page.Offset+1, shown, page.Total, shown)
+			}
+			return nil
+		},
+	}
+	flags := cmd.Flags()
+	flags.IntVar(&opts.Limit, "limit", 0, "receipts per page (server default 100)")
+	flags.IntVar(&opts.Offset, "offset", 0, "receipts to skip")
+	flags.StringVar(&opts.Sort, "sort", "", "comma-separated sort fields, - for descending, e.g. -points,id")
+	flags.StringVar(&opts.Retailer, "retailer", "", "retailer name, case-insensitive")
+	flags.StringVar(&opts.From, "from", "", "earliest purchase date, YYYY-MM-DD")
+	flags.StringVar(&opts.To, "to", "", "latest purchase date, YYYY-MM-DD")
+	flags.StringVar(&opts.Channel, "channel", "", "submission channel")
+	flags.StringVar(&opts.State, "state", "", "lifecycle state")
+	flags.StringVar(&opts.Category, "category", "", "item category")
+	flags.StringVar(&opts.MinTotal, "min-total", "", "smallest total, e.g. 10.00")
+	flags.StringVar(&opts.MaxTotal, "max-total", "", "largest total")
+	flags.IntVar(&minPoints, "min-points", 0, "fewest points awarded")
+	return cmd
+}
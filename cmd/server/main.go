@@ -0,0 +1,177 @@
+// Command server runs the receipt processor API on port 8080. It is configured with environment
+// variables; see the README.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"receipt-processor/internal/config"
+	"receipt-processor/internal/handlers"
+	"receipt-processor/internal/service"
+)
+
+func main() {
+	service.LogStartupBanner()
+
+	receipts, err := service.OpenStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+	svc := service.New(receipts, nil, time.Now)
+	srv := handlers.NewServer(svc, log.Default())
+	if err := svc.ConfigureRules(); err != nil {
+		log.Fatal(err)
+	}
+	svc.ConfigureRulesFile()
+	svc.WatchRulesFile(config.Duration("RULES_FILE_POLL_INTERVAL", 5*time.Second))
+	// SIGHUP reloads RULES_FILE without waiting for the poll
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for range hup {
+			if _, err := svc.ReloadRules(context.Background()); err != nil {
+				log.Printf("Rules not reloaded on SIGHUP: %v", err)
+			}
+		}
+	}()
+	svc.ConfigureRedaction()
+	if err := svc.StartWebhooks(); err != nil {
+		log.Fatal(err)
+	}
+	svc.StartKafkaPublisher()
+	srv.StartNATS()
+	srv.StartIdempotencyExpiry(config.Duration("IDEMPOTENCY_TTL", 24*time.Hour))
+	svc.StartStoreBuffer(config.Int("STORE_BUFFER_SIZE", 0), config.Duration("STORE_REPLAY_INTERVAL", 5*time.Second))
+	svc.ConfigureDuplicateDetection()
+	svc.StartDuplicateIndex(config.Duration("DUPLICATE_SWEEP_INTERVAL", time.Minute))
+	svc.ConfigureFraud()
+	svc.ConfigureOCR()
+	svc.ConfigureXMLMapping()
+	svc.ConfigureCurrency()
+	svc.ConfigureWorkflows()
+	svc.ConfigureRetailers()
+	svc.ConfigureTiers()
+	if err := svc.ConfigureAudit(); err != nil {
+		log.Fatal(err)
+	}
+	if err := svc.ConfigureReferrals(); err != nil {
+		log.Fatal(err)
+	}
+	if err := svc.ConfigureCampaigns(); err != nil {
+		log.Fatal(err)
+	}
+	svc.SetAsyncProcessing(config.Bool("ASYNC_PROCESSING", false))
+	svc.StartBatchWorkers(config.Int("BATCH_WORKERS", 4), config.Int("BATCH_QUEUE_SIZE", 1000))
+	svc.StartJobExpiry(config.Duration("JOB_TTL", time.Hour))
+	svc.ConfigurePointsCache(config.Int("POINTS_CACHE_SIZE", 10000), config.Duration("POINTS_CACHE_TTL", 5*time.Minute))
+	svc.StartBalanceCache(config.Duration("BALANCE_CHECK_INTERVAL", time.Hour))
+	svc.StartSearchIndex()
+	svc.StartRetention(config.Duration("RETENTION_INTERVAL", time.Hour))
+	svc.StartS3Export()
+	svc.StartSnapshots(config.Duration("SNAPSHOT_INTERVAL", 5*time.Minute))
+	svc.SetLeaderboardTTL(config.Duration("LEADERBOARD_TTL", time.Minute))
+
+	// The debug routes get a port of their own with DEBUG_ADDR, which should not be reachable from outside
+	if addr := os.Getenv("DEBUG_ADDR"); addr != "" {
+		go func() {
+			log.Printf("Serving debug routes at %s", addr)
+			if err := http.ListenAndServe(addr, handlers.DebugHandler()); err != nil {
+				log.Printf("Debug routes: %v", err)
+			}
+		}()
+	}
+
+	tlsConfig, err := handlers.TLSConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	listeners, err := handlers.Listeners()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// gRPC is served on the listeners over HTTP/2, and on a port of its own with GRPC_ADDR
+	grpcServer := srv.GRPCServer(tlsConfig)
+	handler := srv.Handler(grpcServer)
+	servers := make([]*http.Server, len(listeners))
+	for i, l := range listeners {
+		serverTLS := tlsConfig
+		if l.Plaintext {
+			serverTLS = nil
+		}
+		if serverTLS != nil {
+			fmt.Printf("Server is running at %s (HTTPS)\n", l.Where)
+		} else {
+			fmt.Printf("Server is running at %s\n", l.Where)
+		}
+		// Slow clients are cut off rather than holding connections open: the headers and the whole request
+		// have to arrive, and the response be written, within these limits
+		servers[i] = &http.Server{
+			Handler:           l.Handler(handler),
+			ReadHeaderTimeout: config.Duration("SERVER_READ_HEADER_TIMEOUT", 10*time.Second),
+			ReadTimeout:       config.Duration("SERVER_READ_TIMEOUT", time.Minute),
+			WriteTimeout:      config.Duration("SERVER_WRITE_TIMEOUT", 2*time.Minute),
+			IdleTimeout:       config.Duration("SERVER_IDLE_TIMEOUT", 2*time.Minute),
+			TLSConfig:         serverTLS,
+		}
+		if err := handlers.ConfigureHTTP2(servers[i]); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// The gRPC port has the same TLS as the HTTP server
+	if addr := os.Getenv("GRPC_ADDR"); addr != "" {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go func() {
+			log.Printf("Serving gRPC at %s", addr)
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Printf("gRPC: %v", err)
+			}
+		}()
+	}
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		grpcServer.GracefulStop()
+		for _, server := range servers {
+			if err := server.Shutdown(ctx); err != nil {
+				log.Printf("Shutdown: %v", err)
+			}
+		}
+	}()
+	// Every listener is served until shutdown, and one failing stops the server
+	done := make(chan error, len(servers))
+	for i, server := range servers {
+		listener, secure := listeners[i].Listener, tlsConfig != nil && !listeners[i].Plaintext
+		go func() {
+			if secure {
+				// The certificate comes from TLSConfig, so no files are given here
+				done <- server.ServeTLS(listener, "", "")
+			} else {
+				done <- server.Serve(listener)
+			}
+		}()
+	}
+	for range servers {
+		if err := <-done; !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}
+	if err := svc.SaveSnapshot(); err != nil {
+		log.Fatalf("Final snapshot failed: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+// Package config reads the server's settings from environment variables. Invalid values are logged
+// and the default is used instead, so a typo never keeps the server from starting.
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Int reads an integer setting from the environment, falling back to def when unset
+func Int(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Ignoring invalid %s=%q: %v", name, value, err)
+		return def
+	}
+	return n
+}
+
+// Float reads a decimal setting from the environment, falling back to def when unset
+func Float(name string, def float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Ignoring invalid %s=%q: %v", name, value, err)
+		return def
+	}
+	return f
+}
+
+// Bool reads a boolean setting from the environment, falling back to def when unset
+func Bool(name string, def bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Ignoring invalid %s=%q: %v", name, value, err)
+		return def
+	}
+	return b
+}
+
+// Duration reads a duration setting from the environment, falling back to def when unset
+func Duration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Ignoring invalid %s=%q: %v", name, value, err)
+		return def
+	}
+	return d
+}
+
+// DurationMap reads a comma-separated list of key=duration pairs, e.g. "acme=48h,globex=0"
+func DurationMap(name string) map[string]time.Duration {
+	values := make(map[string]time.Duration)
+	for _, pair := range strings.Split(os.Getenv(name), ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			log.Printf("Ignoring invalid %s entry %q: %v", name, pair, err)
+			continue
+		}
+		values[strings.TrimSpace(key)] = d
+	}
+	return values
+}
+
+// Map reads a comma-separated list of key=value pairs, e.g. "k1=acme,k2=globex"
+func Map(name string) map[string]string {
+	values := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(name), ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if key == "" || value == "" {
+			log.Printf("Ignoring invalid %s entry %q", name, pair)
+			continue
+		}
+		values[key] = value
+	}
+	return values
+}
+
+// List reads a comma-separated list, falling back to def when unset; blank entries are dropped
+func List(name string, def []string) []string {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	var values []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			values = append(values, entry)
+		}
+	}
+	return values
+}
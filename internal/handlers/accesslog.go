@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// accessLogEntry is one request of the JSON access log
+type accessLogEntry struct {
+	Time       string  `json:"time"`
+	RemoteAddr string  `json:"remoteAddr"`
+	User       string  `json:"user,omitempty"`
+	Method     string  `json:"method"`
+	URI        string  `json:"uri"`
+	Proto      string  `json:"proto"`
+	Status     int     `json:"status"`
+	Bytes      int64   `json:"bytes"`
+	LatencyMs  float64 `json:"latencyMs"`
+	Referer    string  `json:"referer,omitempty"`
+	UserAgent  string  `json:"userAgent,omitempty"`
+}
+
+// accessLog writes a line per request to ACCESS_LOG: "stdout", "stderr" or a file, which is appended
+// to. ACCESS_LOG_FORMAT is "combined" (default), the Apache combined log format followed by the latency
+// in microseconds, or "json". Without ACCESS_LOG it does nothing.
+func (s *Server) accessLog() mux.MiddlewareFunc {
+	var out io.Writer
+	switch target := os.Getenv("ACCESS_LOG"); target {
+	case "":
+	case "stdout":
+		out = os.Stdout
+	case "stderr":
+		out = os.Stderr
+	default:
+		file, err := os.OpenFile(target, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			s.logger.Printf("Access log disabled: %v", err)
+		} else {
+			out = file
+		}
+	}
+	format := strings.ToLower(os.Getenv("ACCESS_LOG_FORMAT"))
+	switch format {
+	case "combined", "json":
+	case "":
+		format = "combined"
+	default:
+		s.logger.Printf("Ignoring invalid ACCESS_LOG_FORMAT=%q, using combined", format)
+		format = "combined"
+	}
+	// A log.Logger serializes the writes of concurrent requests
+	logger := log.New(out, "", 0)
+	return func(next http.Handler) http.Handler {
+		if out == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			start := s.svc.Now()
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, req)
+			latency := s.svc.Now().Sub(start)
+			user, _, _ := req.BasicAuth()
+			if format == "json" {
+				line, _ := json.Marshal(accessLogEntry{
+					Time:       start.UTC().Format(time.RFC3339Nano),
+					RemoteAddr: clientIP(req),
+					User:       user,
+					Method:     req.Method,
+					URI:        s.redactedURI(req),
+					Proto:      req.Proto,
+					Status:     recorder.status,
+					Bytes:      recorder.bytes,
+					LatencyMs:  float64(latency.Microseconds()) / 1000,
+					Referer:    req.Referer(),
+					UserAgent:  req.UserAgent(),
+				})
+				logger.Print(string(line))
+				return
+			}
+			size := "-"
+			if recorder.bytes > 0 {
+				size = strconv.FormatInt(recorder.bytes, 10)
+			}
+			logger.Printf("%s - %s [%s] %q %d %s %q %q %d",
+				clientIP(req), orDash(user), start.Format("02/Jan/2006:15:04:05 -0700"),
+				req.Method+" "+s.redactedURI(req)+" "+req.Proto, recorder.status, size,
+				orDash(req.Referer()), orDash(req.UserAgent()), latency.Microseconds())
+		})
+	}
+}
+
+// redactedURI is the request URI as logged, with the receipt filters of its query redacted
+func (s *Server) redactedURI(req *http.Request) string {
+	path, query, ok := strings.Cut(req.RequestURI, "?")
+	if !ok {
+		return req.RequestURI
+	}
+	return path + "?" + s.svc.RedactQuery(query)
+}
+
+// orDash is how the combined log format writes a missing value
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
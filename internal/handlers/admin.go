@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"receipt-processor/internal/service"
+)
+
+// AdminDashboardHandler serves the admin dashboard. The page only holds the layout; its script fills it
+// in from the analytics, listing, fraud, metrics and health endpoints.
+func (s *Server) AdminDashboardHandler(w http.ResponseWriter, req *http.Request) {
+	s.renderPage(w, "admin.html", struct{ Build service.BuildInfo }{service.CurrentBuildInfo()})
+}
+
+// StoreHealthHandler probes the receipt store. It answers 503 when the store is failing, so it can
+// back a probe as well as the dashboard.
+func (s *Server) StoreHealthHandler(w http.ResponseWriter, req *http.Request) {
+	health := s.svc.CheckStore(req.Context())
+	w.Header().Set("Content-Type", "application/json")
+	if !health.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(health)
+}
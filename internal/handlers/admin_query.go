@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"receipt-processor/internal/service"
+	"receipt-processor/internal/store"
+)
+
+// AdminQueryHandler runs a structured read-only query for ad-hoc investigation on SQL backends
+func (s *Server) AdminQueryHandler(w http.ResponseWriter, req *http.Request) {
+	sqlBackend, ok := s.svc.Store().(*store.SQL)
+	if !ok {
+		http.Error(w, "Admin queries require a SQL store backend", http.StatusNotImplemented)
+		return
+	}
+
+	var q service.AdminQuery
+	if err := s.decodeJSON(w, req, &q); err != nil {
+		writeDecodeError(w, err, "query")
+		return
+	}
+	query, args, err := q.Build(tenantFromRequest(req))
+	if err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), service.AdminQueryTimeout)
+	defer cancel()
+	result, err := sqlBackend.ReadOnlyQuery(ctx, query, args)
+	if err != nil {
+		http.Error(w, "Query failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
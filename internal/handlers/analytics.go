@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"receipt-processor/internal/query"
+	"receipt-processor/internal/service"
+	"receipt-processor/internal/store"
+)
+
+// retailerAnalyticsSpec is what GET /analytics/retailers accepts
+var retailerAnalyticsSpec = query.Spec{
+	Filters: map[string]query.FilterType{
+		"from":  query.Date,
+		"to":    query.Date,
+		"user":  query.String,
+		"state": query.String,
+	},
+	Sortable:     []string{"retailer", "receipts", "total", "points"},
+	DefaultSort:  "-total,retailer",
+	DefaultLimit: 50,
+	MaxLimit:     1000,
+}
+
+// compareRetailerSpend orders two retailers by one sortable field
+func compareRetailerSpend(a, b service.RetailerSpend, field string) int {
+	switch field {
+	case "receipts":
+		return a.Receipts - b.Receipts
+	case "total":
+		return compareCents(a.Cents, b.Cents)
+	case "points":
+		return a.Points - b.Points
+	}
+	return strings.Compare(a.Retailer, b.Retailer)
+}
+
+// RetailerAnalyticsEndpoint reports spend, receipt counts and points per retailer over a purchase date
+// range, e.g. ?from=2022-01-01&to=2022-03-31&user=me, biggest spend first
+func (s *Server) RetailerAnalyticsEndpoint(w http.ResponseWriter, req *http.Request) {
+	params, err := query.Parse(req.URL.Query(), retailerAnalyticsSpec)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	var filter store.Filter
+	filter.From, _ = params.Filter("from")
+	filter.To, _ = params.Filter("to")
+	filter.State, _ = params.Filter("state")
+	userID, _ := params.Filter("user")
+	if userID == "me" {
+		var ok bool
+		if userID, ok = currentUser(w, req); !ok {
+			return
+		}
+	}
+
+	spends, err := s.svc.SpendByRetailer(req.Context(), filter, userID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	query.SortSlice(spends, params.Sort, compareRetailerSpend)
+	page := query.Page(spends, params)
+	s.writeNegotiated(w, req, map[string]interface{}{
+		"from":      filter.From,
+		"to":        filter.To,
+		"currency":  s.svc.BaseCurrency(),
+		"retailers": page,
+		"total":     len(spends),
+		"limit":     params.Limit,
+		"offset":    params.Offset,
+	}, func() table {
+		t := table{Title: "Spend per retailer (" + s.svc.BaseCurrency() + ")", Columns: []string{"retailer", "receipts", "total", "points"}}
+		for _, spend := range page {
+			t.Rows = append(t.Rows, []string{spend.Retailer, strconv.Itoa(spend.Receipts), spend.Total, strconv.Itoa(spend.Points)})
+		}
+		return t
+	})
+}
+
+// pointsAnalyticsSpec is what GET /analytics/points accepts
+var pointsAnalyticsSpec = query.Spec{
+	Filters: map[string]query.FilterType{
+		"from":     query.Date,
+		"to":       query.Date,
+		"retailer": query.String,
+		"channel":  query.String,
+		"state":    query.String,
+		"buckets":  query.Int,
+	},
+}
+
+// PointsAnalyticsEndpoint reports the distribution of points per receipt: count, mean, extremes, percentiles
+// and a histogram of ?buckets= (default 10) bars, over the receipts matching the listing's from, to,
+// retailer, channel and state filters
+func (s *Server) PointsAnalyticsEndpoint(w http.ResponseWriter, req *http.Request) {
+	params, err := query.Parse(req.URL.Query(), pointsAnalyticsSpec)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	buckets, ok := params.Int("buckets")
+	if !ok {
+		buckets = 10
+	}
+	if buckets < 1 || buckets > 100 {
+		http.Error(w, "buckets must be between 1 and 100", http.StatusBadRequest)
+		return
+	}
+
+	list, err := s.svc.FindReceipts(req.Context(), s.receiptFilterFromParams(params))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	points := make([]int, len(list))
+	for i, receipt := range list {
+		points[i] = s.svc.AwardedPoints(receipt)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(service.DistributePoints(points, buckets))
+}
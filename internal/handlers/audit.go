@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"receipt-processor/internal/query"
+	"receipt-processor/internal/service"
+)
+
+// auditListSpec is what GET /admin/audit accepts
+var auditListSpec = query.Spec{
+	Filters: map[string]query.FilterType{
+		"actor":   query.String,
+		"action":  query.String,
+		"subject": query.String,
+		"from":    query.Date,
+		"to":      query.Date,
+	},
+	DefaultLimit: 100,
+	MaxLimit:     1000,
+}
+
+// AuditLogHandler lists the audit log, newest entries first. ?subject= matches as a prefix, so
+// ?subject=receipt:<id> is the history of one receipt and ?subject=rules: every rules change.
+func (s *Server) AuditLogHandler(w http.ResponseWriter, req *http.Request) {
+	params, err := query.Parse(req.URL.Query(), auditListSpec)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	filter := service.AuditFilter{Tenant: tenantFromRequest(req)}
+	filter.Actor, _ = params.Filter("actor")
+	filter.Action, _ = params.Filter("action")
+	filter.Subject, _ = params.Filter("subject")
+	filter.From, _ = params.Filter("from")
+	filter.To, _ = params.Filter("to")
+	entries := s.svc.AuditEntries(filter)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries": query.Page(entries, params),
+		"total":   len(entries),
+		"limit":   params.Limit,
+		"offset":  params.Offset,
+	})
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// UserBalanceEndpoint returns a user's points balance
+func (s *Server) UserBalanceEndpoint(w http.ResponseWriter, req *http.Request) {
+	userID, ok := resolveUser(w, req)
+	if !ok {
+		return
+	}
+	balance, err := s.svc.UserBalance(req.Context(), userID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"userId": userID, "balance": balance})
+}
+
+// BalanceCheckHandler reports the last consistency check between the balance cache and the ledger
+func (s *Server) BalanceCheckHandler(w http.ResponseWriter, req *http.Request) {
+	report := s.svc.LastBalanceCheck()
+	if report == nil {
+		http.Error(w, "No consistency check has run yet", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report.ForTenant(tenantFromRequest(req)))
+}
+
+// RunBalanceCheckHandler runs the consistency check now and reports it
+func (s *Server) RunBalanceCheckHandler(w http.ResponseWriter, req *http.Request) {
+	report, err := s.svc.CheckBalances(req.Context())
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report.ForTenant(tenantFromRequest(req)))
+}
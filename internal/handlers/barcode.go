@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"receipt-processor/internal/service"
+)
+
+// maxBarcodePayloadSize bounds a raw barcode payload sent as text
+const maxBarcodePayloadSize = 64 << 10
+
+// readBarcodePayload returns the payload of a submission: decoded from the "image" field of a multipart
+// form, taken from its "payload" field, or read from a text/plain body
+func readBarcodePayload(w http.ResponseWriter, req *http.Request) (string, int, error) {
+	if !strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/form-data") {
+		data, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxBarcodePayloadSize))
+		if err != nil {
+			return "", http.StatusBadRequest, errors.New("failed to read payload")
+		}
+		return string(data), 0, nil
+	}
+
+	req.Body = http.MaxBytesReader(w, req.Body, maxOCRImageSize)
+	if payload := req.FormValue("payload"); payload != "" {
+		return payload, 0, nil
+	}
+	file, _, err := req.FormFile("image")
+	if err != nil {
+		return "", http.StatusBadRequest, errors.New("send an image or payload field")
+	}
+	defer file.Close()
+	image, err := io.ReadAll(file)
+	if err != nil {
+		return "", http.StatusBadRequest, errors.New("failed to read image upload")
+	}
+	payload, err := service.DecodeBarcodeImage(image)
+	if err != nil {
+		return "", http.StatusUnprocessableEntity, err
+	}
+	return payload, 0, nil
+}
+
+// ProcessBarcodeReceiptEndpoint decodes a receipt's QR code or barcode, from an uploaded image or the raw
+// payload, maps it into a Receipt and processes it
+func (s *Server) ProcessBarcodeReceiptEndpoint(w http.ResponseWriter, req *http.Request) {
+	payload, status, err := readBarcodePayload(w, req)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	receipt, err := service.ParseBarcodePayload(payload)
+	if err == nil {
+		err = s.svc.ValidateReceipt(req.Context(), receipt)
+	}
+	if err != nil {
+		http.Error(w, "Invalid receipt code: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	receipt.Channel = submissionChannel(req, service.ChannelBarcode)
+	receipt, err = s.svc.ProcessReceipt(req.Context(), tenantFromRequest(req), receipt)
+	s.writeProcessedJSON(w, receipt, err, map[string]interface{}{"payload": payload})
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// basePath is the prefix of BASE_PATH every route is mounted under, like /api/receipts, or "" to serve
+// them from the root. Routes are matched without it, so only the links and redirects the server makes
+// itself need to add it back.
+var basePath = sync.OnceValue(func() string {
+	value := strings.TrimSuffix(os.Getenv("BASE_PATH"), "/")
+	if value != "" && (!strings.HasPrefix(value, "/") || strings.ContainsAny(value, "?#%\\ ") || strings.Contains(value, "//")) {
+		log.Printf("Ignoring invalid BASE_PATH %q, which must be a path like /api/receipts", value)
+		return ""
+	}
+	return value
+})
+
+// stripBasePath serves the requests under BASE_PATH with the prefix taken off their path, and answers any
+// other request with 404
+func stripBasePath(next http.Handler) http.Handler {
+	prefix := basePath()
+	if prefix == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path, ok := strings.CutPrefix(req.URL.Path, prefix)
+		if !ok || path != "" && !strings.HasPrefix(path, "/") {
+			http.NotFound(w, req)
+			return
+		}
+		if path == "" {
+			path = "/"
+		}
+		stripped := new(http.Request)
+		*stripped = *req
+		stripped.URL = new(url.URL)
+		*stripped.URL = *req.URL
+		stripped.URL.Path = path
+		stripped.URL.RawPath = strings.TrimPrefix(req.URL.RawPath, prefix)
+		next.ServeHTTP(w, stripped)
+	})
+}
+
+// openAPIDocument is the OpenAPI document with BASE_PATH as its server, so clients generated from it and
+// Swagger UI send requests under the prefix
+var openAPIDocument = sync.OnceValue(func() []byte {
+	prefix := basePath()
+	if prefix == "" {
+		return openAPISpec
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		return openAPISpec
+	}
+	doc["servers"], _ = json.Marshal([]map[string]string{{"url": prefix}})
+	withPrefix, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return openAPISpec
+	}
+	return withPrefix
+})
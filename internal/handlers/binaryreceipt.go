@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+
+	"receipt-processor/internal/receiptsv1"
+	"receipt-processor/internal/store"
+)
+
+// Binary media types a receipt can be submitted as, with the names clients commonly send them under
+const (
+	mediaProtobuf = "application/x-protobuf"
+	mediaMsgpack  = "application/msgpack"
+)
+
+// binaryMediaTypes maps each accepted name of a binary encoding to the one above
+var binaryMediaTypes = map[string]string{
+	mediaProtobuf:             mediaProtobuf,
+	"application/protobuf":    mediaProtobuf,
+	mediaMsgpack:              mediaMsgpack,
+	"application/x-msgpack":   mediaMsgpack,
+	"application/vnd.msgpack": mediaMsgpack,
+}
+
+// binaryContentType returns the binary encoding a request body is in, or "" for any other body
+func binaryContentType(contentType string) string {
+	media, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return binaryMediaTypes[media]
+}
+
+// decodeBinaryReceipt reads a receipt as a receipts.v1.Receipt protobuf message, the one of the gRPC
+// API, or as a MessagePack map with the keys of the JSON receipt. Like JSON bodies they are limited to
+// MAX_BODY_SIZE and fields the receipt does not have are errors.
+func (s *Server) decodeBinaryReceipt(w http.ResponseWriter, req *http.Request, media string) (store.Receipt, error) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, req.Body, s.maxBodySize))
+	if err != nil {
+		return store.Receipt{}, err
+	}
+	return parseBinaryReceipt(data, media)
+}
+
+// parseBinaryReceipt reads a receipt from a body in one of the binary encodings
+func parseBinaryReceipt(data []byte, media string) (store.Receipt, error) {
+	if media == mediaProtobuf {
+		var message receiptsv1.Receipt
+		if err := proto.Unmarshal(data, &message); err != nil {
+			return store.Receipt{}, err
+		}
+		if unknown := message.ProtoReflect().GetUnknown(); len(unknown) > 0 {
+			return store.Receipt{}, errors.New("unknown fields in the protobuf message")
+		}
+		return receiptFromProto(&message), nil
+	}
+
+	reader := bytes.NewReader(data)
+	decoder := msgpack.NewDecoder(reader)
+	decoder.SetCustomStructTag("json")
+	decoder.DisallowUnknownFields(true)
+	var receipt store.Receipt
+	if err := decoder.Decode(&receipt); err != nil {
+		return store.Receipt{}, err
+	}
+	if reader.Len() > 0 {
+		return store.Receipt{}, errors.New("unexpected data after the MessagePack value")
+	}
+	return receipt, nil
+}
@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"receipt-processor/internal/service"
+)
+
+// VersionHandler returns the build information as JSON
+func (s *Server) VersionHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(service.CurrentBuildInfo())
+}
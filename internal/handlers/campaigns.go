@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"receipt-processor/internal/service"
+	"receipt-processor/scoring"
+)
+
+// decodeCampaign reads and validates a campaign, canonicalizing its retailers like receipts' and
+// lowercasing its weekdays
+func (s *Server) decodeCampaign(w http.ResponseWriter, req *http.Request) (scoring.Campaign, error) {
+	var campaign scoring.Campaign
+	if err := s.decodeJSON(w, req, &campaign); err != nil {
+		return campaign, fmt.Errorf("Failed to decode campaign: %w", err)
+	}
+	campaign.Name = strings.TrimSpace(campaign.Name)
+	if campaign.Name == "" {
+		return campaign, errors.New("name is required")
+	}
+	for i, retailer := range campaign.Retailers {
+		campaign.Retailers[i] = s.svc.CanonicalRetailer(strings.TrimSpace(retailer))
+	}
+	for i, day := range campaign.Weekdays {
+		campaign.Weekdays[i] = strings.ToLower(strings.TrimSpace(day))
+	}
+	return campaign, campaign.Validate()
+}
+
+// writeCampaign answers with a campaign as JSON
+func writeCampaign(w http.ResponseWriter, status int, campaign scoring.Campaign) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(campaign)
+}
+
+// ListCampaignsHandler lists every campaign
+func (s *Server) ListCampaignsHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"campaigns": s.svc.ListCampaigns()})
+}
+
+// CreateCampaignHandler adds a campaign; it applies to receipts processed from now on
+func (s *Server) CreateCampaignHandler(w http.ResponseWriter, req *http.Request) {
+	campaign, err := s.decodeCampaign(w, req)
+	if err != nil {
+		if !bodyTooLarge(w, err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	campaign.ID = uuid.New().String()
+	if err := s.svc.SaveCampaign(campaign); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	s.svc.RecordAudit(req.Context(), service.AuditCampaignSaved, "campaign:"+campaign.ID, nil, map[string]interface{}{"campaign": campaign})
+	writeCampaign(w, http.StatusCreated, campaign)
+}
+
+// GetCampaignHandler returns one campaign
+func (s *Server) GetCampaignHandler(w http.ResponseWriter, req *http.Request) {
+	campaign, ok := s.svc.Campaign(mux.Vars(req)["id"])
+	if !ok {
+		http.Error(w, service.ErrCampaignNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	writeCampaign(w, http.StatusOK, campaign)
+}
+
+// PutCampaignHandler replaces a campaign; receipts already scored keep the copy they were scored with
+func (s *Server) PutCampaignHandler(w http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["id"]
+	previous, ok := s.svc.Campaign(id)
+	if !ok {
+		http.Error(w, service.ErrCampaignNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	campaign, err := s.decodeCampaign(w, req)
+	if err != nil {
+		if !bodyTooLarge(w, err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	campaign.ID = id
+	if err := s.svc.SaveCampaign(campaign); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	s.svc.RecordAudit(req.Context(), service.AuditCampaignSaved, "campaign:"+id,
+		map[string]interface{}{"campaign": previous}, map[string]interface{}{"campaign": campaign})
+	writeCampaign(w, http.StatusOK, campaign)
+}
+
+// DeleteCampaignHandler ends a campaign for receipts processed from now on
+func (s *Server) DeleteCampaignHandler(w http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["id"]
+	previous, err := s.svc.DeleteCampaign(id)
+	if errors.Is(err, service.ErrCampaignNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	s.svc.RecordAudit(req.Context(), service.AuditCampaignDeleted, "campaign:"+id, map[string]interface{}{"campaign": previous}, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
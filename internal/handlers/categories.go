@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/internal/service"
+	"receipt-processor/internal/store"
+)
+
+// TagItemEndpoint sets the category and tags of one item of a receipt after ingestion
+func (s *Server) TagItemEndpoint(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	position, err := strconv.Atoi(vars["item"])
+	if err != nil {
+		http.Error(w, "Item must be a position starting at 1", http.StatusBadRequest)
+		return
+	}
+	var change service.ItemTags
+	if err := s.decodeJSON(w, req, &change); err != nil {
+		writeDecodeError(w, err, "item tags")
+		return
+	}
+
+	receipt, err := s.svc.TagItem(req.Context(), vars["id"], position, change)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		http.Error(w, "Receipt not found", http.StatusNotFound)
+		return
+	case errors.Is(err, service.ErrItemNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":     receipt.ID,
+		"item":   receipt.Items[position-1],
+		"points": s.points(receipt),
+	})
+}
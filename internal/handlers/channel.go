@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"receipt-processor/internal/service"
+)
+
+// channelHeader lets a client or gateway name the channel a submission arrived through,
+// e.g. the mobile app ("app") or the email gateway ("email")
+const channelHeader = "X-Receipt-Channel"
+
+// submissionChannel returns the channel named by the request when it is a known one, or def
+func submissionChannel(req *http.Request, def string) string {
+	return knownChannel(req.Header.Get(channelHeader), def)
+}
+
+// knownChannel returns the channel a value of channelHeader names when it is a known one, or def
+func knownChannel(value, def string) string {
+	if channel := strings.ToLower(strings.TrimSpace(value)); service.KnownChannels[channel] {
+		return channel
+	}
+	return def
+}
+
+// ChannelStatsHandler breaks stored receipts and their points down by submission channel.
+// Receipts stored before channels were recorded are counted as "unknown".
+func (s *Server) ChannelStatsHandler(w http.ResponseWriter, req *http.Request) {
+	list, err := s.svc.AllReceipts(req.Context())
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	stats := make(map[string]*service.ChannelStats)
+	for _, receipt := range list {
+		channel := receipt.Channel
+		if channel == "" {
+			channel = "unknown"
+		}
+		if stats[channel] == nil {
+			stats[channel] = &service.ChannelStats{}
+		}
+		stats[channel].Receipts++
+		stats[channel].Points += s.points(receipt)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"channels": stats})
+}
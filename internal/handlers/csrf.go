@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// csrfCookie holds the token of a browser, readable by the pages' scripts so they can send it back
+	csrfCookie = "receipt_csrf"
+	// csrfHeader carries the token on the writes of the pages
+	csrfHeader = "X-CSRF-Token"
+)
+
+// csrf protects browsers from other sites making requests with their credentials, like the basic auth
+// password or the OIDC session they send along by themselves. Browsers are given a token in a cookie,
+// and writes from a browser must send it back in the X-CSRF-Token header, which another site can neither
+// read nor set; they are answered with 403 otherwise. API clients are known by sending no Origin,
+// Sec-Fetch-Site or cookie of this server, and are let through, as are requests with a key in the
+// Authorization bearer or X-API-Key header, which browsers never add on their own.
+func csrf() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			token := ""
+			if cookie, err := req.Cookie(csrfCookie); err == nil {
+				token = cookie.Value
+			}
+			browser := browserRequest(req)
+			if token == "" && (browser || req.Method == http.MethodGet && negotiate(req, mediaJSON, mediaHTML) == mediaHTML) {
+				token = randomToken()
+				http.SetCookie(w, &http.Cookie{
+					Name:     csrfCookie,
+					Value:    token,
+					Path:     basePath() + "/",
+					Secure:   req.TLS != nil,
+					SameSite: http.SameSiteStrictMode,
+				})
+			}
+			if browser && !safeMethod(req.Method) && !headerCredential(req) {
+				sent := req.Header.Get(csrfHeader)
+				if sent == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+					http.Error(w, "Missing or invalid CSRF token", http.StatusForbidden)
+					return
+				}
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// browserRequest reports whether a request comes from a browser: browsers send Origin with their writes
+// and Sec-Fetch-Site with every request, and only they keep this server's cookies
+func browserRequest(req *http.Request) bool {
+	if req.Header.Get("Origin") != "" || req.Header.Get("Sec-Fetch-Site") != "" {
+		return true
+	}
+	for _, name := range []string{csrfCookie, sessionCookie} {
+		if _, err := req.Cookie(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// headerCredential reports whether a request carries a key in a header only a script of the origin or
+// a non-browser client can set, unlike basic auth, which browsers repeat by themselves
+func headerCredential(req *http.Request) bool {
+	_, bearer := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return bearer || req.Header.Get("X-API-Key") != ""
+}
+
+// safeMethod reports whether a method only reads, and so needs no CSRF token
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"receipt-processor/internal/service"
+)
+
+// maxImportSize bounds the size of an uploaded CSV or JSON file
+const maxImportSize = 32 << 20
+
+// ImportCSVEndpoint imports receipts from a CSV upload, either as the raw request body or as
+// the "file" field of a multipart form, and reports the outcome of every receipt
+func (s *Server) ImportCSVEndpoint(w http.ResponseWriter, req *http.Request) {
+	body, err := uploadBody(w, req)
+	if err != nil {
+		writeUploadError(w, err, "CSV")
+		return
+	}
+	defer body.Close()
+
+	parsed, err := service.ParseReceiptsCSV(body)
+	if err != nil {
+		if !bodyTooLarge(w, err) {
+			http.Error(w, "Failed to parse CSV: "+err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	s.writeImportReport(w, req, s.svc.ImportReceipts(req.Context(), tenantFromRequest(req), submissionChannel(req, service.ChannelCSV), parsed))
+}
+
+// uploadBody returns an import's upload, up to maxImportSize: the "file" field of a multipart form,
+// or else the request body itself
+func uploadBody(w http.ResponseWriter, req *http.Request) (io.ReadCloser, error) {
+	req.Body = http.MaxBytesReader(w, req.Body, maxImportSize)
+	if !strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/form-data") {
+		return req.Body, nil
+	}
+	file, _, err := req.FormFile("file")
+	return file, err
+}
+
+// writeUploadError answers an upload that could not be read: 413 when it was too large, 400 otherwise
+func writeUploadError(w http.ResponseWriter, err error, format string) {
+	if !bodyTooLarge(w, err) {
+		http.Error(w, "Failed to read "+format+" upload", http.StatusBadRequest)
+	}
+}
+
+// importReport is the outcome of an import
+type importReport struct {
+	Imported int                    `json:"imported"`
+	Failed   int                    `json:"failed"`
+	Results  []service.ImportResult `json:"results"`
+}
+
+// writeImportReport answers an import with the outcome of every receipt, as JSON or, for browsers
+// uploading from the home page, as an HTML page
+func (s *Server) writeImportReport(w http.ResponseWriter, req *http.Request, results []service.ImportResult) {
+	report := importReport{Results: results}
+	for _, result := range results {
+		if result.Error != "" {
+			report.Failed++
+		} else {
+			report.Imported++
+		}
+	}
+	w.Header().Add("Vary", "Accept")
+	if negotiate(req, mediaJSON, mediaHTML) == mediaHTML {
+		s.renderPage(w, "imported.html", report)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
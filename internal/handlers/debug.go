@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/internal/config"
+)
+
+// DebugHandler serves the runtime profiles of net/http/pprof under /debug/pprof/ and the expvar
+// variables, including memstats, at /debug/vars
+func DebugHandler() http.Handler {
+	routes := http.NewServeMux()
+	routes.HandleFunc("/debug/pprof/", pprof.Index)
+	routes.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	routes.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	routes.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	routes.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	routes.Handle("/debug/vars", expvar.Handler())
+	return routes
+}
+
+// mountDebug serves DebugHandler on the API port when DEBUG_ROUTES is set. The profiles reveal the
+// command line and what the process is doing, so they are only mounted behind AUTH_API_KEYS; without
+// keys, give them a port of their own with DEBUG_ADDR instead.
+func (s *Server) mountDebug(router *mux.Router) {
+	if !config.Bool("DEBUG_ROUTES", false) {
+		return
+	}
+	if len(config.List("AUTH_API_KEYS", nil)) == 0 {
+		s.logger.Printf("Ignoring DEBUG_ROUTES: the debug routes need AUTH_API_KEYS")
+		return
+	}
+	router.PathPrefix("/debug/").Handler(DebugHandler()).Methods("GET", "POST")
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// decodeJSON reads a request's JSON body into v. Bodies over the server's MAX_BODY_SIZE, fields v does
+// not have and anything after the JSON value are errors, which writeDecodeError answers.
+func (s *Server) decodeJSON(w http.ResponseWriter, req *http.Request, v interface{}) error {
+	req.Body = http.MaxBytesReader(w, req.Body, s.maxBodySize)
+	return strictUnmarshal(req.Body, v)
+}
+
+// strictUnmarshal decodes exactly one JSON value into v, rejecting unknown fields
+func strictUnmarshal(r io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("unexpected data after the JSON value")
+	}
+	return nil
+}
+
+// writeDecodeError answers a body that could not be decoded as what it should have been, e.g.
+// "receipt": with 413 when it was too large and with 400 naming the problem otherwise
+func writeDecodeError(w http.ResponseWriter, err error, what string) {
+	if bodyTooLarge(w, err) {
+		return
+	}
+	http.Error(w, fmt.Sprintf("Failed to decode %s: %v", what, err), http.StatusBadRequest)
+}
+
+// bodyTooLarge answers 413 when err is a http.MaxBytesReader limit being hit
+func bodyTooLarge(w http.ResponseWriter, err error) bool {
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) {
+		return false
+	}
+	http.Error(w, fmt.Sprintf("Request body is larger than %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+	return true
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"receipt-processor/internal/service"
+	"receipt-processor/internal/store"
+)
+
+// writeFlagHeaders tells the client which flags were raised on an admitted receipt
+func writeFlagHeaders(w http.ResponseWriter, receipt store.Receipt) {
+	for _, flag := range receipt.Flags {
+		w.Header().Add("X-Receipt-Flag", flag)
+	}
+	if receipt.DuplicateOf != "" {
+		w.Header().Set("X-Duplicate-Of", receipt.DuplicateOf)
+	}
+}
+
+// writeDuplicateError answers a blocked submission with 409 and the ID it duplicates
+func writeDuplicateError(w http.ResponseWriter, err error) {
+	var dup *service.DuplicateError
+	if errors.As(err, &dup) {
+		w.Header().Set("X-Duplicate-Of", dup.ExistingID)
+	}
+	http.Error(w, "Duplicate receipt", http.StatusConflict)
+}
+
+// DuplicateStatsHandler reports how many submissions were blocked or flagged per tenant
+func (s *Server) DuplicateStatsHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.svc.DuplicateStats())
+}
@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"receipt-processor/internal/service"
+)
+
+const (
+	// errorReportQueue bounds the reports waiting to be sent; more are dropped rather than slowing requests
+	errorReportQueue = 100
+	// maxErrorMessage bounds how much of a 5xx response body becomes the reported message
+	maxErrorMessage = 1024
+)
+
+// redactedHeaders are not sent with the request context of a report
+var redactedHeaders = map[string]bool{
+	"Authorization": true,
+	"Cookie":        true,
+	"X-Api-Key":     true,
+}
+
+// errorReporter ships panics and 5xx responses to a Sentry-compatible server (Sentry, GlitchTip, ...)
+// through its envelope endpoint. Reports are sent in the background, one at a time.
+type errorReporter struct {
+	dsn         string
+	endpoint    string
+	auth        string
+	environment string
+	release     string
+	serverName  string
+	client      *http.Client
+	logger      *log.Logger
+	// svc timestamps reports and redacts the query strings in them
+	svc    *service.Service
+	events chan sentryEvent
+}
+
+// sentryEvent is the subset of the Sentry event payload the reporter fills in
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Platform    string            `json:"platform"`
+	Level       string            `json:"level"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Exception   *sentryExceptions `json:"exception,omitempty"`
+	Request     sentryRequest     `json:"request"`
+	User        map[string]string `json:"user,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+type sentryExceptions struct {
+	Values []sentryException `json:"values"`
+}
+
+type sentryException struct {
+	Type       string           `json:"type"`
+	Value      string           `json:"value"`
+	Stacktrace sentryStacktrace `json:"stacktrace"`
+}
+
+// sentryStacktrace lists frames oldest first, as Sentry expects
+type sentryStacktrace struct {
+	Frames []sentryFrame `json:"frames"`
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	Module   string `json:"module,omitempty"`
+	Filename string `json:"filename"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+type sentryRequest struct {
+	URL         string            `json:"url"`
+	Method      string            `json:"method"`
+	QueryString string            `json:"query_string,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Env         map[string]string `json:"env,omitempty"`
+}
+
+// newErrorReporter reports to SENTRY_DSN, tagging reports with SENTRY_ENVIRONMENT and the build version.
+// It returns nil, reporting nothing, without a DSN or with an invalid one, which is logged. Reports are
+// timestamped by the service's clock.
+func newErrorReporter(logger *log.Logger, svc *service.Service) *errorReporter {
+	dsn := os.Getenv("SENTRY_DSN")
+	if dsn == "" {
+		return nil
+	}
+	endpoint, key, err := parseDSN(dsn)
+	if err != nil {
+		logger.Printf("Ignoring invalid SENTRY_DSN: %v", err)
+		return nil
+	}
+	version := service.CurrentBuildInfo().Version
+	hostname, _ := os.Hostname()
+	r := &errorReporter{
+		dsn:         dsn,
+		endpoint:    endpoint,
+		auth:        fmt.Sprintf("Sentry sentry_version=7, sentry_client=receipt-processor/%s, sentry_key=%s", version, key),
+		environment: os.Getenv("SENTRY_ENVIRONMENT"),
+		release:     "receipt-processor@" + version,
+		serverName:  hostname,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		logger:      logger,
+		svc:         svc,
+		events:      make(chan sentryEvent, errorReportQueue),
+	}
+	go r.send()
+	return r
+}
+
+// parseDSN splits a DSN, scheme://key@host/path/project, into the envelope endpoint and the public key
+func parseDSN(dsn string) (endpoint, key string, err error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" || u.User == nil || u.User.Username() == "" {
+		return "", "", fmt.Errorf("%q is not scheme://key@host/project", dsn)
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	project := path[slash+1:]
+	if project == "" {
+		return "", "", fmt.Errorf("%q has no project ID", dsn)
+	}
+	return fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, path[:slash], project), u.User.Username(), nil
+}
+
+// reportPanic reports a panic recovered while serving a request. It must be called from the deferred
+// function that recovered, while the panicking stack is still there to walk.
+func (r *errorReporter) reportPanic(req *http.Request, value interface{}) {
+	pcs := make([]uintptr, 64)
+	// Skip runtime.Callers, reportPanic and the deferred function; the frames of the runtime's panic
+	// handling are dropped by stackFrames
+	n := runtime.Callers(3, pcs)
+	event := r.newEvent(req, "fatal")
+	event.Exception = &sentryExceptions{Values: []sentryException{{
+		Type:       "panic",
+		Value:      fmt.Sprint(value),
+		Stacktrace: sentryStacktrace{Frames: stackFrames(pcs[:n])},
+	}}}
+	event.Tags["status"] = "500"
+	r.enqueue(event)
+}
+
+// reportResponse reports a request answered with a 5xx status, with the stack that wrote the status and
+// the start of the response body as the message
+func (r *errorReporter) reportResponse(req *http.Request, status int, body string, pcs []uintptr) {
+	event := r.newEvent(req, "error")
+	message := strings.TrimSpace(body)
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	event.Exception = &sentryExceptions{Values: []sentryException{{
+		Type:       fmt.Sprintf("HTTP %d", status),
+		Value:      message,
+		Stacktrace: sentryStacktrace{Frames: stackFrames(pcs)},
+	}}}
+	event.Tags["status"] = fmt.Sprint(status)
+	r.enqueue(event)
+}
+
+// newEvent is an event carrying the request context: the URL, method and headers, without credentials,
+// the client address and the actor and tenant of the request
+func (r *errorReporter) newEvent(req *http.Request, level string) sentryEvent {
+	id := make([]byte, 16)
+	rand.Read(id)
+	headers := make(map[string]string, len(req.Header))
+	for name, values := range req.Header {
+		if !redactedHeaders[http.CanonicalHeaderKey(name)] {
+			headers[name] = strings.Join(values, ", ")
+		}
+	}
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	return sentryEvent{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   r.svc.Now().UTC().Format(time.RFC3339Nano),
+		Platform:    "go",
+		Level:       level,
+		ServerName:  r.serverName,
+		Release:     r.release,
+		Environment: r.environment,
+		Request: sentryRequest{
+			URL:         scheme + "://" + req.Host + req.URL.Path,
+			Method:      req.Method,
+			QueryString: r.svc.RedactQuery(req.URL.RawQuery),
+			Headers:     headers,
+			Env:         map[string]string{"REMOTE_ADDR": clientIP(req)},
+		},
+		// The auth middleware runs inside recovery, so the actor is worked out again here
+		User: map[string]string{"username": requestActor(req, requestAPIKey(req)), "ip_address": clientIP(req)},
+		Tags: map[string]string{"tenant": tenantFromRequest(req), "method": req.Method},
+	}
+}
+
+// enqueue hands an event to the sender, dropping it when the queue is full
+func (r *errorReporter) enqueue(event sentryEvent) {
+	select {
+	case r.events <- event:
+	default:
+		r.logger.Printf("Error report %s dropped: the report queue is full", event.EventID)
+	}
+}
+
+// send delivers queued events, logging the ones the server does not accept
+func (r *errorReporter) send() {
+	for event := range r.events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			r.logger.Printf("Error report %s not sent: %v", event.EventID, err)
+			continue
+		}
+		var envelope bytes.Buffer
+		header, _ := json.Marshal(map[string]string{"event_id": event.EventID, "dsn": r.dsn, "sent_at": r.svc.Now().UTC().Format(time.RFC3339)})
+		envelope.Write(header)
+		fmt.Fprintf(&envelope, "\n{\"type\":\"event\",\"length\":%d}\n", len(payload))
+		envelope.Write(payload)
+		envelope.WriteByte('\n')
+
+		req, err := http.NewRequest(http.MethodPost, r.endpoint, &envelope)
+		if err != nil {
+			r.logger.Printf("Error report %s not sent: %v", event.EventID, err)
+			continue
+		}
+		req.Header.Set("Content-Type", "application/x-sentry-envelope")
+		req.Header.Set("X-Sentry-Auth", r.auth)
+		resp, err := r.client.Do(req)
+		if err != nil {
+			r.logger.Printf("Error report %s not sent: %v", event.EventID, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			r.logger.Printf("Error report %s rejected: %s", event.EventID, resp.Status)
+		}
+	}
+}
+
+// stackFrames turns program counters, innermost first, into Sentry frames, outermost first. The Go
+// runtime's own frames are left out; frames of this module are in-app.
+func stackFrames(pcs []uintptr) []sentryFrame {
+	var frames []sentryFrame
+	callers := runtime.CallersFrames(pcs)
+	for {
+		frame, more := callers.Next()
+		if frame.Function != "" && !strings.HasPrefix(frame.Function, "runtime.") {
+			module, function := splitFunction(frame.Function)
+			frames = append(frames, sentryFrame{
+				Function: function,
+				Module:   module,
+				Filename: frameFilename(frame.File),
+				AbsPath:  frame.File,
+				Lineno:   frame.Line,
+				InApp:    strings.HasPrefix(frame.Function, "receipt-processor/"),
+			})
+		}
+		if !more {
+			break
+		}
+	}
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return frames
+}
+
+// splitFunction splits "receipt-processor/internal/handlers.(*Server).recovery.func1" into the package
+// path and the function within it
+func splitFunction(name string) (module, function string) {
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return "", name
+	}
+	return name[:slash+1+dot], name[slash+2+dot:]
+}
+
+// frameFilename shortens a source path to its directory and file, e.g. handlers/receipts.go
+func frameFilename(path string) string {
+	dir, file := path, ""
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		dir, file = path[:i], path[i+1:]
+	}
+	if i := strings.LastIndex(dir, "/"); i >= 0 {
+		return dir[i+1:] + "/" + file
+	}
+	return path
+}
+
+// errorRecorder remembers, for a 5xx response, the stack that wrote the status and the start of the
+// body, so they can be reported once the handler returns
+type errorRecorder struct {
+	statusRecorder
+	stack []uintptr
+	body  []byte
+}
+
+func (r *errorRecorder) WriteHeader(status int) {
+	if status >= 500 && r.stack == nil {
+		pcs := make([]uintptr, 64)
+		// Skip runtime.Callers and WriteHeader
+		n := runtime.Callers(2, pcs)
+		r.stack = pcs[:n]
+	}
+	r.statusRecorder.WriteHeader(status)
+}
+
+func (r *errorRecorder) Write(b []byte) (int, error) {
+	if r.status >= 500 && len(r.body) < maxErrorMessage {
+		r.body = append(r.body, b[:min(len(b), maxErrorMessage-len(r.body))]...)
+	}
+	return r.statusRecorder.Write(b)
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// bufferedResponse holds back a response, so it can be looked at as a whole before sending it: its ETag
+// worked out from the whole body, or the JSON of a gateway route turned into another representation
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *bufferedResponse) Header() http.Header { return r.header }
+
+func (r *bufferedResponse) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *bufferedResponse) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(p)
+}
+
+// send writes the held back response to w
+func (r *bufferedResponse) send(w http.ResponseWriter) {
+	for name, values := range r.header {
+		w.Header()[name] = values
+	}
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	w.WriteHeader(r.status)
+	w.Write(r.body.Bytes())
+}
+
+// conditional tags successful responses with an ETag, a hash of their body, and answers a GET whose
+// If-None-Match already names it with 304 and no body, so polling clients and caches only download what
+// changed. The representation negotiated with Accept is part of the body, so each gets its own tag.
+// Responses must be revalidated before being reused, as receipts change state and get rescored.
+func conditional(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			next.ServeHTTP(w, req)
+			return
+		}
+		recorder := &bufferedResponse{header: w.Header()}
+		next.ServeHTTP(recorder, req)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		if recorder.status == http.StatusOK {
+			sum := sha256.Sum256(recorder.body.Bytes())
+			tag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+			w.Header().Set("ETag", tag)
+			if w.Header().Get("Cache-Control") == "" {
+				w.Header().Set("Cache-Control", "no-cache")
+			}
+			if etagMatches(req.Header.Get("If-None-Match"), tag) {
+				// A 304 describes the stored response, so the headers of its body are left out
+				w.Header().Del("Content-Type")
+				w.Header().Del("Content-Length")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		w.WriteHeader(recorder.status)
+		w.Write(recorder.body.Bytes())
+	})
+}
+
+// etagMatches reports whether an If-None-Match header names a tag, or is *. The comparison is weak, as
+// RFC 9110 asks of If-None-Match, so W/ prefixes added by proxies that compress the body still match.
+func etagMatches(header, tag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
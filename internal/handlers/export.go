@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"receipt-processor/internal/query"
+	"receipt-processor/internal/store"
+)
+
+// receiptExportSpec is what GET /receipts/export accepts: the listing's filters and sorting, without a row limit
+var receiptExportSpec = query.Spec{
+	Filters:     receiptListSpec.Filters,
+	Sortable:    receiptListSpec.Sortable,
+	DefaultSort: receiptListSpec.DefaultSort,
+}
+
+// exportColumns are the columns of an export, one row per receipt; exportNumeric are the positions of the
+// ones that hold numbers
+var (
+	exportColumns = []string{"id", "shortCode", "retailer", "purchaseDate", "purchaseTime", "total", "items", "points"}
+	exportNumeric = map[int]bool{6: true, 7: true}
+)
+
+// exportPageSize is how many receipts an export reads and writes at a time
+const exportPageSize = 500
+
+// csvFormulaPrefixes start the cells a spreadsheet would evaluate as a formula
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// csvCell neutralizes a text value that a spreadsheet opening the CSV would run as a formula, such as a
+// retailer named "=HYPERLINK(...)", by prefixing it with a quote
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune(csvFormulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// exportPager reads the receipts of an export a page at a time, so an export holds one page rather than
+// every receipt
+type exportPager struct {
+	s      *Server
+	ctx    context.Context
+	params query.Params
+	done   bool
+}
+
+// newExportPager pages through the receipts matching params in their order. Receipts that sort alike are
+// ordered by ID, so that the pages neither skip nor repeat them.
+func (s *Server) newExportPager(ctx context.Context, params query.Params) *exportPager {
+	if !slices.ContainsFunc(params.Sort, func(key query.SortKey) bool { return key.Field == "id" }) {
+		params.Sort = append(params.Sort, query.SortKey{Field: "id"})
+	}
+	params.Limit, params.Offset = exportPageSize, 0
+	return &exportPager{s: s, ctx: ctx, params: params}
+}
+
+// next returns the next page, or none once every receipt has been read
+func (p *exportPager) next() ([]store.Receipt, error) {
+	if p.done {
+		return nil, nil
+	}
+	page, _, err := p.s.listReceipts(p.ctx, p.params)
+	if err != nil {
+		return nil, err
+	}
+	p.params.Offset += len(page)
+	p.done = len(page) < exportPageSize
+	return page, nil
+}
+
+// exportRow renders a receipt as an export row, with the retailer redacted when PII_REDACTION says so
+func (s *Server) exportRow(receipt store.Receipt) []string {
+	return []string{
+		receipt.ID,
+		receipt.ShortCode,
+		s.svc.RedactReceipt(receipt).Retailer,
+		receipt.PurchaseDate,
+		receipt.PurchaseTime,
+		receipt.Total,
+		strconv.Itoa(len(receipt.Items)),
+		strconv.Itoa(s.points(receipt)),
+	}
+}
+
+// ExportReceiptsEndpoint streams the matching receipts with their points as a CSV or XLSX download, a page
+// at a time. A failure after the first page cuts the download short, since its status is already sent.
+func (s *Server) ExportReceiptsEndpoint(w http.ResponseWriter, req *http.Request) {
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "xlsx" {
+		http.Error(w, "format must be csv or xlsx", http.StatusBadRequest)
+		return
+	}
+
+	params, err := query.Parse(req.URL.Query(), receiptExportSpec)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	pager := s.newExportPager(req.Context(), params)
+	first, err := pager.next()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	if format == "xlsx" {
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		w.Header().Set("Content-Disposition", `attachment; filename="receipts.xlsx"`)
+		err = s.writeXLSX(w, exportColumns, first, pager)
+	} else {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="receipts.csv"`)
+		err = s.writeCSV(w, first, pager)
+	}
+	if err != nil {
+		s.logger.Printf("Receipt export failed: %v", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// writeCSV writes the export as CSV from its first page on, flushing each page to the client
+func (s *Server) writeCSV(w http.ResponseWriter, page []store.Receipt, pager *exportPager) error {
+	controller := http.NewResponseController(w)
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportColumns); err != nil {
+		return err
+	}
+	for len(page) > 0 {
+		for _, receipt := range page {
+			row := s.exportRow(receipt)
+			for col, value := range row {
+				if !exportNumeric[col] {
+					row[col] = csvCell(value)
+				}
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return err
+		}
+		controller.Flush()
+		var err error
+		if page, err = pager.next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The fixed parts of a single-sheet XLSX workbook
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Receipts" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`
+)
+
+// writeXLSX streams a minimal XLSX workbook with one sheet holding the header and one row per receipt,
+// from the first page on. Cells are written as inline strings, which a spreadsheet never evaluates,
+// except the items and points columns which are numbers.
+func (s *Server) writeXLSX(w http.ResponseWriter, header []string, page []store.Receipt, pager *exportPager) error {
+	controller := http.NewResponseController(w)
+	archive := zip.NewWriter(w)
+	for _, part := range [][2]string{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	} {
+		file, err := archive.Create(part[0])
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(file, part[1]); err != nil {
+			return err
+		}
+	}
+
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+"\n"+
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`); err != nil {
+		return err
+	}
+	if err := writeXLSXRow(sheet, 1, header, nil); err != nil {
+		return err
+	}
+	row := 2
+	for len(page) > 0 {
+		for _, receipt := range page {
+			if err := writeXLSXRow(sheet, row, s.exportRow(receipt), exportNumeric); err != nil {
+				return err
+			}
+			row++
+		}
+		if err := archive.Flush(); err != nil {
+			return err
+		}
+		controller.Flush()
+		var err error
+		if page, err = pager.next(); err != nil {
+			return err
+		}
+	}
+	if _, err := io.WriteString(sheet, `</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// writeXLSXRow writes one sheet row; columns in numeric are written as numbers
+func writeXLSXRow(w io.Writer, row int, values []string, numeric map[int]bool) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<row r="%d">`, row)
+	for col, value := range values {
+		ref := string(rune('A'+col)) + strconv.Itoa(row)
+		if numeric[col] {
+			fmt.Fprintf(&buf, `<c r="%s"><v>%s</v></c>`, ref, value)
+			continue
+		}
+		fmt.Fprintf(&buf, `<c r="%s" t="inlineStr"><is><t>`, ref)
+		xml.EscapeText(&buf, []byte(value))
+		buf.WriteString(`</t></is></c>`)
+	}
+	buf.WriteString(`</row>`)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExportReceipts(t *testing.T) {
+	router := newTestServer(t)
+	submit := func(body string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/receipts/process", strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+		}
+	}
+	submit(strings.Replace(targetReceipt, `"Target"`, `"=HYPERLINK(\"http://evil.example\")"`, 1))
+	// More receipts than fit on one page of the export
+	for i := 0; i < exportPageSize; i++ {
+		submit(strings.Replace(cornerMarketReceipt, `"14:33"`, fmt.Sprintf(`"%02d:%02d"`, i/60%24, i%60), 1))
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/receipts/export", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != exportPageSize+2 {
+		t.Fatalf("rows = %d, want a header and %d receipts", len(rows), exportPageSize+1)
+	}
+	seen := make(map[string]bool)
+	formulas := 0
+	for _, row := range rows[1:] {
+		if seen[row[0]] {
+			t.Fatalf("receipt %s exported twice", row[0])
+		}
+		seen[row[0]] = true
+		if strings.HasPrefix(row[2], "=") {
+			t.Errorf("retailer %q would run as a formula", row[2])
+		}
+		if row[2] == `'=HYPERLINK("http://evil.example")` {
+			formulas++
+		}
+	}
+	if formulas != 1 {
+		t.Errorf("found %d neutralized formulas, want 1", formulas)
+	}
+}
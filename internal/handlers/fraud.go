@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"receipt-processor/internal/query"
+	"receipt-processor/internal/service"
+	"receipt-processor/internal/store"
+)
+
+// fraudListSpec is what GET /admin/fraud accepts
+var fraudListSpec = query.Spec{
+	Filters: map[string]query.FilterType{
+		"flag":  query.String,
+		"state": query.String,
+		"from":  query.Date,
+		"to":    query.Date,
+	},
+	DefaultLimit: 100,
+	MaxLimit:     1000,
+}
+
+// FraudReceiptsHandler lists the receipts the fraud pass flagged, newest purchases first, with how many
+// carry each flag. ?state=pending_review narrows it to the review queue.
+func (s *Server) FraudReceiptsHandler(w http.ResponseWriter, req *http.Request) {
+	params, err := query.Parse(req.URL.Query(), fraudListSpec)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	var filter store.Filter
+	filter.State, _ = params.Filter("state")
+	filter.From, _ = params.Filter("from")
+	filter.To, _ = params.Filter("to")
+	wanted, _ := params.Filter("flag")
+	list, err := s.svc.FindReceipts(req.Context(), filter)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	counts := make(map[string]int)
+	flagged := []map[string]interface{}{}
+	for _, receipt := range list {
+		flags := service.FraudFlagsOf(receipt)
+		if len(flags) == 0 || wanted != "" && !service.ContainsString(flags, wanted) {
+			continue
+		}
+		for _, flag := range flags {
+			counts[flag]++
+		}
+		record := s.receiptRecord(receipt)
+		record["userId"] = receipt.UserID
+		record["fraudFlags"] = flags
+		flagged = append(flagged, record)
+	}
+	sort.Slice(flagged, func(i, j int) bool {
+		a, b := flagged[i]["purchaseDate"].(string), flagged[j]["purchaseDate"].(string)
+		if a != b {
+			return a > b
+		}
+		return flagged[i]["id"].(string) < flagged[j]["id"].(string)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"receipts": query.Page(flagged, params),
+		"flags":    counts,
+		"total":    len(flagged),
+		"limit":    params.Limit,
+		"offset":   params.Offset,
+	})
+}
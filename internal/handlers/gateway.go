@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"receipt-processor/internal/receiptsv1"
+	"receipt-processor/internal/store"
+)
+
+// gatewayRequestHeaders are the headers a submission is tagged with, which the gateway passes to the
+// Receipts service as metadata
+var gatewayRequestHeaders = map[string]bool{channelHeader: true, priorityHeader: true}
+
+// gatewayResponseHeaders are the metadata the Receipts service tells the client about a submission with,
+// which the gateway sends as headers
+var gatewayResponseHeaders = map[string]bool{"X-Receipt-Flag": true, "X-Duplicate-Of": true, "Retry-After": true}
+
+// grpcGateway serves the HTTP bindings of the Receipts service in proto/receipts/v1, the /v1/receipts
+// routes, calling it in process. The routes sit behind the router's middleware like every other one and
+// answer like the REST API always has: errors in plain text, and JSON with its field names, rejecting
+// unknown fields. Receipts can be submitted as XML, protobuf or MessagePack too, as decodeReceipt reads
+// them. The proto binds the routes under /v1, which also serves the legacy paths and any other version.
+func (s *Server) grpcGateway() http.Handler {
+	options := []runtime.ServeMuxOption{
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &compactJSON{}),
+		runtime.WithIncomingHeaderMatcher(func(key string) (string, bool) {
+			if gatewayRequestHeaders[textproto.CanonicalMIMEHeaderKey(key)] {
+				return key, true
+			}
+			return runtime.DefaultHeaderMatcher(key)
+		}),
+		runtime.WithOutgoingHeaderMatcher(gatewayHeader),
+		runtime.WithForwardResponseOption(forwardAccepted),
+		runtime.WithErrorHandler(func(ctx context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, req *http.Request, err error) {
+			if md, ok := runtime.ServerMetadataFromContext(ctx); ok {
+				writeGatewayHeaders(w, md.HeaderMD)
+			}
+			// The gateway reports a body over MAX_BODY_SIZE as any other it could not decode
+			if body, ok := req.Body.(*limitedBody); ok && bodyTooLarge(w, body.err) {
+				return
+			}
+			st := status.Convert(err)
+			http.Error(w, st.Message(), runtime.HTTPStatusFromCode(st.Code()))
+		}),
+	}
+	for name, media := range binaryMediaTypes {
+		options = append(options, runtime.WithMarshalerOption(name, &receiptBody{decode: func(data []byte) (store.Receipt, error) {
+			return parseBinaryReceipt(data, media)
+		}}))
+	}
+	for _, name := range []string{"application/xml", "text/xml"} {
+		options = append(options, runtime.WithMarshalerOption(name, &receiptBody{decode: s.svc.ParseXMLReceipt}))
+	}
+	gateway := runtime.NewServeMux(options...)
+	receiptsv1.RegisterReceiptsHandlerServer(context.Background(), gateway, &grpcServer{s: s})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		routed := new(http.Request)
+		*routed = *req
+		routed.URL = new(url.URL)
+		*routed.URL = *req.URL
+		routed.URL.Path = "/v1" + versionPrefix.ReplaceAllString(req.URL.Path, "/")
+		if req.URL.RawPath != "" {
+			routed.URL.RawPath = "/v1" + versionPrefix.ReplaceAllString(req.URL.RawPath, "/")
+		}
+		routed.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, req.Body, s.maxBodySize)}
+		gateway.ServeHTTP(w, routed)
+	})
+}
+
+// gatewayHeader names the header a metadata key the Receipts service sends goes out as, leaving out any
+// other metadata
+func gatewayHeader(key string) (string, bool) {
+	name := textproto.CanonicalMIMEHeaderKey(key)
+	return name, gatewayResponseHeaders[name]
+}
+
+// writeGatewayHeaders sends the metadata of a failed call as headers, as the gateway does for successful ones
+func writeGatewayHeaders(w http.ResponseWriter, md metadata.MD) {
+	for key, values := range md {
+		if name, ok := gatewayHeader(key); ok {
+			for _, value := range values {
+				w.Header().Add(name, value)
+			}
+		}
+	}
+}
+
+// forwardAccepted answers 202 for a submitted receipt that will be stored later, pointing at the job
+// processing a queued one
+func forwardAccepted(ctx context.Context, w http.ResponseWriter, m proto.Message) error {
+	processed, ok := m.(*receiptsv1.ProcessReceiptResponse)
+	if !ok || processed.GetStatus() == "" {
+		return nil
+	}
+	if processed.GetJobId() != "" {
+		w.Header().Set("Location", basePath()+"/"+apiVersionOf(ctx)+"/jobs/"+processed.GetJobId())
+	}
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+// limitedBody is a request body cut off at MAX_BODY_SIZE, which keeps the error of hitting the limit
+type limitedBody struct {
+	io.ReadCloser
+	err error
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		b.err = err
+	}
+	return n, err
+}
+
+// compactJSON is the gateway's JSON without whitespace. protojson varies its whitespace from build to
+// build, which would change the body, and so the ETag, of a receipt that did not change.
+type compactJSON struct {
+	runtime.JSONPb
+}
+
+func (m *compactJSON) Marshal(v interface{}) ([]byte, error) {
+	data, err := m.JSONPb.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, data); err != nil {
+		return nil, err
+	}
+	return compact.Bytes(), nil
+}
+
+// receiptBody decodes a receipt submitted in one of the encodings decodeReceipt reads besides JSON, for
+// the body of ProcessReceipt. Responses are JSON, like those of the rest of the gateway.
+type receiptBody struct {
+	compactJSON
+	decode func(data []byte) (store.Receipt, error)
+}
+
+func (m *receiptBody) NewDecoder(r io.Reader) runtime.Decoder {
+	return runtime.DecoderFunc(func(v interface{}) error {
+		target, ok := v.(**receiptsv1.Receipt)
+		if !ok {
+			return fmt.Errorf("cannot decode %T", v)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		receipt, err := m.decode(data)
+		if err != nil {
+			return err
+		}
+		*target = receiptSubmissionToProto(receipt)
+		return nil
+	})
+}
+
+// gatewayRepresentations serves a read route of the gateway as its JSON, or as an HTML page or CSV of the
+// table rows makes of its response, decoded into newMessage(), as the Accept header prefers. Errors are
+// answered as the gateway answers them.
+func (s *Server) gatewayRepresentations(newMessage func() proto.Message, rows func(*http.Request, proto.Message) table) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		media := negotiate(req, mediaJSON, mediaHTML, mediaCSV)
+		switch media {
+		case mediaJSON:
+			s.gateway.ServeHTTP(w, req)
+			return
+		case "":
+			writeNotAcceptable(w)
+			return
+		}
+		answer := &bufferedResponse{header: make(http.Header)}
+		s.gateway.ServeHTTP(answer, req)
+		if answer.status != http.StatusOK {
+			answer.send(w)
+			return
+		}
+		message := newMessage()
+		if err := protojson.Unmarshal(answer.body.Bytes(), message); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.writeTable(w, media, rows(req, message))
+	})
+}
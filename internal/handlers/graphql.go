@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/graph-gophers/graphql-go"
+
+	"receipt-processor/internal/service"
+	"receipt-processor/internal/store"
+)
+
+// graphQLSchema describes receipts, items and points as a queryable graph
+const graphQLSchema = `
+	schema {
+		query: Query
+		mutation: Mutation
+	}
+
+	type Query {
+		receipt(id: ID!): Receipt
+		receipts(first: Int = 50, after: ID): [Receipt!]!
+		points(id: ID!): Int
+	}
+
+	type Mutation {
+		processReceipt(receipt: ReceiptInput!): Receipt!
+	}
+
+	type Receipt {
+		id: ID!
+		shortCode: String!
+		retailer: String!
+		purchaseDate: String!
+		purchaseTime: String!
+		total: String!
+		tax: String
+		tip: String
+		userId: String
+		items: [Item!]!
+		points: Int!
+	}
+
+	type Item {
+		shortDescription: String!
+		price: String!
+		category: String
+		tags: [String!]!
+	}
+
+	input ReceiptInput {
+		retailer: String!
+		purchaseDate: String!
+		purchaseTime: String!
+		total: String!
+		tax: String
+		tip: String
+		userId: String
+		items: [ItemInput!]!
+	}
+
+	input ItemInput {
+		shortDescription: String!
+		price: String!
+		category: String
+	}
+`
+
+// graphQLResolver is the root resolver for queries and mutations
+type graphQLResolver struct {
+	s *Server
+}
+
+// Receipt resolves a single receipt by ID
+func (r *graphQLResolver) Receipt(ctx context.Context, args struct{ ID graphql.ID }) (*receiptResolver, error) {
+	receipt, exists, err := r.s.svc.FindReceipt(ctx, string(args.ID))
+	if err != nil || !exists {
+		return nil, err
+	}
+	return &receiptResolver{r.s, receipt}, nil
+}
+
+// maxGraphQLReceipts caps the first argument of the receipts query
+const maxGraphQLReceipts = 100
+
+// receiptsArgs are the arguments of the receipts query: a page of the first receipts whose ID sorts after
+// the cursor, the ID of the last receipt of the previous page
+type receiptsArgs struct {
+	First int32
+	After *graphql.ID
+}
+
+// Receipts resolves a page of the stored receipts, ordered by ID for stable output and cursors
+func (r *graphQLResolver) Receipts(ctx context.Context, args receiptsArgs) ([]*receiptResolver, error) {
+	if args.First < 0 {
+		return nil, errors.New("first must not be negative")
+	}
+	first := min(int(args.First), maxGraphQLReceipts)
+	list, err := r.s.svc.AllReceipts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	if args.After != nil {
+		after := string(*args.After)
+		list = list[sort.Search(len(list), func(i int) bool { return list[i].ID > after }):]
+	}
+	if len(list) > first {
+		list = list[:first]
+	}
+
+	resolvers := make([]*receiptResolver, len(list))
+	for i, receipt := range list {
+		resolvers[i] = &receiptResolver{r.s, receipt}
+	}
+	return resolvers, nil
+}
+
+// Points resolves the points awarded for a receipt
+func (r *graphQLResolver) Points(ctx context.Context, args struct{ ID graphql.ID }) (*int32, error) {
+	receipt, exists, err := r.s.svc.FindReceipt(ctx, string(args.ID))
+	if err != nil || !exists {
+		return nil, err
+	}
+	points := int32(r.s.points(receipt))
+	return &points, nil
+}
+
+// receiptInput mirrors the ReceiptInput type of the schema
+type receiptInput struct {
+	Retailer     string
+	PurchaseDate string
+	PurchaseTime string
+	Total        string
+	Tax          *string
+	Tip          *string
+	UserID       *string
+	Items        []itemInput
+}
+
+// itemInput mirrors the ItemInput type of the schema
+type itemInput struct {
+	ShortDescription string
+	Price            string
+	Category         *string
+}
+
+// ProcessReceipt validates and stores a new receipt, exactly like POST /receipts/process
+func (r *graphQLResolver) ProcessReceipt(ctx context.Context, args struct{ Receipt receiptInput }) (*receiptResolver, error) {
+	receipt := store.Receipt{
+		Retailer:     args.Receipt.Retailer,
+		PurchaseDate: args.Receipt.PurchaseDate,
+		PurchaseTime: args.Receipt.PurchaseTime,
+		Total:        args.Receipt.Total,
+	}
+	if args.Receipt.Tax != nil {
+		receipt.Tax = *args.Receipt.Tax
+	}
+	if args.Receipt.Tip != nil {
+		receipt.Tip = *args.Receipt.Tip
+	}
+	if args.Receipt.UserID != nil {
+		receipt.UserID = *args.Receipt.UserID
+	}
+	for _, item := range args.Receipt.Items {
+		entry := store.ReceiptItem{
+			ShortDescription: item.ShortDescription,
+			Price:            item.Price,
+		}
+		if item.Category != nil {
+			entry.Category = *item.Category
+		}
+		receipt.Items = append(receipt.Items, entry)
+	}
+	receipt.Channel = service.ChannelGraphQL
+	receipt, err := r.s.svc.ProcessReceipt(ctx, service.TenantFromContext(ctx), receipt)
+	if err != nil && !errors.Is(err, service.ErrReceiptBuffered) {
+		return nil, err
+	}
+	return &receiptResolver{r.s, receipt}, nil
+}
+
+// receiptResolver exposes a Receipt to the GraphQL schema
+type receiptResolver struct {
+	s       *Server
+	receipt store.Receipt
+}
+
+func (r *receiptResolver) ID() graphql.ID { return graphql.ID(r.receipt.ID) }
+
+func (r *receiptResolver) ShortCode() string { return r.receipt.ShortCode }
+
+func (r *receiptResolver) Retailer() string { return r.receipt.Retailer }
+
+func (r *receiptResolver) PurchaseDate() string { return r.receipt.PurchaseDate }
+
+func (r *receiptResolver) PurchaseTime() string { return r.receipt.PurchaseTime }
+
+func (r *receiptResolver) Total() string { return r.receipt.Total }
+
+func (r *receiptResolver) Tax() *string { return optionalString(r.receipt.Tax) }
+
+func (r *receiptResolver) Tip() *string { return optionalString(r.receipt.Tip) }
+
+func (r *receiptResolver) UserID() *string { return optionalString(r.receipt.UserID) }
+
+func (r *receiptResolver) Points() int32 { return int32(r.s.points(r.receipt)) }
+
+func (r *receiptResolver) Items() []*itemResolver {
+	resolvers := make([]*itemResolver, len(r.receipt.Items))
+	for i, item := range r.receipt.Items {
+		resolvers[i] = &itemResolver{item}
+	}
+	return resolvers
+}
+
+// itemResolver exposes a ReceiptItem to the GraphQL schema
+type itemResolver struct {
+	item store.ReceiptItem
+}
+
+func (r *itemResolver) ShortDescription() string { return r.item.ShortDescription }
+
+func (r *itemResolver) Price() string { return r.item.Price }
+
+func (r *itemResolver) Category() *string { return optionalString(r.item.Category) }
+
+func (r *itemResolver) Tags() []string {
+	if r.item.Tags == nil {
+		return []string{}
+	}
+	return r.item.Tags
+}
+
+// graphQLRequest is the standard GraphQL-over-HTTP request body
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+	// Extensions are accepted, as the spec allows clients to send them, and ignored
+	Extensions map[string]interface{} `json:"extensions"`
+}
+
+// graphQLOperationType returns the type of the operation a GraphQL document runs: "query", "mutation" or
+// "subscription". That is the operation named operationName, or without a name a mutation if the document
+// has one, else its first operation. It only reads the top level of the document, skipping comments,
+// strings, arguments and selection sets, and leaves reporting syntax errors to the schema.
+func graphQLOperationType(document, operationName string) string {
+	types := make(map[string]string)
+	first, mutation := "", false
+	var words []string
+	depth := 0
+	for i := 0; i < len(document); i++ {
+		c := document[i]
+		switch {
+		case c == '#':
+			for i < len(document) && document[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(document[i:], `"""`):
+			end := strings.Index(document[i+3:], `"""`)
+			if end < 0 {
+				i = len(document)
+			} else {
+				i += end + 5
+			}
+		case c == '"':
+			for i++; i < len(document) && document[i] != '"'; i++ {
+				if document[i] == '\\' {
+					i++
+				}
+			}
+		case c == '(' || c == '[' || (c == '{' && depth > 0):
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		case c == '{':
+			// A top-level selection set ends the definition the words so far started
+			opType, name := "query", ""
+			if len(words) > 0 {
+				opType = words[0]
+			}
+			if len(words) > 1 && !strings.HasPrefix(words[1], "@") {
+				name = words[1]
+			}
+			if opType != "fragment" {
+				types[name] = opType
+				if first == "" {
+					first = opType
+				}
+				mutation = mutation || opType == "mutation"
+			}
+			words = nil
+			depth++
+		case depth == 0 && (c == '@' || c == '_' || unicode.IsLetter(rune(c))):
+			start := i
+			for i+1 < len(document) && (document[i+1] == '_' || unicode.IsLetter(rune(document[i+1])) || unicode.IsDigit(rune(document[i+1]))) {
+				i++
+			}
+			words = append(words, document[start:i+1])
+		}
+	}
+	if operationName != "" {
+		return types[operationName]
+	}
+	if mutation {
+		return "mutation"
+	}
+	return first
+}
+
+// GraphQLHandler serves the /graphql endpoint for GET and POST requests. Queries need read access and
+// mutations operate access. Mutations are only taken by POST, so that links and prefetches cannot change
+// data, and are answered with 405 on GET.
+func (s *Server) GraphQLHandler() http.Handler {
+	schema := graphql.MustParseSchema(graphQLSchema, &graphQLResolver{s})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var params graphQLRequest
+		if req.Method == http.MethodGet {
+			params.Query = req.URL.Query().Get("query")
+			params.OperationName = req.URL.Query().Get("operationName")
+			if variables := req.URL.Query().Get("variables"); variables != "" {
+				if err := json.Unmarshal([]byte(variables), &params.Variables); err != nil {
+					http.Error(w, "Failed to decode variables", http.StatusBadRequest)
+					return
+				}
+			}
+		} else if err := s.decodeJSON(w, req, &params); err != nil {
+			writeDecodeError(w, err, "GraphQL request")
+			return
+		}
+		if graphQLOperationType(params.Query, params.OperationName) == "mutation" {
+			if req.Method != http.MethodPost {
+				w.Header().Set("Allow", http.MethodPost)
+				http.Error(w, "Mutations must be sent with POST", http.StatusMethodNotAllowed)
+				return
+			}
+			if !mayAccess(req, accessOperate) {
+				http.Error(w, "This role may not run GraphQL mutations", http.StatusForbidden)
+				return
+			}
+		}
+
+		ctx := service.WithTenant(req.Context(), tenantFromRequest(req))
+		response := schema.Exec(ctx, params.Query, params.OperationName, params.Variables)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	})
+}
+
+// optionalString maps an empty string to a GraphQL null
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
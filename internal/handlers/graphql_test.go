@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGraphQLOperationType(t *testing.T) {
+	tests := []struct {
+		name      string
+		document  string
+		operation string
+		want      string
+	}{
+		{"shorthand", `{ receipts { id } }`, "", "query"},
+		{"named query", `query List($n: Int = 2) { receipts(first: $n) { id } }`, "", "query"},
+		{"mutation", `mutation { processReceipt(receipt: {retailer: "{"}) { id } }`, "", "mutation"},
+		{"comment and string", "# mutation {\nquery Q @cached { receipt(id: \"mutation\") { id } }", "", "query"},
+		{"mutation after a query", `query A { receipts { id } } mutation B { processReceipt { id } }`, "", "mutation"},
+		{"selected query", `query A { receipts { id } } mutation B { processReceipt { id } }`, "A", "query"},
+		{"fragment", `fragment F on Receipt { id } query { receipts { ...F } }`, "", "query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := graphQLOperationType(tt.document, tt.operation); got != tt.want {
+				t.Errorf("graphQLOperationType = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphQL(t *testing.T) {
+	router := newTestServer(t)
+	var ids []string
+	for _, body := range []string{targetReceipt, cornerMarketReceipt, targetReceipt} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/receipts/process", strings.NewReader(body)))
+		var processed struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&processed); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, processed.ID)
+	}
+
+	t.Run("mutation over GET", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		query := url.QueryEscape(`mutation { processReceipt(receipt: {retailer: "A", purchaseDate: "2022-01-01", purchaseTime: "13:01", total: "1.00", items: []}) { id } }`)
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/graphql?query="+query, nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("status = %d, want 405: %s", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("invalid receipt", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		body := `{"query": "mutation { processReceipt(receipt: {retailer: \"A\", purchaseDate: \"2022-13-01\", purchaseTime: \"13:01\", total: \"1.00\", items: [{shortDescription: \"x\", price: \"1.00\"}]}) { id } }"}`
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/graphql", strings.NewReader(body)))
+		var response struct {
+			Errors []struct{ Message string } `json:"errors"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		if len(response.Errors) == 0 || !strings.Contains(response.Errors[0].Message, "purchaseDate") {
+			t.Fatalf("errors = %v, want a purchaseDate error", response.Errors)
+		}
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		var got []string
+		after := ""
+		for page := 0; page < 3; page++ {
+			query := `{ receipts(first: 2) { id } }`
+			if after != "" {
+				query = `{ receipts(first: 2, after: "` + after + `") { id } }`
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/graphql?query="+url.QueryEscape(query), nil))
+			var response struct {
+				Data struct {
+					Receipts []struct{ ID string } `json:"receipts"`
+				} `json:"data"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if len(response.Data.Receipts) == 0 {
+				break
+			}
+			for _, receipt := range response.Data.Receipts {
+				got = append(got, receipt.ID)
+			}
+			after = got[len(got)-1]
+		}
+		if len(got) != len(ids) {
+			t.Fatalf("paged through %v, want the %d receipts %v", got, len(ids), ids)
+		}
+	})
+}
+
+func TestGraphQLAccess(t *testing.T) {
+	t.Setenv("API_KEY_ROLES", "reader-key=read-only,operator-key=operator,submitter-key=submitter")
+	router := newTestServer(t)
+	query := `{"query": "{ receipts { id } }"}`
+	mutation := `{"query": "mutation { processReceipt(receipt: {retailer: \"Target\", purchaseDate: \"2022-01-01\", purchaseTime: \"13:01\", total: \"1.00\", items: [{shortDescription: \"Pepsi\", price: \"1.00\"}]}) { id } }"}`
+
+	tests := []struct {
+		name       string
+		key        string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"read-only query", "reader-key", "/v1/graphql", query, http.StatusOK},
+		{"read-only mutation", "reader-key", "/v1/graphql", mutation, http.StatusForbidden},
+		{"operator mutation", "operator-key", "/v1/graphql", mutation, http.StatusOK},
+		{"submitter query", "submitter-key", "/v1/graphql", query, http.StatusForbidden},
+		{"operator admin query", "operator-key", "/admin/query", `{"table": "receipts"}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-API-Key", tt.key)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"receipt-processor/internal/query"
+	"receipt-processor/internal/receiptsv1"
+	"receipt-processor/internal/service"
+	"receipt-processor/internal/store"
+)
+
+// grpcServer implements the Receipts service of proto/receipts/v1 on the same service calls as the REST
+// endpoints. It serves both gRPC clients and, in process, the routes of the service's HTTP bindings,
+// which grpcGateway mounts under /v1.
+type grpcServer struct {
+	receiptsv1.UnimplementedReceiptsServer
+	s *Server
+}
+
+// ProcessReceipt validates, scores and stores a receipt, or queues batch traffic for the worker pool.
+// The metadata stands in for the headers of POST /v1/receipts/process: x-receipt-channel and
+// x-receipt-priority come in, and x-receipt-flag, x-duplicate-of and retry-after go out.
+func (g *grpcServer) ProcessReceipt(ctx context.Context, req *receiptsv1.ProcessReceiptRequest) (*receiptsv1.ProcessReceiptResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	receipt := receiptFromProto(req.GetReceipt())
+	// Receipts are submitted through the API when the call came over HTTP, and through gRPC otherwise
+	receipt.Channel = service.ChannelGRPC
+	if _, ok := runtime.HTTPPathPattern(ctx); ok {
+		receipt.Channel = service.ChannelAPI
+	}
+	receipt.Channel = knownChannel(firstValue(md, channelHeader), receipt.Channel)
+	tenant := service.TenantFromContext(ctx)
+
+	if g.s.priorityOf(firstValue(md, priorityHeader)) == service.PriorityBatch {
+		receipt, jobID, err := g.s.enqueueBatchReceipt(ctx, tenant, receipt)
+		if err != nil {
+			return nil, submissionError(ctx, err)
+		}
+		grpc.SetHeader(ctx, flagMetadata(receipt))
+		return &receiptsv1.ProcessReceiptResponse{Id: receipt.ID, ShortCode: receipt.ShortCode, Status: service.JobQueued, JobId: jobID}, nil
+	}
+
+	receipt, err := g.s.svc.ProcessReceipt(ctx, tenant, receipt)
+	if err != nil && !errors.Is(err, service.ErrReceiptBuffered) {
+		return nil, submissionError(ctx, err)
+	}
+	grpc.SetHeader(ctx, flagMetadata(receipt))
+	resp := &receiptsv1.ProcessReceiptResponse{Id: receipt.ID, ShortCode: receipt.ShortCode, Points: proto.Int32(int32(g.s.points(receipt)))}
+	if err != nil {
+		// The store is down, and the receipt is stored when it recovers
+		resp.Status = "buffered"
+	}
+	return resp, nil
+}
+
+// firstValue is the first value of a metadata key, or ""
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// flagMetadata is the metadata telling the client which flags were raised on an admitted receipt, as
+// writeFlagHeaders does
+func flagMetadata(receipt store.Receipt) metadata.MD {
+	md := metadata.MD{}
+	for _, flag := range receipt.Flags {
+		md.Append("x-receipt-flag", flag)
+	}
+	if receipt.DuplicateOf != "" {
+		md.Set("x-duplicate-of", receipt.DuplicateOf)
+	}
+	return md
+}
+
+// submissionError is grpcError for a submission, with the ID a duplicate duplicates in x-duplicate-of and,
+// when the batch queue is full, when to retry in retry-after
+func submissionError(ctx context.Context, err error) error {
+	var dup *service.DuplicateError
+	switch {
+	case errors.As(err, &dup):
+		grpc.SetHeader(ctx, metadata.Pairs("x-duplicate-of", dup.ExistingID))
+	case errors.Is(err, errBatchQueueFull):
+		grpc.SetHeader(ctx, metadata.Pairs("retry-after", "1"))
+	}
+	return grpcError(err)
+}
+
+// GetReceipt returns a stored receipt with its points and their provenance
+func (g *grpcServer) GetReceipt(ctx context.Context, req *receiptsv1.GetReceiptRequest) (*receiptsv1.GetReceiptResponse, error) {
+	receipt, exists, err := g.s.svc.FindReceipt(ctx, req.GetId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if !exists {
+		return nil, status.Error(codes.NotFound, "Receipt not found")
+	}
+	// The provenance is the JSON object the REST API has always answered with, carried as a Struct
+	data, err := json.Marshal(g.s.svc.ProvenanceOf(receipt))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	provenance := new(structpb.Struct)
+	if err := protojson.Unmarshal(data, provenance); err != nil {
+		return nil, grpcError(err)
+	}
+	return &receiptsv1.GetReceiptResponse{Receipt: g.receiptToProto(receipt), Points: proto.Int32(int32(g.s.points(receipt))), Provenance: provenance}, nil
+}
+
+// GetPoints returns the points awarded for a receipt, from the points cache when it has them
+func (g *grpcServer) GetPoints(ctx context.Context, req *receiptsv1.GetPointsRequest) (*receiptsv1.GetPointsResponse, error) {
+	cached, exists, err := g.s.svc.ReceiptPoints(ctx, req.GetId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if !exists {
+		return nil, status.Error(codes.NotFound, "Receipt not found")
+	}
+	return &receiptsv1.GetPointsResponse{Points: proto.Int32(int32(cached.Points))}, nil
+}
+
+// ListReceipts lists the stored receipts matching the filters, sorted and a page at a time. The request's
+// fields are parsed as the query parameters of a listing, receiptListSpec, so they are validated the same
+// way through gRPC and HTTP.
+func (g *grpcServer) ListReceipts(ctx context.Context, req *receiptsv1.ListReceiptsRequest) (*receiptsv1.ListReceiptsResponse, error) {
+	values := url.Values{}
+	for name, value := range map[string]string{
+		"retailer":  req.GetRetailer(),
+		"from":      req.GetFrom(),
+		"to":        req.GetTo(),
+		"channel":   req.GetChannel(),
+		"state":     req.GetState(),
+		"category":  req.GetCategory(),
+		"minTotal":  req.GetMinTotal(),
+		"maxTotal":  req.GetMaxTotal(),
+		"minPoints": req.GetMinPoints(),
+		"sort":      req.GetSort(),
+	} {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	if req.GetLimit() != 0 {
+		values.Set("limit", strconv.Itoa(int(req.GetLimit())))
+	}
+	if req.GetOffset() != 0 {
+		values.Set("offset", strconv.Itoa(int(req.GetOffset())))
+	}
+	params, err := query.Parse(values, receiptListSpec)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	receipts, matched, err := g.s.listReceipts(ctx, params)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	resp := &receiptsv1.ListReceiptsResponse{Total: proto.Int32(int32(matched)), Limit: proto.Int32(int32(params.Limit)), Offset: proto.Int32(int32(params.Offset))}
+	for _, receipt := range receipts {
+		resp.Receipts = append(resp.Receipts, g.receiptToProto(receipt))
+	}
+	return resp, nil
+}
+
+// receiptFromProto takes the submitted fields of a receipt, leaving out the ones only the server sets
+func receiptFromProto(in *receiptsv1.Receipt) store.Receipt {
+	receipt := store.Receipt{
+		Retailer:     in.GetRetailer(),
+		PurchaseDate: in.GetPurchaseDate(),
+		PurchaseTime: in.GetPurchaseTime(),
+		Total:        in.GetTotal(),
+		Tax:          in.GetTax(),
+		Tip:          in.GetTip(),
+		Currency:     in.GetCurrency(),
+		UserID:       in.GetUserId(),
+	}
+	for _, item := range in.GetItems() {
+		receipt.Items = append(receipt.Items, store.ReceiptItem{
+			ShortDescription: item.GetShortDescription(),
+			Price:            item.GetPrice(),
+			Category:         item.GetCategory(),
+			Tags:             item.GetTags(),
+		})
+	}
+	return receipt
+}
+
+// receiptSubmissionToProto renders the submitted fields of a receipt, the ones receiptFromProto takes
+func receiptSubmissionToProto(receipt store.Receipt) *receiptsv1.Receipt {
+	out := &receiptsv1.Receipt{
+		Retailer:     receipt.Retailer,
+		PurchaseDate: receipt.PurchaseDate,
+		PurchaseTime: receipt.PurchaseTime,
+		Total:        receipt.Total,
+		Tax:          receipt.Tax,
+		Tip:          receipt.Tip,
+		Currency:     receipt.Currency,
+		UserId:       receipt.UserID,
+	}
+	for _, item := range receipt.Items {
+		out.Items = append(out.Items, &receiptsv1.Item{
+			ShortDescription: item.ShortDescription,
+			Price:            item.Price,
+			Category:         item.Category,
+			Tags:             item.Tags,
+		})
+	}
+	return out
+}
+
+// receiptToProto renders a stored receipt with its points
+func (g *grpcServer) receiptToProto(receipt store.Receipt) *receiptsv1.Receipt {
+	out := receiptSubmissionToProto(receipt)
+	out.Id = receipt.ID
+	out.ShortCode = receipt.ShortCode
+	out.Points = int32(g.s.points(receipt))
+	out.RulesVersion = receipt.RulesVersion
+	out.Channel = receipt.Channel
+	out.State = store.StateOf(receipt)
+	out.Flags = receipt.Flags
+	if receipt.ScoredAt != nil {
+		out.ScoredAt = timestamppb.New(*receipt.ScoredAt)
+	}
+	return out
+}
+
+// grpcError maps the errors of the service calls to gRPC codes, as writeStoreError and the endpoints map
+// them to HTTP statuses
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrDuplicateReceipt):
+		return status.Error(codes.AlreadyExists, "Duplicate receipt")
+	case errors.Is(err, service.ErrInvalidReceipt):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return status.Error(codes.DeadlineExceeded, "Request timed out")
+	case errors.Is(err, store.ErrUnavailable):
+		return status.Error(codes.Unavailable, "Receipt store unavailable")
+	case errors.Is(err, errBatchQueueFull):
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// GRPCServer returns the gRPC server of the Receipts service, with TLS when tlsConfig is set. Calls go
+// through the same middleware as HTTP requests: the metadata stands in for the headers, so the API key
+// goes in authorization or x-api-key and the tenant in x-tenant-id, and the call's full method for the
+// path, which routeAccess gives each method's role.
+func (s *Server) GRPCServer(tlsConfig *tls.Config) *grpc.Server {
+	options := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(int(s.maxBodySize)),
+		grpc.UnaryInterceptor(s.grpcMiddleware()),
+	}
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(options...)
+	receiptsv1.RegisterReceiptsServer(server, &grpcServer{s: s})
+	return server
+}
+
+// grpcMiddleware runs each call through the middleware chain, tenancy and clientAddress as a POST to its
+// full method. A middleware answering the request itself, e.g. with 401, fails the call with the matching
+// code.
+func (s *Server) grpcMiddleware() grpc.UnaryServerInterceptor {
+	chain := append(s.middlewareChain(), tenancy(), clientAddress())
+	return func(ctx context.Context, in interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, info.FullMethod, nil)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		for name, values := range md {
+			if strings.HasPrefix(name, ":") {
+				continue
+			}
+			for _, value := range values {
+				req.Header.Add(name, value)
+			}
+		}
+		req.Header.Set("Content-Type", "application/grpc")
+		req.ProtoMajor, req.ProtoMinor, req.Proto = 2, 0, "HTTP/2.0"
+		if p, ok := peer.FromContext(ctx); ok {
+			req.RemoteAddr = p.Addr.String()
+			if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+				req.TLS = &info.State
+			}
+		}
+
+		var resp interface{}
+		called := false
+		var final http.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			called = true
+			resp, err = handler(req.Context(), in)
+			if err != nil {
+				// The access log and metrics see failed calls as the status their code maps to
+				w.WriteHeader(runtime.HTTPStatusFromCode(status.Code(err)))
+			}
+		})
+		for i := len(chain) - 1; i >= 0; i-- {
+			final = chain[i](final)
+		}
+		answer := &grpcResponse{header: make(http.Header)}
+		final.ServeHTTP(answer, req)
+		if !called {
+			return nil, status.Error(grpcCode(answer.status), strings.TrimSpace(answer.body.String()))
+		}
+		return resp, err
+	}
+}
+
+// grpcResponse stands in for the response writer of a gRPC call going through the middleware, keeping
+// the status and message a middleware answers with
+type grpcResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *grpcResponse) Header() http.Header { return r.header }
+
+func (r *grpcResponse) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(p)
+}
+
+func (r *grpcResponse) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+// grpcCode maps the HTTP status a middleware answered with to a gRPC code
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusInternalServerError:
+		return codes.Internal
+	}
+	return codes.Unknown
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"receipt-processor/internal/query"
+	"receipt-processor/internal/store"
+)
+
+// historySpec is what /history accepts: the receipt listing's parameters, most recent receipts first,
+// a page at a time
+var historySpec = func() query.Spec {
+	spec := receiptListSpec
+	spec.DefaultSort = "-scoredAt,id"
+	spec.DefaultLimit = 20
+	return spec
+}()
+
+// historyRow is one receipt of the history page
+type historyRow struct {
+	Receipt store.Receipt
+	Points  int
+}
+
+// HistoryPageHandler renders the submitted receipts a page at a time, with links to their pages. It
+// takes the parameters of the receipt listing, whose sorting and filters it shares.
+func (s *Server) HistoryPageHandler(w http.ResponseWriter, req *http.Request) {
+	params, err := query.Parse(req.URL.Query(), historySpec)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	receipts, matched, err := s.listReceipts(req.Context(), params)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	rows := make([]historyRow, len(receipts))
+	for i, receipt := range receipts {
+		rows[i] = historyRow{receipt, s.points(receipt)}
+	}
+	data := struct {
+		Rows            []historyRow
+		From, To, Total int
+		Previous, Next  string
+	}{Rows: rows, From: params.Offset + 1, To: params.Offset + len(rows), Total: matched}
+	if params.Offset > 0 {
+		data.Previous = historyPage(req.URL.Query(), max(params.Offset-params.Limit, 0))
+	}
+	if params.Offset+len(rows) < matched {
+		data.Next = historyPage(req.URL.Query(), params.Offset+params.Limit)
+	}
+	s.renderPage(w, "history.html", data)
+}
+
+// historyPage links to the history page at offset, keeping the other parameters
+func historyPage(values url.Values, offset int) string {
+	values.Set("offset", strconv.Itoa(offset))
+	return "/history?" + values.Encode()
+}
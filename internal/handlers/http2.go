@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+
+	"receipt-processor/internal/config"
+)
+
+// Handler serves the router, and gRPC calls arriving over HTTP/2 on the same listener, told apart by
+// their application/grpc content type. gRPC calls skip the router's middleware, which the gRPC server
+// runs them through itself.
+func (s *Server) Handler(grpcServer *grpc.Server) http.Handler {
+	router := stripBasePath(s.Router())
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.ProtoMajor == 2 && strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc") {
+			grpcServer.ServeHTTP(w, req)
+			return
+		}
+		router.ServeHTTP(w, req)
+	})
+}
+
+// ConfigureHTTP2 turns on HTTP/2 for a server, with at most HTTP2_MAX_CONCURRENT_STREAMS (default 250)
+// streams open on one connection and frames of up to HTTP2_MAX_READ_FRAME_SIZE (default 1MB, between 16KB
+// and 16MB) bytes. Over TLS clients negotiate it with ALPN; with H2C=true cleartext connections may use it
+// too, by prior knowledge or by upgrading, which is meant for internal traffic like gRPC from a sidecar,
+// since nothing protects it on the wire. Call it after the server's TLSConfig and Handler are set.
+func ConfigureHTTP2(server *http.Server) error {
+	streams := config.Int("HTTP2_MAX_CONCURRENT_STREAMS", 250)
+	if streams <= 0 {
+		log.Printf("Ignoring invalid HTTP2_MAX_CONCURRENT_STREAMS=%d, using 250", streams)
+		streams = 250
+	}
+	frameSize := config.Int("HTTP2_MAX_READ_FRAME_SIZE", 1<<20)
+	if frameSize < 16<<10 || frameSize > 16<<20 {
+		log.Printf("Ignoring HTTP2_MAX_READ_FRAME_SIZE=%d, which must be between 16KB and 16MB", frameSize)
+		frameSize = 1 << 20
+	}
+	h2 := &http2.Server{
+		MaxConcurrentStreams: uint32(streams),
+		MaxReadFrameSize:     uint32(frameSize),
+		IdleTimeout:          server.IdleTimeout,
+	}
+	if config.Bool("H2C", false) {
+		server.Handler = h2c.NewHandler(server.Handler, h2)
+	}
+	return http2.ConfigureServer(server, h2)
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"time"
+
+	"receipt-processor/internal/service"
+)
+
+// idempotencyHeader lets clients retry a submission without creating a second receipt
+const idempotencyHeader = "Idempotency-Key"
+
+// defaultIdempotencyTTL is how long keys are remembered until StartIdempotencyExpiry sets IDEMPOTENCY_TTL
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// idempotentResponse is a successful response remembered for replay
+type idempotentResponse struct {
+	BodyHash [sha256.Size]byte
+	Status   int
+	Header   http.Header
+	Body     []byte
+	Done     bool
+	Expires  time.Time
+}
+
+// bufferingRecorder captures a response while also writing it to the client
+type bufferingRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *bufferingRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *bufferingRecorder) Write(p []byte) (int, error) {
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
+
+// idempotencyScope is what a key is remembered under: the tenant, the actor and credential that sent it,
+// and the method and path it was sent to, so one client's key never replays another client's response,
+// nor the response of another endpoint. The credential is hashed, so the log holds no API keys.
+func idempotencyScope(req *http.Request, key string) string {
+	scope := sha256.New()
+	for _, part := range []string{
+		tenantFromRequest(req),
+		service.ActorFromContext(req.Context()),
+		requestAPIKey(req),
+		req.Method,
+		req.URL.Path,
+		key,
+	} {
+		io.WriteString(scope, part)
+		scope.Write([]byte{0})
+	}
+	return string(scope.Sum(nil))
+}
+
+// idempotent replays the original successful response for a repeated Idempotency-Key.
+// Keys are scoped by idempotencyScope; reusing a key with a different body is rejected with 422,
+// and a retry that arrives while the first request is still running gets 409.
+func (s *Server) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get(idempotencyHeader)
+		if key == "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, s.maxBodySize))
+		if err != nil {
+			if !bodyTooLarge(w, err) {
+				http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			}
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		bodyHash := sha256.Sum256(body)
+		logKey := idempotencyScope(req, key)
+
+		s.idempotencyMu.Lock()
+		s.sweepIdempotencyLog(s.svc.Now(), time.Minute)
+		if entry, exists := s.idempotencyLog[logKey]; exists && s.svc.Now().Before(entry.Expires) {
+			s.idempotencyMu.Unlock()
+			switch {
+			case entry.BodyHash != bodyHash:
+				http.Error(w, "Idempotency-Key was already used with a different request body", http.StatusUnprocessableEntity)
+			case !entry.Done:
+				http.Error(w, "A request with this Idempotency-Key is still in progress", http.StatusConflict)
+			default:
+				for name, values := range entry.Header {
+					w.Header()[name] = values
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(entry.Status)
+				w.Write(entry.Body)
+			}
+			return
+		}
+		entry := &idempotentResponse{BodyHash: bodyHash, Expires: s.svc.Now().Add(s.idempotencyTTL)}
+		s.idempotencyLog[logKey] = entry
+		s.idempotencyMu.Unlock()
+
+		// A handler that panics never finishes the entry: forget it, so retries are not answered 409 until it
+		// expires, and let the panic carry on to the recovery middleware
+		defer func() {
+			if err := recover(); err != nil {
+				s.idempotencyMu.Lock()
+				delete(s.idempotencyLog, logKey)
+				s.idempotencyMu.Unlock()
+				panic(err)
+			}
+		}()
+		recorder := &bufferingRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, req)
+
+		s.idempotencyMu.Lock()
+		defer s.idempotencyMu.Unlock()
+		if recorder.status >= 300 {
+			// Failed attempts are not remembered, so the client can retry them
+			delete(s.idempotencyLog, logKey)
+			return
+		}
+		entry.Status = recorder.status
+		entry.Header = recorder.Header().Clone()
+		entry.Body = recorder.body.Bytes()
+		entry.Done = true
+	})
+}
+
+// sweepIdempotencyLog forgets the expired keys, unless they were swept less than every ago. The caller
+// holds idempotencyMu.
+func (s *Server) sweepIdempotencyLog(now time.Time, every time.Duration) {
+	if now.Sub(s.idempotencySwept) < every {
+		return
+	}
+	s.idempotencySwept = now
+	for key, entry := range s.idempotencyLog {
+		if now.After(entry.Expires) {
+			delete(s.idempotencyLog, key)
+		}
+	}
+}
+
+// StartIdempotencyExpiry sets how long keys are remembered, and forgets expired ones every minute even when
+// no new keys come in to sweep them
+func (s *Server) StartIdempotencyExpiry(ttl time.Duration) {
+	s.idempotencyMu.Lock()
+	s.idempotencyTTL = ttl
+	s.idempotencyMu.Unlock()
+	go func() {
+		for range time.Tick(time.Minute) {
+			s.idempotencyMu.Lock()
+			s.sweepIdempotencyLog(s.svc.Now(), 0)
+			s.idempotencyMu.Unlock()
+		}
+	}()
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"receipt-processor/internal/points"
+	"receipt-processor/internal/service"
+	"receipt-processor/internal/store"
+)
+
+func TestIdempotentForgetsPanickedRequests(t *testing.T) {
+	s := NewServer(newTestService(), log.New(io.Discard, "", 0))
+	calls := 0
+	handler := s.idempotent(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		if calls == 1 {
+			panic("store exploded")
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(targetReceipt))
+		req.Header.Set(idempotencyHeader, "retry-me")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("the panic was swallowed")
+			}
+		}()
+		send()
+	}()
+	if rec := send(); rec.Code != http.StatusCreated {
+		t.Fatalf("retry status = %d, want 201: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestIdempotencyScope(t *testing.T) {
+	now := testNow
+	svc := service.New(store.NewMemory(), fixedRules{rules: points.SpecRules}, func() time.Time { return now })
+	s := NewServer(svc, log.New(io.Discard, "", 0))
+	calls := 0
+	handler := s.idempotent(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusCreated)
+	}))
+	send := func(actor, apiKey, path string) {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(targetReceipt))
+		req.Header.Set(idempotencyHeader, "shared-key")
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		req = req.WithContext(service.WithActor(req.Context(), actor))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	tests := []struct {
+		name      string
+		actor     string
+		apiKey    string
+		path      string
+		advance   time.Duration
+		wantCalls int
+	}{
+		{"first request", "alice", "key-a", "/receipts/process", 0, 1},
+		{"retry", "alice", "key-a", "/receipts/process", 0, 1},
+		{"another actor", "bob", "key-a", "/receipts/process", 0, 2},
+		{"another credential", "alice", "key-b", "/receipts/process", 0, 3},
+		{"another path", "alice", "key-a", "/receipts/process/batch", 0, 4},
+		{"retry before the default TTL", "alice", "key-a", "/receipts/process", defaultIdempotencyTTL - time.Minute, 4},
+		{"retry after the default TTL", "alice", "key-a", "/receipts/process", 2 * time.Minute, 5},
+	}
+	for _, tt := range tests {
+		now = now.Add(tt.advance)
+		send(tt.actor, tt.apiKey, tt.path)
+		if calls != tt.wantCalls {
+			t.Errorf("%s: handler calls = %d, want %d", tt.name, calls, tt.wantCalls)
+		}
+	}
+	s.idempotencyMu.Lock()
+	defer s.idempotencyMu.Unlock()
+	if len(s.idempotencyLog) != 1 {
+		t.Errorf("idempotency log holds %d keys, want the expired ones swept, leaving 1", len(s.idempotencyLog))
+	}
+}
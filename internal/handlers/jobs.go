@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// GetJobEndpoint reports the status of an asynchronous submission of the caller's tenant, and for
+// submitters one they submitted
+func (s *Server) GetJobEndpoint(w http.ResponseWriter, req *http.Request) {
+	j, exists := s.svc.FindJob(req.Context(), mux.Vars(req)["id"])
+	if !exists {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(j)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"receipt-processor/internal/service"
+)
+
+func TestGetJobScopedToTenant(t *testing.T) {
+	svc := newTestService()
+	svc.StartBatchWorkers(1, 10)
+	router := NewServer(svc, log.New(io.Discard, "", 0)).Router()
+
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process/batch", strings.NewReader(targetReceipt))
+	req.Header.Set(tenantHeader, "acme")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", rec.Code, rec.Body)
+	}
+	var queued struct {
+		ID    string `json:"id"`
+		JobID string `json:"jobId"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&queued); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		tenant     string
+		wantStatus int
+	}{
+		{"submitting tenant", "acme", http.StatusOK},
+		{"other tenant", "globex", http.StatusNotFound},
+		{"default tenant", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/jobs/"+queued.JobID, nil)
+			if tt.tenant != "" {
+				req.Header.Set(tenantHeader, tt.tenant)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+
+	// The worker stores the receipt in the submitting tenant's partition
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		req := httptest.NewRequest(http.MethodGet, "/receipts/"+queued.ID, nil)
+		req.Header.Set(tenantHeader, "acme")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("receipt %s was not stored for its tenant: %d %s", queued.ID, rec.Code, rec.Body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/receipts/"+queued.ID, nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("default tenant GET receipt = %d, want 404", rec.Code)
+	}
+
+	// and audits it as the submitter's, not the system's
+	subject := "receipt:" + queued.ID
+	if entries := svc.AuditEntries(service.AuditFilter{Subject: subject}); len(entries) != 0 {
+		t.Errorf("default tenant audit log has %d entries for %s", len(entries), subject)
+	}
+	entries := svc.AuditEntries(service.AuditFilter{Tenant: "acme", Subject: subject})
+	if len(entries) != 1 || entries[0].Actor != "anonymous" {
+		t.Errorf("acme audit log for %s = %+v, want one entry by anonymous", subject, entries)
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"receipt-processor/internal/service"
+	"receipt-processor/internal/store"
+)
+
+// ImportJSONEndpoint imports a JSON upload holding one receipt or an array of them, as the raw request
+// body or the "file" field of a multipart form, and reports the outcome of every receipt like the CSV
+// import, numbering them from 1
+func (s *Server) ImportJSONEndpoint(w http.ResponseWriter, req *http.Request) {
+	body, err := uploadBody(w, req)
+	if err != nil {
+		writeUploadError(w, err, "JSON")
+		return
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		writeUploadError(w, err, "JSON")
+		return
+	}
+
+	var receipts []store.Receipt
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		err = strictUnmarshal(bytes.NewReader(data), &receipts)
+	} else {
+		receipts = make([]store.Receipt, 1)
+		err = strictUnmarshal(bytes.NewReader(data), &receipts[0])
+	}
+	if err != nil {
+		http.Error(w, "Failed to decode receipts: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	parsed := make([]service.CSVReceipt, len(receipts))
+	for i, receipt := range receipts {
+		parsed[i] = service.CSVReceipt{Line: i + 1, Receipt: receipt}
+	}
+	s.writeImportReport(w, req, s.svc.ImportReceipts(req.Context(), tenantFromRequest(req), submissionChannel(req, service.ChannelBulk), parsed))
+}
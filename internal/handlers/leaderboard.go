@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"receipt-processor/internal/query"
+	"receipt-processor/internal/service"
+)
+
+// leaderboardSpec is what GET /leaderboard accepts
+var leaderboardSpec = query.Spec{
+	Filters:      map[string]query.FilterType{"window": query.String},
+	DefaultLimit: 10,
+	MaxLimit:     100,
+}
+
+// LeaderboardEndpoint returns the top users by points over a window (?window=day|week|month|all, default all)
+func (s *Server) LeaderboardEndpoint(w http.ResponseWriter, req *http.Request) {
+	params, err := query.Parse(req.URL.Query(), leaderboardSpec)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	window, ok := params.Filter("window")
+	if !ok {
+		window = service.WindowAllTime
+	}
+	if _, bounded := service.WindowDays[window]; !bounded && window != service.WindowAllTime {
+		writeQueryError(w, &query.Error{Param: "window", Message: fmt.Sprintf("%q is not day, week, month or all", window)})
+		return
+	}
+
+	board, err := s.svc.CachedLeaderboard(req.Context(), window)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	board.Leaders = query.Page(board.Leaders, params)
+	s.writeNegotiated(w, req, board, func() table {
+		t := table{Title: "Leaderboard (" + board.Window + ")", Columns: []string{"rank", "userId", "points"}}
+		for _, leader := range board.Leaders {
+			t.Rows = append(t.Rows, []string{strconv.Itoa(leader.Rank), leader.UserID, strconv.Itoa(leader.Points)})
+		}
+		return t
+	})
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"receipt-processor/internal/store"
+)
+
+// UserLedgerEndpoint lists a user's ledger entries, newest first
+func (s *Server) UserLedgerEndpoint(w http.ResponseWriter, req *http.Request) {
+	userID, ok := resolveUser(w, req)
+	if !ok {
+		return
+	}
+	entries := []store.LedgerEntry{}
+	for _, entry := range s.svc.AllLedgerEntries() {
+		if entry.UserID == userID {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].CreatedAt.After(entries[j].CreatedAt) })
+	s.writeNegotiated(w, req, map[string]interface{}{"userId": userID, "entries": entries}, func() table {
+		t := table{Title: "Ledger of " + userID, Columns: []string{"createdAt", "points", "reason", "receiptId", "id"}}
+		for _, entry := range entries {
+			t.Rows = append(t.Rows, []string{entry.CreatedAt.Format(time.RFC3339), strconv.Itoa(entry.Points), entry.Reason, entry.ReceiptID, entry.ID})
+		}
+		return t
+	})
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/internal/service"
+	"receipt-processor/internal/store"
+)
+
+// TransitionReceiptHandler moves a receipt through its lifecycle, e.g. a reviewer approving it
+func (s *Server) TransitionReceiptHandler(w http.ResponseWriter, req *http.Request) {
+	var body struct {
+		State  string `json:"state"`
+		Reason string `json:"reason"`
+	}
+	if err := s.decodeJSON(w, req, &body); err != nil {
+		writeDecodeError(w, err, "transition")
+		return
+	}
+	if !service.KnownStates[body.State] {
+		http.Error(w, fmt.Sprintf("Unknown state %q", body.State), http.StatusBadRequest)
+		return
+	}
+
+	receipt, err := s.svc.TransitionReceipt(req.Context(), tenantFromRequest(req), mux.Vars(req)["id"], body.State, body.Reason)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		http.Error(w, "Receipt not found", http.StatusNotFound)
+		return
+	case errors.Is(err, service.ErrInvalidTransition):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": receipt.ID, "state": receipt.State})
+}
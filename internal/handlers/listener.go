@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"receipt-processor/internal/config"
+)
+
+// Listener is one of the listeners the HTTP server serves on
+type Listener struct {
+	Name     string
+	Where    string
+	Listener net.Listener
+	// Plaintext listeners are served without TLS even when it is configured
+	Plaintext bool
+	// routes are the path prefixes the listener serves; a listener without any serves the paths no other
+	// listener is assigned, which are in claimed
+	routes  []string
+	claimed []string
+}
+
+// Listeners opens the listeners the HTTP server serves on. Without LISTENERS it is a single one: the socket
+// systemd passed with socket activation, or else port 8080, or with UNIX_SOCKET the Unix socket at that
+// path. LISTENERS names several as name=address pairs, like public=:8443,internal=127.0.0.1:9000, an
+// address being a TCP address or unix: and a socket path; a systemd socket with the listener's name as
+// its FileDescriptorName= takes the place of its address. LISTENER_ROUTES assigns listeners the path
+// prefixes they serve, as name=prefix pairs with the prefixes separated by spaces, like
+// internal=/admin /debug /metrics, and LISTENER_PLAINTEXT lists those served without TLS.
+func Listeners() ([]Listener, error) {
+	sockets, err := systemdListeners()
+	if err != nil {
+		return nil, err
+	}
+	addresses := config.Map("LISTENERS")
+	if len(addresses) == 0 {
+		listener, where, err := listen(sockets)
+		if err != nil {
+			return nil, err
+		}
+		return []Listener{{Name: "default", Where: where, Listener: listener}}, nil
+	}
+
+	names := make([]string, 0, len(addresses))
+	for name := range addresses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	routes := make(map[string][]string)
+	for name, prefixes := range config.Map("LISTENER_ROUTES") {
+		if _, ok := addresses[name]; !ok {
+			return nil, fmt.Errorf("LISTENER_ROUTES names unknown listener %q", name)
+		}
+		routes[name] = strings.Fields(prefixes)
+	}
+	plaintext := make(map[string]bool)
+	for _, name := range config.List("LISTENER_PLAINTEXT", nil) {
+		if _, ok := addresses[name]; !ok {
+			return nil, fmt.Errorf("LISTENER_PLAINTEXT names unknown listener %q", name)
+		}
+		plaintext[name] = true
+	}
+
+	var listeners []Listener
+	for _, name := range names {
+		l := Listener{Name: name, Plaintext: plaintext[name], routes: routes[name]}
+		for other, prefixes := range routes {
+			if other != name {
+				l.claimed = append(l.claimed, prefixes...)
+			}
+		}
+		if socket := findSocket(sockets, name); socket != nil {
+			l.Listener, l.Where = socket, "systemd socket "+socket.Addr().String()
+		} else if path, ok := strings.CutPrefix(addresses[name], "unix:"); ok {
+			l.Listener, err = listenUnix(path)
+			l.Where = "unix socket " + path
+		} else {
+			l.Listener, err = net.Listen("tcp", addresses[name])
+			l.Where = addresses[name]
+		}
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Listener.Close()
+			}
+			return nil, fmt.Errorf("listener %s: %w", name, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// Handler serves the requests for the listener's routes with next, and answers the others with 404
+func (l Listener) Handler(next http.Handler) http.Handler {
+	if len(l.routes) == 0 && len(l.claimed) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		served := !matchesPrefix(req.URL.Path, l.claimed)
+		if len(l.routes) > 0 {
+			served = matchesPrefix(req.URL.Path, l.routes)
+		}
+		if !served {
+			http.NotFound(w, req)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// matchesPrefix reports whether a path is one of the prefixes or below one of them
+func matchesPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// listen opens the single listener served without LISTENERS: the socket systemd passed, the one named
+// http if there are several, or else port 8080, or the Unix socket at UNIX_SOCKET
+func listen(sockets []systemdSocket) (net.Listener, string, error) {
+	if len(sockets) > 0 {
+		socket := findSocket(sockets, "http")
+		if socket == nil {
+			socket = sockets[0].listener
+		}
+		return socket, "systemd socket " + socket.Addr().String(), nil
+	}
+	if path := os.Getenv("UNIX_SOCKET"); path != "" {
+		listener, err := listenUnix(path)
+		return listener, "unix socket " + path, err
+	}
+	listener, err := net.Listen("tcp", ":8080")
+	return listener, "port 8080", err
+}
+
+// listenUnix listens on the Unix socket at a path, for a reverse proxy on the same host. The socket gets
+// the permissions of UNIX_SOCKET_MODE (octal, default 0660), so only the proxy's user or group can connect;
+// an invalid mode stops the server rather than leaving it open to everyone. A socket left behind by an
+// earlier run is removed, but any other file at the path is an error.
+func listenUnix(path string) (net.Listener, error) {
+	mode := fs.FileMode(0o660)
+	if value := os.Getenv("UNIX_SOCKET_MODE"); value != "" {
+		parsed, err := strconv.ParseUint(value, 8, 32)
+		if err != nil || parsed > 0o777 {
+			return nil, fmt.Errorf("invalid UNIX_SOCKET_MODE %q, want octal permissions like 0660", value)
+		}
+		mode = fs.FileMode(parsed)
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&fs.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	// net.Listen creates the socket with the umask's permissions, so it is created for the owner alone and
+	// only opened up to UNIX_SOCKET_MODE afterwards, leaving no moment when others may connect
+	restore := ownerOnlyUmask()
+	listener, err := net.Listen("unix", path)
+	restore()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
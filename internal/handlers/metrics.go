@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"receipt-processor/internal/service"
+)
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	// bytes counts the body written, for the access log
+	bytes int64
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, for flushing streamed responses
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Hijack lets WebSocket handlers take over the connection, which is logged as switching protocols
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err == nil {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// metrics records request and error counts for every request
+func (s *Server) metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, req)
+		s.svc.RecordRequestMetrics(s.svc.Now(), recorder.status)
+	})
+}
+
+// chartBar is one bar of a dashboard chart, already scaled to the chart height
+type chartBar struct {
+	X, Y, Height int
+	Label        string
+}
+
+// chart is a titled bar chart rendered as inline SVG
+type chart struct {
+	Title string
+	Max   int
+	Bars  []chartBar
+}
+
+const chartHeight = 120
+
+// buildChart scales one metric of the series into a chart
+func buildChart(title string, series []service.MinuteBucket, value func(service.MinuteBucket) int) chart {
+	c := chart{Title: title}
+	for _, bucket := range series {
+		if v := value(bucket); v > c.Max {
+			c.Max = v
+		}
+	}
+	for i, bucket := range series {
+		v := value(bucket)
+		height := 0
+		if c.Max > 0 {
+			height = v * chartHeight / c.Max
+		}
+		c.Bars = append(c.Bars, chartBar{
+			X:      i * 10,
+			Y:      chartHeight - height,
+			Height: height,
+			Label:  time.Unix(bucket.Minute*60, 0).Format("15:04") + ": " + strconv.Itoa(v),
+		})
+	}
+	return c
+}
+
+// AdminMetricsHandler renders a server-side dashboard of recent activity, or answers with the series
+// itself to clients that prefer JSON
+func (s *Server) AdminMetricsHandler(w http.ResponseWriter, req *http.Request) {
+	series := s.svc.MetricsSeries()
+	w.Header().Add("Vary", "Accept")
+	if negotiate(req, mediaHTML, mediaJSON) == mediaJSON {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(series)
+		return
+	}
+	data := struct {
+		Build  service.BuildInfo
+		Window int
+		Charts []chart
+	}{
+		Build:  service.CurrentBuildInfo(),
+		Window: service.MetricsWindow,
+		Charts: []chart{
+			buildChart("Receipts/min", series, func(b service.MinuteBucket) int { return b.Receipts }),
+			buildChart("Points/min", series, func(b service.MinuteBucket) int { return b.Points }),
+			buildChart("Errors/min", series, func(b service.MinuteBucket) int { return b.Errors }),
+			buildChart("Error rate (%)", series, func(b service.MinuteBucket) int {
+				if b.Requests == 0 {
+					return 0
+				}
+				return b.Errors * 100 / b.Requests
+			}),
+			buildChart("Batch queue depth (peak)", series, func(b service.MinuteBucket) int { return b.QueueDepth }),
+			buildChart("Store outage buffer depth (peak)", series, func(b service.MinuteBucket) int { return b.Buffered }),
+			buildChart("Duplicates blocked/min", series, func(b service.MinuteBucket) int { return b.Blocked }),
+			buildChart("Near-duplicates flagged/min", series, func(b service.MinuteBucket) int { return b.Flagged }),
+			buildChart("Receipts purged/min", series, func(b service.MinuteBucket) int { return b.Purged }),
+			buildChart("Webhook deliveries dropped/min", series, func(b service.MinuteBucket) int { return b.WebhooksDropped }),
+		},
+	}
+	s.renderPage(w, "dashboard.html", data)
+}
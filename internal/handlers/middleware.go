@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/internal/config"
+	"receipt-processor/internal/service"
+)
+
+// defaultMiddleware is the order middleware wraps the routes in, outermost first. Logging and metrics
+// come before recovery so that they see the 500 a panic is answered with.
+var defaultMiddleware = []string{"accesslog", "logging", "metrics", "recovery", "timeout", "ratelimit", "auth", "csrf", "rbac"}
+
+// middlewareChain builds the middleware named by MIDDLEWARE, in order, from the available ones.
+// Unknown names are logged and skipped; accesslog, auth, rbac and ratelimit do nothing until they are configured.
+// csrf only checks requests from browsers. The server is open when auth runs ahead of rbac without any
+// keys or OIDC to check; rbac makes every other request without a role read-only, so that leaving auth
+// out of MIDDLEWARE does not make anonymous requests admins.
+func (s *Server) middlewareChain() []mux.MiddlewareFunc {
+	names := config.List("MIDDLEWARE", defaultMiddleware)
+	open := false
+	for _, name := range names {
+		if name == "rbac" {
+			break
+		}
+		if name == "auth" {
+			open = len(configuredAPIKeys()) == 0 && s.oidc == nil
+		}
+	}
+	available := map[string]func() mux.MiddlewareFunc{
+		"accesslog": s.accessLog,
+		"logging":   func() mux.MiddlewareFunc { return s.logging },
+		"metrics":   func() mux.MiddlewareFunc { return s.metrics },
+		"recovery":  func() mux.MiddlewareFunc { return s.recovery },
+		"timeout":   timeout,
+		"ratelimit": s.rateLimit,
+		"auth":      s.auth,
+		"csrf":      csrf,
+		"rbac":      func() mux.MiddlewareFunc { return rbac(open) },
+	}
+	var chain []mux.MiddlewareFunc
+	for _, name := range names {
+		build, ok := available[name]
+		if !ok {
+			s.logger.Printf("Ignoring unknown middleware %q in MIDDLEWARE", name)
+			continue
+		}
+		chain = append(chain, build())
+	}
+	return chain
+}
+
+// logging logs the method, path, status and duration of every request
+func (s *Server) logging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := s.svc.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, req)
+		s.logger.Printf("%s %s %d %s", req.Method, req.URL.Path, recorder.status, s.svc.Now().Sub(start).Round(time.Microsecond))
+	})
+}
+
+// recovery answers with 500 instead of dropping the connection when a handler panics, and logs the
+// panic with its stack. With SENTRY_DSN set it also reports panics and 5xx responses there.
+func (s *Server) recovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var recorder *errorRecorder
+		if s.reporter != nil {
+			recorder = &errorRecorder{statusRecorder: statusRecorder{ResponseWriter: w, status: http.StatusOK}}
+			w = recorder
+		}
+		defer func() {
+			err := recover()
+			if err == nil {
+				if recorder != nil && recorder.status >= 500 {
+					s.reporter.reportResponse(req, recorder.status, string(recorder.body), recorder.stack)
+				}
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			s.logger.Printf("Panic serving %s %s: %v\n%s", req.Method, req.URL.Path, err, debug.Stack())
+			if s.reporter != nil {
+				s.reporter.reportPanic(req, err)
+			}
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, req)
+	})
+}
+
+// timeout gives every request REQUEST_TIMEOUT (default 1m, 0 disables) to finish. The deadline is set
+// on the request context, which the store and everything else a handler waits on give up with.
+func timeout() mux.MiddlewareFunc {
+	limit := config.Duration("REQUEST_TIMEOUT", time.Minute)
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx, cancel := context.WithTimeout(req.Context(), limit)
+			defer cancel()
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
+
+// publicPaths, and the static assets and sign-in routes, are served without an API key even when
+// AUTH_API_KEYS is set. With OIDC the home page needs a session too.
+var publicPaths = map[string]bool{
+	"/":             true,
+	"/version":      true,
+	"/openapi.json": true,
+	"/docs":         true,
+}
+
+// auth requires one of the AUTH_API_KEYS, or a key of TENANT_API_KEYS or API_KEY_ROLES, on every request
+// but the public pages, as "Authorization: Bearer <key>", "X-API-Key: <key>" or the password of HTTP basic
+// auth, which lets browsers sign in to the admin pages. Without keys every request is let through. Either
+// way it names the request's actor for the audit log. With OIDC_ISSUER, a browser session is accepted in
+// place of a key, and browsers asking for a page without either are sent to sign in. Behind mutual TLS a
+// verified client certificate is accepted too. The user a key is bound to by API_KEY_USERS, or the subject
+// of a session, is the one /users/me stands for.
+func (s *Server) auth() mux.MiddlewareFunc {
+	keys, keyUsers := configuredAPIKeys(), apiKeyUsers()
+	// withKeyUser binds the request to the user of its key, if it has one
+	withKeyUser := func(ctx context.Context, key string) context.Context {
+		if user, ok := keyBinding(keyUsers, key); ok {
+			return withUser(ctx, user)
+		}
+		return ctx
+	}
+	return func(next http.Handler) http.Handler {
+		if len(keys) == 0 && s.oidc == nil {
+			return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				actor := requestActor(req, "")
+				if identity, ok := certIdentity(req); ok {
+					actor = certActor(identity)
+				}
+				ctx := withKeyUser(service.WithActor(req.Context(), actor), requestAPIKey(req))
+				next.ServeHTTP(w, req.WithContext(ctx))
+			})
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if key := requestAPIKey(req); validAPIKey(keys, key) {
+				next.ServeHTTP(w, req.WithContext(withKeyUser(service.WithActor(req.Context(), requestActor(req, key)), key)))
+				return
+			}
+			if identity, ok := certIdentity(req); ok {
+				next.ServeHTTP(w, req.WithContext(service.WithActor(req.Context(), certActor(identity))))
+				return
+			}
+			if sess, ok := s.oidc.sessionOf(req, s.svc.Now()); ok {
+				ctx := withUser(withSession(service.WithActor(req.Context(), sess.actor()), sess), sess.Subject)
+				next.ServeHTTP(w, req.WithContext(ctx))
+				return
+			}
+			if publicPaths[req.URL.Path] && !(req.URL.Path == "/" && s.oidc != nil) ||
+				strings.HasPrefix(req.URL.Path, "/static/") || strings.HasPrefix(req.URL.Path, "/auth/") {
+				next.ServeHTTP(w, req)
+				return
+			}
+			if s.oidc != nil && req.Method == http.MethodGet && negotiate(req, mediaJSON, mediaHTML) == mediaHTML {
+				http.Redirect(w, req, basePath()+"/auth/login?next="+url.QueryEscape(req.URL.RequestURI()), http.StatusFound)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="receipt-processor"`)
+			w.Header().Add("WWW-Authenticate", `Basic realm="receipt-processor"`)
+			http.Error(w, "Missing or invalid API key", http.StatusUnauthorized)
+		})
+	}
+}
+
+// configuredAPIKeys lists every key auth accepts: AUTH_API_KEYS and the keys of TENANT_API_KEYS and
+// API_KEY_ROLES
+func configuredAPIKeys() []string {
+	keys := config.List("AUTH_API_KEYS", nil)
+	for key := range tenantAPIKeys() {
+		keys = append(keys, key)
+	}
+	for key := range config.Map("API_KEY_ROLES") {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// requestAPIKey returns the API key a request carries, if any
+func requestAPIKey(req *http.Request) string {
+	if token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if _, password, ok := req.BasicAuth(); ok {
+		return password
+	}
+	return req.Header.Get("X-API-Key")
+}
+
+// requestActor names who is making a request: the basic auth user name if there is one, and the API key
+// it was authenticated with, by a fingerprint that does not reveal the key
+func requestActor(req *http.Request, key string) string {
+	user, _, _ := req.BasicAuth()
+	if key == "" {
+		if user == "" {
+			return "anonymous"
+		}
+		return user
+	}
+	sum := sha256.Sum256([]byte(key))
+	fingerprint := "key:" + hex.EncodeToString(sum[:4])
+	if user == "" {
+		return fingerprint
+	}
+	return user + " (" + fingerprint + ")"
+}
+
+// validAPIKey compares in constant time, so response times do not leak how much of a key matched
+func validAPIKey(keys []string, key string) bool {
+	if key == "" {
+		return false
+	}
+	valid := false
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// tokenBucket is one client's rate limit state
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimit allows each client IP RATE_LIMIT requests per second on average, in bursts of up to
+// RATE_LIMIT_BURST (default: twice the rate), and answers the rest with 429. Zero disables it.
+func (s *Server) rateLimit() mux.MiddlewareFunc {
+	rate := config.Float("RATE_LIMIT", 0)
+	burst := config.Float("RATE_LIMIT_BURST", 2*rate)
+	if burst < 1 {
+		burst = 1
+	}
+	var (
+		mu      sync.Mutex
+		buckets = make(map[string]*tokenBucket)
+		swept   = s.svc.Now()
+	)
+	allow := func(client string, now time.Time) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		// Buckets idle long enough to have refilled are dropped, so the map does not grow with every client ever seen
+		if now.Sub(swept) > time.Minute {
+			for key, bucket := range buckets {
+				if now.Sub(bucket.last).Seconds()*rate >= burst {
+					delete(buckets, key)
+				}
+			}
+			swept = now
+		}
+		bucket, ok := buckets[client]
+		if !ok {
+			bucket = &tokenBucket{tokens: burst, last: now}
+			buckets[client] = bucket
+		}
+		bucket.tokens += now.Sub(bucket.last).Seconds() * rate
+		if bucket.tokens > burst {
+			bucket.tokens = burst
+		}
+		bucket.last = now
+		if bucket.tokens < 1 {
+			return false
+		}
+		bucket.tokens--
+		return true
+	}
+	return func(next http.Handler) http.Handler {
+		if rate <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if !allow(clientIP(req), s.svc.Now()) {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
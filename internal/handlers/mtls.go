@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"receipt-processor/internal/config"
+)
+
+// TLSConfig is the TLS setup of the API listener: HTTPS with TLS_CERT_FILE and TLS_KEY_FILE, and mutual
+// TLS when TLS_CLIENT_CA_FILE is set too, which requires every client to present a certificate signed by
+// that CA. It returns nil for plain HTTP. Unlike most settings, a broken one is an error: the server must
+// not fall back to accepting what it was configured to refuse.
+func TLSConfig() (*tls.Config, error) {
+	certFile, keyFile, caFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE"), os.Getenv("TLS_CLIENT_CA_FILE")
+	if certFile == "" && keyFile == "" {
+		if caFile != "" {
+			return nil, errors.New("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
+		}
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	certs := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := certs.load(); err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.getCertificate,
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("TLS_CLIENT_CA_FILE %s holds no PEM certificates", caFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// certReloader serves the server certificate from its files, loading them again when they change, so
+// short-lived certificates can be rotated without a restart
+type certReloader struct {
+	certFile, keyFile string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modified time.Time
+}
+
+// load reads the certificate again if either file changed since it was last read
+func (r *certReloader) load() (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var modified time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			if r.cert != nil {
+				return r.cert, nil
+			}
+			return nil, err
+		}
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+	}
+	if r.cert != nil && !modified.After(r.modified) {
+		return r.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			// A rotation caught half-written keeps the previous certificate until the next handshake
+			log.Printf("Keeping the current TLS certificate: %v", err)
+			return r.cert, nil
+		}
+		return nil, err
+	}
+	r.cert, r.modified = &cert, modified
+	return r.cert, nil
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.load()
+}
+
+// certIdentity names the verified client certificate of a request: its first URI SAN, like a SPIFFE ID,
+// or else its subject common name
+func certIdentity(req *http.Request) (string, bool) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	cert := req.TLS.VerifiedChains[0][0]
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String(), true
+	}
+	return cert.Subject.CommonName, cert.Subject.CommonName != ""
+}
+
+// certActor names a client certificate in the audit log
+func certActor(identity string) string {
+	return "cert:" + identity
+}
+
+// certTenants reads MTLS_TENANTS, identity=tenant pairs binding client certificates to a tenant
+func certTenants() map[string]string {
+	return config.Map("MTLS_TENANTS")
+}
+
+// certRoles reads MTLS_ROLES, identity=role pairs. Like API_KEY_ROLES, an unknown role is logged and
+// read-only, and so are certificates without a role.
+func certRoles() map[string]string {
+	roles := config.Map("MTLS_ROLES")
+	for identity, role := range roles {
+		if roleAccess[role] == nil {
+			log.Printf("Unknown role %q in MTLS_ROLES, giving %s the %s role", role, identity, roleReadOnly)
+			roles[identity] = roleReadOnly
+		}
+	}
+	return roles
+}
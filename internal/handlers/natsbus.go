@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+
+	"receipt-processor/internal/config"
+	"receipt-processor/internal/service"
+	"receipt-processor/internal/store"
+)
+
+// natsSubmitSubjects reads the subjects receipts are submitted on and the tenant each one submits for:
+// NATS_SUBMIT_SUBJECT for NATS_SUBMIT_TENANT, the default tenant when unset, and NATS_TENANT_SUBJECTS,
+// tenant=subject pairs, for a subject per tenant. Publishers cannot pick the tenant themselves, since
+// anyone who may publish on a subject could otherwise write to every tenant.
+func natsSubmitSubjects() map[string]string {
+	subjects := make(map[string]string)
+	if subject := os.Getenv("NATS_SUBMIT_SUBJECT"); subject != "" {
+		tenant := os.Getenv("NATS_SUBMIT_TENANT")
+		if tenant == "" {
+			tenant = service.DefaultTenant
+		}
+		subjects[subject] = tenant
+	}
+	for tenant, subject := range config.Map("NATS_TENANT_SUBJECTS") {
+		subjects[subject] = tenant
+	}
+	return subjects
+}
+
+// StartNATS connects to NATS_URL, publishes every event under NATS_SUBJECT_PREFIX and processes the
+// receipts published to the submission subjects of natsSubmitSubjects
+func (s *Server) StartNATS() {
+	url := os.Getenv("NATS_URL")
+	if url == "" {
+		return
+	}
+	conn, err := nats.Connect(url, nats.Name("receipt-processor"), nats.MaxReconnects(-1))
+	if err != nil {
+		s.logger.Fatalf("Failed to connect to NATS at %s: %v", url, err)
+	}
+
+	prefix := os.Getenv("NATS_SUBJECT_PREFIX")
+	if prefix == "" {
+		prefix = "receipts"
+	}
+	s.svc.SubscribeEvents(func(event service.Event) {
+		data, err := json.Marshal(s.svc.RedactEvent(event))
+		if err != nil {
+			s.logger.Printf("Failed to encode %s event: %v", event.Type, err)
+			return
+		}
+		// receipt.processed is published on <prefix>.processed, and so on
+		subject := prefix + "." + strings.TrimPrefix(event.Type, "receipt.")
+		if err := conn.Publish(subject, data); err != nil {
+			s.logger.Printf("Failed to publish %s event to NATS: %v", event.Type, err)
+		}
+	})
+
+	for subject, tenant := range natsSubmitSubjects() {
+		tenant := tenant
+		handler := func(msg *nats.Msg) { s.handleNATSSubmission(tenant, msg) }
+		if _, err := conn.QueueSubscribe(subject, service.NATSQueueGroup, handler); err != nil {
+			s.logger.Fatalf("Failed to subscribe to NATS subject %s: %v", subject, err)
+		}
+		s.logger.Printf("Consuming receipt submissions for tenant %s from NATS subject %s", tenant, subject)
+	}
+}
+
+// handleNATSSubmission processes a receipt published on the submissions subject of a tenant,
+// answering with the ID and points when the publisher asked for a reply
+func (s *Server) handleNATSSubmission(tenant string, msg *nats.Msg) {
+	reply := s.processNATSSubmission(tenant, msg)
+	if reply.Error != "" {
+		s.logger.Printf("Rejected receipt from NATS subject %s: %s", msg.Subject, reply.Error)
+	}
+	if msg.Reply != "" {
+		data, _ := json.Marshal(reply)
+		msg.Respond(data)
+	}
+}
+
+// processNATSSubmission decodes, validates and stores a receipt published for a tenant. A message
+// naming another tenant in its X-Tenant-ID header is refused rather than stored for either.
+func (s *Server) processNATSSubmission(tenant string, msg *nats.Msg) service.NATSReply {
+	if named := msg.Header.Get(tenantHeader); named != "" && named != tenant {
+		return service.NATSReply{Status: http.StatusForbidden, Error: "Submissions on " + msg.Subject + " are for tenant " + tenant}
+	}
+	var receipt store.Receipt
+	if err := strictUnmarshal(bytes.NewReader(msg.Data), &receipt); err != nil {
+		return service.NATSReply{Status: http.StatusBadRequest, Error: "Failed to decode receipt: " + err.Error()}
+	}
+	receipt.Channel = service.ChannelNATS
+	receipt, err := s.svc.ProcessReceipt(context.Background(), tenant, receipt)
+	var dup *service.DuplicateError
+	switch {
+	case errors.As(err, &dup):
+		return service.NATSReply{Status: http.StatusConflict, Error: "Duplicate of receipt " + dup.ExistingID}
+	case errors.Is(err, service.ErrInvalidReceipt):
+		return service.NATSReply{Status: http.StatusBadRequest, Error: err.Error()}
+	case err != nil && !errors.Is(err, service.ErrReceiptBuffered):
+		return service.NATSReply{Status: http.StatusServiceUnavailable, Error: err.Error()}
+	}
+	return service.NATSReply{ID: receipt.ID, Points: s.points(receipt)}
+}
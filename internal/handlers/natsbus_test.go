@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestNATSSubmission(t *testing.T) {
+	s := NewServer(newTestService(), log.New(io.Discard, "", 0))
+	tests := []struct {
+		name       string
+		body       string
+		tenant     string
+		wantStatus int
+	}{
+		{"valid", targetReceipt, "", 0},
+		{"naming the subject's tenant", cornerMarketReceipt, "acme", 0},
+		{"naming another tenant", targetReceipt, "globex", http.StatusForbidden},
+		{"unknown field", `{"retailer": "Target", "store": 7}`, "", http.StatusBadRequest},
+		{"invalid", strings.Replace(targetReceipt, `"2022-01-01"`, `"2022-13-01"`, 1), "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := nats.NewMsg("receipts.submit")
+			msg.Data = []byte(tt.body)
+			if tt.tenant != "" {
+				msg.Header.Set(tenantHeader, tt.tenant)
+			}
+			reply := s.processNATSSubmission("acme", msg)
+			if reply.Status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", reply.Status, tt.wantStatus, reply.Error)
+			}
+			if tt.wantStatus == 0 && reply.ID == "" {
+				t.Errorf("reply has no receipt ID")
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"receipt-processor/internal/service"
+)
+
+// maxNDJSONLineSize bounds a single receipt line of a bulk upload; the body itself is unbounded
+const maxNDJSONLineSize = 1 << 20
+
+// ndjsonContentType is the media type of newline-delimited JSON
+const ndjsonContentType = "application/x-ndjson"
+
+// BulkNDJSONEndpoint streams receipts in as newline-delimited JSON, one Receipt per line, and streams
+// back one result line per receipt as soon as it is processed, so uploads of any size never sit in memory
+func (s *Server) BulkNDJSONEndpoint(w http.ResponseWriter, req *http.Request) {
+	if !strings.HasPrefix(req.Header.Get("Content-Type"), ndjsonContentType) {
+		http.Error(w, "Bulk uploads must be sent as "+ndjsonContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// Results are written while the body is still being read, which HTTP/1.x needs full duplex for
+	controller := http.NewResponseController(w)
+	controller.EnableFullDuplex()
+
+	tenant := tenantFromRequest(req)
+	channel := submissionChannel(req, service.ChannelBulk)
+	w.Header().Set("Content-Type", ndjsonContentType)
+	encoder := json.NewEncoder(w)
+
+	scanner := bufio.NewScanner(req.Body)
+	scanner.Buffer(make([]byte, 64<<10), maxNDJSONLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		entry := service.CSVReceipt{Line: line}
+		if err := strictUnmarshal(bytes.NewReader(data), &entry.Receipt); err != nil {
+			entry.Err = errors.New("failed to decode receipt: " + err.Error())
+		}
+		encoder.Encode(s.svc.ImportReceipt(req.Context(), tenant, channel, entry))
+		controller.Flush()
+	}
+	if err := scanner.Err(); err != nil {
+		// The stream is already under way, so the failure is reported as a last result line
+		encoder.Encode(service.ImportResult{Row: line + 1, Error: "failed to read upload: " + err.Error()})
+	}
+}
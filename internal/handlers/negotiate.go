@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"receipt-processor/internal/store"
+)
+
+// The representations read endpoints negotiate between
+const (
+	mediaJSON = "application/json"
+	mediaHTML = "text/html"
+	mediaCSV  = "text/csv"
+)
+
+// negotiate picks the offered media type the request's Accept header prefers, by q-value and then by the
+// order of the offers, so a missing Accept header or */* gets the first one. It returns "" when the
+// client accepts none of them.
+func negotiate(req *http.Request, offers ...string) string {
+	accept := req.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(accept, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// acceptQuality is the q-value an Accept header gives a media type, taken from the most specific media
+// range that matches it
+func acceptQuality(accept, media string) float64 {
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mediaRange := strings.ToLower(strings.TrimSpace(fields[0]))
+		level := -1
+		switch {
+		case mediaRange == media:
+			level = 2
+		case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(media, strings.TrimSuffix(mediaRange, "*")):
+			level = 1
+		case mediaRange == "*/*":
+			level = 0
+		}
+		if level <= specificity {
+			continue
+		}
+		specificity, q = level, 1
+		for _, param := range fields[1:] {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+	}
+	return q
+}
+
+// table is a read endpoint's response flattened into rows, for its HTML and CSV representations
+type table struct {
+	Title   string
+	Columns []string
+	Rows    [][]string
+}
+
+// writeNegotiated answers a read endpoint with v as JSON, or with the table as an HTML page or CSV, as the
+// Accept header prefers; the table is only built for those. Clients accepting none of them get 406.
+func (s *Server) writeNegotiated(w http.ResponseWriter, req *http.Request, v interface{}, rows func() table) {
+	w.Header().Add("Vary", "Accept")
+	switch media := negotiate(req, mediaJSON, mediaHTML, mediaCSV); media {
+	case mediaJSON:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	case mediaHTML, mediaCSV:
+		s.writeTable(w, media, rows())
+	default:
+		writeNotAcceptable(w)
+	}
+}
+
+// writeTable answers with a table as an HTML page or as CSV
+func (s *Server) writeTable(w http.ResponseWriter, media string, t table) {
+	if media == mediaHTML {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		s.renderPage(w, "table.html", t)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	writer := csv.NewWriter(w)
+	writer.Write(t.Columns)
+	writer.WriteAll(t.Rows)
+}
+
+// writeNotAcceptable answers 406 to a client accepting none of the representations of a read endpoint
+func writeNotAcceptable(w http.ResponseWriter) {
+	http.Error(w, "Acceptable representations are application/json, text/html and text/csv", http.StatusNotAcceptable)
+}
+
+// recordTable flattens listing records into a table of the given columns
+func recordTable(title string, columns []string, records []map[string]interface{}) table {
+	t := table{Title: title, Columns: columns, Rows: make([][]string, len(records))}
+	for i, record := range records {
+		row := make([]string, len(columns))
+		for j, column := range columns {
+			row[j] = cell(record[column])
+		}
+		t.Rows[i] = row
+	}
+	return t
+}
+
+// cell renders one field of a record as table text; items are counted
+func cell(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case []string:
+		return strings.Join(value, ";")
+	case []store.ReceiptItem:
+		return strconv.Itoa(len(value))
+	case *time.Time:
+		if value == nil {
+			return ""
+		}
+		return value.Format(time.RFC3339)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"receipt-processor/internal/service"
+)
+
+// maxOCRImageSize bounds the size of an uploaded receipt image
+const maxOCRImageSize = 10 << 20
+
+// ProcessOCRReceiptEndpoint accepts a receipt image (multipart field "image"), recognizes it with
+// the tenant's OCR language packs and processes the resulting receipt. ?lang=spa+eng overrides the packs.
+func (s *Server) ProcessOCRReceiptEndpoint(w http.ResponseWriter, req *http.Request) {
+	req.Body = http.MaxBytesReader(w, req.Body, maxOCRImageSize)
+	file, _, err := req.FormFile("image")
+	if err != nil {
+		http.Error(w, "Failed to read image upload", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	image, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Failed to read image upload", http.StatusBadRequest)
+		return
+	}
+
+	tenant := tenantFromRequest(req)
+	languages := service.SplitLanguages(req.URL.Query().Get("lang"))
+	if len(languages) == 0 {
+		languages = s.svc.OCRLanguages(tenant)
+	}
+	text, language, err := s.svc.RecognizeReceipt(image, languages)
+	if err != nil {
+		http.Error(w, "OCR failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	receipt, err := service.ParseReceiptText(text)
+	if err != nil {
+		http.Error(w, "Failed to parse receipt: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	receipt.Channel = submissionChannel(req, service.ChannelOCR)
+	receipt, err = s.svc.ProcessReceipt(req.Context(), tenant, receipt)
+	s.writeProcessedJSON(w, receipt, err, map[string]interface{}{"language": language})
+}
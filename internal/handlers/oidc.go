@@ -0,0 +1,476 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"receipt-processor/internal/config"
+)
+
+const (
+	// sessionCookie holds the signed session of a signed-in browser
+	sessionCookie = "receipt_session"
+	// loginCookie holds the state of a login in progress, between /auth/login and /auth/callback
+	loginCookie = "receipt_login"
+	// loginTimeout is how long a user has to sign in at the provider
+	loginTimeout = 10 * time.Minute
+)
+
+// oidcProvider signs browsers in with an OpenID Connect provider, by the authorization code flow with
+// PKCE, and keeps them signed in with a session cookie signed by the server. API clients keep using API keys.
+type oidcProvider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       string
+	secret       []byte
+	ttl          time.Duration
+	secure       bool
+	roles        map[string]string
+	defaultRole  string
+	tenants      map[string]string
+	insecure     bool
+	client       *http.Client
+
+	// endpoints are discovered from the issuer on the first login
+	mu        sync.Mutex
+	endpoints *oidcEndpoints
+}
+
+// oidcEndpoints is the part of the provider's discovery document the login needs
+type oidcEndpoints struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+}
+
+// session is who a browser is signed in as, and until when
+type session struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Role    string `json:"role"`
+	// Tenant is the tenant OIDC_TENANTS binds the user to; empty for the default tenant
+	Tenant  string `json:"tenant,omitempty"`
+	Expires int64  `json:"exp"`
+}
+
+// loginState ties a callback to the login that started it
+type loginState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Next     string `json:"next"`
+	Expires  int64  `json:"exp"`
+}
+
+// newOIDCProvider reads the OIDC_* settings. It returns nil, leaving browsers to API keys, without
+// OIDC_ISSUER, and when a required setting is missing, which is logged.
+func newOIDCProvider(logger *log.Logger) *oidcProvider {
+	issuer := strings.TrimSuffix(os.Getenv("OIDC_ISSUER"), "/")
+	if issuer == "" {
+		return nil
+	}
+	p := &oidcProvider{
+		issuer:       issuer,
+		clientID:     os.Getenv("OIDC_CLIENT_ID"),
+		clientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		redirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		scopes:       strings.Join(config.List("OIDC_SCOPES", []string{"openid", "email", "profile"}), " "),
+		ttl:          config.Duration("SESSION_TTL", 12*time.Hour),
+		roles:        config.Map("OIDC_ROLES"),
+		defaultRole:  os.Getenv("OIDC_DEFAULT_ROLE"),
+		tenants:      config.Map("OIDC_TENANTS"),
+		insecure:     config.Bool("OIDC_ALLOW_INSECURE", false),
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+	if p.clientID == "" || p.redirectURL == "" {
+		logger.Printf("Ignoring OIDC_ISSUER: OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required")
+		return nil
+	}
+	if !p.insecure && !httpsURL(issuer) {
+		logger.Printf("Ignoring OIDC_ISSUER %q: the issuer must be https, unless OIDC_ALLOW_INSECURE is set", issuer)
+		return nil
+	}
+	if p.insecure {
+		logger.Printf("OIDC_ALLOW_INSECURE is set: ID tokens may come over plain HTTP, which is only fit for local development")
+	}
+	redirect, err := url.Parse(p.redirectURL)
+	if err != nil || redirect.Host == "" {
+		logger.Printf("Ignoring OIDC_ISSUER: invalid OIDC_REDIRECT_URL %q", p.redirectURL)
+		return nil
+	}
+	p.secure = redirect.Scheme == "https"
+	if p.defaultRole == "" {
+		p.defaultRole = roleReadOnly
+	}
+	for email, role := range p.roles {
+		if roleAccess[role] == nil {
+			logger.Printf("Unknown role %q in OIDC_ROLES, giving %s the %s role", role, email, roleReadOnly)
+			p.roles[email] = roleReadOnly
+		}
+	}
+	if roleAccess[p.defaultRole] == nil {
+		logger.Printf("Ignoring unknown OIDC_DEFAULT_ROLE %q, using %s", p.defaultRole, roleReadOnly)
+		p.defaultRole = roleReadOnly
+	}
+	if secret := os.Getenv("SESSION_SECRET"); secret != "" {
+		p.secret = []byte(secret)
+	} else {
+		// Without a shared secret sessions end when the server restarts, and only work with one server
+		p.secret = make([]byte, 32)
+		rand.Read(p.secret)
+		logger.Printf("SESSION_SECRET is not set: browser sessions end when the server restarts")
+	}
+	return p
+}
+
+// discover fetches the provider's endpoints once, retrying on the next login after a failure
+func (p *oidcProvider) discover(ctx context.Context) (*oidcEndpoints, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.endpoints != nil {
+		return p.endpoints, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery answered %s", resp.Status)
+	}
+	var endpoints oidcEndpoints
+	if err := json.NewDecoder(resp.Body).Decode(&endpoints); err != nil {
+		return nil, fmt.Errorf("invalid discovery document: %v", err)
+	}
+	if strings.TrimSuffix(endpoints.Issuer, "/") != p.issuer || endpoints.AuthorizationEndpoint == "" || endpoints.TokenEndpoint == "" {
+		return nil, fmt.Errorf("discovery document of %s does not describe it", p.issuer)
+	}
+	if !p.insecure && (!httpsURL(endpoints.AuthorizationEndpoint) || !httpsURL(endpoints.TokenEndpoint)) {
+		return nil, fmt.Errorf("discovery document of %s names endpoints that are not https", p.issuer)
+	}
+	p.endpoints = &endpoints
+	return p.endpoints, nil
+}
+
+// httpsURL reports whether raw is an absolute https URL
+func httpsURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+// LoginHandler sends the browser to the provider to sign in, and back to ?next= afterwards
+func (s *Server) LoginHandler(w http.ResponseWriter, req *http.Request) {
+	p := s.oidc
+	endpoints, err := p.discover(req.Context())
+	if err != nil {
+		s.logger.Printf("OIDC discovery failed: %v", err)
+		http.Error(w, "Sign-in provider unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	state := loginState{
+		State:    randomToken(),
+		Nonce:    randomToken(),
+		Verifier: randomToken(),
+		Next:     localPath(req.URL.Query().Get("next")),
+		Expires:  s.svc.Now().Add(loginTimeout).Unix(),
+	}
+	p.setCookie(w, loginCookie, p.sign(state), "/auth/", loginTimeout)
+
+	challenge := sha256.Sum256([]byte(state.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.clientID},
+		"redirect_uri":          {p.redirectURL},
+		"scope":                 {p.scopes},
+		"state":                 {state.State},
+		"nonce":                 {state.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(endpoints.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	http.Redirect(w, req, endpoints.AuthorizationEndpoint+separator+query.Encode(), http.StatusFound)
+}
+
+// CallbackHandler finishes a login: it exchanges the code for an ID token, checks the token and starts
+// the session
+func (s *Server) CallbackHandler(w http.ResponseWriter, req *http.Request) {
+	p := s.oidc
+	var state loginState
+	cookie, err := req.Cookie(loginCookie)
+	if err != nil || !p.verify(cookie.Value, &state) || state.Expires < s.svc.Now().Unix() {
+		http.Error(w, "Login expired, please sign in again", http.StatusBadRequest)
+		return
+	}
+	p.setCookie(w, loginCookie, "", "/auth/", -1)
+	if subtle.ConstantTimeCompare([]byte(req.URL.Query().Get("state")), []byte(state.State)) != 1 {
+		http.Error(w, "Login state mismatch, please sign in again", http.StatusBadRequest)
+		return
+	}
+	if reason := req.URL.Query().Get("error"); reason != "" {
+		http.Error(w, "Sign-in failed: "+reason, http.StatusForbidden)
+		return
+	}
+	claims, err := p.exchange(req.Context(), req.URL.Query().Get("code"), state, s.svc.Now())
+	if err != nil {
+		s.logger.Printf("OIDC sign-in failed: %v", err)
+		http.Error(w, "Sign-in failed", http.StatusForbidden)
+		return
+	}
+	sess := session{Subject: claims.Subject, Name: claims.Name, Role: p.roleOf(claims), Tenant: p.tenantOf(claims), Expires: s.svc.Now().Add(p.ttl).Unix()}
+	if claims.emailVerified() {
+		sess.Email = claims.Email
+	}
+	p.setCookie(w, sessionCookie, p.sign(sess), "/", p.ttl)
+	http.Redirect(w, req, basePath()+state.Next, http.StatusFound)
+}
+
+// roleOf is the role OIDC_ROLES gives a user by verified email or subject, or OIDC_DEFAULT_ROLE
+func (p *oidcProvider) roleOf(claims idTokenClaims) string {
+	if role, ok := claimBinding(p.roles, claims); ok {
+		return role
+	}
+	return p.defaultRole
+}
+
+// tenantOf is the tenant OIDC_TENANTS binds a user to by verified email or subject, or "" for none
+func (p *oidcProvider) tenantOf(claims idTokenClaims) string {
+	tenant, _ := claimBinding(p.tenants, claims)
+	return tenant
+}
+
+// claimBinding looks a user up in an email=value or subject=value setting. Emails only count when the
+// provider says it verified them, since anyone can put any address in their account elsewhere.
+func claimBinding(bound map[string]string, claims idTokenClaims) (string, bool) {
+	if value, ok := bound[claims.Email]; ok && claims.Email != "" && claims.emailVerified() {
+		return value, true
+	}
+	value, ok := bound[claims.Subject]
+	return value, ok
+}
+
+// LogoutHandler ends the browser's session. It only takes POST, which the csrf middleware checks, so
+// that other sites cannot sign a browser out with a link or an image.
+func (s *Server) LogoutHandler(w http.ResponseWriter, req *http.Request) {
+	s.oidc.setCookie(w, sessionCookie, "", "/", -1)
+	http.Redirect(w, req, basePath()+"/", http.StatusSeeOther)
+}
+
+// idTokenClaims are the claims of an ID token the login checks and keeps
+type idTokenClaims struct {
+	Issuer        string          `json:"iss"`
+	Subject       string          `json:"sub"`
+	Audience      json.RawMessage `json:"aud"`
+	Expires       int64           `json:"exp"`
+	Nonce         string          `json:"nonce"`
+	Email         string          `json:"email"`
+	EmailVerified interface{}     `json:"email_verified"`
+	Name          string          `json:"name"`
+}
+
+// emailVerified reports whether the provider verified the email, by an email_verified claim that is true;
+// providers send it as a boolean or a string, and a missing claim is taken as unverified
+func (claims idTokenClaims) emailVerified() bool {
+	return claims.EmailVerified == true || claims.EmailVerified == "true"
+}
+
+// exchange trades an authorization code for the ID token and checks its claims. The token comes
+// straight from the token endpoint over TLS, which OpenID Connect Core 3.1.3.7 accepts in place of
+// checking its signature, so the provider's keys are not needed. That only holds because discovery
+// refuses a token endpoint that is not https, unless OIDC_ALLOW_INSECURE is set.
+func (p *oidcProvider) exchange(ctx context.Context, code string, state loginState, now time.Time) (idTokenClaims, error) {
+	var claims idTokenClaims
+	if code == "" {
+		return claims, errors.New("no authorization code")
+	}
+	endpoints, err := p.discover(ctx)
+	if err != nil {
+		return claims, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"client_id":     {p.clientID},
+		"code_verifier": {state.Verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoints.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return claims, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return claims, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return claims, fmt.Errorf("token endpoint answered %s", resp.Status)
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return claims, fmt.Errorf("invalid token response: %v", err)
+	}
+	parts := strings.Split(tokens.IDToken, ".")
+	if len(parts) != 3 {
+		return claims, errors.New("the token response has no ID token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, fmt.Errorf("invalid ID token: %v", err)
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, fmt.Errorf("invalid ID token: %v", err)
+	}
+	switch {
+	case strings.TrimSuffix(claims.Issuer, "/") != p.issuer:
+		return claims, fmt.Errorf("ID token issued by %q", claims.Issuer)
+	case !audienceIncludes(claims.Audience, p.clientID):
+		return claims, errors.New("ID token is for another client")
+	case claims.Expires < now.Unix():
+		return claims, errors.New("ID token expired")
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(state.Nonce)) != 1:
+		return claims, errors.New("ID token nonce mismatch")
+	case claims.Subject == "":
+		return claims, errors.New("ID token has no subject")
+	}
+	return claims, nil
+}
+
+// audienceIncludes reads the aud claim, a string or an array of them
+func audienceIncludes(aud json.RawMessage, clientID string) bool {
+	var one string
+	if json.Unmarshal(aud, &one) == nil {
+		return one == clientID
+	}
+	var many []string
+	if json.Unmarshal(aud, &many) != nil {
+		return false
+	}
+	for _, a := range many {
+		if a == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionOf returns the unexpired session a request's cookie holds. A nil provider has no sessions.
+func (p *oidcProvider) sessionOf(req *http.Request, now time.Time) (session, bool) {
+	var sess session
+	if p == nil {
+		return sess, false
+	}
+	cookie, err := req.Cookie(sessionCookie)
+	if err != nil || !p.verify(cookie.Value, &sess) || sess.Expires < now.Unix() {
+		return session{}, false
+	}
+	return sess, true
+}
+
+// actor names a session's user in the audit log
+func (sess session) actor() string {
+	if sess.Email != "" {
+		return "oidc:" + sess.Email
+	}
+	return "oidc:" + sess.Subject
+}
+
+type sessionContextKey struct{}
+
+// withSession stores the session a request was authenticated with in its context, for rbac
+func withSession(ctx context.Context, sess session) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, sess)
+}
+
+// sessionFromContext returns the session stored by withSession
+func sessionFromContext(ctx context.Context) (session, bool) {
+	sess, ok := ctx.Value(sessionContextKey{}).(session)
+	return sess, ok
+}
+
+// sign encodes a value as base64 JSON followed by its HMAC, so the browser can hold it but not change it
+func (p *oidcProvider) sign(value interface{}) string {
+	data, _ := json.Marshal(value)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(payload))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify decodes a value encoded by sign, reporting false when it was tampered with
+func (p *oidcProvider) verify(signed string, value interface{}) bool {
+	payload, signature, ok := strings.Cut(signed, ".")
+	if !ok {
+		return false
+	}
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(payload))
+	expected := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	return err == nil && json.Unmarshal(data, value) == nil
+}
+
+// setCookie sets an HttpOnly, SameSite=Lax cookie for a path under BASE_PATH, Secure when the server is
+// reached over HTTPS; a negative age deletes it
+func (p *oidcProvider) setCookie(w http.ResponseWriter, name, value, path string, age time.Duration) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     basePath() + path,
+		HttpOnly: true,
+		Secure:   p.secure,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(age.Seconds()),
+	}
+	if age < 0 {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+// randomToken is an unguessable value for the state, nonce and PKCE verifier of a login, and for CSRF tokens
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// localPath keeps a post-login redirect on this server: anything but a local path becomes "/"
+func localPath(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
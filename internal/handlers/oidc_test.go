@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClaimBinding(t *testing.T) {
+	bound := map[string]string{"alice@example.com": "acme", "sub-bob": "globex"}
+	tests := []struct {
+		name      string
+		claims    idTokenClaims
+		want      string
+		wantBound bool
+	}{
+		{"verified email", idTokenClaims{Subject: "sub-alice", Email: "alice@example.com", EmailVerified: true}, "acme", true},
+		{"verified as a string", idTokenClaims{Subject: "sub-alice", Email: "alice@example.com", EmailVerified: "true"}, "acme", true},
+		{"unverified email", idTokenClaims{Subject: "sub-alice", Email: "alice@example.com", EmailVerified: false}, "", false},
+		{"no email_verified claim", idTokenClaims{Subject: "sub-alice", Email: "alice@example.com"}, "", false},
+		{"subject", idTokenClaims{Subject: "sub-bob", Email: "alice@example.com"}, "globex", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := claimBinding(bound, tt.claims)
+			if got != tt.want || ok != tt.wantBound {
+				t.Errorf("claimBinding = %q, %v, want %q, %v", got, ok, tt.want, tt.wantBound)
+			}
+		})
+	}
+}
+
+func TestSessionTenant(t *testing.T) {
+	t.Setenv("OIDC_ISSUER", "https://accounts.example.com")
+	t.Setenv("OIDC_CLIENT_ID", "receipts")
+	t.Setenv("OIDC_REDIRECT_URL", "https://receipts.example.com/auth/callback")
+	t.Setenv("SESSION_SECRET", "test-secret")
+	s := NewServer(newTestService(), log.New(io.Discard, "", 0))
+	router := s.Router()
+	cookie := func(tenant string) *http.Cookie {
+		sess := session{Subject: "sub-alice", Role: roleReadOnly, Tenant: tenant, Expires: testNow.Unix() + 3600}
+		return &http.Cookie{Name: sessionCookie, Value: s.oidc.sign(sess)}
+	}
+
+	tests := []struct {
+		name       string
+		tenant     string
+		named      string
+		wantStatus int
+	}{
+		{"bound session", "acme", "", http.StatusOK},
+		{"bound session naming its tenant", "acme", "acme", http.StatusOK},
+		{"bound session naming another tenant", "acme", "default", http.StatusForbidden},
+		{"unbound session", "", "", http.StatusOK},
+		{"unbound session naming another tenant", "", "acme", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/receipts", nil)
+			req.AddCookie(cookie(tt.tenant))
+			if tt.named != "" {
+				req.Header.Set(tenantHeader, tt.named)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+
+	t.Run("logout over GET", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/auth/logout", nil)
+		req.AddCookie(cookie(""))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("status = %d, want 405", rec.Code)
+		}
+	})
+	t.Run("logout without the CSRF token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+		req.AddCookie(cookie(""))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("status = %d, want 403", rec.Code)
+		}
+	})
+}
+
+func TestOIDCRequiresHTTPS(t *testing.T) {
+	t.Setenv("OIDC_CLIENT_ID", "receipts")
+	t.Setenv("OIDC_REDIRECT_URL", "https://receipts.example.com/auth/callback")
+	logger := log.New(io.Discard, "", 0)
+
+	t.Setenv("OIDC_ISSUER", "http://accounts.example.com")
+	if p := newOIDCProvider(logger); p != nil {
+		t.Fatal("plain HTTP issuer accepted")
+	}
+	t.Setenv("OIDC_ALLOW_INSECURE", "true")
+	if p := newOIDCProvider(logger); p == nil {
+		t.Fatal("plain HTTP issuer refused with OIDC_ALLOW_INSECURE")
+	}
+
+	tests := []struct {
+		name          string
+		tokenEndpoint string
+		insecure      string
+		wantErr       bool
+	}{
+		{"https endpoints", "https://accounts.example.com/token", "", false},
+		{"plain HTTP token endpoint", "http://accounts.example.com/token", "", true},
+		{"plain HTTP token endpoint allowed", "http://accounts.example.com/token", "true", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var provider *httptest.Server
+			provider = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"issuer":%q,"authorization_endpoint":"https://accounts.example.com/authorize","token_endpoint":%q}`,
+					provider.URL, tt.tokenEndpoint)
+			}))
+			defer provider.Close()
+			t.Setenv("OIDC_ISSUER", provider.URL)
+			t.Setenv("OIDC_ALLOW_INSECURE", tt.insecure)
+			p := newOIDCProvider(logger)
+			if p == nil {
+				t.Fatal("provider not configured")
+			}
+			p.client = provider.Client()
+			_, err := p.discover(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("discover error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
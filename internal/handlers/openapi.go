@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec is the OpenAPI 3 document describing every endpoint
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// OpenAPIHandler serves the OpenAPI document
+func (s *Server) OpenAPIHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDocument())
+}
+
+// SwaggerUIHandler serves Swagger UI pointed at /openapi.json
+func (s *Server) SwaggerUIHandler(w http.ResponseWriter, req *http.Request) {
+	s.renderPage(w, "swagger.html", nil)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"receipt-processor/internal/service"
+)
+
+// maxPOSReceiptSize bounds the size of a POS receipt document
+const maxPOSReceiptSize = 1 << 20
+
+// posFormatForContentType picks a parser from the request content type
+func posFormatForContentType(contentType string) string {
+	switch {
+	case strings.Contains(contentType, "ld+json"):
+		return "jsonld"
+	case strings.Contains(contentType, "xml"):
+		return "arts"
+	}
+	return ""
+}
+
+// ProcessPOSReceiptEndpoint accepts a receipt in a POS vendor's native format, chosen with
+// ?format=arts|jsonld or from the content type, maps it into a Receipt and processes it
+func (s *Server) ProcessPOSReceiptEndpoint(w http.ResponseWriter, req *http.Request) {
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = posFormatForContentType(req.Header.Get("Content-Type"))
+	}
+	parse, ok := service.POSParsers[format]
+	if !ok {
+		http.Error(w, "Unsupported POS receipt format", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxPOSReceiptSize))
+	if err != nil {
+		http.Error(w, "Failed to read POS receipt", http.StatusBadRequest)
+		return
+	}
+	receipt, err := parse(data)
+	if err != nil {
+		http.Error(w, "Invalid POS receipt: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	receipt.Channel = submissionChannel(req, service.ChannelPOS)
+	receipt, err = s.svc.ProcessReceipt(req.Context(), tenantFromRequest(req), receipt)
+	s.writeProcessedJSON(w, receipt, err, nil)
+}
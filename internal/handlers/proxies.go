@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/internal/config"
+	"receipt-processor/internal/service"
+)
+
+// trustedProxies are the networks of TRUSTED_PROXIES, whose X-Forwarded-For and X-Real-IP are believed
+var trustedProxies = sync.OnceValue(func() []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, entry := range config.List("TRUSTED_PROXIES", nil) {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(entry)
+			if addrErr != nil {
+				log.Printf("Ignoring invalid TRUSTED_PROXIES entry %q: %v", entry, err)
+				continue
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+})
+
+// trustedProxy reports whether an address is one of TRUSTED_PROXIES
+func trustedProxy(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies() {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP is the address a request came from, without its port. Behind a proxy of TRUSTED_PROXIES it is
+// the client the proxies forwarded it for: the last X-Forwarded-For address not of a trusted proxy, as
+// the ones before it could be made up by the client, or else X-Real-IP. Requests over a Unix socket have
+// no address of their own and come from the reverse proxy in front of it, so that is trusted too. Forwarding
+// headers from anyone else are ignored.
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	} else if !trustedProxy(host) {
+		return host
+	}
+	var hops []string
+	for _, value := range req.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	client := ""
+	for i := len(hops) - 1; i >= 0; i-- {
+		if client = strings.TrimSpace(hops[i]); client != "" && !trustedProxy(client) {
+			return client
+		}
+	}
+	if client != "" {
+		// Every hop was a trusted proxy, so the first is as near to the client as it gets
+		return client
+	}
+	if real := strings.TrimSpace(req.Header.Get("X-Real-IP")); real != "" {
+		return real
+	}
+	return host
+}
+
+// clientAddress records the client's address in the context, for the audit log
+func clientAddress() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			next.ServeHTTP(w, req.WithContext(service.WithClientIP(req.Context(), clientIP(req))))
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"receipt-processor/internal/service"
+	"receipt-processor/internal/store"
+)
+
+// priorityHeader lets clients tag a submission on the regular process endpoint
+const priorityHeader = "X-Receipt-Priority"
+
+// submissionPriority determines whether a request is interactive or batch traffic.
+// Untagged requests are interactive, or batch when async processing is enabled.
+func (s *Server) submissionPriority(req *http.Request) string {
+	return s.priorityOf(req.Header.Get(priorityHeader))
+}
+
+// priorityOf is the priority a value of priorityHeader tags a submission with, as submissionPriority
+// determines it
+func (s *Server) priorityOf(value string) string {
+	switch {
+	case strings.EqualFold(value, service.PriorityBatch):
+		return service.PriorityBatch
+	case strings.EqualFold(value, service.PriorityInteractive):
+		return service.PriorityInteractive
+	case s.svc.AsyncProcessing():
+		return service.PriorityBatch
+	}
+	return service.PriorityInteractive
+}
+
+// errBatchQueueFull is enqueueBatchReceipt's error when the worker pool has no room for another job
+var errBatchQueueFull = errors.New("Batch queue is full")
+
+// enqueueBatchReceipt admits the receipt and hands it to the worker pool as a job, returning the
+// admitted receipt and the job's ID. It fails like service.AdmitReceipt when the receipt is not
+// admitted, and with errBatchQueueFull when the queue is full.
+func (s *Server) enqueueBatchReceipt(ctx context.Context, tenant string, receipt store.Receipt) (store.Receipt, string, error) {
+	receipt, err := s.svc.AdmitReceipt(ctx, tenant, receipt)
+	if err != nil {
+		return receipt, "", err
+	}
+	j := s.svc.NewJob(ctx, tenant, receipt)
+	if !s.svc.EnqueueJob(j) {
+		s.svc.ForgetJob(j)
+		s.svc.ReleaseDuplicate(tenant, receipt)
+		return receipt, "", errBatchQueueFull
+	}
+	return receipt, j.ID, nil
+}
+
+// ProcessBatchReceiptsEndpoint always treats the submission as batch traffic, answering 202 with the
+// job processing it, 409 for duplicates, 503 when the queue is full, and like writeStoreError when the
+// receipt could not be admitted
+func (s *Server) ProcessBatchReceiptsEndpoint(w http.ResponseWriter, req *http.Request) {
+	receipt, err := s.decodeReceipt(w, req)
+	if err != nil {
+		writeDecodeError(w, err, "receipt")
+		return
+	}
+	receipt.Channel = submissionChannel(req, service.ChannelAPI)
+	receipt, jobID, err := s.enqueueBatchReceipt(req.Context(), tenantFromRequest(req), receipt)
+	switch {
+	case errors.Is(err, service.ErrDuplicateReceipt):
+		writeDuplicateError(w, err)
+		return
+	case errors.Is(err, service.ErrInvalidReceipt):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, errBatchQueueFull):
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		writeStoreError(w, err)
+		return
+	}
+
+	// The receipt is stored once a worker gets to it; the job reports how that went
+	w.Header().Set("Location", basePath()+"/"+apiVersion(req)+"/jobs/"+jobID)
+	writeFlagHeaders(w, receipt)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":        receipt.ID,
+		"shortCode": receipt.ShortCode,
+		"jobId":     jobID,
+		"status":    service.JobQueued,
+	})
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/internal/store"
+	"receipt-processor/scoring"
+)
+
+// scoreLine is one rule of a receipt's breakdown, with what the rule is about
+type scoreLine struct {
+	scoring.RuleScore
+	Description string
+}
+
+// ReceiptPageHandler renders a stored receipt and the rule-by-rule breakdown of its points for browsers
+func (s *Server) ReceiptPageHandler(w http.ResponseWriter, req *http.Request) {
+	receipt, exists, err := s.svc.FindReceipt(req.Context(), mux.Vars(req)["id"])
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if !exists {
+		http.Error(w, "Receipt not found", http.StatusNotFound)
+		return
+	}
+
+	rules := s.svc.Rules().For(receipt)
+	explanation := s.svc.ExplainAwardedPoints(receipt)
+	descriptions := make(map[int]string)
+	for _, rule := range describeRules(rules) {
+		descriptions[rule.Rule] = rule.Description
+	}
+	lines := make([]scoreLine, len(explanation.Breakdown))
+	for i, score := range explanation.Breakdown {
+		lines[i] = scoreLine{score, descriptions[score.Rule]}
+	}
+
+	s.renderPage(w, "receipt.html", struct {
+		Receipt   store.Receipt
+		State     string
+		Points    int
+		Version   string
+		Breakdown []scoreLine
+	}{receipt, store.StateOf(receipt), explanation.Points, explanation.Version, lines})
+}
@@ -0,0 +1,99 @@
+// Package handlers is the HTTP API: the endpoints, the middleware and the router that mounts them under
+// /v1 and the legacy unversioned paths.
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/protobuf/proto"
+
+	"receipt-processor/internal/receiptsv1"
+	"receipt-processor/internal/service"
+	"receipt-processor/internal/store"
+)
+
+// processReceiptRoute serves POST /v1/receipts/process from the gateway. API clients get its JSON; the
+// home page form asks for a page displaying the ID and the points awarded.
+func (s *Server) processReceiptRoute() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if negotiate(req, mediaJSON, mediaHTML) != mediaHTML {
+			s.gateway.ServeHTTP(w, req)
+			return
+		}
+		answer := &bufferedResponse{header: make(http.Header)}
+		s.gateway.ServeHTTP(answer, req)
+		var data struct {
+			ID        string `json:"id"`
+			ShortCode string `json:"shortCode"`
+			Points    int    `json:"points"`
+		}
+		if answer.status != http.StatusOK || json.Unmarshal(answer.body.Bytes(), &data) != nil {
+			answer.send(w)
+			return
+		}
+		// The flags go out with the page, which has a body of its own
+		answer.header.Del("Content-Type")
+		answer.header.Del("Content-Length")
+		for name, values := range answer.header {
+			w.Header()[name] = values
+		}
+		s.renderPage(w, "processed.html", data)
+	})
+}
+
+// writeProcessedJSON answers a processed submission with its id, points, the stored receipt and any
+// extra fields, or with the error service.ProcessReceipt reported
+func (s *Server) writeProcessedJSON(w http.ResponseWriter, receipt store.Receipt, err error, extra map[string]interface{}) {
+	switch {
+	case errors.Is(err, service.ErrDuplicateReceipt):
+		writeDuplicateError(w, err)
+		return
+	case errors.Is(err, service.ErrInvalidReceipt):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil && !errors.Is(err, service.ErrReceiptBuffered):
+		writeStoreError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"id":        receipt.ID,
+		"shortCode": receipt.ShortCode,
+		"points":    s.points(receipt),
+		"receipt":   receipt,
+	}
+	for key, value := range extra {
+		response[key] = value
+	}
+	writeFlagHeaders(w, receipt)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// getReceiptRoute serves GET /v1/receipts/{id} from the gateway: a stored receipt with its points and
+// their provenance
+func (s *Server) getReceiptRoute() http.Handler {
+	return s.gatewayRepresentations(func() proto.Message { return new(receiptsv1.GetReceiptResponse) }, func(_ *http.Request, m proto.Message) table {
+		receipt := m.(*receiptsv1.GetReceiptResponse).GetReceipt()
+		return recordTable("Receipt "+receipt.GetShortCode(), receiptColumns, []map[string]interface{}{receiptMessageRecord(receipt)})
+	})
+}
+
+// getPointsRoute serves GET /v1/receipts/{id}/points from the gateway: the points awarded for a receipt,
+// as computed when it was processed or last rescored
+func (s *Server) getPointsRoute() http.Handler {
+	return s.gatewayRepresentations(func() proto.Message { return new(receiptsv1.GetPointsResponse) }, func(req *http.Request, m proto.Message) table {
+		id := mux.Vars(req)["id"]
+		points := m.(*receiptsv1.GetPointsResponse).GetPoints()
+		return table{Title: "Points of receipt " + id, Columns: []string{"id", "points"}, Rows: [][]string{{id, strconv.Itoa(int(points))}}}
+	})
+}
+
+// HomePageHandler serves the home page with a form for JSON input
+func (s *Server) HomePageHandler(w http.ResponseWriter, req *http.Request) {
+	s.renderPage(w, "home.html", nil)
+}
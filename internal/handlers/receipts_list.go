@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"receipt-processor/internal/query"
+	"receipt-processor/internal/receiptsv1"
+	"receipt-processor/internal/store"
+	"receipt-processor/scoring"
+)
+
+// receiptFields are the fields a receipt listing can select with ?fields=
+var receiptFields = []string{"id", "shortCode", "retailer", "purchaseDate", "purchaseTime", "total", "items", "points", "rulesVersion", "scoredAt", "channel", "state", "flags"}
+
+// receiptListSpec is what GET /receipts accepts
+var receiptListSpec = query.Spec{
+	Filters: map[string]query.FilterType{
+		"retailer":  query.String,
+		"from":      query.Date,
+		"to":        query.Date,
+		"channel":   query.String,
+		"state":     query.String,
+		"category":  query.String,
+		"minTotal":  query.Decimal,
+		"maxTotal":  query.Decimal,
+		"minPoints": query.Int,
+	},
+	Sortable:     []string{"id", "retailer", "purchaseDate", "total", "points", "scoredAt"},
+	DefaultSort:  "purchaseDate,id",
+	Fields:       receiptFields,
+	DefaultLimit: 100,
+	MaxLimit:     1000,
+}
+
+// receiptFilterFromParams builds the receipt filter from the parsed filters of a list request. The
+// retailer is canonicalized by the retailer dictionary, as stored receipts are.
+func (s *Server) receiptFilterFromParams(params query.Params) store.Filter {
+	var filter store.Filter
+	if retailer, ok := params.Filter("retailer"); ok {
+		filter.Retailer = s.svc.CanonicalRetailer(retailer)
+	}
+	filter.From, _ = params.Filter("from")
+	filter.To, _ = params.Filter("to")
+	filter.Channel, _ = params.Filter("channel")
+	filter.State, _ = params.Filter("state")
+	filter.Category, _ = params.Filter("category")
+	filter.MinTotal, _ = params.Filter("minTotal")
+	filter.MaxTotal, _ = params.Filter("maxTotal")
+	if minPoints, ok := params.Int("minPoints"); ok {
+		filter.MinPoints = &minPoints
+	}
+	return filter
+}
+
+// compareReceipts orders two receipts by one sortable field
+func (s *Server) compareReceipts(a, b store.Receipt, field string) int {
+	switch field {
+	case "retailer":
+		return strings.Compare(a.Retailer, b.Retailer)
+	case "purchaseDate":
+		return strings.Compare(a.PurchaseDate+a.PurchaseTime, b.PurchaseDate+b.PurchaseTime)
+	case "total":
+		x, _ := scoring.ParseCents(a.Total)
+		y, _ := scoring.ParseCents(b.Total)
+		return compareCents(x, y)
+	case "points":
+		return s.points(a) - s.points(b)
+	case "scoredAt":
+		return compareTimes(a.ScoredAt, b.ScoredAt)
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+// compareTimes orders unset times first
+func compareTimes(x, y *time.Time) int {
+	switch {
+	case x == nil && y == nil:
+		return 0
+	case x == nil:
+		return -1
+	case y == nil:
+		return 1
+	}
+	return x.Compare(*y)
+}
+
+// compareCents orders two amounts of cents
+func compareCents(x, y int64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// listReceipts returns the stored receipts matching the filters of params, sorted by its sort keys,
+// together with how many matched before pagination. The store applies the filters.
+func (s *Server) listReceipts(ctx context.Context, params query.Params) ([]store.Receipt, int, error) {
+	receipts, err := s.svc.FindReceipts(ctx, s.receiptFilterFromParams(params))
+	if err != nil {
+		return nil, 0, err
+	}
+	query.SortSlice(receipts, params.Sort, s.compareReceipts)
+	return query.Page(receipts, params), len(receipts), nil
+}
+
+// receiptColumns are the fields of a listing, in the order the HTML and CSV representations show them
+var receiptColumns = []string{"id", "shortCode", "retailer", "purchaseDate", "purchaseTime", "total", "items", "points", "rulesVersion", "scoredAt", "channel", "state", "flags"}
+
+// receiptRecord renders a receipt as the fields of a listing
+func (s *Server) receiptRecord(receipt store.Receipt) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           receipt.ID,
+		"shortCode":    receipt.ShortCode,
+		"retailer":     receipt.Retailer,
+		"purchaseDate": receipt.PurchaseDate,
+		"purchaseTime": receipt.PurchaseTime,
+		"total":        receipt.Total,
+		"items":        receipt.Items,
+		"points":       s.points(receipt),
+		"rulesVersion": receipt.RulesVersion,
+		"scoredAt":     receipt.ScoredAt,
+		"channel":      receipt.Channel,
+		"state":        store.StateOf(receipt),
+		"flags":        receipt.Flags,
+	}
+}
+
+// receiptMessageRecord renders a receipt of the Receipts service as the fields of a listing, like
+// receiptRecord
+func receiptMessageRecord(receipt *receiptsv1.Receipt) map[string]interface{} {
+	record := map[string]interface{}{
+		"id":           receipt.GetId(),
+		"shortCode":    receipt.GetShortCode(),
+		"retailer":     receipt.GetRetailer(),
+		"purchaseDate": receipt.GetPurchaseDate(),
+		"purchaseTime": receipt.GetPurchaseTime(),
+		"total":        receipt.GetTotal(),
+		"items":        len(receipt.GetItems()),
+		"points":       receipt.GetPoints(),
+		"rulesVersion": receipt.GetRulesVersion(),
+		"channel":      receipt.GetChannel(),
+		"state":        receipt.GetState(),
+		"flags":        receipt.GetFlags(),
+	}
+	if receipt.GetScoredAt() != nil {
+		scoredAt := receipt.GetScoredAt().AsTime()
+		record["scoredAt"] = &scoredAt
+	}
+	return record
+}
+
+// writeQueryError answers 400 for invalid list parameters
+func writeQueryError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// listReceiptsRoute serves GET /v1/receipts from the gateway: stored receipts with pagination, sorting,
+// field selection and filters. The query is parsed as receiptListSpec first, so a listing is answered
+// like the other listings, and ?fields=, which the gateway does not know, selects the fields of the
+// receipts in its JSON.
+func (s *Server) listReceiptsRoute() http.Handler {
+	tables := s.gatewayRepresentations(func() proto.Message { return new(receiptsv1.ListReceiptsResponse) }, func(req *http.Request, m proto.Message) table {
+		listing := m.(*receiptsv1.ListReceiptsResponse)
+		columns := receiptColumns
+		if params, _ := query.Parse(req.URL.Query(), receiptListSpec); params.Fields != nil {
+			columns = params.Fields
+		}
+		records := make([]map[string]interface{}, len(listing.GetReceipts()))
+		for i, receipt := range listing.GetReceipts() {
+			records[i] = receiptMessageRecord(receipt)
+		}
+		offset := int(listing.GetOffset())
+		return recordTable(fmt.Sprintf("Receipts %d-%d of %d", offset+1, offset+len(records), listing.GetTotal()), columns, records)
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		params, err := query.Parse(req.URL.Query(), receiptListSpec)
+		if err != nil {
+			writeQueryError(w, err)
+			return
+		}
+		if negotiate(req, mediaJSON, mediaHTML, mediaCSV) != mediaJSON {
+			tables.ServeHTTP(w, req)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept")
+		answer := &bufferedResponse{header: make(http.Header)}
+		s.gateway.ServeHTTP(answer, req)
+		var listing struct {
+			Receipts []map[string]interface{} `json:"receipts"`
+			Total    int                      `json:"total"`
+			Limit    int                      `json:"limit"`
+			Offset   int                      `json:"offset"`
+		}
+		if answer.status != http.StatusOK || json.Unmarshal(answer.body.Bytes(), &listing) != nil {
+			answer.send(w)
+			return
+		}
+		// The gateway leaves out an empty page's receipts, which are still listed as []
+		records := make([]map[string]interface{}, len(listing.Receipts))
+		for i, record := range listing.Receipts {
+			records[i] = params.Project(record)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"receipts": records,
+			"total":    listing.Total,
+			"limit":    listing.Limit,
+			"offset":   listing.Offset,
+		})
+	})
+}
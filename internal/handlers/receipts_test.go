@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+
+	"receipt-processor/internal/points"
+	"receipt-processor/internal/receiptsv1"
+	"receipt-processor/internal/service"
+	"receipt-processor/internal/store"
+)
+
+// fixedRules is a rules engine that scores every receipt with one rules version
+type fixedRules struct {
+	service.RulesEngine
+	rules store.RuleConfig
+}
+
+func (r fixedRules) Active() store.RuleConfig { return r.rules }
+
+func (r fixedRules) ActiveFor(string) store.RuleConfig { return r.rules }
+
+func (r fixedRules) For(store.Receipt) store.RuleConfig { return r.rules }
+
+func (r fixedRules) Version(string) (store.RuleConfig, bool) { return r.rules, true }
+
+func (r fixedRules) Activations() []store.RuleActivation { return nil }
+
+// testNow is the time on the clock of the test server
+var testNow = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestService creates a service on an in-memory store, the spec rules and a stopped clock
+func newTestService() *service.Service {
+	return service.New(store.NewMemory(), fixedRules{rules: points.SpecRules}, func() time.Time { return testNow })
+}
+
+// newTestServer builds the router of a server around a new test service
+func newTestServer(t *testing.T) http.Handler {
+	t.Helper()
+	return NewServer(newTestService(), log.New(io.Discard, "", 0)).Router()
+}
+
+const (
+	targetReceipt = `{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "total": "35.35",
+		"items": [{"shortDescription": "Mountain Dew 12PK", "price": "6.49"}, {"shortDescription": "Emils Cheese Pizza", "price": "12.25"},
+			{"shortDescription": "Knorr Creamy Chicken", "price": "1.26"}, {"shortDescription": "Doritos Nacho Cheese", "price": "3.35"},
+			{"shortDescription": "   Klarbrunn 12-PK 12 FL OZ  ", "price": "12.00"}]}`
+	cornerMarketReceipt = `{"retailer": "M&M Corner Market", "purchaseDate": "2022-03-20", "purchaseTime": "14:33", "total": "9.00",
+		"items": [{"shortDescription": "Gatorade", "price": "2.25"}, {"shortDescription": "Gatorade", "price": "2.25"},
+			{"shortDescription": "Gatorade", "price": "2.25"}, {"shortDescription": "Gatorade", "price": "2.25"}]}`
+)
+
+func TestProcessReceipt(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantPoints int
+	}{
+		{"target", targetReceipt, http.StatusOK, 28},
+		{"corner market", cornerMarketReceipt, http.StatusOK, 109},
+		{"multibyte description", `{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "total": "1.50",
+			"items": [{"shortDescription": " Café au lait ", "price": "1.50"}]}`, http.StatusOK, 38},
+		{"malformed JSON", `{"retailer": `, http.StatusBadRequest, 0},
+		{"unknown field", `{"retailer": "Target", "store": 7}`, http.StatusBadRequest, 0},
+		{"bad total", strings.Replace(targetReceipt, `"35.35"`, `"35.3"`, 1), http.StatusBadRequest, 0},
+		{"missing retailer", strings.Replace(targetReceipt, `"Target"`, `"  "`, 1), http.StatusBadRequest, 0},
+		{"bad purchase date", strings.Replace(targetReceipt, `"2022-01-01"`, `"2022-13-01"`, 1), http.StatusBadRequest, 0},
+		{"no items", `{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "total": "35.35", "items": []}`, http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestServer(t)
+			req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var processed struct {
+				ID     string `json:"id"`
+				Points int    `json:"points"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&processed); err != nil {
+				t.Fatal(err)
+			}
+			if processed.Points != tt.wantPoints {
+				t.Errorf("points = %d, want %d", processed.Points, tt.wantPoints)
+			}
+
+			rec = httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/receipts/"+processed.ID+"/points", nil))
+			var got map[string]int
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != http.StatusOK || got["points"] != tt.wantPoints {
+				t.Errorf("GET points = %d %v, want 200 %d", rec.Code, got, tt.wantPoints)
+			}
+		})
+	}
+}
+
+func TestGetReceipt(t *testing.T) {
+	router := newTestServer(t)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/receipts/process", strings.NewReader(targetReceipt)))
+	var processed struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&processed); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{"by ID", "/v1/receipts/" + processed.ID, http.StatusOK},
+		{"legacy path", "/receipts/" + processed.ID, http.StatusOK},
+		{"unknown ID", "/v1/receipts/00000000-0000-0000-0000-000000000000", http.StatusNotFound},
+		{"unknown points", "/v1/receipts/00000000-0000-0000-0000-000000000000/points", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got struct {
+				Receipt store.Receipt `json:"receipt"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Receipt.RulesVersion != points.SpecRules.Version {
+				t.Errorf("rulesVersion = %q, want %q", got.Receipt.RulesVersion, points.SpecRules.Version)
+			}
+			if got.Receipt.ScoredAt == nil || !got.Receipt.ScoredAt.Equal(testNow) {
+				t.Errorf("scoredAt = %v, want the clock's %v", got.Receipt.ScoredAt, testNow)
+			}
+		})
+	}
+}
+
+func TestProcessReceiptEncodings(t *testing.T) {
+	protobufBody, err := proto.Marshal(&receiptsv1.Receipt{Retailer: "Target", PurchaseDate: "2022-01-01", PurchaseTime: "13:01", Total: "1.25",
+		Items: []*receiptsv1.Item{{ShortDescription: "Pepsi - 12-oz", Price: "1.25"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgpackBody, err := msgpack.Marshal(map[string]interface{}{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "total": "1.25",
+		"items": []map[string]string{{"shortDescription": "Pepsi - 12-oz", "price": "1.25"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		wantStatus  int
+	}{
+		{"XML", "application/xml; charset=utf-8", []byte(`<receipt><retailer>Target</retailer><purchaseDate>2022-01-01</purchaseDate><purchaseTime>13:01</purchaseTime>
+			<total>1.25</total><items><item><shortDescription>Pepsi - 12-oz</shortDescription><price>1.25</price></item></items></receipt>`), http.StatusOK},
+		{"protobuf", "application/x-protobuf", protobufBody, http.StatusOK},
+		{"MessagePack", "application/msgpack", msgpackBody, http.StatusOK},
+		{"malformed XML", "text/xml", []byte(`<receipt><retailer>`), http.StatusBadRequest},
+		{"too large", "application/json", []byte(`{"retailer": "` + strings.Repeat("x", 1<<20) + `"}`), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/receipts/process", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			newTestServer(t).ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var processed struct {
+				Points int `json:"points"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&processed); err != nil {
+				t.Fatal(err)
+			}
+			if processed.Points != 37 {
+				t.Errorf("points = %d, want 37", processed.Points)
+			}
+		})
+	}
+}
+
+func TestListReceipts(t *testing.T) {
+	router := newTestServer(t)
+	for _, body := range []string{targetReceipt, cornerMarketReceipt} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/receipts/process", strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("process status = %d: %s", rec.Code, rec.Body)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		accept     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"fields", "/v1/receipts?fields=retailer,points&sort=-points", "", http.StatusOK,
+			`{"limit":100,"offset":0,"receipts":[{"points":109,"retailer":"M\u0026M Corner Market"},{"points":28,"retailer":"Target"}],"total":2}` + "\n"},
+		{"empty page", "/v1/receipts?retailer=Walgreens", "", http.StatusOK, `{"limit":100,"offset":0,"receipts":[],"total":0}` + "\n"},
+		{"CSV", "/receipts?fields=retailer,points&sort=points", "text/csv", http.StatusOK, "retailer,points\nTarget,28\nM&M Corner Market,109\n"},
+		{"invalid limit", "/v1/receipts?limit=x", "", http.StatusBadRequest, ""},
+		{"not acceptable", "/v1/receipts", "image/png", http.StatusNotAcceptable, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body, tt.wantBody)
+			}
+		})
+	}
+}
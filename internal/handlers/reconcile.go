@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"receipt-processor/internal/service"
+)
+
+// ReconcileHandler produces a discrepancy report for a purchase date range
+func (s *Server) ReconcileHandler(w http.ResponseWriter, req *http.Request) {
+	var params service.ReconcileRequest
+	if err := s.decodeJSON(w, req, &params); err != nil {
+		writeDecodeError(w, err, "reconcile request")
+		return
+	}
+	for _, date := range []string{params.From, params.To} {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			http.Error(w, "from and to must be dates in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := s.svc.ReconcilePoints(req.Context(), params.From, params.To)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
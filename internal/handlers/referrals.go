@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"receipt-processor/internal/service"
+)
+
+// ReferralCodeEndpoint returns a user's referral code, creating it on the first request
+func (s *Server) ReferralCodeEndpoint(w http.ResponseWriter, req *http.Request) {
+	userID, ok := resolveUser(w, req)
+	if !ok {
+		return
+	}
+	code, created, err := s.svc.ReferralCodeFor(userID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(map[string]string{"userId": userID, "code": code})
+}
+
+// RedeemReferralEndpoint signs a new user up with a referral code
+func (s *Server) RedeemReferralEndpoint(w http.ResponseWriter, req *http.Request) {
+	userID, ok := resolveUser(w, req)
+	if !ok {
+		return
+	}
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := s.decodeJSON(w, req, &body); err != nil {
+		writeDecodeError(w, err, "referral code")
+		return
+	}
+	if strings.TrimSpace(body.Code) == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	r, err := s.svc.RedeemReferral(req.Context(), userID, body.Code)
+	switch {
+	case errors.Is(err, service.ErrUnknownReferralCode):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, service.ErrSelfReferral):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, service.ErrAlreadyReferred), errors.Is(err, service.ErrNotNewUser):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(r)
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/internal/service"
+)
+
+// ListRetailerAliasesHandler lists the dictionary, ordered by canonical name and alias
+func (s *Server) ListRetailerAliasesHandler(w http.ResponseWriter, req *http.Request) {
+	dictionary := s.svc.RetailerAliases()
+	aliases := make([]service.RetailerAlias, 0, len(dictionary))
+	for alias, canonical := range dictionary {
+		aliases = append(aliases, service.RetailerAlias{Alias: alias, Canonical: canonical})
+	}
+	sort.Slice(aliases, func(i, j int) bool {
+		if aliases[i].Canonical != aliases[j].Canonical {
+			return aliases[i].Canonical < aliases[j].Canonical
+		}
+		return aliases[i].Alias < aliases[j].Alias
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"aliases": aliases})
+}
+
+// PutRetailerAliasHandler adds an alias or points it at another canonical name
+func (s *Server) PutRetailerAliasHandler(w http.ResponseWriter, req *http.Request) {
+	alias := mux.Vars(req)["alias"]
+	var body struct {
+		Canonical string `json:"canonical"`
+	}
+	if err := s.decodeJSON(w, req, &body); err != nil {
+		writeDecodeError(w, err, "alias")
+		return
+	}
+	body.Canonical = strings.TrimSpace(body.Canonical)
+	if body.Canonical == "" || service.RetailerKey(alias) == "" {
+		http.Error(w, "Alias and canonical name are required", http.StatusBadRequest)
+		return
+	}
+
+	previous, existed, err := s.svc.PutRetailerAlias(alias, body.Canonical)
+	var before map[string]interface{}
+	if existed {
+		before = map[string]interface{}{"canonical": previous}
+	}
+	s.svc.RecordAudit(req.Context(), service.AuditAliasSaved, "retailer_alias:"+alias, before, map[string]interface{}{"canonical": body.Canonical})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Alias applied but not saved: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(service.RetailerAlias{Alias: alias, Canonical: body.Canonical})
+}
+
+// DeleteRetailerAliasHandler removes an alias
+func (s *Server) DeleteRetailerAliasHandler(w http.ResponseWriter, req *http.Request) {
+	alias := mux.Vars(req)["alias"]
+
+	previous, existed, err := s.svc.DeleteRetailerAlias(alias)
+	if !existed {
+		http.Error(w, "Alias not found", http.StatusNotFound)
+		return
+	}
+	s.svc.RecordAudit(req.Context(), service.AuditAliasDeleted, "retailer_alias:"+alias, map[string]interface{}{"canonical": previous}, nil)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Alias removed but not saved: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// NormalizeRetailerHandler shows what the dictionary makes of a raw retailer name and the key retailer overrides use, e.g. ?retailer=WAL-MART%20%231234
+func (s *Server) NormalizeRetailerHandler(w http.ResponseWriter, req *http.Request) {
+	raw := req.URL.Query().Get("retailer")
+	w.Header().Set("Content-Type", "application/json")
+	canonical := s.svc.CanonicalRetailer(raw)
+	json.NewEncoder(w).Encode(map[string]string{"retailer": raw, "canonical": canonical, "key": service.RetailerKey(canonical)})
+}
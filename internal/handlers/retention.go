@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// RetentionStatusHandler reports the retention settings, how many receipts were purged since startup and
+// the last run
+func (s *Server) RetentionStatusHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.svc.RetentionStatus())
+}
+
+// PurgeReceiptsHandler runs the retention job now and reports the run
+func (s *Server) PurgeReceiptsHandler(w http.ResponseWriter, req *http.Request) {
+	if !s.svc.RetentionEnabled() {
+		http.Error(w, "Retention is disabled; set RETENTION_PERIOD to enable it", http.StatusConflict)
+		return
+	}
+	report := s.svc.PurgeReceipts(req.Context(), s.svc.Now())
+	w.Header().Set("Content-Type", "application/json")
+	if report.Error != "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
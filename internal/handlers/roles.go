@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/internal/config"
+	"receipt-processor/internal/store"
+)
+
+// The roles an API key can have. Keys without a role in API_KEY_ROLES are read-only.
+const (
+	roleAdmin     = "admin"
+	roleOperator  = "operator"
+	roleSubmitter = "submitter"
+	roleReadOnly  = "read-only"
+)
+
+// access is what a route needs of the role of a request
+type access int
+
+const (
+	// accessPublic routes are open to every request, with a key or without
+	accessPublic access = iota
+	// accessOwn routes read receipts; submitters only see the ones they submitted
+	accessOwn
+	// accessRead routes read data of every user of the tenant
+	accessRead
+	// accessSubmit routes submit receipts
+	accessSubmit
+	// accessOperate routes change receipts, users, campaigns and the like
+	accessOperate
+	// accessManage routes change the rules, re-score receipts, run backups, purges, erasures and ad-hoc queries
+	// and debug the server
+	accessManage
+	// accessSelf routes are about one user: accessOwn for the user the request's credentials are bound to,
+	// and accessManage for any other
+	accessSelf
+)
+
+// roleAccess lists what each role may do
+var roleAccess = map[string]map[access]bool{
+	roleAdmin:     {accessPublic: true, accessOwn: true, accessRead: true, accessSubmit: true, accessOperate: true, accessManage: true},
+	roleOperator:  {accessPublic: true, accessOwn: true, accessRead: true, accessSubmit: true, accessOperate: true},
+	roleSubmitter: {accessPublic: true, accessOwn: true, accessSubmit: true},
+	roleReadOnly:  {accessPublic: true, accessOwn: true, accessRead: true},
+}
+
+// routeAccess is the access of the routes that do not have the default one: accessRead for GET and
+// accessOperate for other methods. API routes are listed without their version prefix.
+var routeAccess = map[string]access{
+	"GET /":                                 accessPublic,
+	"GET /version":                          accessPublic,
+	"GET /openapi.json":                     accessPublic,
+	"GET /docs":                             accessPublic,
+	"GET /static/":                          accessPublic,
+	"GET /auth/login":                       accessPublic,
+	"GET /auth/callback":                    accessPublic,
+	"POST /auth/logout":                     accessPublic,
+	"POST /receipts/process":                accessSubmit,
+	"POST /receipts/process/batch":          accessSubmit,
+	"POST /receipts/import/csv":             accessSubmit,
+	"POST /receipts/import/json":            accessSubmit,
+	"POST /receipts/bulk":                   accessSubmit,
+	"POST /receipts/pos":                    accessSubmit,
+	"POST /receipts/ocr":                    accessSubmit,
+	"POST /receipts/barcode":                accessSubmit,
+	"GET /ws":                               accessSubmit,
+	"GET /receipts":                         accessOwn,
+	"GET /receipts/search":                  accessOwn,
+	"GET /receipts/export":                  accessOwn,
+	"GET /receipts/{id}":                    accessOwn,
+	"GET /receipts/{id}/points":             accessOwn,
+	"GET /receipts/{id}/explain":            accessOwn,
+	"GET /receipts/{id}/view":               accessOwn,
+	"GET /jobs/{id}":                        accessOwn,
+	"GET /rules/active":                     accessOwn,
+	"GET /graphql":                          accessRead,
+	"POST /graphql":                         accessRead,
+	"POST /admin/query":                     accessManage,
+	"POST /admin/rules/simulate":            accessRead,
+	"POST /admin/rules":                     accessManage,
+	"POST /admin/rules/reload":              accessManage,
+	"POST /admin/rules/{version}/activate":  accessManage,
+	"POST /admin/rules/{version}/rescore":   accessManage,
+	"POST /admin/receipts/recalculate":      accessManage,
+	"POST /admin/receipts/{id}/recalculate": accessManage,
+	"POST /admin/retention/purge":           accessManage,
+	"POST /admin/exports/s3/run":            accessManage,
+	"DELETE /users/{user}/data":             accessManage,
+	"GET /users/{user}/export":              accessSelf,
+	"GET /debug/":                           accessManage,
+	"POST /debug/":                          accessManage,
+
+	// The gRPC methods by their full name
+	"POST /receipts.v1.Receipts/ProcessReceipt": accessSubmit,
+	"POST /receipts.v1.Receipts/GetReceipt":     accessOwn,
+	"POST /receipts.v1.Receipts/GetPoints":      accessOwn,
+	"POST /receipts.v1.Receipts/ListReceipts":   accessOwn,
+}
+
+// roleContextKey keys the role rbac gave a request in its context
+type roleContextKey struct{}
+
+// mayAccess reports whether the role of a request allows an access the route alone does not decide, like
+// a GraphQL mutation on a route that also takes queries. Every request may when rbac is not in use.
+func mayAccess(req *http.Request, a access) bool {
+	role, ok := req.Context().Value(roleContextKey{}).(string)
+	return !ok || roleAccess[role][a]
+}
+
+// versionPrefix matches the version prefix of an API route, like /v1
+var versionPrefix = regexp.MustCompile(`^/v[0-9]+/`)
+
+// routeAccessOf looks up the access a matched route needs
+func routeAccessOf(req *http.Request) access {
+	template := req.URL.Path
+	if route := mux.CurrentRoute(req); route != nil {
+		if t, err := route.GetPathTemplate(); err == nil {
+			template = t
+		}
+	}
+	template = versionPrefix.ReplaceAllString(template, "/")
+	if a, ok := routeAccess[req.Method+" "+template]; ok {
+		if a == accessSelf {
+			user := mux.Vars(req)["user"]
+			if own, ok := userFromContext(req.Context()); user == "me" || ok && user == own {
+				return accessOwn
+			}
+			return accessManage
+		}
+		return a
+	}
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return accessRead
+	}
+	return accessOperate
+}
+
+// apiKeyRoles reads API_KEY_ROLES, key=role pairs. A key given an unknown role is logged and gets the
+// read-only role, like keys without one.
+func apiKeyRoles() map[string]string {
+	roles := config.Map("API_KEY_ROLES")
+	for key, role := range roles {
+		if roleAccess[role] == nil {
+			log.Printf("Unknown role %q in API_KEY_ROLES, giving its key the %s role", role, roleReadOnly)
+			roles[key] = roleReadOnly
+		}
+	}
+	return roles
+}
+
+// rbac answers requests whose role may not use the route with 403. The role is the one API_KEY_ROLES
+// gives the request's key, or MTLS_ROLES its client certificate, or the one of the browser's OIDC session:
+// admins may do everything, operators everything but managing rules, re-scoring, backups and purges,
+// read-only keys may only read, and submitters may only submit receipts and read the ones they submitted.
+// Every other request is read-only, but for one without any credentials on an open server (see
+// middlewareChain), which is an admin since there is no one it could have signed in as.
+func rbac(open bool) mux.MiddlewareFunc {
+	roles, identities := apiKeyRoles(), certRoles()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			key := requestAPIKey(req)
+			role, ok := keyBinding(roles, key)
+			actor := requestActor(req, key)
+			if sess, signedIn := sessionFromContext(req.Context()); signedIn {
+				role, ok, actor = sess.Role, true, sess.actor()
+			} else if identity, hasCert := certIdentity(req); hasCert && !ok {
+				if role, ok = identities[identity]; !ok {
+					role, ok = roleReadOnly, true
+				}
+				actor = certActor(identity)
+			}
+			if !ok && open && key == "" {
+				role = roleAdmin
+			} else if !ok {
+				role = roleReadOnly
+			}
+			if !roleAccess[role][routeAccessOf(req)] {
+				http.Error(w, "The "+role+" role may not use this endpoint", http.StatusForbidden)
+				return
+			}
+			ctx := context.WithValue(req.Context(), roleContextKey{}, role)
+			if role == roleSubmitter {
+				ctx = store.WithSubmitter(ctx, actor)
+			}
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
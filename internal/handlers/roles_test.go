@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRoles(t *testing.T) {
+	tests := []struct {
+		name       string
+		middleware string
+		keys       string
+		key        string
+		method     string
+		wantStatus int
+	}{
+		{"key without a role reads", "", "plain-key", "plain-key", http.MethodGet, http.StatusOK},
+		{"key without a role submits", "", "plain-key", "plain-key", http.MethodPost, http.StatusForbidden},
+		{"auth off", "", "", "", http.MethodPost, http.StatusOK},
+		{"auth off with a key", "", "", "some-key", http.MethodPost, http.StatusForbidden},
+		{"anonymous without auth in the chain", "recovery,rbac", "", "", http.MethodPost, http.StatusForbidden},
+		{"anonymous without auth in the chain reads", "recovery,rbac", "", "", http.MethodGet, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AUTH_API_KEYS", tt.keys)
+			if tt.middleware != "" {
+				t.Setenv("MIDDLEWARE", tt.middleware)
+			}
+			router := newTestServer(t)
+			req := httptest.NewRequest(http.MethodGet, "/v1/receipts", nil)
+			if tt.method == http.MethodPost {
+				req = httptest.NewRequest(http.MethodPost, "/v1/receipts/process", strings.NewReader(targetReceipt))
+			}
+			if tt.key != "" {
+				req.Header.Set("X-API-Key", tt.key)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
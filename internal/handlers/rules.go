@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/internal/service"
+	"receipt-processor/internal/store"
+)
+
+// ListRulesHandler lists every rules version, which one is active for the tenant and when each was
+// activated for it, or for the default tenant whose rules it falls back to
+func (s *Server) ListRulesHandler(w http.ResponseWriter, req *http.Request) {
+	tenant := tenantFromRequest(req)
+	versions, _ := s.svc.Rules().Versions()
+	active := s.svc.Rules().ActiveFor(tenant).Version
+	history := []store.RuleActivation{}
+	for _, activation := range s.svc.Rules().Activations() {
+		// The default tenant's activations are stored without a tenant
+		if activation.Tenant == "" || activation.Tenant == tenant {
+			history = append(history, activation)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"active": active, "versions": versions, "activations": history})
+}
+
+// CreateRulesHandler adds a new rules version without activating it
+func (s *Server) CreateRulesHandler(w http.ResponseWriter, req *http.Request) {
+	var rules store.RuleConfig
+	if err := s.decodeJSON(w, req, &rules); err != nil {
+		writeDecodeError(w, err, "rules")
+		return
+	}
+	if err := service.ValidateRules(rules); err != nil {
+		http.Error(w, "Invalid rules: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	createdAt := s.svc.Now().UTC()
+	rules.CreatedAt = &createdAt
+
+	err := s.svc.Rules().Add(rules)
+	if errors.Is(err, service.ErrRulesExist) {
+		http.Error(w, "Rules version already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	s.svc.RecordAudit(req.Context(), service.AuditRulesCreated, "rules:"+rules.Version, nil, map[string]interface{}{"rules": rules.Rules})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rules)
+}
+
+// ReloadRulesHandler reads RULES_FILE again and makes its rules version the active one, as SIGHUP and a
+// change to the file do. A rejected file leaves the current rules active.
+func (s *Server) ReloadRulesHandler(w http.ResponseWriter, req *http.Request) {
+	reload, err := s.svc.ReloadRules(req.Context())
+	switch {
+	case errors.Is(err, service.ErrNoRulesFile):
+		http.Error(w, "Rules reloading requires RULES_FILE", http.StatusNotImplemented)
+		return
+	case errors.Is(err, service.ErrInvalidRulesFile):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reload)
+}
+
+// ActivateRulesHandler makes a rules version active for the tenant's new receipts. With ?recalculate=true
+// every stored receipt of the tenant is re-scored under it and points-changed events are emitted.
+func (s *Server) ActivateRulesHandler(w http.ResponseWriter, req *http.Request) {
+	version := mux.Vars(req)["version"]
+	recalculate, _ := strconv.ParseBool(req.URL.Query().Get("recalculate"))
+
+	tenant := tenantFromRequest(req)
+	previous := s.svc.Rules().ActiveFor(tenant).Version
+	rules, err := s.svc.Rules().ActivateFor(tenant, version)
+	if errors.Is(err, service.ErrRulesNotFound) {
+		http.Error(w, "Rules version not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	s.svc.RecordAudit(req.Context(), service.AuditRulesActivated, "rules:"+version,
+		map[string]interface{}{"active": previous}, map[string]interface{}{"active": version, "recalculate": recalculate})
+
+	report := service.RecalculationReport{Version: version}
+	if recalculate {
+		if report, err = s.svc.RecalculateAll(req.Context(), rules); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// RescoreRulesHandler re-scores historical receipts under a rules version without activating it and
+// reports the diff. With ?dryRun=true nothing is saved.
+func (s *Server) RescoreRulesHandler(w http.ResponseWriter, req *http.Request) {
+	version := mux.Vars(req)["version"]
+	dryRun, _ := strconv.ParseBool(req.URL.Query().Get("dryRun"))
+
+	rules, exists := s.svc.Rules().Version(version)
+	if !exists {
+		http.Error(w, "Rules version not found", http.StatusNotFound)
+		return
+	}
+	report, err := s.svc.RescoreReceipts(req.Context(), rules, dryRun)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// RecalculateReceiptHandler re-scores one receipt under the active rules, e.g. after a rules or scoring fix,
+// and reports its old and new points
+func (s *Server) RecalculateReceiptHandler(w http.ResponseWriter, req *http.Request) {
+	receipt, exists, err := s.svc.FindReceipt(req.Context(), mux.Vars(req)["id"])
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if !exists {
+		http.Error(w, "Receipt not found", http.StatusNotFound)
+		return
+	}
+	change, err := s.svc.RescoreReceipt(req.Context(), receipt, s.svc.Rules().ActiveFor(tenantFromRequest(req)), true)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(change)
+}
+
+// RecalculateReceiptsHandler re-scores the receipts listed as {"ids": [...]} under the active rules, or every
+// stored receipt when no ids are given, and reports their old and new points
+func (s *Server) RecalculateReceiptsHandler(w http.ResponseWriter, req *http.Request) {
+	var body struct {
+		IDs []string `json:"ids"`
+	}
+	if req.ContentLength != 0 {
+		if err := s.decodeJSON(w, req, &body); err != nil {
+			writeDecodeError(w, err, "receipt ids")
+			return
+		}
+	}
+
+	var list []store.Receipt
+	var notFound []string
+	if len(body.IDs) == 0 {
+		var err error
+		if list, err = s.svc.AllReceipts(req.Context()); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+	}
+	for _, id := range body.IDs {
+		receipt, exists, err := s.svc.FindReceipt(req.Context(), id)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		if !exists {
+			notFound = append(notFound, id)
+			continue
+		}
+		list = append(list, receipt)
+	}
+
+	rules := s.svc.Rules().ActiveFor(tenantFromRequest(req))
+	report := service.RecalculationReport{Version: rules.Version}
+	for _, receipt := range list {
+		change, err := s.svc.RescoreReceipt(req.Context(), receipt, rules, true)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		report.Add(change)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		service.RecalculationReport
+		NotFound []string `json:"notFound,omitempty"`
+	}{report, notFound})
+}
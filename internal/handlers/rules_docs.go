@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"receipt-processor/internal/store"
+	"receipt-processor/scoring"
+)
+
+// ruleDescription is a human-readable explanation of one points rule
+type ruleDescription struct {
+	Rule        int    `json:"rule"`
+	Description string `json:"description"`
+}
+
+// describeRules explains what a rules version actually does, skipping rules that award nothing.
+// The wording follows points.Calculate exactly, so it has to change whenever the scoring does.
+func describeRules(rules store.RuleConfig) []ruleDescription {
+	var descriptions []ruleDescription
+	add := func(rule int, points float64, format string, args ...interface{}) {
+		if points != 0 {
+			descriptions = append(descriptions, ruleDescription{Rule: rule, Description: fmt.Sprintf(format, args...)})
+		}
+	}
+
+	add(1, float64(rules.RetailerCharacterPoints), "%s for every character in the retailer name.",
+		pluralPoints(rules.RetailerCharacterPoints))
+	add(2, float64(rules.RoundDollarPoints), "%s if the total is a round dollar amount with no cents.",
+		pluralPoints(rules.RoundDollarPoints))
+	add(3, float64(rules.QuarterMultiplePoints), "%s if the total is a multiple of 0.25.",
+		pluralPoints(rules.QuarterMultiplePoints))
+	add(4, float64(rules.ItemPairPoints), "%s for every two items on the receipt.",
+		pluralPoints(rules.ItemPairPoints))
+	if rules.DescriptionLengthMultiple > 0 {
+		add(5, rules.DescriptionPriceMultiplier,
+			"If the length of an item description is a multiple of %d, the item price multiplied by %g, rounded down to a whole number, is awarded.",
+			rules.DescriptionLengthMultiple, rules.DescriptionPriceMultiplier)
+	}
+	add(6, float64(rules.OddDayPoints), "%s if the day in the purchase date is odd.",
+		pluralPoints(rules.OddDayPoints))
+	add(7, float64(rules.AfternoonPoints), "%s if the time of purchase is after %s and before %s.",
+		pluralPoints(rules.AfternoonPoints), rules.AfternoonStart, rules.AfternoonEnd)
+	channels := make([]string, 0, len(rules.ChannelBonuses))
+	for channel := range rules.ChannelBonuses {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	for _, channel := range channels {
+		bonus := rules.ChannelBonuses[channel]
+		add(8, float64(bonus), "%s if the receipt was submitted through the %s channel.", pluralPoints(bonus), channel)
+	}
+	retailers := make([]string, 0, len(rules.RetailerOverrides))
+	for retailer := range rules.RetailerOverrides {
+		retailers = append(retailers, retailer)
+	}
+	sort.Strings(retailers)
+	for _, retailer := range retailers {
+		override := rules.RetailerOverrides[retailer]
+		if override.Multiplier > 0 && override.Multiplier != 1 {
+			add(12, override.Multiplier, "Points of receipts from %s are multiplied by %g.", retailer, override.Multiplier)
+		}
+		add(12, float64(override.BonusPoints), "%s extra for receipts from %s.", pluralPoints(override.BonusPoints), retailer)
+	}
+	return descriptions
+}
+
+// describeCampaigns explains the campaigns running on a date (YYYY-MM-DD) as rule 11
+func describeCampaigns(list []scoring.Campaign, date string) []ruleDescription {
+	var descriptions []ruleDescription
+	for _, campaign := range list {
+		if date < campaign.StartDate || date > campaign.EndDate {
+			continue
+		}
+		var terms []string
+		if campaign.Multiplier > 0 && campaign.Multiplier != 1 {
+			terms = append(terms, fmt.Sprintf("points multiplied by %g", campaign.Multiplier))
+		}
+		if campaign.BonusPoints != 0 {
+			terms = append(terms, pluralPoints(campaign.BonusPoints)+" extra")
+		}
+		description := fmt.Sprintf("%s: %s for purchases until %s", campaign.Name, strings.Join(terms, " and "), campaign.EndDate)
+		if len(campaign.Weekdays) > 0 {
+			description += " on " + strings.Join(campaign.Weekdays, ", ")
+		}
+		if len(campaign.Retailers) > 0 {
+			description += " at " + strings.Join(campaign.Retailers, ", ")
+		}
+		descriptions = append(descriptions, ruleDescription{Rule: 11, Description: description + "."})
+	}
+	return descriptions
+}
+
+// pluralPoints renders "1 point" or "n points"
+func pluralPoints(n int) string {
+	if n == 1 {
+		return "1 point"
+	}
+	return fmt.Sprintf("%d points", n)
+}
+
+// ActiveRulesEndpoint describes the active rules and today's campaigns as JSON, or as HTML for browsers that ask for it
+func (s *Server) ActiveRulesEndpoint(w http.ResponseWriter, req *http.Request) {
+	rules := s.svc.Rules().ActiveFor(tenantFromRequest(req))
+	data := struct {
+		Version string            `json:"version"`
+		Rules   []ruleDescription `json:"rules"`
+	}{rules.Version, append(describeRules(rules), describeCampaigns(s.svc.ListCampaigns(), s.svc.Now().UTC().Format("2006-01-02"))...)}
+
+	if negotiate(req, mediaJSON, mediaHTML) == mediaHTML {
+		s.renderPage(w, "active_rules.html", data)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// S3ExportStatusHandler reports the export settings, the next scheduled run and the last one
+func (s *Server) S3ExportStatusHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.svc.S3ExportStatus())
+}
+
+// RunS3ExportHandler runs the export now and reports the run
+func (s *Server) RunS3ExportHandler(w http.ResponseWriter, req *http.Request) {
+	if !s.svc.S3ExportEnabled() {
+		http.Error(w, "S3 export is disabled; set S3_EXPORT_BUCKET to enable it", http.StatusConflict)
+		return
+	}
+	report := s.svc.ExportReceipts(req.Context(), s.svc.Now())
+	w.Header().Set("Content-Type", "application/json")
+	if report.Error != "" {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"receipt-processor/internal/query"
+	"receipt-processor/internal/service"
+	"receipt-processor/internal/store"
+)
+
+// searchSpec is what GET /receipts/search accepts: the query, the listing's filters and pagination
+var searchSpec = query.Spec{
+	Filters: map[string]query.FilterType{
+		"q":        query.String,
+		"retailer": query.String,
+		"from":     query.Date,
+		"to":       query.Date,
+		"channel":  query.String,
+		"state":    query.String,
+		"category": query.String,
+	},
+	Fields:       append([]string{"rank"}, receiptFields...),
+	DefaultLimit: 20,
+	MaxLimit:     100,
+}
+
+// searchReceipts returns the receipts matching the query and filters of params, best first, together with
+// how many matched before pagination
+func (s *Server) searchReceipts(ctx context.Context, params query.Params) ([]store.Receipt, int, error) {
+	q, _ := params.Filter("q")
+	filter := s.receiptFilterFromParams(params)
+	var receipts []store.Receipt
+	for _, id := range s.svc.SearchReceiptIDs(q) {
+		receipt, exists, err := s.svc.FindReceipt(ctx, id)
+		if err != nil {
+			return nil, 0, err
+		}
+		if exists && s.svc.MatchesFilter(filter, receipt) {
+			receipts = append(receipts, receipt)
+		}
+	}
+	return query.Page(receipts, params), len(receipts), nil
+}
+
+// SearchReceiptsEndpoint finds receipts by the words of their retailer name and item descriptions,
+// e.g. ?q=mountain+dew, ranked by relevance
+func (s *Server) SearchReceiptsEndpoint(w http.ResponseWriter, req *http.Request) {
+	params, err := query.Parse(req.URL.Query(), searchSpec)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	if q, _ := params.Filter("q"); len(service.SearchWords(q)) == 0 {
+		http.Error(w, "q must contain a word to search for", http.StatusBadRequest)
+		return
+	}
+	receipts, matched, err := s.searchReceipts(req.Context(), params)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	records := make([]map[string]interface{}, len(receipts))
+	for i, receipt := range receipts {
+		record := s.receiptRecord(receipt)
+		record["rank"] = params.Offset + i + 1
+		records[i] = params.Project(record)
+	}
+	s.writeNegotiated(w, req, map[string]interface{}{
+		"receipts": records,
+		"total":    matched,
+		"limit":    params.Limit,
+		"offset":   params.Offset,
+	}, func() table {
+		columns := append([]string{"rank"}, receiptColumns...)
+		if params.Fields != nil {
+			columns = params.Fields
+		}
+		q, _ := params.Filter("q")
+		return recordTable(fmt.Sprintf("Receipts matching %q", q), columns, records)
+	})
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"receipt-processor/internal/config"
+	"receipt-processor/internal/service"
+	"receipt-processor/internal/store"
+)
+
+// Server serves the HTTP API. Everything its handlers depend on is given to NewServer: the service
+// with its store, rules engine and clock, and the logger.
+type Server struct {
+	svc    *service.Service
+	logger *log.Logger
+	// templates are the HTML pages, parsed once at construction
+	templates *template.Template
+	// maxBodySize bounds the JSON body of a request, MAX_BODY_SIZE bytes (default 1MB)
+	maxBodySize int64
+
+	// idempotencyLog remembers the responses of requests sent with an Idempotency-Key, by the scope of
+	// idempotencyScope; entries older than idempotencyTTL are swept at most once a minute
+	idempotencyTTL   time.Duration
+	idempotencyMu    sync.Mutex
+	idempotencyLog   map[string]*idempotentResponse
+	idempotencySwept time.Time
+
+	// reporter ships panics and 5xx responses to SENTRY_DSN; nil without one
+	reporter *errorReporter
+	// oidc signs browsers in with OIDC_ISSUER; nil without one
+	oidc *oidcProvider
+	// gateway serves the HTTP bindings of the Receipts service, see grpcGateway
+	gateway http.Handler
+}
+
+// NewServer creates a server calling into a service, which it shares with the background jobs started
+// on it, and reading the time from the service's clock. A nil logger is log.Default().
+func NewServer(svc *service.Service, logger *log.Logger) *Server {
+	if logger == nil {
+		logger = log.Default()
+	}
+	s := &Server{
+		svc:            svc,
+		logger:         logger,
+		templates:      parseTemplates(),
+		maxBodySize:    int64(config.Int("MAX_BODY_SIZE", 1<<20)),
+		idempotencyTTL: defaultIdempotencyTTL,
+		idempotencyLog: make(map[string]*idempotentResponse),
+		reporter:       newErrorReporter(logger, svc),
+		oidc:           newOIDCProvider(logger),
+	}
+	s.gateway = s.grpcGateway()
+	return s
+}
+
+// points is what a receipt was awarded when it was scored, or for receipts stored without awarded
+// points what it scores under the rules that scored it
+func (s *Server) points(receipt store.Receipt) int {
+	return s.svc.AwardedPoints(receipt)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/internal/points"
+	"receipt-processor/internal/service"
+	"receipt-processor/internal/store"
+)
+
+// ExplainPointsEndpoint explains the points of a stored receipt with the breakdown recorded when it was scored
+func (s *Server) ExplainPointsEndpoint(w http.ResponseWriter, req *http.Request) {
+	receipt, exists, err := s.svc.FindReceipt(req.Context(), mux.Vars(req)["id"])
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if !exists {
+		http.Error(w, "Receipt not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.svc.ExplainAwardedPoints(receipt))
+}
+
+// simulationRequest scores a receipt under a stored rules version, or under draft rules that have not been saved
+type simulationRequest struct {
+	Receipt store.Receipt     `json:"receipt"`
+	Version string            `json:"version"`
+	Rules   *store.RuleConfig `json:"rules"`
+}
+
+// SimulateRulesHandler scores a receipt without storing it: under the draft rules in the request if given,
+// otherwise under the named version (default: the active one)
+func (s *Server) SimulateRulesHandler(w http.ResponseWriter, req *http.Request) {
+	var simulation simulationRequest
+	if err := s.decodeJSON(w, req, &simulation); err != nil {
+		writeDecodeError(w, err, "simulation")
+		return
+	}
+
+	var rules store.RuleConfig
+	switch {
+	case simulation.Rules != nil:
+		rules = *simulation.Rules
+		if rules.Version == "" {
+			rules.Version = "draft"
+		}
+		if err := service.ValidateRules(rules); err != nil {
+			http.Error(w, "Invalid rules: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	case simulation.Version != "":
+		stored, exists := s.svc.Rules().Version(simulation.Version)
+		if !exists {
+			http.Error(w, "Rules version not found", http.StatusNotFound)
+			return
+		}
+		rules = stored
+	default:
+		rules = s.svc.Rules().ActiveFor(tenantFromRequest(req))
+	}
+
+	currency, rate, err := s.svc.ExchangeRate(req.Context(), simulation.Receipt.Currency)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	simulation.Receipt.Currency, simulation.Receipt.ExchangeRate = currency, rate
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(points.Explain(rules, simulation.Receipt))
+}
+
+// simulatorSample is the receipt the simulator starts with
+const simulatorSample = `{
+  "retailer": "Target",
+  "purchaseDate": "2022-01-01",
+  "purchaseTime": "13:01",
+  "items": [
+    {"shortDescription": "Mountain Dew 12PK", "price": "6.49"},
+    {"shortDescription": "Emils Cheese Pizza", "price": "12.25"}
+  ],
+  "total": "18.74"
+}`
+
+// SimulatorPageHandler serves the rules simulator for rule authors
+func (s *Server) SimulatorPageHandler(w http.ResponseWriter, req *http.Request) {
+	versions, _ := s.svc.Rules().Versions()
+
+	draft := s.svc.Rules().ActiveFor(tenantFromRequest(req))
+	active := draft.Version
+	draft.Version = "draft"
+	draftJSON, _ := json.MarshalIndent(draft, "", "  ")
+
+	data := struct {
+		Versions []store.RuleConfig
+		Active   string
+		Sample   string
+		Draft    string
+	}{versions, active, simulatorSample, string(draftJSON)}
+	s.renderPage(w, "simulator.html", data)
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"receipt-processor/internal/config"
+	"receipt-processor/internal/service"
+	"receipt-processor/internal/store"
+)
+
+const (
+	// socketPingPeriod is how often the server pings a connection; one that has not answered within
+	// socketPongWait is closed
+	socketPingPeriod = 30 * time.Second
+	socketPongWait   = 60 * time.Second
+	// maxSocketMessageSize bounds one client message, like a POS receipt
+	maxSocketMessageSize = maxPOSReceiptSize
+)
+
+// socketUpgrader accepts connections from native clients, which send no Origin, and from pages served
+// by this server
+var socketUpgrader = websocket.Upgrader{}
+
+// socketRequest is a message from a WebSocket client. Ref is echoed in the answer, so clients can
+// match answers to requests.
+type socketRequest struct {
+	Type      string         `json:"type"`
+	Ref       string         `json:"ref,omitempty"`
+	Receipt   *store.Receipt `json:"receipt,omitempty"`
+	ReceiptID string         `json:"receiptId,omitempty"`
+}
+
+// socketMessage is a message to a WebSocket client
+type socketMessage struct {
+	Type      string `json:"type"`
+	Ref       string `json:"ref,omitempty"`
+	ID        string `json:"id,omitempty"`
+	ShortCode string `json:"shortCode,omitempty"`
+	Points    *int   `json:"points,omitempty"`
+	// Status is "buffered" when the store was down and the receipt will be saved once it recovers
+	Status string `json:"status,omitempty"`
+	// Code and Error are the HTTP status and message a request over HTTP would have been answered with
+	Code        int    `json:"code,omitempty"`
+	Error       string `json:"error,omitempty"`
+	DuplicateOf string `json:"duplicateOf,omitempty"`
+	// A points message carries what the receipt had before and the rules version it was rescored under
+	OldPoints    *int   `json:"oldPoints,omitempty"`
+	RulesVersion string `json:"rulesVersion,omitempty"`
+}
+
+// SocketHandler serves the WebSocket API. Clients send {"type": "submit", "receipt": {...}} to process
+// a receipt, answered with a processed or error message, and {"type": "watch", "receiptId": "..."} to
+// follow a stored one. The connection then gets a points message whenever the points of a receipt it
+// submitted or watched change, e.g. when its rules version is rescored. Submissions are recorded under
+// the tenant and channel of the handshake.
+func (s *Server) SocketHandler(w http.ResponseWriter, req *http.Request) {
+	conn, err := socketUpgrader.Upgrade(w, req, nil)
+	if err != nil {
+		// The upgrader has answered the handshake with an error
+		return
+	}
+	defer conn.Close()
+
+	// The connection outlives the request timeout; each message gets it instead
+	ctx := context.WithoutCancel(req.Context())
+	limit := config.Duration("REQUEST_TIMEOUT", time.Minute)
+	tenant := tenantFromRequest(req)
+	channel := submissionChannel(req, service.ChannelSocket)
+
+	changes, stop := s.svc.FollowPointsChanges(streamBuffer)
+	defer stop()
+
+	conn.SetReadLimit(maxSocketMessageSize)
+	conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	conn.SetPongHandler(func(string) error { return conn.SetReadDeadline(time.Now().Add(socketPongWait)) })
+	requests := make(chan socketRequest)
+	closed, done := make(chan struct{}), make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(closed)
+		for {
+			var request socketRequest
+			if err := conn.ReadJSON(&request); err != nil {
+				var syntaxErr *json.SyntaxError
+				var typeErr *json.UnmarshalTypeError
+				if !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr) {
+					return
+				}
+				request = socketRequest{Type: "invalid"}
+			}
+			select {
+			case requests <- request:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	watched := make(map[string]bool)
+	ping := time.NewTicker(socketPingPeriod)
+	defer ping.Stop()
+	for {
+		var message socketMessage
+		select {
+		case <-closed:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketPingPeriod)); err != nil {
+				return
+			}
+			continue
+		case change := <-changes:
+			if !watched[change.ReceiptID] {
+				continue
+			}
+			message = socketMessage{Type: "points", ID: change.ReceiptID, Points: &change.Points, OldPoints: &change.OldPoints, RulesVersion: change.RulesVersion}
+		case request := <-requests:
+			msgCtx, cancel := ctx, func() {}
+			if limit > 0 {
+				msgCtx, cancel = context.WithTimeout(ctx, limit)
+			}
+			message = s.answerSocketRequest(msgCtx, tenant, channel, request)
+			cancel()
+			message.Ref = request.Ref
+			if message.Type != "error" {
+				watched[message.ID] = true
+			}
+		}
+		conn.SetWriteDeadline(time.Now().Add(socketPingPeriod))
+		if err := conn.WriteJSON(message); err != nil {
+			return
+		}
+	}
+}
+
+// answerSocketRequest carries out one client request
+func (s *Server) answerSocketRequest(ctx context.Context, tenant, channel string, request socketRequest) socketMessage {
+	switch request.Type {
+	case "submit":
+		if request.Receipt == nil {
+			return socketError(http.StatusBadRequest, "A submission needs a receipt")
+		}
+		receipt := *request.Receipt
+		receipt.Channel = channel
+		receipt, err := s.svc.ProcessReceipt(ctx, tenant, receipt)
+		var dup *service.DuplicateError
+		switch {
+		case errors.As(err, &dup):
+			message := socketError(http.StatusConflict, "Duplicate receipt")
+			message.DuplicateOf = dup.ExistingID
+			return message
+		case errors.Is(err, service.ErrInvalidReceipt):
+			return socketError(http.StatusBadRequest, err.Error())
+		case err != nil && !errors.Is(err, service.ErrReceiptBuffered):
+			return socketError(http.StatusServiceUnavailable, err.Error())
+		}
+		points := s.points(receipt)
+		message := socketMessage{Type: "processed", ID: receipt.ID, ShortCode: receipt.ShortCode, Points: &points}
+		if err != nil {
+			message.Status = "buffered"
+		}
+		return message
+	case "watch":
+		receipt, exists, err := s.svc.FindReceipt(ctx, request.ReceiptID)
+		if err != nil {
+			return socketError(http.StatusServiceUnavailable, err.Error())
+		}
+		if !exists {
+			return socketError(http.StatusNotFound, "Receipt not found")
+		}
+		points := s.points(receipt)
+		return socketMessage{Type: "watching", ID: receipt.ID, ShortCode: receipt.ShortCode, Points: &points}
+	case "invalid":
+		return socketError(http.StatusBadRequest, "Failed to decode message")
+	}
+	return socketError(http.StatusBadRequest, "Unknown message type "+request.Type)
+}
+
+// socketError is the error message answering a request
+func socketError(code int, text string) socketMessage {
+	return socketMessage{Type: "error", Code: code, Error: text}
+}
@@ -0,0 +1,102 @@
+function getJSON(path) {
+	return fetch(path, {headers: {"Accept": "application/json"}}).then(function (response) {
+		// The health endpoint answers 503 with the failure, which the dashboard shows
+		if (!response.ok && response.status !== 503) {
+			return response.text().then(function (text) { throw new Error(path + ": " + text); });
+		}
+		return response.json();
+	});
+}
+
+function showError(error) {
+	document.getElementById("error").textContent = error.message;
+}
+
+// receiptRow adds a row to a table body, with the ID linking to the receipt's page
+function receiptRow(body, receipt, cells) {
+	var row = body.insertRow();
+	var link = document.createElement("a");
+	link.href = "receipts/" + encodeURIComponent(receipt.id) + "/view";
+	link.textContent = receipt.id;
+	row.insertCell().appendChild(link);
+	cells.forEach(function (value) {
+		row.insertCell().textContent = value === undefined || value === null ? "" : value;
+	});
+}
+
+function loadPoints() {
+	return getJSON("v1/analytics/points").then(function (points) {
+		document.getElementById("points-total").textContent = points.total;
+		document.getElementById("points-summary").textContent = points.count + " receipts, mean " + points.mean +
+			(points.count ? ", min " + points.min + ", max " + points.max : "");
+	});
+}
+
+function loadHealth() {
+	return getJSON("admin/health").then(function (health) {
+		var status = document.getElementById("health-status");
+		status.textContent = health.healthy ? "Healthy" : "Unhealthy";
+		status.className = health.healthy ? "healthy" : "unhealthy";
+		document.getElementById("health-detail").textContent = health.backend + ", answered in " + health.latency +
+			", " + health.buffered + " receipts buffered" + (health.error ? ": " + health.error : "");
+	});
+}
+
+function loadVolume() {
+	return getJSON("admin/metrics").then(function (series) {
+		var max = 0, total = 0;
+		series.forEach(function (bucket) {
+			max = Math.max(max, bucket.receipts);
+			total += bucket.receipts;
+		});
+		var svg = document.getElementById("volume");
+		svg.innerHTML = "";
+		series.forEach(function (bucket, i) {
+			var height = max ? Math.round(bucket.receipts * 120 / max) : 0;
+			var bar = document.createElementNS("http://www.w3.org/2000/svg", "rect");
+			bar.setAttribute("x", i * 10);
+			bar.setAttribute("y", 120 - height);
+			bar.setAttribute("width", 8);
+			bar.setAttribute("height", height);
+			var title = document.createElementNS("http://www.w3.org/2000/svg", "title");
+			title.textContent = new Date(bucket.minute * 60000).toLocaleTimeString() + ": " + bucket.receipts;
+			bar.appendChild(title);
+			svg.appendChild(bar);
+		});
+		document.getElementById("volume-summary").textContent = total + " receipts in the last " + series.length + " minutes, peak " + max + "/min";
+	});
+}
+
+function loadRecent() {
+	return getJSON("v1/receipts?sort=-scoredAt&limit=10").then(function (list) {
+		var body = document.getElementById("recent");
+		body.innerHTML = "";
+		list.receipts.forEach(function (receipt) {
+			receiptRow(body, receipt, [receipt.retailer, receipt.purchaseDate + " " + receipt.purchaseTime, receipt.total,
+				receipt.points, receipt.state, receipt.scoredAt ? new Date(receipt.scoredAt).toLocaleString() : ""]);
+		});
+	});
+}
+
+function loadFlagged() {
+	return getJSON("admin/fraud?limit=10").then(function (fraud) {
+		var counts = Object.keys(fraud.flags).sort().map(function (flag) { return flag + ": " + fraud.flags[flag]; });
+		document.getElementById("flag-counts").textContent = fraud.total + " flagged receipts" + (counts.length ? " (" + counts.join(", ") + ")" : "");
+		var body = document.getElementById("flagged");
+		body.innerHTML = "";
+		fraud.receipts.forEach(function (receipt) {
+			receiptRow(body, receipt, [receipt.retailer, receipt.purchaseDate + " " + receipt.purchaseTime,
+				receipt.points, receipt.state, receipt.fraudFlags.join(", ")]);
+		});
+	});
+}
+
+function refresh() {
+	document.getElementById("error").textContent = "";
+	[loadPoints, loadHealth, loadVolume, loadRecent, loadFlagged].forEach(function (load) {
+		load().catch(showError);
+	});
+}
+
+refresh();
+setInterval(refresh, 30000);
@@ -0,0 +1,5 @@
+// csrfToken returns the token the server set in the receipt_csrf cookie, which writes send back as X-CSRF-Token
+function csrfToken() {
+	var match = document.cookie.match(/(?:^|;\s*)receipt_csrf=([^;]*)/);
+	return match ? decodeURIComponent(match[1]) : "";
+}
@@ -0,0 +1,45 @@
+// JavaScript code to handle form submission
+document.getElementById("jsonForm").addEventListener("submit", function(event) {
+	event.preventDefault(); // Prevent the default form submission
+
+	var file = document.getElementById("receiptFile").files[0];
+	var jsonData = document.getElementById("jsonData").value;
+	var request;
+	if (file) {
+		// Uploads go to the import endpoint of their format, as a multipart form
+		var form = new FormData();
+		form.append("file", file);
+		var csv = /\.csv$/i.test(file.name) || file.type === "text/csv";
+		request = fetch(csv ? 'v1/receipts/import/csv' : 'v1/receipts/import/json', {
+			method: 'POST',
+			headers: {'Accept': 'text/html', 'X-Receipt-Channel': 'web', 'X-CSRF-Token': csrfToken()},
+			body: form
+		});
+	} else if (jsonData.trim()) {
+		// Send JSON data using fetch API
+		request = fetch('v1/receipts/process', {
+			method: 'POST',
+			headers: {
+				'Content-Type': 'application/json',
+				'Accept': 'text/html',
+				'X-Receipt-Channel': 'web',
+				'X-CSRF-Token': csrfToken()
+			},
+			body: jsonData
+		});
+	} else {
+		alert("Paste a receipt or choose a file to upload.");
+		return;
+	}
+
+	request
+	.then(response => response.text())
+	.then(data => {
+		// Display the outcome
+		document.body.innerHTML = data;
+	})
+	.catch(error => {
+		console.error('Error:', error);
+		alert("Failed to process the receipt. Please try again.");
+	});
+});
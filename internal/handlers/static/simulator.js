@@ -0,0 +1,46 @@
+var timer;
+function simulate() {
+	var body = {};
+	try {
+		body.receipt = JSON.parse(document.getElementById("receipt").value);
+		var version = document.getElementById("version").value;
+		if (version) {
+			body.version = version;
+		} else {
+			body.rules = JSON.parse(document.getElementById("draft").value);
+		}
+	} catch (e) {
+		document.getElementById("error").textContent = "Invalid JSON: " + e.message;
+		return;
+	}
+	fetch("admin/rules/simulate", {method: "POST", headers: {"Content-Type": "application/json", "X-CSRF-Token": csrfToken()}, body: JSON.stringify(body)})
+		.then(function (response) {
+			if (!response.ok) {
+				return response.text().then(function (text) { throw new Error(text); });
+			}
+			return response.json();
+		})
+		.then(function (result) {
+			document.getElementById("error").textContent = "";
+			var rows = document.getElementById("breakdown");
+			rows.innerHTML = "";
+			result.breakdown.forEach(function (score) {
+				var row = rows.insertRow();
+				row.insertCell().textContent = score.rule;
+				row.insertCell().textContent = score.points;
+				row.insertCell().textContent = score.detail;
+			});
+			document.getElementById("points").textContent = result.points;
+			document.getElementById("scored").textContent = "under version " + result.version;
+		})
+		.catch(function (error) {
+			document.getElementById("error").textContent = error.message;
+		});
+}
+["receipt", "version", "draft"].forEach(function (id) {
+	document.getElementById(id).addEventListener("input", function () {
+		clearTimeout(timer);
+		timer = setTimeout(simulate, 200);
+	});
+});
+simulate();
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"receipt-processor/internal/store"
+)
+
+// writeStoreError answers with 503 when the store is down or the request ran out of time, and 500 for
+// anything else
+func writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		http.Error(w, "Request timed out", http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, store.ErrUnavailable) {
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "Receipt store unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// streamBuffer is how many receipts a stream client may fall behind before it misses some
+	streamBuffer = 64
+	// streamHeartbeat is how often an idle stream sends a comment, so proxies do not close it
+	streamHeartbeat = 15 * time.Second
+)
+
+// ReceiptStreamEndpoint pushes every receipt of the tenant processed while the client is connected as a server-sent
+// "receipt" event of {id, retailer, points}. The stream ends with the request timeout; the retry field
+// has EventSource clients reconnect right away.
+func (s *Server) ReceiptStreamEndpoint(w http.ResponseWriter, req *http.Request) {
+	tenant := tenantFromRequest(req)
+	receipts, stop := s.svc.FollowProcessedReceipts(streamBuffer)
+	defer stop()
+
+	controller := http.NewResponseController(w)
+	// A stream outlives the server's write timeout, which would otherwise cut it off
+	controller.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprint(w, "retry: 1000\n\n")
+	controller.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case receipt := <-receipts:
+			if receipt.Tenant != tenant {
+				continue
+			}
+			data, _ := json.Marshal(receipt)
+			fmt.Fprintf(w, "id: %s\nevent: receipt\ndata: %s\n\n", receipt.ID, data)
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
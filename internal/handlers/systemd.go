@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// systemdFirstFD is the first file descriptor systemd passes to a socket-activated service
+const systemdFirstFD = 3
+
+// systemdSocket is a socket systemd passed, with its FileDescriptorName=
+type systemdSocket struct {
+	name     string
+	listener net.Listener
+}
+
+// systemdListeners returns the sockets systemd passed the process with socket activation, in order, or
+// none when it was started without any. The LISTEN_* variables are unset once read, so processes the
+// server starts do not take the sockets for theirs.
+func systemdListeners() ([]systemdSocket, error) {
+	pid, fds, names := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES")
+	if fds == "" {
+		return nil, nil
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	// The variables are meant for the process systemd started, not for one that inherited them from it
+	if pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(fds)
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", fds)
+	}
+	fdNames := strings.Split(names, ":")
+	sockets := make([]systemdSocket, 0, count)
+	for i := 0; i < count; i++ {
+		fd := systemdFirstFD + i
+		file := os.NewFile(uintptr(fd), "systemd socket")
+		// FileListener works on a copy of the descriptor, so the original is closed either way
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket %d from systemd: %w", fd, err)
+		}
+		socket := systemdSocket{listener: listener}
+		if i < len(fdNames) {
+			socket.name = fdNames[i]
+		}
+		sockets = append(sockets, socket)
+	}
+	return sockets, nil
+}
+
+// findSocket returns the listener of the systemd socket with a name, or nil
+func findSocket(sockets []systemdSocket, name string) net.Listener {
+	for _, socket := range sockets {
+		if socket.name == name {
+			return socket.listener
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"receipt-processor/internal/service"
+	"receipt-processor/internal/store"
+)
+
+// UserExportEndpoint downloads everything kept about a user, for data portability: by default a ZIP
+// archive with the whole takeout as takeout.json and receipts.csv, ledger.csv and referrals.csv for
+// spreadsheets, or with ?format=json the JSON alone. Unlike the other exports the receipts are not
+// redacted, since they go back to the user they are about.
+func (s *Server) UserExportEndpoint(w http.ResponseWriter, req *http.Request) {
+	userID, ok := resolveUser(w, req)
+	if !ok {
+		return
+	}
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = "zip"
+	}
+	if format != "zip" && format != "json" {
+		http.Error(w, "format must be zip or json", http.StatusBadRequest)
+		return
+	}
+	takeout, err := s.svc.UserTakeout(req.Context(), userID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="takeout.json"`)
+		json.NewEncoder(w).Encode(takeout)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="takeout.zip"`)
+	if err := s.writeTakeout(w, takeout); err != nil {
+		// The archive has started streaming, so the status cannot change: cut the download short instead,
+		// leaving the client with a truncated ZIP rather than one that looks complete
+		s.logger.Printf("Takeout of user %s failed: %v", userID, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// writeTakeout streams a takeout as a ZIP archive of its JSON and one CSV file per kind of record
+func (s *Server) writeTakeout(w io.Writer, takeout service.UserTakeout) error {
+	archive := zip.NewWriter(w)
+	create := func(name string) (io.Writer, error) {
+		return archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: takeout.ExportedAt})
+	}
+	file, err := create("takeout.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(takeout); err != nil {
+		return err
+	}
+
+	receipts := [][]string{{"id", "shortCode", "retailer", "purchaseDate", "purchaseTime", "total", "items", "points", "state"}}
+	for _, receipt := range takeout.Receipts {
+		receipts = append(receipts, []string{
+			receipt.ID,
+			receipt.ShortCode,
+			receipt.Retailer,
+			receipt.PurchaseDate,
+			receipt.PurchaseTime,
+			receipt.Total,
+			strconv.Itoa(len(receipt.Items)),
+			strconv.Itoa(s.points(receipt)),
+			store.StateOf(receipt),
+		})
+	}
+	ledger := [][]string{{"createdAt", "points", "reason", "receiptId", "id"}}
+	for _, entry := range takeout.Ledger {
+		ledger = append(ledger, []string{entry.CreatedAt.Format(time.RFC3339), strconv.Itoa(entry.Points), entry.Reason, entry.ReceiptID, entry.ID})
+	}
+	referrals := [][]string{{"createdAt", "referee", "referrer", "code", "rewardedAt"}}
+	for _, r := range takeout.Referrals {
+		rewarded := ""
+		if r.RewardedAt != nil {
+			rewarded = r.RewardedAt.Format(time.RFC3339)
+		}
+		referrals = append(referrals, []string{r.CreatedAt.Format(time.RFC3339), r.Referee, r.Referrer, r.Code, rewarded})
+	}
+	for _, part := range []struct {
+		name string
+		rows [][]string
+	}{{"receipts.csv", receipts}, {"ledger.csv", ledger}, {"referrals.csv", referrals}} {
+		file, err := create(part.name)
+		if err != nil {
+			return err
+		}
+		writer := csv.NewWriter(file)
+		if err := writer.WriteAll(part.rows); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
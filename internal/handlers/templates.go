@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+)
+
+// templateFiles are the HTML pages, each executed by its file name, e.g. "home.html"
+//
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+// staticFiles are the scripts the pages load, served under /static/
+//
+//go:embed static
+var staticFiles embed.FS
+
+// parseTemplates parses every page, so that a broken template stops the server at startup instead of
+// failing the first request that renders it
+func parseTemplates() *template.Template {
+	// Pages link relative to <base href="{{ basePath }}/">, so they follow BASE_PATH
+	funcs := template.FuncMap{"basePath": basePath}
+	return template.Must(template.New("").Funcs(funcs).ParseFS(templateFiles, "templates/*.html"))
+}
+
+// renderPage answers with a page template executed with data
+func (s *Server) renderPage(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.templates.ExecuteTemplate(w, name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// staticHandler serves the embedded static assets under /static/
+func staticHandler() http.Handler {
+	assets, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/static/", http.FileServer(http.FS(assets)))
+}
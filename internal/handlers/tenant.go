@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/internal/config"
+	"receipt-processor/internal/service"
+	"receipt-processor/internal/store"
+)
+
+// tenantHeader identifies which tenant a request belongs to
+const tenantHeader = "X-Tenant-ID"
+
+// tenantFromRequest returns the tenant a request was scoped to by tenancy, or else the one its header
+// names, or the default tenant
+func tenantFromRequest(req *http.Request) string {
+	if tenant, ok := store.ScopedTenant(req.Context()); ok {
+		return tenant
+	}
+	if tenant := strings.TrimSpace(req.Header.Get(tenantHeader)); tenant != "" {
+		return tenant
+	}
+	return service.DefaultTenant
+}
+
+// tenantAPIKeys reads TENANT_API_KEYS, key=tenant pairs binding API keys to the one tenant they may act for
+func tenantAPIKeys() map[string]string {
+	return config.Map("TENANT_API_KEYS")
+}
+
+// tenancy scopes every request to one tenant, so handlers and the store below them only see that
+// tenant's receipts, points and rules. A key bound by TENANT_API_KEYS, a client certificate bound by
+// MTLS_TENANTS, or an OIDC session whose user OIDC_TENANTS binds, always acts for its tenant, and is
+// refused another one in X-Tenant-ID. Other credentials, keys of AUTH_API_KEYS or API_KEY_ROLES, other
+// sessions and unbound certificates, only act for the default tenant and are refused any other. Only
+// requests without credentials, when auth is off, act for the tenant their header names.
+func tenancy() mux.MiddlewareFunc {
+	keys, boundKeys, boundCerts := configuredAPIKeys(), tenantAPIKeys(), certTenants()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			tenant := tenantFromRequest(req)
+			named := strings.TrimSpace(req.Header.Get(tenantHeader))
+			key := requestAPIKey(req)
+			sess, signedIn := sessionFromContext(req.Context())
+			identity, hasCert := certIdentity(req)
+			credentialed := validAPIKey(keys, key) || signedIn || hasCert
+			// bound is the tenant the request's key or certificate is bound to, if any
+			bound, _ := keyBinding(boundKeys, key)
+			if signedIn {
+				bound = sess.Tenant
+			}
+			if hasCert {
+				if certTenant, ok := boundCerts[identity]; ok {
+					if bound != "" && bound != certTenant {
+						http.Error(w, "The API key and the client certificate are bound to different tenants", http.StatusForbidden)
+						return
+					}
+					bound = certTenant
+				}
+			}
+			switch {
+			case bound != "":
+				if named != "" && named != bound {
+					http.Error(w, "Credentials are not valid for tenant "+named, http.StatusForbidden)
+					return
+				}
+				tenant = bound
+			case credentialed:
+				if named != "" && named != service.DefaultTenant {
+					http.Error(w, "Credentials are not bound to tenant "+named, http.StatusForbidden)
+					return
+				}
+				tenant = service.DefaultTenant
+			}
+			next.ServeHTTP(w, req.WithContext(service.WithTenant(req.Context(), tenant)))
+		})
+	}
+}
+
+// keyBinding returns what an API key is bound to in a key=value setting, comparing in constant time like
+// validAPIKey
+func keyBinding(bound map[string]string, key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	value, found := "", false
+	for k, v := range bound {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			value, found = v, true
+		}
+	}
+	return value, found
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTenancy(t *testing.T) {
+	t.Setenv("AUTH_API_KEYS", "operator-key")
+	t.Setenv("API_KEY_ROLES", "reader-key=read-only")
+	t.Setenv("TENANT_API_KEYS", "acme-key=acme")
+	router := newTestServer(t)
+
+	tests := []struct {
+		name       string
+		key        string
+		tenant     string
+		wantStatus int
+	}{
+		{"bound key", "acme-key", "", http.StatusOK},
+		{"bound key naming its tenant", "acme-key", "acme", http.StatusOK},
+		{"bound key naming another tenant", "acme-key", "globex", http.StatusForbidden},
+		{"unbound key", "operator-key", "", http.StatusOK},
+		{"unbound key naming the default tenant", "operator-key", "default", http.StatusOK},
+		{"unbound key naming another tenant", "operator-key", "acme", http.StatusForbidden},
+		{"role key naming another tenant", "reader-key", "acme", http.StatusForbidden},
+		{"no key", "", "acme", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/receipts", nil)
+			if tt.key != "" {
+				req.Header.Set("X-API-Key", tt.key)
+			}
+			if tt.tenant != "" {
+				req.Header.Set(tenantHeader, tt.tenant)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"receipt-processor/internal/service"
+)
+
+// UserEndpoint returns a user's balance and loyalty tier
+func (s *Server) UserEndpoint(w http.ResponseWriter, req *http.Request) {
+	userID, ok := resolveUser(w, req)
+	if !ok {
+		return
+	}
+	profile := service.UserProfile{UserID: userID, RollingSince: s.svc.TierWindowStart(s.svc.Now().UTC())}
+	var err error
+	if profile.Balance, err = s.svc.UserBalance(req.Context(), userID); err == nil {
+		profile.RollingPoints, err = s.svc.RollingPoints(req.Context(), userID, profile.RollingSince)
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	profile.Tier, profile.NextTier, profile.PointsToNextTier = s.svc.TierFor(profile.RollingPoints)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
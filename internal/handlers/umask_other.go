@@ -0,0 +1,8 @@
+//go:build !unix
+
+package handlers
+
+// ownerOnlyUmask does nothing where there is no umask
+func ownerOnlyUmask() (restore func()) {
+	return func() {}
+}
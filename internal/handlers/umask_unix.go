@@ -0,0 +1,12 @@
+//go:build unix
+
+package handlers
+
+import "syscall"
+
+// ownerOnlyUmask keeps the group and others out of the files created until restore is called. The umask
+// is the process's, so it is only meant for the listeners created at startup.
+func ownerOnlyUmask() (restore func()) {
+	old := syscall.Umask(0o177)
+	return func() { syscall.Umask(old) }
+}
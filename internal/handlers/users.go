@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/internal/config"
+)
+
+// userContextKey keys the loyalty member a request's credentials are bound to in its context
+type userContextKey struct{}
+
+// apiKeyUsers reads API_KEY_USERS, key=user pairs binding API keys to the loyalty member they act as
+func apiKeyUsers() map[string]string {
+	return config.Map("API_KEY_USERS")
+}
+
+// withUser stores the loyalty member a request's credentials are bound to in its context, for /users/me
+func withUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userContextKey{}, user)
+}
+
+// userFromContext returns the user stored by withUser
+func userFromContext(ctx context.Context) (string, bool) {
+	user, ok := ctx.Value(userContextKey{}).(string)
+	return user, ok && user != ""
+}
+
+// currentUser returns the user "me" stands for: the one the request's credentials are bound to, never a
+// user the request names itself. It answers 403 and reports false when the credentials are bound to none.
+func currentUser(w http.ResponseWriter, req *http.Request) (string, bool) {
+	user, ok := userFromContext(req.Context())
+	if !ok {
+		http.Error(w, "These credentials are not bound to a user, so there is no me", http.StatusForbidden)
+	}
+	return user, ok
+}
+
+// resolveUser returns the user a /users/{user} path names, with "me" for the request's own user.
+func resolveUser(w http.ResponseWriter, req *http.Request) (string, bool) {
+	if user := mux.Vars(req)["user"]; user != "me" {
+		return user, true
+	}
+	return currentUser(w, req)
+}
+
+// PointsSummaryEndpoint returns a user's monthly rewards statement, ?month=YYYY-MM (default: the current month)
+func (s *Server) PointsSummaryEndpoint(w http.ResponseWriter, req *http.Request) {
+	userID, ok := resolveUser(w, req)
+	if !ok {
+		return
+	}
+	month := req.URL.Query().Get("month")
+	if month == "" {
+		month = s.svc.Now().UTC().Format("2006-01")
+	}
+	if _, err := time.Parse("2006-01", month); err != nil {
+		http.Error(w, "month must be YYYY-MM", http.StatusBadRequest)
+		return
+	}
+
+	summary, err := s.svc.SummarizePoints(req.Context(), userID, month)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// EraseUserDataEndpoint erases a user's receipts, points ledger and referrals and anonymizes the audit
+// entries about them, for a right-to-erasure request, returning what was erased
+func (s *Server) EraseUserDataEndpoint(w http.ResponseWriter, req *http.Request) {
+	userID, ok := resolveUser(w, req)
+	if !ok {
+		return
+	}
+	report, err := s.svc.EraseUser(req.Context(), userID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
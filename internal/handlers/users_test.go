@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUserExportAccess(t *testing.T) {
+	t.Setenv("API_KEY_ROLES", "alice-key=submitter,unbound-key=submitter,admin-key=admin")
+	t.Setenv("API_KEY_USERS", "alice-key=alice")
+	router := newTestServer(t)
+
+	tests := []struct {
+		name       string
+		key        string
+		user       string
+		header     string
+		wantStatus int
+	}{
+		{"me", "alice-key", "me", "", http.StatusOK},
+		{"own id", "alice-key", "alice", "", http.StatusOK},
+		{"another user", "alice-key", "bob", "", http.StatusForbidden},
+		{"me claimed by header", "alice-key", "me", "bob", http.StatusOK},
+		{"me without a bound user", "unbound-key", "me", "alice", http.StatusForbidden},
+		{"admin exporting another user", "admin-key", "bob", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/"+tt.user+"/export?format=json", nil)
+			req.Header.Set("X-API-Key", tt.key)
+			if tt.header != "" {
+				req.Header.Set("X-User-ID", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
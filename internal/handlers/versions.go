@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// currentAPIVersion is the version the unversioned legacy paths alias
+const currentAPIVersion = "v1"
+
+// apiRoute is one JSON endpoint, registered once per API version
+type apiRoute struct {
+	Path    string
+	Methods []string
+	Handler http.Handler
+}
+
+// apiRoutes lists the JSON endpoints served under every version prefix.
+// Handlers that need to behave differently in a later version should branch
+// on apiVersion(req) at the edges (decoding and encoding) rather than be forked.
+// The receipt routes of the Receipts service are its HTTP bindings, served by
+// the gateway.
+func (s *Server) apiRoutes() []apiRoute {
+	return []apiRoute{
+		{"/receipts/process", []string{"POST"}, s.idempotent(s.processReceiptRoute())},
+		{"/receipts/process/batch", []string{"POST"}, s.idempotent(http.HandlerFunc(s.ProcessBatchReceiptsEndpoint))},
+		{"/receipts/import/csv", []string{"POST"}, http.HandlerFunc(s.ImportCSVEndpoint)},
+		{"/receipts/import/json", []string{"POST"}, http.HandlerFunc(s.ImportJSONEndpoint)},
+		{"/receipts/bulk", []string{"POST"}, http.HandlerFunc(s.BulkNDJSONEndpoint)},
+		{"/receipts/pos", []string{"POST"}, http.HandlerFunc(s.ProcessPOSReceiptEndpoint)},
+		{"/receipts/ocr", []string{"POST"}, http.HandlerFunc(s.ProcessOCRReceiptEndpoint)},
+		{"/receipts/barcode", []string{"POST"}, http.HandlerFunc(s.ProcessBarcodeReceiptEndpoint)},
+		{"/receipts", []string{"GET"}, s.listReceiptsRoute()},
+		{"/receipts/export", []string{"GET"}, http.HandlerFunc(s.ExportReceiptsEndpoint)},
+		{"/receipts/search", []string{"GET"}, http.HandlerFunc(s.SearchReceiptsEndpoint)},
+		{"/receipts/stream", []string{"GET"}, http.HandlerFunc(s.ReceiptStreamEndpoint)},
+		{"/receipts/{id}", []string{"GET"}, conditional(s.getReceiptRoute())},
+		{"/receipts/{id}/points", []string{"GET"}, conditional(s.getPointsRoute())},
+		{"/receipts/{id}/explain", []string{"GET"}, http.HandlerFunc(s.ExplainPointsEndpoint)},
+		{"/receipts/{id}/items/{item}", []string{"PATCH"}, http.HandlerFunc(s.TagItemEndpoint)},
+		{"/users/{user}", []string{"GET"}, http.HandlerFunc(s.UserEndpoint)},
+		{"/users/{user}/balance", []string{"GET"}, http.HandlerFunc(s.UserBalanceEndpoint)},
+		{"/users/{user}/points/summary", []string{"GET"}, http.HandlerFunc(s.PointsSummaryEndpoint)},
+		{"/users/{user}/ledger", []string{"GET"}, http.HandlerFunc(s.UserLedgerEndpoint)},
+		{"/users/{user}/referral-code", []string{"POST"}, http.HandlerFunc(s.ReferralCodeEndpoint)},
+		{"/users/{user}/referral", []string{"POST"}, http.HandlerFunc(s.RedeemReferralEndpoint)},
+		{"/users/{user}/data", []string{"DELETE"}, http.HandlerFunc(s.EraseUserDataEndpoint)},
+		{"/users/{user}/export", []string{"GET"}, http.HandlerFunc(s.UserExportEndpoint)},
+		{"/leaderboard", []string{"GET"}, http.HandlerFunc(s.LeaderboardEndpoint)},
+		{"/analytics/retailers", []string{"GET"}, http.HandlerFunc(s.RetailerAnalyticsEndpoint)},
+		{"/analytics/points", []string{"GET"}, http.HandlerFunc(s.PointsAnalyticsEndpoint)},
+		{"/rules/active", []string{"GET"}, http.HandlerFunc(s.ActiveRulesEndpoint)},
+		{"/jobs/{id}", []string{"GET"}, http.HandlerFunc(s.GetJobEndpoint)},
+		{"/graphql", []string{"GET", "POST"}, s.GraphQLHandler()},
+	}
+}
+
+type apiVersionContextKey struct{}
+
+// apiVersion returns the API version the request was routed through
+func apiVersion(req *http.Request) string {
+	return apiVersionOf(req.Context())
+}
+
+// apiVersionOf returns the API version of the request a context is of
+func apiVersionOf(ctx context.Context) string {
+	if version, ok := ctx.Value(apiVersionContextKey{}).(string); ok {
+		return version
+	}
+	return currentAPIVersion
+}
+
+// mountAPIVersion registers every API route under /<version>
+func (s *Server) mountAPIVersion(router *mux.Router, version string) {
+	sub := router.PathPrefix("/" + version).Subrouter()
+	for _, route := range s.apiRoutes() {
+		sub.Handle(route.Path, withAPIVersion(version, route.Handler)).Methods(route.Methods...)
+	}
+}
+
+// mountLegacyAPI keeps the pre-versioning paths working as deprecated aliases of currentAPIVersion
+func (s *Server) mountLegacyAPI(router *mux.Router) {
+	for _, route := range s.apiRoutes() {
+		handler := withAPIVersion(currentAPIVersion, route.Handler)
+		router.Handle(route.Path, deprecated(handler)).Methods(route.Methods...)
+	}
+}
+
+// withAPIVersion records the API version in the request context
+func withAPIVersion(version string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := context.WithValue(req.Context(), apiVersionContextKey{}, version)
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// deprecated marks responses from a legacy path and points clients at its versioned successor
+func deprecated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		successor := "/" + currentAPIVersion + req.URL.Path
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		next.ServeHTTP(w, req)
+	})
+}
+
+// Router registers every page, API and admin route
+func (s *Server) Router() *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/", s.HomePageHandler).Methods("GET") // New route for the home page
+	router.HandleFunc("/receipts/{id}/view", s.ReceiptPageHandler).Methods("GET")
+	router.HandleFunc("/history", s.HistoryPageHandler).Methods("GET")
+	router.HandleFunc("/ws", s.SocketHandler).Methods("GET")
+	router.PathPrefix("/static/").Handler(staticHandler()).Methods("GET")
+	s.mountAPIVersion(router, "v1")
+	s.mountLegacyAPI(router)
+	router.HandleFunc("/admin", s.AdminDashboardHandler).Methods("GET")
+	router.HandleFunc("/admin/metrics", s.AdminMetricsHandler).Methods("GET")
+	router.HandleFunc("/admin/health", s.StoreHealthHandler).Methods("GET")
+	router.HandleFunc("/admin/duplicates", s.DuplicateStatsHandler).Methods("GET")
+	router.HandleFunc("/admin/fraud", s.FraudReceiptsHandler).Methods("GET")
+	router.HandleFunc("/admin/audit", s.AuditLogHandler).Methods("GET")
+	router.HandleFunc("/admin/channels", s.ChannelStatsHandler).Methods("GET")
+	router.HandleFunc("/admin/rules", s.ListRulesHandler).Methods("GET")
+	router.HandleFunc("/admin/rules", s.CreateRulesHandler).Methods("POST")
+	router.HandleFunc("/admin/rules/simulate", s.SimulateRulesHandler).Methods("POST")
+	router.HandleFunc("/admin/rules/reload", s.ReloadRulesHandler).Methods("POST")
+	router.HandleFunc("/admin/rules/{version}/activate", s.ActivateRulesHandler).Methods("POST")
+	router.HandleFunc("/admin/rules/{version}/rescore", s.RescoreRulesHandler).Methods("POST")
+	router.HandleFunc("/admin/simulator", s.SimulatorPageHandler).Methods("GET")
+	router.HandleFunc("/admin/reconcile", s.ReconcileHandler).Methods("POST")
+	router.HandleFunc("/admin/receipts/{id}/state", s.TransitionReceiptHandler).Methods("POST")
+	router.HandleFunc("/admin/receipts/recalculate", s.RecalculateReceiptsHandler).Methods("POST")
+	router.HandleFunc("/admin/receipts/{id}/recalculate", s.RecalculateReceiptHandler).Methods("POST")
+	router.HandleFunc("/admin/balances/check", s.BalanceCheckHandler).Methods("GET")
+	router.HandleFunc("/admin/retailers/aliases", s.ListRetailerAliasesHandler).Methods("GET")
+	router.HandleFunc("/admin/retailers/aliases/{alias}", s.PutRetailerAliasHandler).Methods("PUT")
+	router.HandleFunc("/admin/retailers/aliases/{alias}", s.DeleteRetailerAliasHandler).Methods("DELETE")
+	router.HandleFunc("/admin/retailers/normalize", s.NormalizeRetailerHandler).Methods("GET")
+	router.HandleFunc("/admin/balances/check", s.RunBalanceCheckHandler).Methods("POST")
+	router.HandleFunc("/admin/campaigns", s.ListCampaignsHandler).Methods("GET")
+	router.HandleFunc("/admin/campaigns", s.CreateCampaignHandler).Methods("POST")
+	router.HandleFunc("/admin/campaigns/{id}", s.GetCampaignHandler).Methods("GET")
+	router.HandleFunc("/admin/campaigns/{id}", s.PutCampaignHandler).Methods("PUT")
+	router.HandleFunc("/admin/campaigns/{id}", s.DeleteCampaignHandler).Methods("DELETE")
+	router.HandleFunc("/admin/query", s.AdminQueryHandler).Methods("POST")
+	router.HandleFunc("/admin/retention", s.RetentionStatusHandler).Methods("GET")
+	router.HandleFunc("/admin/retention/purge", s.PurgeReceiptsHandler).Methods("POST")
+	router.HandleFunc("/admin/exports/s3", s.S3ExportStatusHandler).Methods("GET")
+	router.HandleFunc("/admin/exports/s3/run", s.RunS3ExportHandler).Methods("POST")
+	router.HandleFunc("/version", s.VersionHandler).Methods("GET")
+	router.HandleFunc("/openapi.json", s.OpenAPIHandler).Methods("GET")
+	router.HandleFunc("/docs", s.SwaggerUIHandler).Methods("GET")
+	s.mountDebug(router)
+	if s.oidc != nil {
+		router.HandleFunc("/auth/login", s.LoginHandler).Methods("GET")
+		router.HandleFunc("/auth/callback", s.CallbackHandler).Methods("GET")
+		router.HandleFunc("/auth/logout", s.LogoutHandler).Methods("POST")
+	}
+	chain := s.middlewareChain()
+	router.Use(chain...)
+	// Tenancy and the client's address are not optional, and come last so that requests are authenticated
+	// before them
+	router.Use(tenancy(), clientAddress())
+	// Requests no route matches skip the router's middleware, so they get the chain too, to be logged
+	var notFound http.Handler = http.NotFoundHandler()
+	for i := len(chain) - 1; i >= 0; i-- {
+		notFound = chain[i](notFound)
+	}
+	router.NotFoundHandler = notFound
+	return router
+}
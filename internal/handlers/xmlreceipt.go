@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"receipt-processor/internal/store"
+)
+
+// isXMLContentType reports whether a request body is XML
+func isXMLContentType(contentType string) bool {
+	return strings.HasPrefix(contentType, "application/xml") || strings.HasPrefix(contentType, "text/xml")
+}
+
+// decodeReceipt reads a submitted receipt as strict JSON, as XML through the element mapping when the
+// request says Content-Type: application/xml or text/xml, or as protobuf or MessagePack when it says
+// application/x-protobuf or application/msgpack; errors are for writeDecodeError
+func (s *Server) decodeReceipt(w http.ResponseWriter, req *http.Request) (store.Receipt, error) {
+	contentType := req.Header.Get("Content-Type")
+	if media := binaryContentType(contentType); media != "" {
+		return s.decodeBinaryReceipt(w, req, media)
+	}
+	if !isXMLContentType(contentType) {
+		var receipt store.Receipt
+		err := s.decodeJSON(w, req, &receipt)
+		return receipt, err
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, req.Body, s.maxBodySize))
+	if err != nil {
+		return store.Receipt{}, err
+	}
+	return s.svc.ParseXMLReceipt(data)
+}
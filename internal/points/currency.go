@@ -0,0 +1,37 @@
+package points
+
+import (
+	"math"
+
+	"receipt-processor/internal/store"
+	"receipt-processor/scoring"
+)
+
+// InBaseCurrency converts a receipt's total and item prices into the base currency at the rate recorded
+// when it was admitted, so rate changes never move the points of stored receipts
+func InBaseCurrency(receipt store.Receipt) store.Receipt {
+	if receipt.ExchangeRate == 0 || receipt.ExchangeRate == 1 {
+		return receipt
+	}
+	convert := func(amount string) string {
+		cents, err := scoring.ParseCents(amount)
+		if err != nil {
+			return amount
+		}
+		return scoring.FormatCents(int64(math.Round(float64(cents) / receipt.ExchangeRate)))
+	}
+	receipt.Total = convert(receipt.Total)
+	if receipt.Tax != "" {
+		receipt.Tax = convert(receipt.Tax)
+	}
+	if receipt.Tip != "" {
+		receipt.Tip = convert(receipt.Tip)
+	}
+	items := make([]store.ReceiptItem, len(receipt.Items))
+	for i, item := range receipt.Items {
+		item.Price = convert(item.Price)
+		items[i] = item
+	}
+	receipt.Items = items
+	return receipt
+}
@@ -0,0 +1,67 @@
+// Package points scores stored receipts with the scoring rules, converting foreign-currency amounts
+// into the base currency first. It has no HTTP or configuration dependencies, so it can be used as a
+// library wherever receipts are scored.
+package points
+
+import (
+	"receipt-processor/internal/store"
+	"receipt-processor/scoring"
+)
+
+// Calculate calculates the points awarded for a receipt based on the given rules
+func Calculate(rules store.RuleConfig, receipt store.Receipt) int {
+	points := 0
+	for _, score := range Scores(rules, receipt) {
+		points += score.Points
+	}
+	return points
+}
+
+// Scores scores a receipt rule by rule under the given rules. The dollar-based rules are
+// applied to the amounts converted into the base currency.
+func Scores(rules store.RuleConfig, receipt store.Receipt) []scoring.RuleScore {
+	return scoring.Explain(rules.Rules, ScoringReceipt(InBaseCurrency(receipt)))
+}
+
+// ScoringReceipt is the part of a receipt the points rules look at
+func ScoringReceipt(receipt store.Receipt) scoring.Receipt {
+	scored := scoring.Receipt{
+		Retailer:     receipt.Retailer,
+		PurchaseDate: receipt.PurchaseDate,
+		PurchaseTime: receipt.PurchaseTime,
+		Total:        receipt.Total,
+		Tax:          receipt.Tax,
+		Tip:          receipt.Tip,
+		Channel:      receipt.Channel,
+		Tier:         receipt.Tier,
+		Items:        make([]scoring.Item, len(receipt.Items)),
+		Campaigns:    receipt.Campaigns,
+	}
+	for i, item := range receipt.Items {
+		scored.Items[i] = scoring.Item{ShortDescription: item.ShortDescription, Price: item.Price, Category: item.Category}
+	}
+	return scored
+}
+
+// DefaultRules is the original scoring, version 1
+var DefaultRules = store.RuleConfig{Version: "1", Rules: scoring.DefaultRules}
+
+// SpecRules is version 2, the original scoring in spec mode. It is built in but not active, so stored
+// receipts move to it only when it is activated with recalculate.
+var SpecRules = store.RuleConfig{Version: "2", Rules: scoring.SpecRules}
+
+// Explanation is a receipt's points under one rules version, rule by rule
+type Explanation struct {
+	Version   string              `json:"version"`
+	Points    int                 `json:"points"`
+	Breakdown []scoring.RuleScore `json:"breakdown"`
+}
+
+// Explain scores a receipt under the given rules and explains the result
+func Explain(rules store.RuleConfig, receipt store.Receipt) Explanation {
+	explanation := Explanation{Version: rules.Version, Breakdown: Scores(rules, receipt)}
+	for _, score := range explanation.Breakdown {
+		explanation.Points += score.Points
+	}
+	return explanation
+}
@@ -0,0 +1,222 @@
+// Package query parses and validates the query parameters shared by list endpoints:
+// pagination (limit, offset), sorting (sort), field selection (fields) and filters.
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FilterType is the type a filter value must parse as
+type FilterType int
+
+const (
+	String FilterType = iota
+	Date              // YYYY-MM-DD
+	Int
+	Decimal
+)
+
+// Spec describes what one list endpoint accepts
+type Spec struct {
+	// Filters maps filter parameter names to the type of their values
+	Filters map[string]FilterType
+	// Sortable lists the fields "sort" may name
+	Sortable []string
+	// DefaultSort applies when "sort" is absent, in the same "-field,field" syntax
+	DefaultSort string
+	// Fields lists the fields "fields" may select; an empty selection means all of them
+	Fields []string
+	// DefaultLimit applies when "limit" is absent and MaxLimit caps it
+	DefaultLimit int
+	MaxLimit     int
+}
+
+// SortKey is one field to sort by
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// Params are the validated parameters of a list request
+type Params struct {
+	Limit  int
+	Offset int
+	Sort   []SortKey
+	// Fields is the requested field selection, or nil for every field
+	Fields []string
+	// Filters holds the filters present in the request, keyed by name, as validated strings
+	Filters map[string]string
+}
+
+// Error reports an invalid query parameter
+type Error struct {
+	Param   string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Param, e.Message)
+}
+
+// Parse validates the query parameters of a request against the spec
+func Parse(values url.Values, spec Spec) (Params, error) {
+	params := Params{Limit: spec.DefaultLimit, Filters: make(map[string]string)}
+
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return Params{}, &Error{"limit", "must be a positive integer"}
+		}
+		params.Limit = limit
+	}
+	if spec.MaxLimit > 0 && params.Limit > spec.MaxLimit {
+		params.Limit = spec.MaxLimit
+	}
+	if raw := values.Get("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return Params{}, &Error{"offset", "must be a non-negative integer"}
+		}
+		params.Offset = offset
+	}
+
+	rawSort := values.Get("sort")
+	if rawSort == "" {
+		rawSort = spec.DefaultSort
+	}
+	for _, field := range splitList(rawSort) {
+		key := SortKey{Field: strings.TrimPrefix(field, "-"), Desc: strings.HasPrefix(field, "-")}
+		if !contains(spec.Sortable, key.Field) {
+			return Params{}, &Error{"sort", fmt.Sprintf("cannot sort by %q", key.Field)}
+		}
+		params.Sort = append(params.Sort, key)
+	}
+
+	for _, field := range splitList(values.Get("fields")) {
+		if !contains(spec.Fields, field) {
+			return Params{}, &Error{"fields", fmt.Sprintf("unknown field %q", field)}
+		}
+		params.Fields = append(params.Fields, field)
+	}
+
+	for name, filterType := range spec.Filters {
+		raw := strings.TrimSpace(values.Get(name))
+		if raw == "" {
+			continue
+		}
+		if err := checkType(raw, filterType); err != nil {
+			return Params{}, &Error{name, err.Error()}
+		}
+		params.Filters[name] = raw
+	}
+	return params, nil
+}
+
+// checkType reports whether a filter value parses as its type
+func checkType(raw string, filterType FilterType) error {
+	switch filterType {
+	case Date:
+		if _, err := time.Parse("2006-01-02", raw); err != nil {
+			return fmt.Errorf("%q is not a YYYY-MM-DD date", raw)
+		}
+	case Int:
+		if _, err := strconv.Atoi(raw); err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+	case Decimal:
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+	}
+	return nil
+}
+
+// Filter returns a filter value, reporting whether the request set it
+func (p Params) Filter(name string) (string, bool) {
+	value, ok := p.Filters[name]
+	return value, ok
+}
+
+// Int returns an Int filter value, reporting whether the request set it
+func (p Params) Int(name string) (int, bool) {
+	value, err := strconv.Atoi(p.Filters[name])
+	return value, err == nil
+}
+
+// Decimal returns a Decimal filter value, reporting whether the request set it
+func (p Params) Decimal(name string) (float64, bool) {
+	value, err := strconv.ParseFloat(p.Filters[name], 64)
+	return value, err == nil
+}
+
+// Selects reports whether a field is part of the field selection
+func (p Params) Selects(field string) bool {
+	return p.Fields == nil || contains(p.Fields, field)
+}
+
+// Project keeps only the selected fields of a record
+func (p Params) Project(record map[string]interface{}) map[string]interface{} {
+	if p.Fields == nil {
+		return record
+	}
+	projected := make(map[string]interface{}, len(p.Fields))
+	for _, field := range p.Fields {
+		if value, ok := record[field]; ok {
+			projected[field] = value
+		}
+	}
+	return projected
+}
+
+// SortSlice sorts items by the sort keys in order; compare returns <0, 0 or >0 for one field
+func SortSlice[T any](items []T, keys []SortKey, compare func(a, b T, field string) int) {
+	sort.SliceStable(items, func(i, j int) bool {
+		for _, key := range keys {
+			c := compare(items[i], items[j], key.Field)
+			if key.Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+// Page returns the window of items selected by limit and offset. A zero limit means no limit.
+func Page[T any](items []T, p Params) []T {
+	if p.Offset >= len(items) {
+		return items[:0]
+	}
+	items = items[p.Offset:]
+	if p.Limit > 0 && p.Limit < len(items) {
+		items = items[:p.Limit]
+	}
+	return items
+}
+
+// splitList splits a comma-separated parameter, dropping empty entries
+func splitList(raw string) []string {
+	var list []string
+	for _, entry := range strings.Split(raw, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+func contains(list []string, value string) bool {
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}
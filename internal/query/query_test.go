@@ -0,0 +1,158 @@
+package query
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testSpec = Spec{
+	Filters:      map[string]FilterType{"retailer": String, "from": Date, "minPoints": Int, "minTotal": Decimal},
+	Sortable:     []string{"points", "purchaseDate", "retailer"},
+	DefaultSort:  "-purchaseDate",
+	Fields:       []string{"id", "points", "retailer"},
+	DefaultLimit: 20,
+	MaxLimit:     100,
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		want      Params
+		wantParam string
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			want:  Params{Limit: 20, Sort: []SortKey{{"purchaseDate", true}}, Filters: map[string]string{}},
+		},
+		{
+			name:  "every parameter",
+			query: "limit=5&offset=10&sort=points,-retailer&fields=id,points&retailer=Target&from=2022-01-01&minPoints=10&minTotal=9.5",
+			want: Params{
+				Limit: 5, Offset: 10,
+				Sort:    []SortKey{{"points", false}, {"retailer", true}},
+				Fields:  []string{"id", "points"},
+				Filters: map[string]string{"retailer": "Target", "from": "2022-01-01", "minPoints": "10", "minTotal": "9.5"},
+			},
+		},
+		{
+			name:  "limit capped at the maximum",
+			query: "limit=1000",
+			want:  Params{Limit: 100, Sort: []SortKey{{"purchaseDate", true}}, Filters: map[string]string{}},
+		},
+		{
+			name:  "blank list entries and filter values dropped",
+			query: "sort=,points,&fields=id,,&retailer=%20%20",
+			want:  Params{Limit: 20, Sort: []SortKey{{"points", false}}, Fields: []string{"id"}, Filters: map[string]string{}},
+		},
+		{
+			name:  "filter values trimmed",
+			query: "minPoints=%2010%20",
+			want:  Params{Limit: 20, Sort: []SortKey{{"purchaseDate", true}}, Filters: map[string]string{"minPoints": "10"}},
+		},
+		{name: "zero limit", query: "limit=0", wantParam: "limit"},
+		{name: "negative limit", query: "limit=-1", wantParam: "limit"},
+		{name: "limit not a number", query: "limit=ten", wantParam: "limit"},
+		{name: "negative offset", query: "offset=-1", wantParam: "offset"},
+		{name: "unsortable field", query: "sort=total", wantParam: "sort"},
+		{name: "unknown field", query: "fields=id,secret", wantParam: "fields"},
+		{name: "bad date", query: "from=2022-13-01", wantParam: "from"},
+		{name: "bad integer", query: "minPoints=1.5", wantParam: "minPoints"},
+		{name: "bad decimal", query: "minTotal=cheap", wantParam: "minTotal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Parse(values, testSpec)
+			if tt.wantParam != "" {
+				var queryErr *Error
+				if !errors.As(err, &queryErr) || queryErr.Param != tt.wantParam {
+					t.Fatalf("Parse error = %v, want an invalid %s", err, tt.wantParam)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterValues(t *testing.T) {
+	params, err := Parse(url.Values{"minPoints": {"10"}, "minTotal": {"9.5"}}, testSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := params.Int("minPoints"); !ok || value != 10 {
+		t.Errorf("Int(minPoints) = %d, %v", value, ok)
+	}
+	if value, ok := params.Decimal("minTotal"); !ok || value != 9.5 {
+		t.Errorf("Decimal(minTotal) = %g, %v", value, ok)
+	}
+	if _, ok := params.Int("retailer"); ok {
+		t.Error("Int reports an unset filter as set")
+	}
+	if _, ok := params.Filter("retailer"); ok {
+		t.Error("Filter reports an unset filter as set")
+	}
+}
+
+func TestProject(t *testing.T) {
+	record := map[string]interface{}{"id": "r1", "points": 28, "retailer": "Target"}
+	if got := (Params{}).Project(record); !reflect.DeepEqual(got, record) {
+		t.Errorf("Project without a selection = %v, want the whole record", got)
+	}
+	params := Params{Fields: []string{"id", "points"}}
+	if got, want := params.Project(record), map[string]interface{}{"id": "r1", "points": 28}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Project = %v, want %v", got, want)
+	}
+	if params.Selects("retailer") || !params.Selects("id") {
+		t.Error("Selects does not follow the selection")
+	}
+}
+
+func TestSortSlice(t *testing.T) {
+	type row struct {
+		retailer string
+		points   int
+	}
+	rows := []row{{"b", 1}, {"a", 2}, {"b", 3}, {"a", 1}}
+	SortSlice(rows, []SortKey{{"retailer", false}, {"points", true}}, func(a, b row, field string) int {
+		if field == "retailer" {
+			return strings.Compare(a.retailer, b.retailer)
+		}
+		return a.points - b.points
+	})
+	if want := []row{{"a", 2}, {"a", 1}, {"b", 3}, {"b", 1}}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("SortSlice = %v, want %v", rows, want)
+	}
+}
+
+func TestPage(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+	tests := []struct {
+		limit, offset int
+		want          []int
+	}{
+		{2, 0, []int{1, 2}},
+		{2, 4, []int{5}},
+		{0, 3, []int{4, 5}},
+		{2, 5, []int{}},
+		{2, 9, []int{}},
+	}
+	for _, tt := range tests {
+		if got := Page(items, Params{Limit: tt.limit, Offset: tt.offset}); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Page(limit %d, offset %d) = %v, want %v", tt.limit, tt.offset, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+package receiptsv1
+
+//go:generate protoc -I ../../proto --go_out=../.. --go_opt=module=receipt-processor --go-grpc_out=../.. --go-grpc_opt=module=receipt-processor --grpc-gateway_out=../.. --grpc-gateway_opt=module=receipt-processor receipts/v1/receipts.proto
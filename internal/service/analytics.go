@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	"receipt-processor/internal/points"
+	"receipt-processor/internal/store"
+	"receipt-processor/scoring"
+)
+
+// RetailerSpend is what was spent and earned at one retailer
+type RetailerSpend struct {
+	Retailer string `json:"retailer"`
+	Receipts int    `json:"receipts"`
+	// Total is the spend in the base currency
+	Total  string `json:"total"`
+	Points int    `json:"points"`
+	Cents  int64  `json:"-"`
+}
+
+// SpendByRetailer aggregates spend, receipts and awarded points per retailer over the receipts purchased in
+// the filter's date range, optionally for one user. Rejected and voided receipts are left out unless the
+// filter asks for a state.
+func (svc *Service) SpendByRetailer(ctx context.Context, filter store.Filter, userID string) ([]RetailerSpend, error) {
+	list, err := svc.FindReceipts(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	retailers := make(map[string]*RetailerSpend)
+	for _, receipt := range list {
+		if userID != "" && receipt.UserID != userID {
+			continue
+		}
+		if state := store.StateOf(receipt); filter.State == "" && (state == store.StateRejected || state == store.StateVoided) {
+			continue
+		}
+		cents, err := scoring.ParseCents(points.InBaseCurrency(receipt).Total)
+		if err != nil {
+			continue
+		}
+		spend, ok := retailers[receipt.Retailer]
+		if !ok {
+			spend = &RetailerSpend{Retailer: receipt.Retailer}
+			retailers[receipt.Retailer] = spend
+		}
+		spend.Receipts++
+		spend.Cents += cents
+		spend.Points += svc.AwardedPoints(receipt)
+	}
+
+	spends := make([]RetailerSpend, 0, len(retailers))
+	for _, spend := range retailers {
+		spend.Total = scoring.FormatCents(spend.Cents)
+		spends = append(spends, *spend)
+	}
+	return spends, nil
+}
+
+// pointsBucket is one histogram bar: the receipts awarded at least From and less than To points
+type pointsBucket struct {
+	From  int `json:"from"`
+	To    int `json:"to"`
+	Count int `json:"count"`
+}
+
+// pointsDistribution describes how many points receipts are awarded
+type pointsDistribution struct {
+	Count       int            `json:"count"`
+	Total       int            `json:"total"`
+	Mean        float64        `json:"mean"`
+	Min         int            `json:"min"`
+	Max         int            `json:"max"`
+	Percentiles map[string]int `json:"percentiles"`
+	Histogram   []pointsBucket `json:"histogram"`
+}
+
+// reportedPercentiles are the percentiles a points distribution reports
+var reportedPercentiles = []int{50, 75, 90, 95, 99}
+
+// DistributePoints summarizes a set of points: nearest-rank percentiles and a histogram of equal-width buckets
+func DistributePoints(points []int, buckets int) pointsDistribution {
+	distribution := pointsDistribution{Count: len(points), Percentiles: make(map[string]int), Histogram: []pointsBucket{}}
+	if len(points) == 0 {
+		return distribution
+	}
+	sort.Ints(points)
+	sum := 0
+	for _, p := range points {
+		sum += p
+	}
+	distribution.Total = sum
+	distribution.Mean = math.Round(float64(sum)/float64(len(points))*100) / 100
+	distribution.Min, distribution.Max = points[0], points[len(points)-1]
+	for _, percentile := range reportedPercentiles {
+		rank := int(math.Ceil(float64(percentile) / 100 * float64(len(points))))
+		distribution.Percentiles[fmt.Sprintf("p%d", percentile)] = points[rank-1]
+	}
+
+	width := (distribution.Max - distribution.Min + buckets) / buckets
+	for from := distribution.Min; from <= distribution.Max; from += width {
+		distribution.Histogram = append(distribution.Histogram, pointsBucket{From: from, To: from + width})
+	}
+	for _, p := range points {
+		distribution.Histogram[(p-distribution.Min)/width].Count++
+	}
+	return distribution
+}
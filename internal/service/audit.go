@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"receipt-processor/internal/store"
+)
+
+// The audited actions
+const (
+	AuditReceiptCreated  = "receipt.created"
+	AuditReceiptUpdated  = "receipt.updated"
+	AuditReceiptState    = "receipt.state_changed"
+	AuditReceiptDeleted  = "receipt.deleted"
+	AuditPointsRescored  = "points.rescored"
+	AuditPointsCredited  = "points.credited"
+	AuditRulesCreated    = "rules.created"
+	AuditRulesActivated  = "rules.activated"
+	AuditCampaignSaved   = "campaign.saved"
+	AuditCampaignDeleted = "campaign.deleted"
+	AuditAliasSaved      = "retailer_alias.saved"
+	AuditAliasDeleted    = "retailer_alias.deleted"
+)
+
+// systemActor is the actor of operations no request asked for, like retention purges
+const systemActor = "system"
+
+// auditArchive persists the audit log. Stores that implement it keep it across restarts; otherwise it
+// lives only in memory.
+type auditArchive interface {
+	SaveAuditEntry(entry store.AuditEntry) error
+	LoadAudit() ([]store.AuditEntry, error)
+}
+
+// auditLog holds every store.AuditEntry, oldest first
+type auditLog struct {
+	mu      sync.RWMutex
+	entries []store.AuditEntry
+}
+
+type actorContextKey struct{}
+
+// WithActor stores who is making a request in the context, for the audit log
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+type clientIPContextKey struct{}
+
+// WithClientIP stores the address a request came from in the context, for the audit log
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPContextKey{}, ip)
+}
+
+// ClientIPFromContext returns the address stored by WithClientIP, or "" for work the server does itself
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPContextKey{}).(string)
+	return ip
+}
+
+// ActorFromContext returns the actor stored by WithActor, or "system"
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorContextKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return systemActor
+}
+
+// ConfigureAudit restores the audit log from the store's archive
+func (svc *Service) ConfigureAudit() error {
+	a, ok := svc.store.(auditArchive)
+	if !ok {
+		return nil
+	}
+	entries, err := a.LoadAudit()
+	if err != nil {
+		return err
+	}
+	svc.audit.mu.Lock()
+	svc.audit.entries = entries
+	svc.audit.mu.Unlock()
+	return nil
+}
+
+// RecordAudit appends an entry for an operation that already happened. A failure to persist it is
+// logged rather than returned: the operation stands either way.
+func (svc *Service) RecordAudit(ctx context.Context, action, subject string, before, after map[string]interface{}) {
+	entry := store.AuditEntry{
+		ID:      uuid.New().String(),
+		Time:    svc.clock().UTC(),
+		Actor:   ActorFromContext(ctx),
+		IP:      ClientIPFromContext(ctx),
+		Action:  action,
+		Subject: subject,
+		Tenant:  tenantField(TenantFromContext(ctx)),
+		Before:  before,
+		After:   after,
+	}
+	if a, ok := svc.store.(auditArchive); ok {
+		if err := a.SaveAuditEntry(entry); err != nil {
+			log.Printf("Audit entry %s %s by %s not saved: %v", action, subject, entry.Actor, err)
+		}
+	}
+	svc.audit.mu.Lock()
+	svc.audit.entries = append(svc.audit.entries, entry)
+	svc.audit.mu.Unlock()
+}
+
+// AuditFilter narrows the audit log; empty fields match everything but Tenant, where empty is the
+// default tenant. Subject matches as a prefix, so "receipt:" selects every receipt. From and To are
+// YYYY-MM-DD days, inclusive.
+type AuditFilter struct {
+	Tenant  string
+	Actor   string
+	Action  string
+	Subject string
+	From    string
+	To      string
+}
+
+// AuditEntries returns the entries of the audit log matching a filter, newest first
+func (svc *Service) AuditEntries(filter AuditFilter) []store.AuditEntry {
+	svc.audit.mu.RLock()
+	defer svc.audit.mu.RUnlock()
+	matched := []store.AuditEntry{}
+	for _, entry := range svc.audit.entries {
+		day := entry.Time.Format("2006-01-02")
+		if entry.Tenant != tenantField(filter.Tenant) ||
+			filter.Actor != "" && entry.Actor != filter.Actor ||
+			filter.Action != "" && entry.Action != filter.Action ||
+			!strings.HasPrefix(entry.Subject, filter.Subject) ||
+			filter.From != "" && day < filter.From ||
+			filter.To != "" && day > filter.To {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].Time.After(matched[j].Time) })
+	return matched
+}
+
+// receiptSubject names a receipt in the audit log
+func receiptSubject(id string) string {
+	return "receipt:" + id
+}
+
+// auditSummary is what the audit log records of a receipt
+func (svc *Service) auditSummary(receipt store.Receipt) map[string]interface{} {
+	summary := map[string]interface{}{
+		"retailer":     receipt.Retailer,
+		"total":        receipt.Total,
+		"state":        store.StateOf(receipt),
+		"rulesVersion": receipt.RulesVersion,
+		"points":       svc.AwardedPoints(receipt),
+	}
+	if receipt.UserID != "" {
+		summary["userId"] = receipt.UserID
+	}
+	return summary
+}
@@ -0,0 +1,349 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"receipt-processor/internal/points"
+	"receipt-processor/internal/store"
+)
+
+// The ledger of a user's points is their stored receipts, where each approved receipt contributes the points
+// it was awarded, and the points ledger of bonuses credited outside of receipts. The balance cache keeps a running total per user so balance reads never scan the ledger.
+// It is kept current by the event bus, and remembers every receipt's contribution so that repeated or
+// out-of-order events cannot count a receipt twice.
+
+// balanceEntry is what one receipt contributes to its user's balance
+type balanceEntry struct {
+	Tenant       string
+	UserID       string
+	PurchaseDate string
+	Points       int
+	Counted      bool
+}
+
+// tenantUser identifies a user within a tenant; the same user ID in two tenants is two users
+type tenantUser struct {
+	Tenant string
+	UserID string
+}
+
+// user is the tenant user a contribution counts towards
+func (entry balanceEntry) user() tenantUser {
+	return tenantUser{Tenant: entry.Tenant, UserID: entry.UserID}
+}
+
+// balanceCache is the running total of every user, and what each receipt and ledger entry contributes to it
+type balanceCache struct {
+	mu            sync.RWMutex
+	totals        map[tenantUser]int
+	contributions map[string]balanceEntry
+	warm          bool
+	// daily holds each user's counted points by purchase date, for rolling totals
+	daily map[tenantUser]map[string]int
+
+	// lastCheck is the report of the latest consistency check
+	lastCheckMu sync.Mutex
+	lastCheck   *balanceCheckReport
+}
+
+// reset empties the cache. The caller holds mu.
+func (c *balanceCache) reset() {
+	c.totals, c.contributions, c.daily = make(map[tenantUser]int), make(map[string]balanceEntry), make(map[tenantUser]map[string]int)
+}
+
+// countsTowardBalance reports whether a receipt's points count towards its user's balance
+func countsTowardBalance(receipt store.Receipt) bool {
+	return receipt.UserID != "" && store.StateOf(receipt) == store.StateApproved
+}
+
+// AwardedPoints returns the points a receipt was credited, recomputing them for receipts stored before
+// awarded points were recorded
+func (svc *Service) AwardedPoints(receipt store.Receipt) int {
+	if receipt.AwardedPoints != nil {
+		return *receipt.AwardedPoints
+	}
+	return svc.CalculatePoints(receipt)
+}
+
+// ExplainAwardedPoints explains a receipt's awarded points with the rule breakdown recorded when it was
+// scored, explaining receipts stored without one under the rules version that scored them
+func (svc *Service) ExplainAwardedPoints(receipt store.Receipt) points.Explanation {
+	if receipt.AwardedPoints != nil && receipt.Breakdown != nil {
+		return points.Explanation{Version: receipt.RulesVersion, Points: *receipt.AwardedPoints, Breakdown: receipt.Breakdown}
+	}
+	return points.Explain(svc.rules.For(receipt), receipt)
+}
+
+// setContribution replaces what a receipt contributes to its user's balance. The caller holds mu.
+func (c *balanceCache) setContribution(receiptID string, entry balanceEntry) {
+	if old, ok := c.contributions[receiptID]; ok && old.Counted {
+		c.totals[old.user()] -= old.Points
+		c.daily[old.user()][old.PurchaseDate] -= old.Points
+	}
+	if entry.UserID == "" {
+		delete(c.contributions, receiptID)
+		return
+	}
+	c.contributions[receiptID] = entry
+	if entry.Counted {
+		user := entry.user()
+		c.totals[user] += entry.Points
+		if c.daily[user] == nil {
+			c.daily[user] = make(map[string]int)
+		}
+		c.daily[user][entry.PurchaseDate] += entry.Points
+	}
+}
+
+// newBalanceEntry is what a receipt contributes to its user's balance
+func (svc *Service) newBalanceEntry(receipt store.Receipt) balanceEntry {
+	return balanceEntry{
+		Tenant:       store.TenantOf(receipt),
+		UserID:       receipt.UserID,
+		PurchaseDate: receipt.PurchaseDate,
+		Points:       svc.AwardedPoints(receipt),
+		Counted:      countsTowardBalance(receipt),
+	}
+}
+
+// applyBalanceEvent updates the cache from a receipt event
+func (svc *Service) applyBalanceEvent(event Event) {
+	c := &svc.balances
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch data := event.Data.(type) {
+	case receiptProcessedData:
+		c.setContribution(data.ReceiptID, svc.newBalanceEntry(data.Receipt))
+	case pointsChangedData:
+		if entry, ok := c.contributions[data.ReceiptID]; ok {
+			entry.Points = data.NewPoints
+			c.setContribution(data.ReceiptID, entry)
+		}
+	case stateChangedData:
+		if entry, ok := c.contributions[data.ReceiptID]; ok {
+			entry.Counted = data.To == store.StateApproved
+			c.setContribution(data.ReceiptID, entry)
+		}
+	case receiptDeletedData:
+		c.setContribution(data.ReceiptID, balanceEntry{})
+	case store.LedgerEntry:
+		// Bonuses have no purchase date, so they count towards balances but not rolling totals
+		c.setContribution(ledgerContributionKey(data.ID), ledgerBalanceEntry(data))
+	}
+}
+
+// ledgerBalanceEntry is what a ledger credit contributes to its user's balance
+func ledgerBalanceEntry(credit store.LedgerEntry) balanceEntry {
+	tenant := credit.Tenant
+	if tenant == "" {
+		tenant = DefaultTenant
+	}
+	return balanceEntry{Tenant: tenant, UserID: credit.UserID, Points: credit.Points, Counted: true}
+}
+
+// ledgerBalances sums the balance of every user from the stored receipts and the points ledger, within
+// the context's tenant
+func (svc *Service) ledgerBalances(ctx context.Context) (map[tenantUser]int, map[string]balanceEntry, error) {
+	list, err := svc.AllReceipts(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	totals := make(map[tenantUser]int)
+	entries := make(map[string]balanceEntry)
+	for _, receipt := range list {
+		if receipt.UserID == "" {
+			continue
+		}
+		entry := svc.newBalanceEntry(receipt)
+		entries[receipt.ID] = entry
+		if entry.Counted {
+			totals[entry.user()] += entry.Points
+		}
+	}
+	tenant, scoped := store.ScopedTenant(ctx)
+	for _, credit := range svc.AllLedgerEntries() {
+		entry := ledgerBalanceEntry(credit)
+		if scoped && entry.Tenant != tenant {
+			continue
+		}
+		entries[ledgerContributionKey(credit.ID)] = entry
+		totals[entry.user()] += credit.Points
+	}
+	return totals, entries, nil
+}
+
+// warmBalances loads the cache from the ledger. Receipts that events already reported are left alone,
+// since the event is newer than the ledger read.
+func (svc *Service) warmBalances(ctx context.Context) error {
+	_, entries, err := svc.ledgerBalances(ctx)
+	if err != nil {
+		return err
+	}
+	c := &svc.balances
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, entry := range entries {
+		if _, ok := c.contributions[id]; !ok {
+			c.setContribution(id, entry)
+		}
+	}
+	c.warm = true
+	return nil
+}
+
+// UserBalance returns the points balance of a user of the context's tenant from the cache, or from the
+// ledger while the cache is warming
+func (svc *Service) UserBalance(ctx context.Context, userID string) (int, error) {
+	user := tenantUser{Tenant: TenantFromContext(ctx), UserID: userID}
+	svc.balances.mu.RLock()
+	balance, warm := svc.balances.totals[user], svc.balances.warm
+	svc.balances.mu.RUnlock()
+	if warm {
+		return balance, nil
+	}
+	totals, _, err := svc.ledgerBalances(WithTenant(ctx, user.Tenant))
+	if err != nil {
+		return 0, err
+	}
+	return totals[user], nil
+}
+
+// RollingPoints returns the points a user earned on purchases since a date (YYYY-MM-DD), from the cache
+// or from the ledger while the cache is warming
+func (svc *Service) RollingPoints(ctx context.Context, userID, since string) (int, error) {
+	user := tenantUser{Tenant: TenantFromContext(ctx), UserID: userID}
+	total := 0
+	svc.balances.mu.RLock()
+	warm := svc.balances.warm
+	for date, points := range svc.balances.daily[user] {
+		if date >= since {
+			total += points
+		}
+	}
+	svc.balances.mu.RUnlock()
+	if warm {
+		return total, nil
+	}
+
+	_, entries, err := svc.ledgerBalances(WithTenant(ctx, user.Tenant))
+	if err != nil {
+		return 0, err
+	}
+	total = 0
+	for _, entry := range entries {
+		if entry.user() == user && entry.Counted && entry.PurchaseDate >= since {
+			total += entry.Points
+		}
+	}
+	return total, nil
+}
+
+// balanceMismatch is a user whose cached balance differs from their ledger
+type balanceMismatch struct {
+	Tenant string `json:"tenant"`
+	UserID string `json:"userId"`
+	Cached int    `json:"cached"`
+	Ledger int    `json:"ledger"`
+}
+
+// balanceCheckReport is the outcome of comparing the cache with the ledger
+type balanceCheckReport struct {
+	CheckedAt  time.Time         `json:"checkedAt"`
+	Users      int               `json:"users"`
+	Mismatches []balanceMismatch `json:"mismatches"`
+}
+
+// ForTenant is the report with only one tenant's mismatches; the check itself always covers every tenant
+func (r balanceCheckReport) ForTenant(tenant string) balanceCheckReport {
+	mismatches := []balanceMismatch{}
+	for _, mismatch := range r.Mismatches {
+		if mismatch.Tenant == tenant {
+			mismatches = append(mismatches, mismatch)
+		}
+	}
+	r.Mismatches = mismatches
+	return r
+}
+
+// LastBalanceCheck returns the report of the latest consistency check, or nil before the first one
+func (svc *Service) LastBalanceCheck() *balanceCheckReport {
+	svc.balances.lastCheckMu.Lock()
+	defer svc.balances.lastCheckMu.Unlock()
+	return svc.balances.lastCheck
+}
+
+// CheckBalances compares every cached balance, of every tenant, with the ledger, reports the users that
+// differ and resets the cache to the ledger so drift does not last past one check
+func (svc *Service) CheckBalances(ctx context.Context) (balanceCheckReport, error) {
+	report := balanceCheckReport{CheckedAt: svc.clock().UTC(), Mismatches: []balanceMismatch{}}
+	totals, entries, err := svc.ledgerBalances(store.AllTenants(ctx))
+	if err != nil {
+		return report, err
+	}
+
+	c := &svc.balances
+	c.mu.Lock()
+	users := make(map[tenantUser]bool)
+	for user := range totals {
+		users[user] = true
+	}
+	for user, balance := range c.totals {
+		if balance != 0 {
+			users[user] = true
+		}
+	}
+	for user := range users {
+		if c.totals[user] != totals[user] {
+			report.Mismatches = append(report.Mismatches, balanceMismatch{Tenant: user.Tenant, UserID: user.UserID, Cached: c.totals[user], Ledger: totals[user]})
+		}
+	}
+	c.reset()
+	for id, entry := range entries {
+		c.setContribution(id, entry)
+	}
+	c.warm = true
+	c.mu.Unlock()
+
+	report.Users = len(users)
+	sort.Slice(report.Mismatches, func(i, j int) bool {
+		a, b := report.Mismatches[i], report.Mismatches[j]
+		if a.Tenant != b.Tenant {
+			return a.Tenant < b.Tenant
+		}
+		return a.UserID < b.UserID
+	})
+	c.lastCheckMu.Lock()
+	c.lastCheck = &report
+	c.lastCheckMu.Unlock()
+	return report, nil
+}
+
+// StartBalanceCache subscribes the cache to the event bus, warms it from the ledger in the background and
+// runs the consistency check on the given interval; zero disables the periodic check
+func (svc *Service) StartBalanceCache(interval time.Duration) {
+	svc.SubscribeEvents(svc.applyBalanceEvent)
+	go func() {
+		if err := svc.warmBalances(store.AllTenants(context.Background())); err != nil {
+			log.Printf("Balance cache stays cold until the next consistency check: %v", err)
+		}
+	}()
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(interval) {
+			report, err := svc.CheckBalances(context.Background())
+			if err != nil {
+				log.Printf("Balance consistency check failed: %v", err)
+				continue
+			}
+			if len(report.Mismatches) > 0 {
+				log.Printf("Balance consistency check corrected %d of %d users", len(report.Mismatches), report.Users)
+			}
+		}
+	}()
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/datamatrix"
+	"github.com/makiuchi-d/gozxing/oned"
+	"github.com/makiuchi-d/gozxing/qrcode"
+
+	"receipt-processor/internal/store"
+)
+
+// barcodeReaders create the decoders tried on an uploaded image, in order. Readers keep
+// state between calls, so each upload gets fresh ones.
+var barcodeReaders = []func() gozxing.Reader{
+	qrcode.NewQRCodeReader,
+	func() gozxing.Reader { return datamatrix.NewDataMatrixReader() },
+	oned.NewCode128Reader,
+	oned.NewCode39Reader,
+	func() gozxing.Reader { return oned.NewMultiFormatUPCEANReader(nil) },
+}
+
+// DecodeBarcodeImage finds a QR code or barcode in a PNG, JPEG or GIF image and returns its payload
+func DecodeBarcodeImage(data []byte) (string, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("unreadable image: %v", err)
+	}
+	bitmap, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return "", err
+	}
+	hints := map[gozxing.DecodeHintType]interface{}{gozxing.DecodeHintType_TRY_HARDER: true}
+	for _, newReader := range barcodeReaders {
+		if result, err := newReader().Decode(bitmap, hints); err == nil {
+			return result.GetText(), nil
+		}
+	}
+	return "", errors.New("no QR code or barcode found in the image")
+}
+
+// ParseBarcodePayload maps a decoded payload into a Receipt. Two encodings are understood:
+//
+// A Receipt JSON object, as accepted by the process endpoint.
+//
+// Key/value pairs in URL query syntax, on their own or as the query of a URL: retailer (or n), date and
+// time, or a fiscal-style timestamp t=YYYYMMDDTHHMM[SS], total (or s) and an item=description:price pair
+// per item, e.g. "retailer=Target&t=20220101T1301&s=6.49&item=Mountain%20Dew%2012PK:6.49".
+func ParseBarcodePayload(payload string) (store.Receipt, error) {
+	payload = strings.TrimSpace(payload)
+	if strings.HasPrefix(payload, "{") {
+		var receipt store.Receipt
+		if err := json.Unmarshal([]byte(payload), &receipt); err != nil {
+			return store.Receipt{}, fmt.Errorf("invalid receipt JSON: %v", err)
+		}
+		return receipt, nil
+	}
+
+	if u, err := url.Parse(payload); err == nil && u.Scheme != "" && u.RawQuery != "" {
+		payload = u.RawQuery
+	}
+	if !strings.Contains(payload, "=") {
+		return store.Receipt{}, errors.New("the code does not carry receipt data")
+	}
+	values, err := url.ParseQuery(payload)
+	if err != nil {
+		return store.Receipt{}, fmt.Errorf("invalid key/value payload: %v", err)
+	}
+	first := func(keys ...string) string {
+		for _, key := range keys {
+			if value := strings.TrimSpace(values.Get(key)); value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+
+	receipt := store.Receipt{
+		Retailer:     first("retailer", "n"),
+		PurchaseDate: first("date"),
+		PurchaseTime: first("time"),
+	}
+	if t := first("t"); t != "" {
+		parsed, err := parseFiscalTimestamp(t)
+		if err != nil {
+			return store.Receipt{}, err
+		}
+		receipt.PurchaseDate, receipt.PurchaseTime = parsed.Format("2006-01-02"), parsed.Format("15:04")
+	}
+	if receipt.Total, err = normalizeAmount(first("total", "s")); err != nil {
+		return store.Receipt{}, fmt.Errorf("total: %w", err)
+	}
+	for _, item := range values["item"] {
+		description, price, ok := cutLast(item, ":")
+		if !ok {
+			return store.Receipt{}, fmt.Errorf("item %q must be description:price", item)
+		}
+		if price, err = normalizeAmount(price); err != nil {
+			return store.Receipt{}, fmt.Errorf("item: %w", err)
+		}
+		receipt.Items = append(receipt.Items, store.ReceiptItem{ShortDescription: strings.TrimSpace(description), Price: price})
+	}
+	return receipt, nil
+}
+
+// parseFiscalTimestamp reads the compact timestamps fiscal receipt codes use, e.g. 20220101T1301
+func parseFiscalTimestamp(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405", "20060102T1504"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+}
+
+// cutLast slices s around the last instance of sep
+func cutLast(s, sep string) (string, string, bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+len(sep):], true
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"receipt-processor/internal/store"
+)
+
+// ErrReceiptBuffered reports that a receipt was accepted into the outage buffer instead of the store
+var ErrReceiptBuffered = errors.New("receipt buffered until the store recovers")
+
+// bufferReplayTimeout bounds the save of each buffered receipt when it is replayed
+const bufferReplayTimeout = 10 * time.Second
+
+// bufferedReceipt is a receipt waiting in the outage buffer, with the scope of the request that submitted
+// it, so that its replay is stored and audited for the same tenant, submitter, actor and IP
+type bufferedReceipt struct {
+	receipt store.Receipt
+	scope   requestScope
+	// err is why the replay gave up on a dead-lettered receipt
+	err error
+}
+
+// outageBuffer holds receipts that could not be saved while the store was unavailable.
+// It is disabled when its capacity is zero. Receipts the store refused for another reason when they were
+// replayed are moved to the dead letters, which keep the last capacity of them.
+type outageBuffer struct {
+	mu          sync.Mutex
+	capacity    int
+	pending     []bufferedReceipt
+	deadLetters []bufferedReceipt
+}
+
+// StartStoreBuffer enables the outage buffer and replays it on the given interval
+func (svc *Service) StartStoreBuffer(capacity int, interval time.Duration) {
+	svc.buffer.mu.Lock()
+	svc.buffer.capacity = capacity
+	svc.buffer.mu.Unlock()
+	if capacity <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(interval) {
+			svc.replayBufferedReceipts()
+		}
+	}()
+}
+
+// add queues a receipt for replay in the scope of ctx, reporting false when the buffer is
+// disabled or full
+func (b *outageBuffer) add(ctx context.Context, receipt store.Receipt) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.pending) >= b.capacity {
+		return false
+	}
+	b.pending = append(b.pending, bufferedReceipt{receipt: receipt, scope: scopeOf(ctx)})
+	return true
+}
+
+// bufferDepth returns how many receipts are waiting for the store to recover, and how many were given up on
+func (svc *Service) bufferDepth() (pending, deadLettered int) {
+	svc.buffer.mu.Lock()
+	defer svc.buffer.mu.Unlock()
+	return len(svc.buffer.pending), len(svc.buffer.deadLetters)
+}
+
+// findBufferedReceipt looks up a receipt that has not been replayed yet by ID or short code
+func (svc *Service) findBufferedReceipt(id string) (store.Receipt, bool) {
+	svc.buffer.mu.Lock()
+	defer svc.buffer.mu.Unlock()
+	for _, entry := range svc.buffer.pending {
+		if entry.receipt.ID == id || entry.receipt.ShortCode == id {
+			return entry.receipt, true
+		}
+	}
+	return store.Receipt{}, false
+}
+
+// replayBufferedReceipts saves buffered receipts in submission order, each in the scope it was submitted
+// in. It stops at the first receipt the store is still unavailable for, or that runs out of time, to
+// retry it next time, and dead-letters receipts the store refuses for any other reason, so that one bad
+// receipt does not hold up the rest. The pending receipts are copied and saved without holding the buffer's lock,
+// so that submissions and lookups are not blocked on the store while it recovers.
+func (svc *Service) replayBufferedReceipts() {
+	b := &svc.buffer
+	b.mu.Lock()
+	pending := append([]bufferedReceipt(nil), b.pending...)
+	b.mu.Unlock()
+
+	done, replayed := 0, 0
+	var deadLetters []bufferedReceipt
+	for _, entry := range pending {
+		ctx, cancel := context.WithTimeout(entry.scope.context(context.Background()), bufferReplayTimeout)
+		err := svc.storeReceipt(ctx, entry.receipt)
+		cancel()
+		if errors.Is(err, store.ErrUnavailable) || errors.Is(err, context.DeadlineExceeded) {
+			break
+		}
+		done++
+		if err != nil {
+			log.Printf("Dead-lettering buffered receipt %s: %v", entry.receipt.ID, err)
+			svc.ReleaseDuplicate(entry.scope.tenant, entry.receipt)
+			entry.err = err
+			deadLetters = append(deadLetters, entry)
+			continue
+		}
+		replayed++
+	}
+	if done == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	// Only the replay removes receipts, and submissions only append, so the first done are the ones replayed
+	b.pending = b.pending[done:]
+	b.deadLetters = append(b.deadLetters, deadLetters...)
+	if extra := len(b.deadLetters) - b.capacity; extra > 0 {
+		b.deadLetters = b.deadLetters[extra:]
+	}
+	remaining := len(b.pending)
+	b.mu.Unlock()
+	log.Printf("Replayed %d buffered receipts, dead-lettered %d, %d still pending", replayed, len(deadLetters), remaining)
+}
+
+// saveOrBuffer stores a receipt, falling back to the outage buffer when the store is unavailable
+func (svc *Service) saveOrBuffer(ctx context.Context, receipt store.Receipt) error {
+	err := svc.storeReceipt(ctx, receipt)
+	if errors.Is(err, store.ErrUnavailable) && svc.buffer.add(ctx, receipt) {
+		return ErrReceiptBuffered
+	}
+	return err
+}
+
+// StoreHealth is how the store answered a probe, for the admin dashboard
+type StoreHealth struct {
+	Backend string `json:"backend"`
+	Healthy bool   `json:"healthy"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+	// Buffered counts the receipts waiting in the outage buffer for the store to recover
+	Buffered int `json:"buffered"`
+	// DeadLettered counts the buffered receipts the store refused when they were replayed
+	DeadLettered int `json:"deadLettered"`
+}
+
+// CheckStore probes the store with the lookup of a receipt that does not exist
+func (svc *Service) CheckStore(ctx context.Context) StoreHealth {
+	health := StoreHealth{Backend: "memory"}
+	health.Buffered, health.DeadLettered = svc.bufferDepth()
+	if _, ok := svc.store.(*store.SQL); ok {
+		health.Backend = "postgres"
+	}
+	start := svc.clock()
+	_, _, err := svc.store.Get(ctx, "health-check")
+	health.Latency = svc.clock().Sub(start).Round(time.Microsecond).String()
+	health.Healthy = err == nil
+	if err != nil {
+		health.Error = err.Error()
+	}
+	return health
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"log"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information, set at build time with
+//
+//	go build -ldflags "-X receipt-processor/internal/service.version=1.2.3 \
+//	  -X receipt-processor/internal/service.gitSHA=$(git rev-parse HEAD) \
+//	  -X receipt-processor/internal/service.buildTime=$(date -u +%FT%TZ)" ./cmd/server
+var (
+	version   = "dev"
+	gitSHA    = "unknown"
+	buildTime = "unknown"
+)
+
+// BuildInfo describes exactly which build is serving traffic
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GitSHA    string `json:"gitSHA"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+}
+
+// CurrentBuildInfo returns the ldflags values, falling back to the VCS stamp Go embeds in the binary
+func CurrentBuildInfo() BuildInfo {
+	info := BuildInfo{Version: version, GitSHA: gitSHA, BuildTime: buildTime, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.GitSHA == "unknown":
+				info.GitSHA = setting.Value
+			case setting.Key == "vcs.time" && info.BuildTime == "unknown":
+				info.BuildTime = setting.Value
+			}
+		}
+	}
+	return info
+}
+
+// LogStartupBanner logs the build information once at startup
+func LogStartupBanner() {
+	info := CurrentBuildInfo()
+	log.Printf("Starting receipt-processor version=%s gitSHA=%s buildTime=%s goVersion=%s",
+		info.Version, info.GitSHA, info.BuildTime, info.GoVersion)
+}
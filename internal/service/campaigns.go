@@ -0,0 +1,123 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"receipt-processor/internal/points"
+	"receipt-processor/internal/store"
+	"receipt-processor/scoring"
+)
+
+// Campaigns layer time-bounded bonuses on top of whichever rules version is active. A receipt keeps a copy
+// of the campaigns it qualified for when it was processed, so editing or deleting a campaign never moves
+// the points of receipts already scored and recalculations apply the same promotions again.
+
+var ErrCampaignNotFound = errors.New("campaign not found")
+
+// campaignArchive persists campaigns. Stores that implement it keep them across restarts; otherwise they
+// live only in memory.
+type campaignArchive interface {
+	SaveCampaign(campaign scoring.Campaign) error
+	DeleteCampaign(id string) error
+	LoadCampaigns() ([]scoring.Campaign, error)
+}
+
+// campaignSet holds every campaign by id
+type campaignSet struct {
+	mu   sync.RWMutex
+	byID map[string]scoring.Campaign
+}
+
+// CampaignStore returns the store's campaign archive, if it has one
+func (svc *Service) CampaignStore() (campaignArchive, bool) {
+	a, ok := svc.store.(campaignArchive)
+	return a, ok
+}
+
+// ConfigureCampaigns restores the campaigns from the archive
+func (svc *Service) ConfigureCampaigns() error {
+	a, ok := svc.CampaignStore()
+	if !ok {
+		return nil
+	}
+	list, err := a.LoadCampaigns()
+	if err != nil {
+		return err
+	}
+	svc.campaigns.mu.Lock()
+	defer svc.campaigns.mu.Unlock()
+	for _, campaign := range list {
+		svc.campaigns.byID[campaign.ID] = campaign
+	}
+	return nil
+}
+
+// campaignsFor returns the campaigns a receipt qualifies for, ordered by start date
+func (svc *Service) campaignsFor(receipt store.Receipt) []scoring.Campaign {
+	scored := points.ScoringReceipt(receipt)
+	var matched []scoring.Campaign
+	for _, campaign := range svc.ListCampaigns() {
+		if campaign.Applies(scored) {
+			matched = append(matched, campaign)
+		}
+	}
+	return matched
+}
+
+// ListCampaigns returns every campaign, ordered by start date and id
+func (svc *Service) ListCampaigns() []scoring.Campaign {
+	svc.campaigns.mu.RLock()
+	list := make([]scoring.Campaign, 0, len(svc.campaigns.byID))
+	for _, campaign := range svc.campaigns.byID {
+		list = append(list, campaign)
+	}
+	svc.campaigns.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].StartDate != list[j].StartDate {
+			return list[i].StartDate < list[j].StartDate
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Campaign looks up a campaign by id
+func (svc *Service) Campaign(id string) (scoring.Campaign, bool) {
+	svc.campaigns.mu.RLock()
+	defer svc.campaigns.mu.RUnlock()
+	campaign, ok := svc.campaigns.byID[id]
+	return campaign, ok
+}
+
+// SaveCampaign stores a campaign, persisting it when the store keeps a campaign archive
+func (svc *Service) SaveCampaign(campaign scoring.Campaign) error {
+	svc.campaigns.mu.Lock()
+	defer svc.campaigns.mu.Unlock()
+	if a, ok := svc.CampaignStore(); ok {
+		if err := a.SaveCampaign(campaign); err != nil {
+			return err
+		}
+	}
+	svc.campaigns.byID[campaign.ID] = campaign
+	return nil
+}
+
+// DeleteCampaign removes a campaign, from the campaign archive too when the store keeps one, and returns
+// what it was; ErrCampaignNotFound if there is none
+func (svc *Service) DeleteCampaign(id string) (scoring.Campaign, error) {
+	svc.campaigns.mu.Lock()
+	defer svc.campaigns.mu.Unlock()
+	previous, ok := svc.campaigns.byID[id]
+	if !ok {
+		return previous, ErrCampaignNotFound
+	}
+	if a, ok := svc.CampaignStore(); ok {
+		if err := a.DeleteCampaign(id); err != nil {
+			return previous, err
+		}
+	}
+	delete(svc.campaigns.byID, id)
+	return previous, nil
+}
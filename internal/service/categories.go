@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"receipt-processor/internal/store"
+)
+
+// ErrItemNotFound is returned when a receipt has no item at the requested position
+var ErrItemNotFound = errors.New("item not found")
+
+// normalizeTags normalizes tags, dropping empty and repeated ones
+func normalizeTags(tags []string) []string {
+	var normalized []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		if tag = store.NormalizeCategory(tag); tag != "" && !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// ItemTags is a change to an item's category and tags; fields left out are kept
+type ItemTags struct {
+	Category *string  `json:"category"`
+	Tags     []string `json:"tags"`
+}
+
+// TagItem sets the category and tags of the item at position (1-based) of a stored receipt. When the
+// new category moves the receipt's points, the awarded points are updated and a points-changed event is published.
+func (svc *Service) TagItem(ctx context.Context, id string, position int, change ItemTags) (store.Receipt, error) {
+	receipt, exists, err := svc.FindReceipt(ctx, id)
+	if err != nil {
+		return receipt, err
+	}
+	if !exists {
+		return receipt, store.ErrNotFound
+	}
+	if position < 1 || position > len(receipt.Items) {
+		return receipt, fmt.Errorf("%w: receipt has %d items", ErrItemNotFound, len(receipt.Items))
+	}
+
+	oldPoints := svc.CalculatePoints(receipt)
+	items := append([]store.ReceiptItem(nil), receipt.Items...)
+	item := &items[position-1]
+	before := map[string]interface{}{"item": position, "category": item.Category, "tags": item.Tags, "points": oldPoints}
+	if change.Category != nil {
+		item.Category = store.NormalizeCategory(*change.Category)
+	}
+	if change.Tags != nil {
+		item.Tags = normalizeTags(change.Tags)
+	}
+	receipt.Items = items
+
+	newPoints := svc.CalculatePoints(receipt)
+	if newPoints != oldPoints {
+		svc.scoreReceipt(&receipt, svc.rules.For(receipt))
+	}
+	if err := svc.store.Save(ctx, receipt); err != nil {
+		return receipt, err
+	}
+	svc.cachePoints(receipt)
+	svc.RecordAudit(ctx, AuditReceiptUpdated, receiptSubject(receipt.ID), before,
+		map[string]interface{}{"item": position, "category": item.Category, "tags": item.Tags, "points": newPoints})
+	if newPoints != oldPoints {
+		svc.publishEvent(svc.clock(), eventPointsChanged, pointsChangedData{
+			ReceiptID:  receipt.ID,
+			UserID:     receipt.UserID,
+			Tenant:     receipt.Tenant,
+			OldVersion: receipt.RulesVersion,
+			NewVersion: receipt.RulesVersion,
+			OldPoints:  oldPoints,
+			NewPoints:  newPoints,
+		})
+	}
+	return receipt, nil
+}
@@ -0,0 +1,32 @@
+package service
+
+// Submission channels. Each endpoint records its own channel unless the request names a known one.
+const (
+	channelWeb     = "web"
+	ChannelAPI     = "api"
+	channelApp     = "app"
+	channelEmail   = "email"
+	ChannelOCR     = "ocr"
+	ChannelBarcode = "barcode"
+	ChannelPOS     = "pos"
+	ChannelCSV     = "csv"
+	ChannelBulk    = "bulk"
+	ChannelGraphQL = "graphql"
+	ChannelGRPC    = "grpc"
+	channelKafka   = "kafka"
+	ChannelNATS    = "nats"
+	ChannelSocket  = "websocket"
+)
+
+// KnownChannels are the channels receipts can be attributed to and rules can be scoped to
+var KnownChannels = map[string]bool{
+	channelWeb: true, ChannelAPI: true, channelApp: true, channelEmail: true, ChannelOCR: true, ChannelBarcode: true,
+	ChannelPOS: true, ChannelCSV: true, ChannelBulk: true, ChannelGraphQL: true, channelKafka: true, ChannelNATS: true,
+	ChannelSocket: true, ChannelGRPC: true,
+}
+
+// ChannelStats is the activity of one channel
+type ChannelStats struct {
+	Receipts int `json:"receipts"`
+	Points   int `json:"points"`
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"receipt-processor/internal/store"
+)
+
+// CSVReceipt is a receipt read from a CSV file, remembering the line it started on
+type CSVReceipt struct {
+	Line    int
+	Receipt store.Receipt
+	Err     error
+}
+
+// ImportResult is the outcome of importing one receipt
+type ImportResult struct {
+	Row       int    `json:"row"`
+	ID        string `json:"id,omitempty"`
+	ShortCode string `json:"shortCode,omitempty"`
+	Points    *int   `json:"points,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// flattenedCSVColumns are the required columns of the flattened format, one item per row; "tax", "tip", "category" and "userId" are optional
+var flattenedCSVColumns = []string{"retailer", "purchaseDate", "purchaseTime", "total", "shortDescription", "price"}
+
+// ParseReceiptsCSV reads receipts from CSV in one of two formats, told apart by the header row:
+//
+// Header and item rows, with a "type" column: "R,retailer,purchaseDate,purchaseTime,total[,tax[,tip]]" starts a
+// receipt and each following "I,shortDescription,price" row adds an item to it.
+//
+// Flattened, with the columns of flattenedCSVColumns plus an optional "receipt" column: each row is one
+// item, and consecutive rows with the same receipt key (or the same retailer, date, time and total when
+// there is no receipt column) belong to the same receipt.
+func ParseReceiptsCSV(r io.Reader) ([]CSVReceipt, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	if _, ok := columns["type"]; ok {
+		return parseTypedCSV(reader)
+	}
+	for _, name := range flattenedCSVColumns {
+		if _, ok := columns[strings.ToLower(name)]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+	return parseFlattenedCSV(reader, columns)
+}
+
+// parseTypedCSV reads the header-and-item-rows format
+func parseTypedCSV(reader *csv.Reader) ([]CSVReceipt, error) {
+	var receipts []CSVReceipt
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return receipts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		switch kind := strings.ToUpper(strings.TrimSpace(record[0])); {
+		case kind == "R" && len(record) >= 5:
+			receipt := store.Receipt{
+				Retailer:     record[1],
+				PurchaseDate: strings.TrimSpace(record[2]),
+				PurchaseTime: strings.TrimSpace(record[3]),
+				Total:        strings.TrimSpace(record[4]),
+			}
+			if len(record) >= 6 {
+				receipt.Tax = strings.TrimSpace(record[5])
+			}
+			if len(record) >= 7 {
+				receipt.Tip = strings.TrimSpace(record[6])
+			}
+			receipts = append(receipts, CSVReceipt{Line: line, Receipt: receipt})
+		case kind == "I" && len(record) >= 3 && len(receipts) > 0:
+			current := &receipts[len(receipts)-1]
+			current.Receipt.Items = append(current.Receipt.Items, store.ReceiptItem{
+				ShortDescription: record[1],
+				Price:            strings.TrimSpace(record[2]),
+			})
+		case kind == "I" && len(receipts) == 0:
+			receipts = append(receipts, CSVReceipt{Line: line, Err: errors.New("item row before any receipt row")})
+		default:
+			receipts = append(receipts, CSVReceipt{Line: line, Err: fmt.Errorf("unrecognized row type %q", record[0])})
+		}
+	}
+}
+
+// parseFlattenedCSV reads the one-item-per-row format
+func parseFlattenedCSV(reader *csv.Reader, columns map[string]int) ([]CSVReceipt, error) {
+	field := func(record []string, name string) string {
+		if i, ok := columns[strings.ToLower(name)]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var receipts []CSVReceipt
+	previousKey := ""
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return receipts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		receipt := store.Receipt{
+			Retailer:     field(record, "retailer"),
+			PurchaseDate: field(record, "purchaseDate"),
+			PurchaseTime: field(record, "purchaseTime"),
+			Total:        field(record, "total"),
+			Tax:          field(record, "tax"),
+			Tip:          field(record, "tip"),
+			UserID:       field(record, "userId"),
+		}
+		key := field(record, "receipt")
+		if _, ok := columns["receipt"]; !ok {
+			key = strings.Join([]string{receipt.Retailer, receipt.PurchaseDate, receipt.PurchaseTime, receipt.Total}, "\x00")
+		}
+		if key != previousKey || len(receipts) == 0 {
+			receipts = append(receipts, CSVReceipt{Line: line, Receipt: receipt})
+			previousKey = key
+		}
+		current := &receipts[len(receipts)-1]
+		current.Receipt.Items = append(current.Receipt.Items, store.ReceiptItem{
+			ShortDescription: field(record, "shortDescription"),
+			Price:            field(record, "price"),
+			Category:         field(record, "category"),
+		})
+	}
+}
+
+// ImportReceipts validates and processes parsed receipts, returning one result per receipt
+func (svc *Service) ImportReceipts(ctx context.Context, tenant, channel string, parsed []CSVReceipt) []ImportResult {
+	results := make([]ImportResult, 0, len(parsed))
+	for _, entry := range parsed {
+		results = append(results, svc.ImportReceipt(ctx, tenant, channel, entry))
+	}
+	return results
+}
+
+// ImportReceipt validates and processes one parsed receipt. Buffered receipts count as imported.
+func (svc *Service) ImportReceipt(ctx context.Context, tenant, channel string, entry CSVReceipt) ImportResult {
+	result := ImportResult{Row: entry.Line}
+	entry.Receipt.Channel = channel
+	err := entry.Err
+	if err == nil {
+		var receipt store.Receipt
+		receipt, err = svc.ProcessReceipt(ctx, tenant, entry.Receipt)
+		if err == nil || errors.Is(err, ErrReceiptBuffered) {
+			result.ID = receipt.ID
+			result.ShortCode = receipt.ShortCode
+			points := svc.CalculatePoints(receipt)
+			result.Points = &points
+			err = nil
+		}
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
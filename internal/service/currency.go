@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"receipt-processor/internal/config"
+)
+
+// ErrUnsupportedCurrency is returned for receipts in a currency that is not ISO 4217 or has no exchange rate
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+// iso4217Codes are the active ISO 4217 currency codes
+var iso4217Codes = strings.Fields(`
+AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BHD BIF BMD BND BOB BRL BSD BTN BWP BYN BZD CAD CDF CHF
+CLP CNY COP CRC CUC CUP CVE CZK DJF DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD GNF GTQ GYD HKD HNL
+HTG HUF IDR ILS INR IQD IRR ISK JMD JOD JPY KES KGS KHR KMF KPW KRW KWD KYD KZT LAK LBP LKR LRD LSL LYD MAD MDL
+MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN MYR MZN NAD NGN NIO NOK NPR NZD OMR PAB PEN PGK PHP PKR PLN PYG QAR RON
+RSD RUB RWF SAR SBD SCR SDG SEK SGD SHP SLE SLL SOS SRD SSP STN SVC SYP SZL THB TJS TMT TND TOP TRY TTD TWD TZS
+UAH UGX USD UYU UZS VES VND VUV WST XAF XCD XOF XPF YER ZAR ZMW ZWL`)
+
+// isISO4217 reports whether a code is an active ISO 4217 currency code
+func isISO4217(code string) bool {
+	for _, known := range iso4217Codes {
+		if known == code {
+			return true
+		}
+	}
+	return false
+}
+
+// ratesProvider quotes exchange rates as units of a currency per one unit of the base currency
+type ratesProvider interface {
+	Rate(ctx context.Context, currency string) (float64, error)
+}
+
+// staticRates are fixed rates from the environment
+type staticRates map[string]float64
+
+func (r staticRates) Rate(_ context.Context, currency string) (float64, error) {
+	rate, ok := r[currency]
+	if !ok {
+		return 0, fmt.Errorf("%w: no exchange rate for %s", ErrUnsupportedCurrency, currency)
+	}
+	return rate, nil
+}
+
+// ratesRetryDelay is how long httpRates waits to try the provider again after a first failed refresh;
+// it doubles with each failure in a row, up to the ttl
+const ratesRetryDelay = time.Minute
+
+// httpRates fetches rates from a URL answering {"rates": {"EUR": 0.92, ...}} relative to the base
+// currency, refetching them once they are older than ttl on the clock
+type httpRates struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+	clock  func() time.Time
+
+	mu      sync.Mutex
+	rates   map[string]float64
+	fetched time.Time
+	// failures counts the failed refreshes since the last one that worked, and retryAt is when the
+	// provider may be asked again after them
+	failures int
+	retryAt  time.Time
+	// refreshing is closed when the refresh in flight is done; nil when there is none
+	refreshing chan struct{}
+}
+
+// Rate quotes a currency from the last fetched rates. Once they are older than the ttl, one caller
+// refreshes them without holding r.mu while the others keep being answered with the stale rates, or wait
+// for the refresh when there are none yet. A failed refresh is logged and not retried until its backoff
+// has passed, so an unreachable provider is not asked again on every receipt.
+func (r *httpRates) Rate(ctx context.Context, currency string) (float64, error) {
+	r.mu.Lock()
+	now := r.clock()
+	switch {
+	case now.Sub(r.fetched) > r.ttl && r.refreshing == nil && !now.Before(r.retryAt):
+		done := make(chan struct{})
+		r.refreshing = done
+		r.mu.Unlock()
+		// The refresh serves every caller, so it is not cut short when this one's request ends
+		fetched, err := r.fetch(context.WithoutCancel(ctx))
+		r.mu.Lock()
+		r.update(fetched, err)
+		r.refreshing = nil
+		close(done)
+	case r.rates == nil && r.refreshing != nil:
+		done := r.refreshing
+		r.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+		r.mu.Lock()
+	}
+	rate, ok := r.rates[currency]
+	r.mu.Unlock()
+	if !ok {
+		return 0, fmt.Errorf("%w: no exchange rate for %s", ErrUnsupportedCurrency, currency)
+	}
+	return rate, nil
+}
+
+// update records the outcome of a refresh; the caller holds r.mu. Rates that are not positive would
+// divide amounts by zero or flip their sign, so they are logged and the last good rate of the currency,
+// if any, is kept instead.
+func (r *httpRates) update(fetched map[string]float64, err error) {
+	now := r.clock()
+	if err != nil {
+		// Keep scoring with the last known rates rather than reject receipts while the provider is down
+		delay := ratesRetryDelay
+		for i := 0; i < r.failures && delay < r.ttl; i++ {
+			delay *= 2
+		}
+		delay = min(delay, r.ttl)
+		r.failures++
+		r.retryAt = now.Add(delay)
+		log.Printf("Failed to refresh exchange rates from %s, retrying in %s: %v", r.url, delay, err)
+		return
+	}
+	for currency, rate := range fetched {
+		if rate <= 0 {
+			log.Printf("Ignoring exchange rate %v for %s from %s", rate, currency, r.url)
+			if last, ok := r.rates[currency]; ok {
+				fetched[currency] = last
+			} else {
+				delete(fetched, currency)
+			}
+		}
+	}
+	r.rates, r.fetched, r.failures, r.retryAt = fetched, now, 0, time.Time{}
+}
+
+// fetch asks the provider for the current rates
+func (r *httpRates) fetch(ctx context.Context) (map[string]float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var body struct {
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	if len(body.Rates) == 0 {
+		return nil, errors.New("no rates in the response")
+	}
+	return body.Rates, nil
+}
+
+// currencyConfig is the base currency and where the exchange rates against it come from
+type currencyConfig struct {
+	// base is the currency the dollar-based rules are applied in
+	base  string
+	rates ratesProvider
+}
+
+// BaseCurrency is the currency the dollar-based rules are applied in
+func (svc *Service) BaseCurrency() string {
+	return svc.currency.base
+}
+
+// ConfigureCurrency sets the base currency from BASE_CURRENCY and the rates provider: RATES_URL
+// (refreshed every RATES_TTL, default 1h) or the fixed CURRENCY_RATES list, e.g. "EUR=0.92,GBP=0.79"
+func (svc *Service) ConfigureCurrency() {
+	if code := strings.ToUpper(strings.TrimSpace(os.Getenv("BASE_CURRENCY"))); code != "" {
+		if isISO4217(code) {
+			svc.currency.base = code
+		} else {
+			log.Printf("Ignoring invalid BASE_CURRENCY=%q, using %s", code, svc.currency.base)
+		}
+	}
+	if url := os.Getenv("RATES_URL"); url != "" {
+		svc.currency.rates = &httpRates{url: url, ttl: config.Duration("RATES_TTL", time.Hour), client: &http.Client{Timeout: 10 * time.Second}, clock: svc.clock}
+		return
+	}
+	static := staticRates{}
+	for _, pair := range strings.Split(os.Getenv("CURRENCY_RATES"), ",") {
+		code, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate <= 0 {
+			log.Printf("Ignoring invalid CURRENCY_RATES entry %q", pair)
+			continue
+		}
+		static[strings.ToUpper(strings.TrimSpace(code))] = rate
+	}
+	svc.currency.rates = static
+}
+
+// ExchangeRate normalizes a receipt currency and returns its rate against the base currency.
+// Receipts without a currency are in the base currency.
+func (svc *Service) ExchangeRate(ctx context.Context, currency string) (string, float64, error) {
+	code := strings.ToUpper(strings.TrimSpace(currency))
+	if code == "" || code == svc.currency.base {
+		return code, 1, nil
+	}
+	if !isISO4217(code) {
+		return code, 0, fmt.Errorf("%w: %q is not an ISO 4217 code", ErrUnsupportedCurrency, currency)
+	}
+	rate, err := svc.currency.rates.Rate(ctx, code)
+	if err != nil {
+		return code, 0, err
+	}
+	return code, rate, nil
+}
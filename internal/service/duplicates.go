@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"receipt-processor/internal/config"
+	"receipt-processor/internal/store"
+)
+
+// Flags raised by duplicate detection
+const (
+	flagDuplicate     = "duplicate"
+	flagNearDuplicate = "near-duplicate"
+)
+
+// Duplicate modes decide what happens to an exact duplicate
+const (
+	duplicateModeReject = "reject"
+	duplicateModeWarn   = "warn"
+	duplicateModeAllow  = "allow"
+)
+
+// ErrDuplicateReceipt is returned when a submission exactly matches a stored receipt
+var ErrDuplicateReceipt = errors.New("duplicate receipt")
+
+// DuplicateError carries the ID of the receipt a blocked submission duplicates
+type DuplicateError struct {
+	ExistingID string
+}
+
+func (e *DuplicateError) Error() string { return "duplicate of receipt " + e.ExistingID }
+
+func (e *DuplicateError) Unwrap() error { return ErrDuplicateReceipt }
+
+// nearDuplicateEntry remembers when a receipt with a given near-duplicate key was seen
+type nearDuplicateEntry struct {
+	ID string
+	At time.Time
+}
+
+// DuplicateStats counts what duplicate detection did for one tenant
+type DuplicateStats struct {
+	Blocked int `json:"blocked"`
+	Flagged int `json:"flagged"`
+}
+
+// duplicateIndex remembers the receipts of every tenant, by content hash for exact duplicates and by
+// near-duplicate key for the ones seen within the tenant's window
+type duplicateIndex struct {
+	mode string
+
+	// Near-duplicate windows: the default applies to every tenant without an override
+	defaultWindow time.Duration
+	tenantWindows map[string]time.Duration
+
+	mu     sync.Mutex
+	exact  map[string]map[string]string
+	near   map[string]map[string][]nearDuplicateEntry
+	totals map[string]*DuplicateStats
+}
+
+// ConfigureDuplicateDetection loads the duplicate mode and near-duplicate windows from the environment
+func (svc *Service) ConfigureDuplicateDetection() {
+	index := &svc.duplicates
+	index.mode = strings.ToLower(os.Getenv("DUPLICATE_MODE"))
+	switch index.mode {
+	case duplicateModeReject, duplicateModeWarn, duplicateModeAllow:
+	case "":
+		index.mode = duplicateModeReject
+	default:
+		log.Printf("Ignoring invalid DUPLICATE_MODE=%q, using %s", index.mode, duplicateModeReject)
+		index.mode = duplicateModeReject
+	}
+	index.defaultWindow = config.Duration("DUPLICATE_WINDOW", 24*time.Hour)
+	index.tenantWindows = config.DurationMap("DUPLICATE_WINDOWS")
+}
+
+// window returns the near-duplicate window for a tenant; zero disables flagging
+func (index *duplicateIndex) window(tenant string) time.Duration {
+	if window, ok := index.tenantWindows[tenant]; ok {
+		return window
+	}
+	return index.defaultWindow
+}
+
+// DuplicateStats returns what duplicate detection did for each tenant
+func (svc *Service) DuplicateStats() map[string]DuplicateStats {
+	svc.duplicates.mu.Lock()
+	defer svc.duplicates.mu.Unlock()
+	stats := make(map[string]DuplicateStats, len(svc.duplicates.totals))
+	for tenant, counts := range svc.duplicates.totals {
+		stats[tenant] = *counts
+	}
+	return stats
+}
+
+// StartDuplicateIndex seeds the duplicate indexes with the stored receipts of every tenant, so that a
+// restart does not let duplicates of earlier receipts through, and drops near-duplicate entries that have
+// left their tenant's window every interval, so the index does not grow with every receipt ever seen.
+func (svc *Service) StartDuplicateIndex(interval time.Duration) {
+	if err := svc.seedDuplicates(store.AllTenants(context.Background())); err != nil {
+		log.Printf("Duplicate detection only covers new receipts: %v", err)
+	}
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(interval) {
+			svc.sweepNearDuplicates()
+		}
+	}()
+}
+
+// seedDuplicates indexes the stored receipts, keeping any entry a submission made in the meantime. Only
+// receipts scored within their tenant's window are near-duplicate candidates.
+func (svc *Service) seedDuplicates(ctx context.Context) error {
+	list, err := svc.AllReceipts(ctx)
+	if err != nil {
+		return err
+	}
+	now := svc.clock()
+
+	index := &svc.duplicates
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	for _, receipt := range list {
+		tenant := store.TenantOf(receipt)
+		if index.exact[tenant] == nil {
+			index.exact[tenant] = make(map[string]string)
+			index.near[tenant] = make(map[string][]nearDuplicateEntry)
+		}
+		exactKey := receipt.ContentHash
+		if exactKey == "" {
+			exactKey = contentHash(receipt)
+		}
+		if _, ok := index.exact[tenant][exactKey]; !ok {
+			index.exact[tenant][exactKey] = receipt.ID
+		}
+		if receipt.ScoredAt != nil && now.Sub(*receipt.ScoredAt) < index.window(tenant) {
+			nearKey := nearDuplicateKey(receipt)
+			index.near[tenant][nearKey] = append(index.near[tenant][nearKey], nearDuplicateEntry{ID: receipt.ID, At: *receipt.ScoredAt})
+		}
+	}
+	return nil
+}
+
+// sweepNearDuplicates drops the near-duplicate entries that are out of their tenant's window
+func (svc *Service) sweepNearDuplicates() {
+	now := svc.clock()
+	index := &svc.duplicates
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	for tenant, keys := range index.near {
+		window := index.window(tenant)
+		for key, entries := range keys {
+			recent := entries[:0]
+			for _, entry := range entries {
+				if now.Sub(entry.At) < window {
+					recent = append(recent, entry)
+				}
+			}
+			if len(recent) == 0 {
+				delete(keys, key)
+			} else {
+				keys[key] = recent
+			}
+		}
+	}
+}
+
+// contentHash hashes the full content of a receipt: retailer, date, time, total, items, currency, tax and tip
+func contentHash(receipt store.Receipt) string {
+	h := sha256.New()
+	for _, field := range []string{receipt.Retailer, receipt.PurchaseDate, receipt.PurchaseTime, receipt.Total} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	for _, item := range receipt.Items {
+		h.Write([]byte(item.ShortDescription))
+		h.Write([]byte{0})
+		h.Write([]byte(item.Price))
+		h.Write([]byte{0})
+	}
+	// Only hashed when set, so receipts in the base currency keep the hashes they always had
+	if receipt.Currency != "" {
+		h.Write([]byte(receipt.Currency))
+	}
+	for _, charge := range [][2]string{{"tax", receipt.Tax}, {"tip", receipt.Tip}} {
+		if charge[1] != "" {
+			h.Write([]byte{0})
+			h.Write([]byte(charge[0] + "=" + charge[1]))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// nearDuplicateKey identifies receipts from the same retailer, day and total,
+// tolerating differences in case, spacing, time of purchase and item details
+func nearDuplicateKey(receipt store.Receipt) string {
+	retailer := strings.ToLower(strings.Join(strings.Fields(receipt.Retailer), " "))
+	return retailer + "|" + receipt.PurchaseDate + "|" + strings.TrimSpace(receipt.Total)
+}
+
+// checkDuplicate records the content hash of a receipt, handles exact duplicates according to
+// the duplicate mode and flags near-duplicates within the tenant's window. A receipt that is
+// admitted is indexed so later submissions are compared against it.
+func (svc *Service) checkDuplicate(tenant string, receipt *store.Receipt) error {
+	receipt.ContentHash = contentHash(*receipt)
+	exactKey := receipt.ContentHash
+	nearKey := nearDuplicateKey(*receipt)
+	now := svc.clock()
+
+	index := &svc.duplicates
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	stats := index.totals[tenant]
+	if stats == nil {
+		stats = &DuplicateStats{}
+		index.totals[tenant] = stats
+	}
+
+	existingID, exists := index.exact[tenant][exactKey]
+	if exists && index.mode == duplicateModeReject {
+		stats.Blocked++
+		svc.recordDuplicateMetrics(now, true)
+		return &DuplicateError{ExistingID: existingID}
+	}
+	if exists && index.mode == duplicateModeWarn {
+		receipt.Flags = append(receipt.Flags, flagDuplicate)
+		receipt.DuplicateOf = existingID
+		stats.Flagged++
+		svc.recordDuplicateMetrics(now, false)
+	}
+
+	// Keep only the entries still inside the window, flagging if any remain
+	window := index.window(tenant)
+	var recent []nearDuplicateEntry
+	for _, entry := range index.near[tenant][nearKey] {
+		if now.Sub(entry.At) < window {
+			recent = append(recent, entry)
+		}
+	}
+	if len(recent) > 0 && !exists {
+		receipt.Flags = append(receipt.Flags, flagNearDuplicate)
+		stats.Flagged++
+		svc.recordDuplicateMetrics(now, false)
+	}
+
+	if index.exact[tenant] == nil {
+		index.exact[tenant] = make(map[string]string)
+		index.near[tenant] = make(map[string][]nearDuplicateEntry)
+	}
+	if !exists {
+		index.exact[tenant][exactKey] = receipt.ID
+	}
+	if window > 0 {
+		index.near[tenant][nearKey] = append(recent, nearDuplicateEntry{ID: receipt.ID, At: now})
+	}
+	return nil
+}
+
+// ReleaseDuplicate removes an admitted receipt from the index when it could not be stored after all
+func (svc *Service) ReleaseDuplicate(tenant string, receipt store.Receipt) {
+	index := &svc.duplicates
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	exactKey := contentHash(receipt)
+	if index.exact[tenant][exactKey] == receipt.ID {
+		delete(index.exact[tenant], exactKey)
+	}
+	nearKey := nearDuplicateKey(receipt)
+	entries := index.near[tenant][nearKey]
+	for i, entry := range entries {
+		if entry.ID == receipt.ID {
+			index.near[tenant][nearKey] = append(entries[:i], entries[i+1:]...)
+			break
+		}
+	}
+}
+
+// forgetDuplicate removes a deleted receipt from every tenant's index, so it can be submitted again
+func (svc *Service) forgetDuplicate(receipt store.Receipt) {
+	svc.duplicates.mu.Lock()
+	tenants := make([]string, 0, len(svc.duplicates.exact))
+	for tenant := range svc.duplicates.exact {
+		tenants = append(tenants, tenant)
+	}
+	svc.duplicates.mu.Unlock()
+	for _, tenant := range tenants {
+		svc.ReleaseDuplicate(tenant, receipt)
+	}
+}
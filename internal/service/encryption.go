@@ -0,0 +1,126 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"receipt-processor/internal/config"
+	"receipt-processor/internal/store"
+)
+
+// kmsClient unwraps data keys with the Decrypt action of AWS KMS, or of a KMS-compatible endpoint
+type kmsClient struct {
+	endpoint     string
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+}
+
+// OpenEncryption reads the keys receipts are encrypted with at rest: ENCRYPTION_KEYS, base64 AES keys as
+// id=key pairs, and ENCRYPTION_KMS_KEYS, data keys wrapped by AWS KMS as id=ciphertext pairs, which are
+// unwrapped at startup. ENCRYPTION_KEY_ID names the key new payloads are sealed with and may be left out
+// when there is only one; the others still open what they sealed before a rotation. Each payload is
+// bound to its receipt ID, which is authenticated alongside the key ID. It returns nil,
+// leaving receipts in plaintext, when no keys are set. Like the TLS settings, a broken key is an error
+// rather than logged and ignored, since it would leave receipts unreadable or unencrypted.
+func OpenEncryption() (*store.Encryption, error) {
+	keys := make(map[string][]byte)
+	for id, encoded := range config.Map("ENCRYPTION_KEYS") {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("ENCRYPTION_KEYS key %q is not base64: %v", id, err)
+		}
+		keys[id] = key
+	}
+	if wrapped := config.Map("ENCRYPTION_KMS_KEYS"); len(wrapped) > 0 {
+		kms := newKMSClient()
+		for id, blob := range wrapped {
+			if _, ok := keys[id]; ok {
+				return nil, fmt.Errorf("encryption key %q is in both ENCRYPTION_KEYS and ENCRYPTION_KMS_KEYS", id)
+			}
+			key, err := kms.decrypt(blob)
+			if err != nil {
+				return nil, fmt.Errorf("unwrapping ENCRYPTION_KMS_KEYS key %q: %w", id, err)
+			}
+			keys[id] = key
+		}
+	}
+	if len(keys) == 0 {
+		if os.Getenv("ENCRYPTION_KEY_ID") != "" {
+			return nil, errors.New("ENCRYPTION_KEY_ID requires ENCRYPTION_KEYS or ENCRYPTION_KMS_KEYS")
+		}
+		return nil, nil
+	}
+	current := os.Getenv("ENCRYPTION_KEY_ID")
+	if current == "" {
+		if len(keys) > 1 {
+			return nil, errors.New("ENCRYPTION_KEY_ID must name the key to encrypt with when several are set")
+		}
+		for id := range keys {
+			current = id
+		}
+	}
+	return store.NewEncryption(keys, current)
+}
+
+// newKMSClient reads the KMS_* settings, falling back to the AWS_* ones the S3 export uses too
+func newKMSClient() *kmsClient {
+	region := firstEnv("KMS_REGION", "AWS_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := strings.TrimSuffix(os.Getenv("KMS_ENDPOINT"), "/")
+	if endpoint == "" {
+		endpoint = "https://kms." + region + ".amazonaws.com"
+	}
+	return &kmsClient{
+		endpoint:     endpoint,
+		region:       region,
+		accessKey:    firstEnv("KMS_ACCESS_KEY_ID", "AWS_ACCESS_KEY_ID"),
+		secretKey:    firstEnv("KMS_SECRET_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY"),
+		sessionToken: firstEnv("KMS_SESSION_TOKEN", "AWS_SESSION_TOKEN"),
+		client:       &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// decrypt unwraps a base64 ciphertext blob, as returned by KMS GenerateDataKey, into the plaintext key
+func (c *kmsClient) decrypt(blob string) ([]byte, error) {
+	body, err := json.Marshal(map[string]string{"CiphertextBlob": blob})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService.Decrypt")
+	signV4(req, body, time.Now().UTC(), c.region, "kms", c.accessKey, c.secretKey, c.sessionToken)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("KMS Decrypt: %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	var result struct {
+		Plaintext string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("KMS Decrypt: %v", err)
+	}
+	return base64.StdEncoding.DecodeString(result.Plaintext)
+}
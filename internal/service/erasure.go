@@ -0,0 +1,270 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"receipt-processor/internal/store"
+)
+
+// AuditUserErased is the audited action of erasing a user's data on their request
+const AuditUserErased = "user.erased"
+
+// reasonErasure is the deletion reason of receipts erased on their user's request
+const reasonErasure = "erasure"
+
+// erasureArchive erases a user from the loyalty and audit records a store persists
+type erasureArchive interface {
+	EraseUser(erasure store.UserErasure) error
+}
+
+// ErasureReport is what erasing a user's data removed and anonymized
+type ErasureReport struct {
+	UserID string `json:"userId"`
+	Tenant string `json:"tenant"`
+	// Receipts are the stored receipts deleted, and ArchivedReceipts those removed from the retention archive
+	Receipts         int `json:"receipts"`
+	ArchivedReceipts int `json:"archivedReceipts"`
+	LedgerEntries    int `json:"ledgerEntries"`
+	// Referrals are the user's referral code and the referrals they took part in
+	Referrals int `json:"referrals"`
+	// AuditEntries are the audit entries about the user or their receipts that were anonymized
+	AuditEntries int       `json:"auditEntries"`
+	ErasedAt     time.Time `json:"erasedAt"`
+}
+
+// EraseUser erases a user of the context's tenant for a right-to-erasure request. Their receipts are
+// deleted, from the store and from the retention archive, without carrying their points over; their
+// points ledger entries, referral code and the referral they redeemed are deleted; referrals they made
+// keep a random pseudonym as the referrer, so the other user's bonus still adds up. Audit entries keep
+// the operation, its time and actor, but name the user by the pseudonym and lose the receipt summaries
+// and client address. The erasure itself is audited under the pseudonym, and the memory store is
+// snapshotted right away, so the write-ahead log segments with the erased data are pruned.
+func (svc *Service) EraseUser(ctx context.Context, userID string) (ErasureReport, error) {
+	svc.erasureMu.Lock()
+	defer svc.erasureMu.Unlock()
+	tenant := TenantFromContext(ctx)
+	report := ErasureReport{UserID: userID, Tenant: tenant, ErasedAt: svc.clock().UTC()}
+	pseudonym := "erased-" + uuid.New().String()
+
+	list, err := svc.AllReceipts(ctx)
+	if err != nil {
+		return report, err
+	}
+	erased := make(map[string]bool)
+	for _, receipt := range list {
+		if receipt.UserID != userID {
+			continue
+		}
+		if err := svc.store.Delete(ctx, receipt.ID); err != nil {
+			return report, err
+		}
+		erased[receipt.ID] = true
+		report.Receipts++
+		svc.forgetPoints(receipt.ID)
+		svc.forgetDuplicate(receipt)
+		svc.publishEvent(svc.clock(), eventReceiptDeleted, receiptDeletedData{ReceiptID: receipt.ID, Reason: reasonErasure, Tenant: receipt.Tenant})
+	}
+	if report.ArchivedReceipts, err = svc.eraseArchivedReceipts(tenant, userID); err != nil {
+		return report, err
+	}
+
+	if err := svc.eraseLoyalty(tenant, userID, pseudonym, erased, &report); err != nil {
+		return report, err
+	}
+	svc.RecordAudit(ctx, AuditUserErased, "user:"+pseudonym, nil, map[string]interface{}{
+		"receipts":         report.Receipts,
+		"archivedReceipts": report.ArchivedReceipts,
+		"ledgerEntries":    report.LedgerEntries,
+		"referrals":        report.Referrals,
+		"auditEntries":     report.AuditEntries,
+	})
+	if err := svc.SaveSnapshot(); err != nil {
+		log.Printf("Snapshot after erasing user %s failed, the write-ahead log still holds their data: %v", pseudonym, err)
+	}
+	return report, nil
+}
+
+// eraseLoyalty erases a user from the points ledger, the referrals and the audit log, persisting the
+// erasure when the store keeps them before changing what is in memory
+func (svc *Service) eraseLoyalty(tenant, userID, pseudonym string, erased map[string]bool, report *ErasureReport) error {
+	// Referrals credit the ledger while holding the referrals' lock, so it is taken first
+	book, ledger, audit, balances := &svc.referrals, &svc.ledger, &svc.audit, &svc.balances
+	book.mu.Lock()
+	defer book.mu.Unlock()
+	ledger.mu.Lock()
+	defer ledger.mu.Unlock()
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+
+	erasure := store.UserErasure{Tenant: tenantField(tenant), UserID: userID, Pseudonym: pseudonym}
+	var kept, dropped []store.LedgerEntry
+	for _, entry := range ledger.entries {
+		if entry.UserID == userID && entry.Tenant == erasure.Tenant {
+			dropped = append(dropped, entry)
+		} else {
+			kept = append(kept, entry)
+		}
+	}
+	report.LedgerEntries = len(dropped)
+	if _, ok := book.userCodes[userID]; ok {
+		report.Referrals++
+	}
+	for _, r := range book.byReferee {
+		if r.Referee == userID || r.Referrer == userID {
+			report.Referrals++
+		}
+	}
+	anonymized := make(map[int]store.AuditEntry)
+	for i, entry := range audit.entries {
+		if entry.Tenant != erasure.Tenant {
+			continue
+		}
+		if replacement, ok := anonymizeAuditEntry(entry, userID, pseudonym, erased); ok {
+			anonymized[i] = replacement
+			erasure.Audit = append(erasure.Audit, replacement)
+		}
+	}
+	report.AuditEntries = len(anonymized)
+
+	if a, ok := svc.store.(erasureArchive); ok {
+		if err := a.EraseUser(erasure); err != nil {
+			return err
+		}
+	}
+	ledger.entries = kept
+	if code, ok := book.userCodes[userID]; ok {
+		delete(book.codes, code)
+		delete(book.userCodes, userID)
+	}
+	delete(book.byReferee, userID)
+	for _, r := range book.byReferee {
+		if r.Referrer == userID {
+			r.Referrer = pseudonym
+		}
+	}
+	for i, replacement := range anonymized {
+		audit.entries[i] = replacement
+	}
+
+	balances.mu.Lock()
+	defer balances.mu.Unlock()
+	for _, entry := range dropped {
+		balances.setContribution(ledgerContributionKey(entry.ID), balanceEntry{})
+	}
+	user := tenantUser{Tenant: tenant, UserID: userID}
+	delete(balances.totals, user)
+	delete(balances.daily, user)
+	return nil
+}
+
+// anonymizeAuditEntry returns an audit entry with the user replaced by their pseudonym, and without the
+// summaries of their erased receipts or the client address, reporting whether the entry was about them
+// at all
+func anonymizeAuditEntry(entry store.AuditEntry, userID, pseudonym string, erased map[string]bool) (store.AuditEntry, bool) {
+	changed := false
+	if entry.Subject == "user:"+userID {
+		entry.Subject, changed = "user:"+pseudonym, true
+	}
+	if id, ok := strings.CutPrefix(entry.Subject, "receipt:"); ok && erased[id] {
+		entry.Before, entry.After, changed = nil, nil, true
+	}
+	replace := func(values map[string]interface{}) map[string]interface{} {
+		var copied map[string]interface{}
+		for key, value := range values {
+			if value != userID {
+				continue
+			}
+			if copied == nil {
+				copied = make(map[string]interface{}, len(values))
+				for k, v := range values {
+					copied[k] = v
+				}
+			}
+			copied[key], changed = pseudonym, true
+		}
+		if copied == nil {
+			return values
+		}
+		return copied
+	}
+	entry.Before, entry.After = replace(entry.Before), replace(entry.After)
+	// The address the user made their requests from is theirs too
+	if changed {
+		entry.IP = ""
+	}
+	return entry, changed
+}
+
+// eraseArchivedReceipts rewrites the retention archive without a user's receipts of a tenant, returning
+// how many it dropped. The file is replaced atomically, like snapshots.
+func (svc *Service) eraseArchivedReceipts(tenant, userID string) (int, error) {
+	svc.retention.mu.Lock()
+	path := svc.retention.archive
+	svc.retention.mu.Unlock()
+	if path == "" {
+		return 0, nil
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var kept [][]byte
+	dropped := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		receipt, err := svc.readArchivedReceipt(scanner.Bytes())
+		if errors.Is(err, errSealedArchiveLine) {
+			// A receipt that cannot be read might be the user's, so the erasure fails rather than keep it
+			return 0, err
+		}
+		if err == nil && receipt.UserID == userID && store.TenantOf(receipt) == tenant {
+			dropped++
+			continue
+		}
+		kept = append(kept, append([]byte(nil), scanner.Bytes()...))
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if dropped == 0 {
+		return 0, nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	for _, line := range kept {
+		if _, err := tmp.Write(append(line, '\n')); err != nil {
+			tmp.Close()
+			return 0, err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		return 0, err
+	}
+	return dropped, os.Rename(tmp.Name(), path)
+}
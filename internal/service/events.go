@@ -0,0 +1,111 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"receipt-processor/internal/store"
+)
+
+// Event types published on the event bus
+const (
+	eventReceiptProcessed = "receipt.processed"
+	eventPointsChanged    = "receipt.points_changed"
+	eventReceiptDeleted   = "receipt.deleted"
+)
+
+// Event is a notification delivered to every subscriber of the event bus
+type Event struct {
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// receiptProcessedData is the payload of a receipt.processed event
+type receiptProcessedData struct {
+	ReceiptID string        `json:"receiptId"`
+	Points    int           `json:"points"`
+	Receipt   store.Receipt `json:"receipt"`
+}
+
+// pointsChangedData is the payload of a receipt.points_changed event
+type pointsChangedData struct {
+	ReceiptID  string `json:"receiptId"`
+	UserID     string `json:"userId,omitempty"`
+	Tenant     string `json:"tenant,omitempty"`
+	OldVersion string `json:"oldRulesVersion"`
+	NewVersion string `json:"newRulesVersion"`
+	OldPoints  int    `json:"oldPoints"`
+	NewPoints  int    `json:"newPoints"`
+}
+
+// receiptDeletedData is the payload of a receipt.deleted event
+type receiptDeletedData struct {
+	ReceiptID string `json:"receiptId"`
+	// Reason says why the receipt was deleted, e.g. retention
+	Reason string `json:"reason"`
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// eventBus delivers every published event to its subscribers
+type eventBus struct {
+	mu          sync.RWMutex
+	subscribers []func(Event)
+}
+
+// SubscribeEvents registers a handler for every published event. Handlers run on the
+// publishing goroutine and must hand slow work (network delivery) off to their own goroutines.
+func (svc *Service) SubscribeEvents(handler func(Event)) {
+	svc.events.mu.Lock()
+	defer svc.events.mu.Unlock()
+	svc.events.subscribers = append(svc.events.subscribers, handler)
+}
+
+// publishEvent delivers an event that happened at a time to every subscriber
+func (svc *Service) publishEvent(at time.Time, eventType string, data interface{}) {
+	event := Event{Type: eventType, Time: at.UTC(), Data: data}
+
+	svc.events.mu.RLock()
+	defer svc.events.mu.RUnlock()
+	for _, handler := range svc.events.subscribers {
+		handler(event)
+	}
+}
+
+// eventReceiptID returns the ID of the receipt an event is about, or "" if it is not about one
+func eventReceiptID(event Event) string {
+	switch data := event.Data.(type) {
+	case receiptProcessedData:
+		return data.ReceiptID
+	case pointsChangedData:
+		return data.ReceiptID
+	case stateChangedData:
+		return data.ReceiptID
+	case receiptDeletedData:
+		return data.ReceiptID
+	case store.LedgerEntry:
+		return data.ReceiptID
+	}
+	return ""
+}
+
+// eventTenant returns the tenant whose receipt or user an event is about
+func eventTenant(event Event) string {
+	var tenant string
+	switch data := event.Data.(type) {
+	case receiptProcessedData:
+		tenant = data.Receipt.Tenant
+	case pointsChangedData:
+		tenant = data.Tenant
+	case stateChangedData:
+		tenant = data.Tenant
+	case receiptDeletedData:
+		tenant = data.Tenant
+	case store.LedgerEntry:
+		tenant = data.Tenant
+	}
+	if tenant == "" {
+		return DefaultTenant
+	}
+	return tenant
+}
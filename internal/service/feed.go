@@ -0,0 +1,91 @@
+package service
+
+import (
+	"sync"
+
+	"receipt-processor/internal/store"
+)
+
+// ProcessedReceipt is what the live feed tells its followers about a processed receipt
+type ProcessedReceipt struct {
+	ID       string `json:"id"`
+	Retailer string `json:"retailer"`
+	Points   int    `json:"points"`
+	// Tenant is who the receipt belongs to, for followers to only pass on their tenant's receipts
+	Tenant string `json:"-"`
+}
+
+// PointsChange is what the live feed tells its followers about a receipt whose points moved
+type PointsChange struct {
+	ReceiptID    string `json:"receiptId"`
+	Points       int    `json:"points"`
+	OldPoints    int    `json:"oldPoints"`
+	RulesVersion string `json:"rulesVersion"`
+}
+
+// feed fans one kind of event out to its followers. Unlike the event bus it lets followers leave,
+// since they are mostly connected clients that come and go.
+type feed[T any] struct {
+	mu        sync.Mutex
+	followers map[chan T]bool
+	convert   func(Event) (T, bool)
+}
+
+// newFeed creates a feed of the events convert accepts, delivered to it by the service's event bus
+func newFeed[T any](svc *Service, convert func(Event) (T, bool)) *feed[T] {
+	f := &feed[T]{followers: make(map[chan T]bool), convert: convert}
+	svc.SubscribeEvents(f.deliver)
+	return f
+}
+
+// processedReceipt is the live feed's update about a processed receipt
+func processedReceipt(event Event) (ProcessedReceipt, bool) {
+	data, ok := event.Data.(receiptProcessedData)
+	return ProcessedReceipt{ID: data.ReceiptID, Retailer: data.Receipt.Retailer, Points: data.Points, Tenant: store.TenantOf(data.Receipt)}, ok
+}
+
+// pointsChange is the live feed's update about a receipt whose points moved
+func pointsChange(event Event) (PointsChange, bool) {
+	data, ok := event.Data.(pointsChangedData)
+	return PointsChange{ReceiptID: data.ReceiptID, Points: data.NewPoints, OldPoints: data.OldPoints, RulesVersion: data.NewVersion}, ok
+}
+
+// FollowProcessedReceipts returns a channel of the receipts processed from now on and a function to
+// stop following. A follower that falls more than buffer receipts behind misses the receipts it had no
+// room for, so a slow client never holds up processing.
+func (svc *Service) FollowProcessedReceipts(buffer int) (<-chan ProcessedReceipt, func()) {
+	return svc.processedFeed.follow(buffer)
+}
+
+// FollowPointsChanges is FollowProcessedReceipts for the receipts rescored or recalculated from now on
+func (svc *Service) FollowPointsChanges(buffer int) (<-chan PointsChange, func()) {
+	return svc.pointsFeed.follow(buffer)
+}
+
+func (f *feed[T]) follow(buffer int) (<-chan T, func()) {
+	follower := make(chan T, buffer)
+	f.mu.Lock()
+	f.followers[follower] = true
+	f.mu.Unlock()
+	return follower, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.followers, follower)
+	}
+}
+
+// deliver hands an event of the feed's kind to every follower with room for it
+func (f *feed[T]) deliver(event Event) {
+	update, ok := f.convert(event)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for follower := range f.followers {
+		select {
+		case follower <- update:
+		default:
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"receipt-processor/internal/config"
+	"receipt-processor/internal/points"
+	"receipt-processor/internal/store"
+	"receipt-processor/scoring"
+)
+
+// Flags raised by the fraud pass
+const (
+	// flagFuturePurchase: the purchase date and time are later than the receipt could have been printed
+	flagFuturePurchase = "future-purchase"
+	// flagUserDuplicate: the same user already submitted a receipt from this retailer, day and total
+	flagUserDuplicate = "user-duplicate"
+	// flagTotalMismatch: the total, before tax and tip, is far above what the items add up to
+	flagTotalMismatch = "total-mismatch"
+	// flagSubmissionBurst: the user submitted more receipts in a short window than a shopper would
+	flagSubmissionBurst = "submission-burst"
+)
+
+// fraudFlags are the flags the admin fraud listing covers
+var fraudFlags = map[string]bool{
+	flagFuturePurchase: true, flagUserDuplicate: true, flagTotalMismatch: true, flagSubmissionBurst: true,
+}
+
+// Fraud modes decide what happens to a flagged receipt
+const (
+	// fraudModeReview holds flagged receipts in pending_review, so their points only count once approved
+	fraudModeReview = "review"
+	// fraudModeFlag only flags them
+	fraudModeFlag = "flag"
+	fraudModeOff  = "off"
+)
+
+// fraudCheck is the fraud pass's settings and the recent submissions of every user
+type fraudCheck struct {
+	mode string
+	// totalRatio is how many times the item sum a subtotal may be before it is flagged
+	totalRatio float64
+	// burstLimit receipts per user are allowed within burstWindow
+	burstLimit  int
+	burstWindow time.Duration
+
+	mu          sync.Mutex
+	submissions map[string][]time.Time
+}
+
+// futureTolerance allows for receipts printed in timezones ahead of the server
+const futureTolerance = 24 * time.Hour
+
+// totalMismatchSlack is how far in cents a subtotal may exceed its items before the ratio is checked,
+// so small receipts with a surcharge are not flagged
+const totalMismatchSlack = 500
+
+// ConfigureFraud reads FRAUD_MODE (review, flag or off), FRAUD_TOTAL_RATIO, FRAUD_BURST_LIMIT and
+// FRAUD_BURST_WINDOW
+func (svc *Service) ConfigureFraud() {
+	check := &svc.fraud
+	check.mode = strings.ToLower(os.Getenv("FRAUD_MODE"))
+	switch check.mode {
+	case fraudModeReview, fraudModeFlag, fraudModeOff:
+	case "":
+		check.mode = fraudModeReview
+	default:
+		log.Printf("Ignoring invalid FRAUD_MODE=%q, using %s", check.mode, fraudModeReview)
+		check.mode = fraudModeReview
+	}
+	check.totalRatio = config.Float("FRAUD_TOTAL_RATIO", 2)
+	check.burstLimit = config.Int("FRAUD_BURST_LIMIT", 10)
+	check.burstWindow = config.Duration("FRAUD_BURST_WINDOW", time.Minute)
+}
+
+// checkFraud flags suspicious receipts and, in review mode, holds them for review instead of approving them
+func (svc *Service) checkFraud(ctx context.Context, tenant string, receipt *store.Receipt) error {
+	check := &svc.fraud
+	if check.mode == fraudModeOff {
+		return nil
+	}
+	var flags []string
+	now := svc.clock()
+	if futurePurchase(*receipt, now) {
+		flags = append(flags, flagFuturePurchase)
+	}
+	if check.totalMismatch(*receipt) {
+		flags = append(flags, flagTotalMismatch)
+	}
+	if receipt.UserID != "" {
+		duplicate, err := svc.userDuplicate(ctx, *receipt)
+		if err != nil {
+			return err
+		}
+		if duplicate {
+			flags = append(flags, flagUserDuplicate)
+		}
+		if check.submissionBurst(receipt.UserID, now) {
+			flags = append(flags, flagSubmissionBurst)
+		}
+	}
+	if len(flags) == 0 {
+		return nil
+	}
+	receipt.Flags = append(receipt.Flags, flags...)
+	if check.mode == fraudModeReview && receipt.State == store.StateApproved && svc.workflowFor(tenant).allows(store.StatePendingReview, store.StateApproved) {
+		receipt.State = store.StatePendingReview
+	}
+	return nil
+}
+
+// futurePurchase reports whether a receipt claims to be from later than now
+func futurePurchase(receipt store.Receipt, now time.Time) bool {
+	purchasedAt, err := time.Parse("2006-01-02 15:04", receipt.PurchaseDate+" "+receipt.PurchaseTime)
+	return err == nil && purchasedAt.After(now.UTC().Add(futureTolerance))
+}
+
+// totalMismatch reports whether a receipt's subtotal is far above the sum of its item prices
+func (check *fraudCheck) totalMismatch(receipt store.Receipt) bool {
+	subtotal, err := scoring.ParseCents(scoring.Subtotal(points.ScoringReceipt(receipt)))
+	if err != nil || len(receipt.Items) == 0 {
+		return false
+	}
+	var items int64
+	for _, item := range receipt.Items {
+		price, err := scoring.ParseCents(item.Price)
+		if err != nil {
+			return false
+		}
+		items += price
+	}
+	return subtotal-items > totalMismatchSlack && float64(subtotal) > float64(items)*check.totalRatio
+}
+
+// userDuplicate reports whether the receipt's user already has a receipt from the same retailer, purchase
+// date and total, whatever its items and time say
+func (svc *Service) userDuplicate(ctx context.Context, receipt store.Receipt) (bool, error) {
+	list, err := svc.FindReceipts(ctx, store.Filter{Retailer: receipt.Retailer, From: receipt.PurchaseDate, To: receipt.PurchaseDate})
+	if err != nil {
+		return false, err
+	}
+	for _, stored := range list {
+		if stored.ID != receipt.ID && stored.UserID == receipt.UserID && stored.Total == receipt.Total {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// submissionBurst records a submission by a user and reports whether it is over the burst limit
+func (check *fraudCheck) submissionBurst(userID string, now time.Time) bool {
+	if check.burstLimit <= 0 || check.burstWindow <= 0 {
+		return false
+	}
+	check.mu.Lock()
+	defer check.mu.Unlock()
+	recent := check.submissions[userID][:0]
+	for _, at := range check.submissions[userID] {
+		if now.Sub(at) < check.burstWindow {
+			recent = append(recent, at)
+		}
+	}
+	check.submissions[userID] = append(recent, now)
+	return len(check.submissions[userID]) > check.burstLimit
+}
+
+// FraudFlagsOf returns the fraud flags raised on a receipt
+func FraudFlagsOf(receipt store.Receipt) []string {
+	var flags []string
+	for _, flag := range receipt.Flags {
+		if fraudFlags[flag] {
+			flags = append(flags, flag)
+		}
+	}
+	return flags
+}
+
+func ContainsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
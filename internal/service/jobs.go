@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"receipt-processor/internal/store"
+)
+
+// Job statuses
+const (
+	JobQueued     = "queued"
+	jobProcessing = "processing"
+	jobCompleted  = "completed"
+	jobFailed     = "failed"
+)
+
+// job tracks a receipt submitted through the worker pool until it is stored
+type job struct {
+	ID        string    `json:"id"`
+	Status    string    `json:"status"`
+	ReceiptID string    `json:"receiptId"`
+	Points    *int      `json:"points,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	// scope is the submitting request's, which the worker stores the receipt under
+	scope   requestScope
+	receipt store.Receipt
+}
+
+// jobTable tracks every job until it expires
+type jobTable struct {
+	mu   sync.RWMutex
+	byID map[string]*job
+}
+
+// NewJob registers a queued job for a receipt a request admitted for a tenant
+func (svc *Service) NewJob(ctx context.Context, tenant string, receipt store.Receipt) *job {
+	now := svc.clock().UTC()
+	j := &job{
+		ID:        uuid.New().String(),
+		Status:    JobQueued,
+		ReceiptID: receipt.ID,
+		CreatedAt: now,
+		UpdatedAt: now,
+		scope:     scopeOf(WithTenant(ctx, tenant)),
+		receipt:   receipt,
+	}
+	svc.jobs.mu.Lock()
+	svc.jobs.byID[j.ID] = j
+	svc.jobs.mu.Unlock()
+	return j
+}
+
+// ForgetJob removes a job that never made it into the queue
+func (svc *Service) ForgetJob(j *job) {
+	svc.jobs.mu.Lock()
+	delete(svc.jobs.byID, j.ID)
+	svc.jobs.mu.Unlock()
+}
+
+// updateJob changes the status of a job, recording the points or error of a finished job
+func (svc *Service) updateJob(j *job, status string, points *int, err error) {
+	svc.jobs.mu.Lock()
+	defer svc.jobs.mu.Unlock()
+	j.Status = status
+	j.Points = points
+	if err != nil {
+		j.Error = err.Error()
+	}
+	j.UpdatedAt = svc.clock().UTC()
+}
+
+// FindJob returns a copy of a job by ID, if its receipt is in the context's scope: jobs of other tenants,
+// and of other submitters for a submitter, are not found
+func (svc *Service) FindJob(ctx context.Context, id string) (job, bool) {
+	svc.jobs.mu.RLock()
+	defer svc.jobs.mu.RUnlock()
+	j, exists := svc.jobs.byID[id]
+	if !exists || !store.Visible(ctx, j.receipt) {
+		return job{}, false
+	}
+	return *j, true
+}
+
+// StartJobExpiry forgets finished jobs once they are older than ttl
+func (svc *Service) StartJobExpiry(ttl time.Duration) {
+	go func() {
+		for range time.Tick(time.Minute) {
+			cutoff := svc.clock().Add(-ttl)
+			svc.jobs.mu.Lock()
+			for id, j := range svc.jobs.byID {
+				if (j.Status == jobCompleted || j.Status == jobFailed) && j.UpdatedAt.Before(cutoff) {
+					delete(svc.jobs.byID, id)
+				}
+			}
+			svc.jobs.mu.Unlock()
+		}
+	}()
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"receipt-processor/internal/config"
+)
+
+// StartKafkaPublisher publishes every event to the configured Kafka topic, keyed by receipt ID
+// so all events of one receipt land on the same partition in order
+func (svc *Service) StartKafkaPublisher() {
+	brokers := os.Getenv("KAFKA_BROKERS")
+	if brokers == "" {
+		return
+	}
+	topic := os.Getenv("KAFKA_TOPIC")
+	if topic == "" {
+		topic = "receipts"
+	}
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(strings.Split(brokers, ",")...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		BatchTimeout: config.Duration("KAFKA_BATCH_TIMEOUT", 100*time.Millisecond),
+		Async:        true,
+		Completion: func(messages []kafka.Message, err error) {
+			if err != nil {
+				log.Printf("Failed to publish %d events to Kafka topic %s: %v", len(messages), topic, err)
+			}
+		},
+	}
+
+	svc.SubscribeEvents(func(event Event) {
+		value, err := json.Marshal(svc.RedactEvent(event))
+		if err != nil {
+			log.Printf("Failed to encode %s event: %v", event.Type, err)
+			return
+		}
+		message := kafka.Message{
+			Key:     []byte(eventReceiptID(event)),
+			Value:   value,
+			Headers: []kafka.Header{{Key: "type", Value: []byte(event.Type)}},
+			Time:    event.Time,
+		}
+		if err := writer.WriteMessages(context.Background(), message); err != nil {
+			log.Printf("Failed to queue %s event for Kafka: %v", event.Type, err)
+		}
+	})
+	log.Printf("Publishing events to Kafka topic %s on %s", topic, brokers)
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Leaderboard windows, by purchase date: today, the last 7 days, the last 30 days or every receipt
+const (
+	windowDay     = "day"
+	windowWeek    = "week"
+	windowMonth   = "month"
+	WindowAllTime = "all"
+)
+
+// WindowDays is how many days of purchases each bounded window covers, today included
+var WindowDays = map[string]int{windowDay: 1, windowWeek: 7, windowMonth: 30}
+
+// leader is one ranked user
+type leader struct {
+	Rank   int    `json:"rank"`
+	UserID string `json:"userId"`
+	Points int    `json:"points"`
+}
+
+// leaderboard is the ranking of one window as of GeneratedAt
+type leaderboard struct {
+	Window      string    `json:"window"`
+	From        string    `json:"from,omitempty"`
+	GeneratedAt time.Time `json:"generatedAt"`
+	Leaders     []leader  `json:"leaders"`
+}
+
+// leaderboardCache holds the rankings built in the last ttl
+type leaderboardCache struct {
+	mu     sync.Mutex
+	boards map[leaderboardKey]leaderboard
+	ttl    time.Duration
+}
+
+// SetLeaderboardTTL sets how long a ranking is served before it is rebuilt
+func (svc *Service) SetLeaderboardTTL(ttl time.Duration) {
+	svc.leaderboards.mu.Lock()
+	defer svc.leaderboards.mu.Unlock()
+	svc.leaderboards.ttl = ttl
+}
+
+// leaderboardKey identifies a cached ranking: every tenant ranks its own users
+type leaderboardKey struct {
+	Tenant string
+	Window string
+}
+
+// rankLeaders orders users by points, then user id, and numbers them; tied users share a rank
+func rankLeaders(totals map[string]int) []leader {
+	leaders := make([]leader, 0, len(totals))
+	for user, points := range totals {
+		if points > 0 {
+			leaders = append(leaders, leader{UserID: user, Points: points})
+		}
+	}
+	sort.Slice(leaders, func(i, j int) bool {
+		if leaders[i].Points != leaders[j].Points {
+			return leaders[i].Points > leaders[j].Points
+		}
+		return leaders[i].UserID < leaders[j].UserID
+	})
+	for i := range leaders {
+		leaders[i].Rank = i + 1
+		if i > 0 && leaders[i].Points == leaders[i-1].Points {
+			leaders[i].Rank = leaders[i-1].Rank
+		}
+	}
+	return leaders
+}
+
+// buildLeaderboard ranks users by the points of their approved receipts in the window. The all-time
+// ranking comes straight from the balance cache; bounded windows scan the ledger.
+func (svc *Service) buildLeaderboard(ctx context.Context, window string, now time.Time) (leaderboard, error) {
+	board := leaderboard{Window: window, GeneratedAt: now}
+	if window == WindowAllTime {
+		svc.balances.mu.RLock()
+		warm := svc.balances.warm
+		tenant := TenantFromContext(ctx)
+		totals := make(map[string]int)
+		for user, points := range svc.balances.totals {
+			if user.Tenant == tenant {
+				totals[user.UserID] = points
+			}
+		}
+		svc.balances.mu.RUnlock()
+		if warm {
+			board.Leaders = rankLeaders(totals)
+			return board, nil
+		}
+	} else {
+		board.From = now.AddDate(0, 0, 1-WindowDays[window]).Format("2006-01-02")
+	}
+
+	list, err := svc.AllReceipts(ctx)
+	if err != nil {
+		return board, err
+	}
+	totals := make(map[string]int)
+	for _, receipt := range list {
+		// Dates are YYYY-MM-DD, so they compare correctly as strings
+		if countsTowardBalance(receipt) && receipt.PurchaseDate >= board.From {
+			totals[receipt.UserID] += svc.AwardedPoints(receipt)
+		}
+	}
+	board.Leaders = rankLeaders(totals)
+	return board, nil
+}
+
+// CachedLeaderboard returns the window's ranking of the context's tenant, rebuilding it at most once per
+// leaderboard TTL
+func (svc *Service) CachedLeaderboard(ctx context.Context, window string) (leaderboard, error) {
+	cache := &svc.leaderboards
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	now := svc.clock().UTC()
+	key := leaderboardKey{Tenant: TenantFromContext(ctx), Window: window}
+	ctx = WithTenant(ctx, key.Tenant)
+	if board, ok := cache.boards[key]; ok && now.Sub(board.GeneratedAt) < cache.ttl {
+		return board, nil
+	}
+	board, err := svc.buildLeaderboard(ctx, window, now)
+	if err != nil {
+		return board, err
+	}
+	cache.boards[key] = board
+	return board, nil
+}
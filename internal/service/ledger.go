@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"receipt-processor/internal/store"
+)
+
+// eventPointsAwarded is published for every points ledger entry
+const eventPointsAwarded = "points.awarded"
+
+// pointsLedger holds every store.LedgerEntry, oldest first. Stores that implement loyaltyArchive keep it
+// across restarts; otherwise it lives only in memory.
+type pointsLedger struct {
+	mu      sync.RWMutex
+	entries []store.LedgerEntry
+}
+
+// ledgerContributionKey is the balance cache key of a ledger entry, apart from receipt ids
+func ledgerContributionKey(id string) string {
+	return "ledger:" + id
+}
+
+// creditPoints records a ledger entry for a user of a tenant, persisting it when the store keeps a loyalty
+// archive, and announces it so the balance cache picks it up
+func (svc *Service) creditPoints(tenant, userID string, points int, reason, receiptID string) (store.LedgerEntry, error) {
+	entry := store.LedgerEntry{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Points:    points,
+		Reason:    reason,
+		ReceiptID: receiptID,
+		CreatedAt: svc.clock().UTC(),
+		Tenant:    tenantField(tenant),
+	}
+	if a, ok := svc.loyalty(); ok {
+		if err := a.SaveLedgerEntry(entry); err != nil {
+			return entry, err
+		}
+	}
+	svc.ledger.mu.Lock()
+	svc.ledger.entries = append(svc.ledger.entries, entry)
+	svc.ledger.mu.Unlock()
+	// Bonuses are credited by the service itself, never on a request's behalf
+	svc.RecordAudit(WithTenant(context.Background(), tenant), AuditPointsCredited, "user:"+userID, nil,
+		map[string]interface{}{"points": points, "reason": reason, "receiptId": receiptID, "ledgerEntry": entry.ID})
+	svc.publishEvent(svc.clock(), eventPointsAwarded, entry)
+	return entry, nil
+}
+
+// AllLedgerEntries returns a copy of the ledger
+func (svc *Service) AllLedgerEntries() []store.LedgerEntry {
+	svc.ledger.mu.RLock()
+	defer svc.ledger.mu.RUnlock()
+	return append([]store.LedgerEntry(nil), svc.ledger.entries...)
+}
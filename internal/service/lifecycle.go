@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"receipt-processor/internal/store"
+)
+
+// eventStateChanged is published for every lifecycle transition
+const eventStateChanged = "receipt.state_changed"
+
+// ErrInvalidTransition is returned for a transition the tenant's workflow does not allow
+var ErrInvalidTransition = errors.New("invalid state transition")
+
+// workflow is a tenant's receipt lifecycle: the state receipts enter when they are admitted and
+// the transitions allowed out of each state
+type workflow struct {
+	Initial     string              `json:"initial"`
+	Transitions map[string][]string `json:"transitions"`
+}
+
+// defaultWorkflow approves receipts on admission; reviewers can still void them, and tenants that want
+// manual review start receipts in pending_review instead
+var defaultWorkflow = workflow{
+	Initial: store.StateApproved,
+	Transitions: map[string][]string{
+		store.StateSubmitted:     {store.StatePendingReview, store.StateApproved, store.StateRejected},
+		store.StatePendingReview: {store.StateApproved, store.StateRejected},
+		store.StateApproved:      {store.StateVoided},
+		store.StateRejected:      {store.StatePendingReview},
+	},
+}
+
+// KnownStates are the states a workflow may use
+var KnownStates = map[string]bool{
+	store.StateSubmitted: true, store.StatePendingReview: true, store.StateApproved: true, store.StateRejected: true, store.StateVoided: true,
+}
+
+// lifecycle holds the per-tenant workflows and the hooks run after transitions
+type lifecycle struct {
+	workflows map[string]workflow
+	hooksMu   sync.RWMutex
+	// hooks are keyed by "from>to"; "*" matches any state
+	hooks map[string][]func(stateChangedData)
+}
+
+// ConfigureWorkflows loads per-tenant workflows from RECEIPT_WORKFLOWS, a JSON object keyed by tenant,
+// e.g. {"acme": {"initial": "pending_review"}}. Omitted fields keep the default workflow's.
+func (svc *Service) ConfigureWorkflows() {
+	value := os.Getenv("RECEIPT_WORKFLOWS")
+	if value == "" {
+		return
+	}
+	var workflows map[string]workflow
+	if err := json.Unmarshal([]byte(value), &workflows); err != nil {
+		log.Printf("Ignoring invalid RECEIPT_WORKFLOWS: %v", err)
+		return
+	}
+	for tenant, wf := range workflows {
+		if wf.Initial == "" {
+			wf.Initial = defaultWorkflow.Initial
+		}
+		if wf.Transitions == nil {
+			wf.Transitions = defaultWorkflow.Transitions
+		}
+		if err := wf.validate(); err != nil {
+			log.Printf("Ignoring RECEIPT_WORKFLOWS entry for %s: %v", tenant, err)
+			continue
+		}
+		svc.lifecycle.workflows[tenant] = wf
+	}
+}
+
+// validate rejects workflows naming unknown states
+func (wf workflow) validate() error {
+	if !KnownStates[wf.Initial] {
+		return fmt.Errorf("unknown initial state %q", wf.Initial)
+	}
+	for from, targets := range wf.Transitions {
+		if !KnownStates[from] {
+			return fmt.Errorf("unknown state %q", from)
+		}
+		for _, to := range targets {
+			if !KnownStates[to] {
+				return fmt.Errorf("unknown state %q", to)
+			}
+		}
+	}
+	return nil
+}
+
+// allows reports whether the workflow allows moving from one state to another
+func (wf workflow) allows(from, to string) bool {
+	for _, target := range wf.Transitions[from] {
+		if target == to {
+			return true
+		}
+	}
+	return false
+}
+
+// workflowFor returns a tenant's workflow
+func (svc *Service) workflowFor(tenant string) workflow {
+	if wf, ok := svc.lifecycle.workflows[tenant]; ok {
+		return wf
+	}
+	return defaultWorkflow
+}
+
+// stateChangedData is the payload of a receipt.state_changed event
+type stateChangedData struct {
+	ReceiptID string    `json:"receiptId"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Reason    string    `json:"reason,omitempty"`
+	Time      time.Time `json:"time"`
+	Tenant    string    `json:"tenant,omitempty"`
+}
+
+// onTransition registers a hook run after every matching transition; from and to may be "*"
+func (svc *Service) onTransition(from, to string, hook func(stateChangedData)) {
+	svc.lifecycle.hooksMu.Lock()
+	defer svc.lifecycle.hooksMu.Unlock()
+	svc.lifecycle.hooks[from+">"+to] = append(svc.lifecycle.hooks[from+">"+to], hook)
+}
+
+// runTransitionHooks runs the hooks matching a transition
+func (svc *Service) runTransitionHooks(change stateChangedData) {
+	svc.lifecycle.hooksMu.RLock()
+	defer svc.lifecycle.hooksMu.RUnlock()
+	for _, key := range []string{change.From + ">" + change.To, change.From + ">*", "*>" + change.To, "*>*"} {
+		for _, hook := range svc.lifecycle.hooks[key] {
+			hook(change)
+		}
+	}
+}
+
+// TransitionReceipt moves a stored receipt to a new state if the tenant's workflow allows it
+func (svc *Service) TransitionReceipt(ctx context.Context, tenant, id, to, reason string) (store.Receipt, error) {
+	receipt, exists, err := svc.FindReceipt(ctx, id)
+	if err != nil {
+		return receipt, err
+	}
+	if !exists {
+		return receipt, store.ErrNotFound
+	}
+	from := store.StateOf(receipt)
+	if !svc.workflowFor(tenant).allows(from, to) {
+		return receipt, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, to)
+	}
+
+	receipt.State = to
+	if err := svc.store.Save(ctx, receipt); err != nil {
+		return receipt, err
+	}
+	svc.cachePoints(receipt)
+	svc.RecordAudit(ctx, AuditReceiptState, receiptSubject(receipt.ID), map[string]interface{}{"state": from}, map[string]interface{}{"state": to, "reason": reason})
+	svc.runTransitionHooks(stateChangedData{ReceiptID: receipt.ID, From: from, To: to, Reason: reason, Time: svc.clock().UTC(), Tenant: receipt.Tenant})
+	return receipt, nil
+}
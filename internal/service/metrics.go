@@ -0,0 +1,115 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// MetricsWindow is how many one-minute buckets the dashboard keeps
+const MetricsWindow = 60
+
+// MinuteBucket aggregates the activity seen during one minute
+type MinuteBucket struct {
+	// Minute counts minutes since the Unix epoch
+	Minute     int64 `json:"minute"`
+	Receipts   int   `json:"receipts"`
+	Points     int   `json:"points"`
+	Requests   int   `json:"requests"`
+	Errors     int   `json:"errors"`
+	QueueDepth int   `json:"queueDepth"`
+	Buffered   int   `json:"buffered"`
+	Blocked    int   `json:"blocked"`
+	Flagged    int   `json:"flagged"`
+	Purged     int   `json:"purged"`
+	// WebhooksDropped counts webhook deliveries dropped for a full queue or after their last attempt
+	WebhooksDropped int `json:"webhooksDropped"`
+}
+
+// minuteMetrics is a ring of the last MetricsWindow minutes, indexed by minute
+type minuteMetrics struct {
+	mu      sync.Mutex
+	buckets [MetricsWindow]MinuteBucket
+}
+
+// currentBucket returns the bucket for the current minute, resetting it if it is stale.
+// Callers must hold mu.
+func (m *minuteMetrics) currentBucket(now time.Time) *MinuteBucket {
+	minute := now.Unix() / 60
+	bucket := &m.buckets[minute%MetricsWindow]
+	if bucket.Minute != minute {
+		*bucket = MinuteBucket{Minute: minute}
+	}
+	return bucket
+}
+
+// recordReceiptMetrics counts a receipt stored at a time and the points it earned
+func (svc *Service) recordReceiptMetrics(now time.Time, points int) {
+	svc.metrics.mu.Lock()
+	defer svc.metrics.mu.Unlock()
+	bucket := svc.metrics.currentBucket(now)
+	bucket.Receipts++
+	bucket.Points += points
+}
+
+// recordDuplicateMetrics counts a submission blocked or flagged by duplicate detection at a time
+func (svc *Service) recordDuplicateMetrics(now time.Time, blocked bool) {
+	svc.metrics.mu.Lock()
+	defer svc.metrics.mu.Unlock()
+	bucket := svc.metrics.currentBucket(now)
+	if blocked {
+		bucket.Blocked++
+	} else {
+		bucket.Flagged++
+	}
+}
+
+// recordPurgeMetrics counts receipts deleted by the retention job at a time
+func (svc *Service) recordPurgeMetrics(now time.Time, purged int) {
+	svc.metrics.mu.Lock()
+	defer svc.metrics.mu.Unlock()
+	svc.metrics.currentBucket(now).Purged += purged
+}
+
+// recordWebhookDropMetrics counts a webhook delivery dropped at a time
+func (svc *Service) recordWebhookDropMetrics(now time.Time) {
+	svc.metrics.mu.Lock()
+	defer svc.metrics.mu.Unlock()
+	svc.metrics.currentBucket(now).WebhooksDropped++
+}
+
+// RecordRequestMetrics counts a request answered at a time and whether it failed
+func (svc *Service) RecordRequestMetrics(now time.Time, status int) {
+	queueDepth := svc.batch.depth()
+	buffered, _ := svc.bufferDepth()
+
+	svc.metrics.mu.Lock()
+	defer svc.metrics.mu.Unlock()
+	bucket := svc.metrics.currentBucket(now)
+	bucket.Requests++
+	if status >= 400 {
+		bucket.Errors++
+	}
+	if queueDepth > bucket.QueueDepth {
+		bucket.QueueDepth = queueDepth
+	}
+	if buffered > bucket.Buffered {
+		bucket.Buffered = buffered
+	}
+}
+
+// MetricsSeries returns the last MetricsWindow minutes, oldest first, with empty minutes filled in
+func (svc *Service) MetricsSeries() []MinuteBucket {
+	svc.metrics.mu.Lock()
+	defer svc.metrics.mu.Unlock()
+	now := svc.clock().Unix() / 60
+	series := make([]MinuteBucket, MetricsWindow)
+	for i := range series {
+		minute := now - int64(MetricsWindow-1-i)
+		bucket := svc.metrics.buckets[minute%MetricsWindow]
+		if bucket.Minute != minute {
+			bucket = MinuteBucket{Minute: minute}
+		}
+		series[i] = bucket
+	}
+	return series
+}
@@ -0,0 +1,13 @@
+package service
+
+// NATSQueueGroup makes several instances share the submissions subject instead of each processing every message
+const NATSQueueGroup = "receipt-processor"
+
+// NATSReply answers a request-reply submission. Rejections carry the HTTP status the same submission
+// would have been answered with, e.g. 400 for an invalid receipt and 409 for a duplicate.
+type NATSReply struct {
+	ID     string `json:"id,omitempty"`
+	Points int    `json:"points,omitempty"`
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"receipt-processor/internal/store"
+)
+
+// ocrProvider turns a receipt image into text using the given language packs, in order of preference
+type ocrProvider interface {
+	Recognize(image []byte, languages []string) (string, error)
+}
+
+// tesseractProvider runs the tesseract command line tool; the language packs it is asked
+// for (e.g. "spa", "fra") must be installed alongside it
+type tesseractProvider struct {
+	Command string
+}
+
+func (p tesseractProvider) Recognize(image []byte, languages []string) (string, error) {
+	cmd := exec.Command(p.Command, "stdin", "stdout", "-l", strings.Join(languages, "+"))
+	cmd.Stdin = bytes.NewReader(image)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("tesseract: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// ocrConfig is the OCR provider and the language packs it is run with
+type ocrConfig struct {
+	provider ocrProvider
+
+	// OCR language packs: the default applies to every tenant without an override
+	defaultLanguages []string
+	tenantLanguages  map[string][]string
+}
+
+// ConfigureOCR selects the OCR provider and loads the per-tenant language packs from the environment
+func (svc *Service) ConfigureOCR() {
+	command := os.Getenv("TESSERACT_PATH")
+	if command == "" {
+		command = "tesseract"
+	}
+	ocr := ocrConfig{provider: tesseractProvider{Command: command}, tenantLanguages: make(map[string][]string)}
+
+	ocr.defaultLanguages = SplitLanguages(os.Getenv("OCR_LANGUAGES"))
+	if len(ocr.defaultLanguages) == 0 {
+		ocr.defaultLanguages = []string{"eng"}
+	}
+	for _, pair := range strings.Split(os.Getenv("OCR_TENANT_LANGUAGES"), ",") {
+		tenant, languages, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok {
+			ocr.tenantLanguages[strings.TrimSpace(tenant)] = SplitLanguages(languages)
+		}
+	}
+	svc.ocr = ocr
+}
+
+// SplitLanguages parses a "+"-separated list of language packs such as "spa+eng"
+func SplitLanguages(value string) []string {
+	var languages []string
+	for _, language := range strings.Split(value, "+") {
+		if language = strings.TrimSpace(language); language != "" {
+			languages = append(languages, language)
+		}
+	}
+	return languages
+}
+
+// OCRLanguages returns the language packs configured for a tenant
+func (svc *Service) OCRLanguages(tenant string) []string {
+	if languages, ok := svc.ocr.tenantLanguages[tenant]; ok && len(languages) > 0 {
+		return languages
+	}
+	return svc.ocr.defaultLanguages
+}
+
+// languageStopwords are common receipt and function words used to guess the language of OCR text
+var languageStopwords = map[string][]string{
+	"eng": {"the", "and", "total", "subtotal", "tax", "change", "cash", "thank", "you"},
+	"spa": {"el", "la", "de", "y", "total", "iva", "gracias", "cambio", "efectivo", "importe"},
+	"fra": {"le", "la", "de", "et", "total", "tva", "merci", "rendu", "espèces", "montant"},
+	"deu": {"der", "die", "und", "summe", "gesamt", "mwst", "danke", "bar", "rückgeld", "betrag"},
+	"ita": {"il", "di", "e", "totale", "iva", "grazie", "resto", "contanti", "importo"},
+	"por": {"o", "de", "e", "total", "troco", "obrigado", "dinheiro", "valor", "imposto"},
+}
+
+// detectLanguage picks the candidate language whose stopwords appear most often in the text,
+// returning "" when none of them appear
+func detectLanguage(text string, candidates []string) string {
+	counts := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r > 127)
+	}) {
+		counts[word]++
+	}
+
+	best, bestScore := "", 0
+	for _, language := range candidates {
+		score := 0
+		for _, stopword := range languageStopwords[language] {
+			score += counts[stopword]
+		}
+		if score > bestScore {
+			best, bestScore = language, score
+		}
+	}
+	return best
+}
+
+// RecognizeReceipt runs OCR with all of the tenant's packs, detects the language of the result
+// and, when that language is not already the first choice, re-runs OCR with its pack first
+func (svc *Service) RecognizeReceipt(image []byte, languages []string) (string, string, error) {
+	text, err := svc.ocr.provider.Recognize(image, languages)
+	if err != nil {
+		return "", "", err
+	}
+	language := detectLanguage(text, languages)
+	if language == "" {
+		return text, languages[0], nil
+	}
+	if language != languages[0] {
+		preferred := []string{language}
+		for _, l := range languages {
+			if l != language {
+				preferred = append(preferred, l)
+			}
+		}
+		if text, err = svc.ocr.provider.Recognize(image, preferred); err != nil {
+			return "", "", err
+		}
+	}
+	return text, language, nil
+}
+
+var (
+	ocrDatePattern  = regexp.MustCompile(`\b(\d{4})-(\d{2})-(\d{2})\b|\b(\d{2})/(\d{2})/(\d{4})\b`)
+	ocrTimePattern  = regexp.MustCompile(`\b([01]\d|2[0-3]):([0-5]\d)\b`)
+	ocrAmountAtEnd  = regexp.MustCompile(`^(.*?)\s+\$?(\d+[.,]\d{2})$`)
+	ocrTotalPattern = regexp.MustCompile(`(?i)^(total|totale|summe|gesamt|importe|montant)\b`)
+	ocrSkipPattern  = regexp.MustCompile(`(?i)^(sub ?total|tax|iva|tva|mwst|change|cambio|cash|efectivo)\b`)
+)
+
+// ParseReceiptText maps OCR output into a Receipt: the first line is the retailer, the first
+// date and time found are the purchase date and time, the total line gives the total and other
+// lines ending in an amount are items
+func ParseReceiptText(text string) (store.Receipt, error) {
+	var receipt store.Receipt
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if receipt.Retailer == "" {
+			receipt.Retailer = line
+			continue
+		}
+		if receipt.PurchaseDate == "" {
+			if m := ocrDatePattern.FindStringSubmatch(line); m != nil {
+				if m[1] != "" {
+					receipt.PurchaseDate = m[1] + "-" + m[2] + "-" + m[3]
+				} else {
+					// Day-first dates are the norm for the non-English receipts this is meant for
+					receipt.PurchaseDate = m[6] + "-" + m[5] + "-" + m[4]
+				}
+			}
+		}
+		if receipt.PurchaseTime == "" {
+			if m := ocrTimePattern.FindString(line); m != "" {
+				receipt.PurchaseTime = m
+			}
+		}
+		m := ocrAmountAtEnd.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		description, amount := strings.TrimSpace(m[1]), strings.Replace(m[2], ",", ".", 1)
+		switch {
+		case ocrTotalPattern.MatchString(description):
+			receipt.Total = amount
+		case ocrSkipPattern.MatchString(description):
+		default:
+			receipt.Items = append(receipt.Items, store.ReceiptItem{ShortDescription: description, Price: amount})
+		}
+	}
+	if receipt.Retailer == "" || receipt.Total == "" {
+		return receipt, errors.New("could not find a retailer and total in the image")
+	}
+	return receipt, nil
+}
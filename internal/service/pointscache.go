@@ -0,0 +1,133 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"receipt-processor/internal/store"
+)
+
+// ConfigurePointsCache caches the points of up to size receipts for ttl (0: until evicted) when the store
+// is postgres; the in-memory store is as fast as the cache and does without. Zero size disables it.
+func (svc *Service) ConfigurePointsCache(size int, ttl time.Duration) {
+	if _, ok := svc.store.(*store.SQL); !ok || size <= 0 {
+		return
+	}
+	svc.pointsCache = newLRUCache(size, ttl, svc.clock)
+}
+
+// CachedPoints is what GET /points answers from, without the rest of the receipt
+type CachedPoints struct {
+	ID        string
+	ShortCode string
+	Points    int
+	// Tenant and SubmittedBy are the receipt's, to check that the cached points are in the caller's scope
+	Tenant      string
+	SubmittedBy string
+}
+
+// ReceiptPoints returns the awarded points of a receipt, looked up by ID or short code, from the points
+// cache when it has them and from the store otherwise
+func (svc *Service) ReceiptPoints(ctx context.Context, id string) (CachedPoints, bool, error) {
+	if cached, ok := svc.pointsCache.get(id); ok && store.Visible(ctx, store.Receipt{Tenant: cached.Tenant, SubmittedBy: cached.SubmittedBy}) {
+		return cached, true, nil
+	}
+	receipt, exists, err := svc.FindReceipt(ctx, id)
+	if err != nil || !exists {
+		return CachedPoints{}, exists, err
+	}
+	svc.cachePoints(receipt)
+	return svc.cachedPoints(receipt), true, nil
+}
+
+// cachedPoints is what the points cache keeps of a receipt
+func (svc *Service) cachedPoints(receipt store.Receipt) CachedPoints {
+	return CachedPoints{ID: receipt.ID, ShortCode: receipt.ShortCode, Points: svc.AwardedPoints(receipt), Tenant: receipt.Tenant, SubmittedBy: receipt.SubmittedBy}
+}
+
+// cachePoints refreshes the cached points of a receipt that was just stored or read
+func (svc *Service) cachePoints(receipt store.Receipt) {
+	svc.pointsCache.put(receipt.ID, svc.cachedPoints(receipt))
+}
+
+// forgetPoints drops the cached points of a deleted receipt
+func (svc *Service) forgetPoints(id string) {
+	svc.pointsCache.remove(id)
+}
+
+// lruCache is a fixed-size cache that evicts the least recently used entry when full. Entries also
+// expire after ttl on the clock, which bounds how long a change written by another server goes unnoticed.
+// The methods of a nil cache do nothing.
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	clock   func() time.Time
+	order   *list.List // of *lruEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	value   CachedPoints
+	expires time.Time
+}
+
+func newLRUCache(size int, ttl time.Duration, clock func() time.Time) *lruCache {
+	return &lruCache{size: size, ttl: ttl, clock: clock, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *lruCache) get(key string) (CachedPoints, bool) {
+	if c == nil {
+		return CachedPoints{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return CachedPoints{}, false
+	}
+	entry := element.Value.(*lruEntry)
+	if c.ttl > 0 && c.clock().After(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return CachedPoints{}, false
+	}
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+func (c *lruCache) put(key string, value CachedPoints) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := c.clock().Add(c.ttl)
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.value, entry.expires = value, expires
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (c *lruCache) remove(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
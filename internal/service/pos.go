@@ -0,0 +1,157 @@
+package service
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"receipt-processor/internal/store"
+	"receipt-processor/scoring"
+)
+
+// POSParsers parse native POS formats into a Receipt, keyed by format name
+var POSParsers = map[string]func([]byte) (store.Receipt, error){
+	"arts":   parseARTSPOSLog,
+	"jsonld": parseSchemaOrgOrder,
+}
+
+// normalizeAmount renders a decimal amount with exactly two decimals, as receipts use
+func normalizeAmount(value string) (string, error) {
+	cents, err := scoring.DecimalCents(value)
+	if err != nil {
+		return "", err
+	}
+	return scoring.FormatCents(cents), nil
+}
+
+// splitDateTime splits an ISO 8601 timestamp into the purchase date and time of a receipt
+func splitDateTime(value string) (string, string, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format("2006-01-02"), t.Format("15:04"), nil
+		}
+	}
+	return "", "", fmt.Errorf("invalid timestamp %q", value)
+}
+
+// artsPOSLog is the subset of an ARTS POSLog document needed to build a receipt
+type artsPOSLog struct {
+	Transactions []struct {
+		RetailStoreID string `xml:"RetailStoreID"`
+		BusinessUnit  struct {
+			UnitID struct {
+				Name string `xml:"Name,attr"`
+			} `xml:"UnitID"`
+		} `xml:"BusinessUnit"`
+		EndDateTime string `xml:"EndDateTime"`
+		Retail      struct {
+			LineItems []struct {
+				Sale *struct {
+					Description    string `xml:"Description"`
+					ExtendedAmount string `xml:"ExtendedAmount"`
+				} `xml:"Sale"`
+			} `xml:"LineItem"`
+			Totals []struct {
+				Type   string `xml:"TotalType,attr"`
+				Amount string `xml:",chardata"`
+			} `xml:"Total"`
+		} `xml:"RetailTransaction"`
+	} `xml:"Transaction"`
+}
+
+// parseARTSPOSLog maps the first transaction of an ARTS POSLog into a Receipt. The store name comes
+// from BusinessUnit/UnitID@Name, falling back to RetailStoreID; sale line items become items, the
+// TransactionGrandAmount total becomes the total and the TransactionTaxAmount total the tax.
+func parseARTSPOSLog(data []byte) (store.Receipt, error) {
+	var doc artsPOSLog
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return store.Receipt{}, err
+	}
+	if len(doc.Transactions) == 0 {
+		return store.Receipt{}, errors.New("no Transaction element")
+	}
+	tx := doc.Transactions[0]
+
+	receipt := store.Receipt{Retailer: strings.TrimSpace(tx.BusinessUnit.UnitID.Name)}
+	if receipt.Retailer == "" {
+		receipt.Retailer = strings.TrimSpace(tx.RetailStoreID)
+	}
+	var err error
+	if receipt.PurchaseDate, receipt.PurchaseTime, err = splitDateTime(tx.EndDateTime); err != nil {
+		return store.Receipt{}, fmt.Errorf("EndDateTime: %w", err)
+	}
+	for _, total := range tx.Retail.Totals {
+		switch total.Type {
+		case "TransactionGrandAmount":
+			if receipt.Total, err = normalizeAmount(total.Amount); err != nil {
+				return store.Receipt{}, fmt.Errorf("Total: %w", err)
+			}
+		case "TransactionTaxAmount":
+			if receipt.Tax, err = normalizeAmount(total.Amount); err != nil {
+				return store.Receipt{}, fmt.Errorf("Total: %w", err)
+			}
+		}
+	}
+	for _, line := range tx.Retail.LineItems {
+		if line.Sale == nil {
+			continue
+		}
+		price, err := normalizeAmount(line.Sale.ExtendedAmount)
+		if err != nil {
+			return store.Receipt{}, fmt.Errorf("ExtendedAmount: %w", err)
+		}
+		receipt.Items = append(receipt.Items, store.ReceiptItem{ShortDescription: strings.TrimSpace(line.Sale.Description), Price: price})
+	}
+	return receipt, nil
+}
+
+// schemaOrgOrder is the subset of a schema.org Order in JSON-LD needed to build a receipt
+type schemaOrgOrder struct {
+	Type   string `json:"@type"`
+	Seller struct {
+		Name string `json:"name"`
+	} `json:"seller"`
+	OrderDate      string `json:"orderDate"`
+	AcceptedOffers []struct {
+		ItemOffered struct {
+			Name string `json:"name"`
+		} `json:"itemOffered"`
+		Price json.Number `json:"price"`
+	} `json:"acceptedOffer"`
+	TotalPaymentDue struct {
+		Price json.Number `json:"price"`
+	} `json:"totalPaymentDue"`
+}
+
+// parseSchemaOrgOrder maps a schema.org Order into a Receipt: seller.name is the retailer,
+// orderDate the purchase date and time, each acceptedOffer an item and totalPaymentDue the total
+func parseSchemaOrgOrder(data []byte) (store.Receipt, error) {
+	var order schemaOrgOrder
+	if err := json.Unmarshal(data, &order); err != nil {
+		return store.Receipt{}, err
+	}
+	if order.Type != "Order" {
+		return store.Receipt{}, fmt.Errorf("unsupported @type %q, expected Order", order.Type)
+	}
+
+	receipt := store.Receipt{Retailer: strings.TrimSpace(order.Seller.Name)}
+	var err error
+	if receipt.PurchaseDate, receipt.PurchaseTime, err = splitDateTime(order.OrderDate); err != nil {
+		return store.Receipt{}, fmt.Errorf("orderDate: %w", err)
+	}
+	if receipt.Total, err = normalizeAmount(order.TotalPaymentDue.Price.String()); err != nil {
+		return store.Receipt{}, fmt.Errorf("totalPaymentDue: %w", err)
+	}
+	for _, offer := range order.AcceptedOffers {
+		price, err := normalizeAmount(offer.Price.String())
+		if err != nil {
+			return store.Receipt{}, fmt.Errorf("acceptedOffer: %w", err)
+		}
+		receipt.Items = append(receipt.Items, store.ReceiptItem{ShortDescription: strings.TrimSpace(offer.ItemOffered.Name), Price: price})
+	}
+	return receipt, nil
+}
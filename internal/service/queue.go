@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+// Submission priorities. Interactive submissions are processed inline so a
+// person waiting on the web form or a kiosk gets an answer right away; batch
+// submissions are queued and smoothed out by the worker pool.
+const (
+	PriorityInteractive = "interactive"
+	PriorityBatch       = "batch"
+)
+
+// batchLane is the bounded queue of batch jobs and how submissions pick their lane. Both are set before
+// the server starts serving.
+type batchLane struct {
+	queue chan *job
+	// async makes batch the default lane of the process endpoint
+	async bool
+}
+
+// depth is how many jobs are waiting for a worker
+func (lane *batchLane) depth() int {
+	return len(lane.queue)
+}
+
+// SetAsyncProcessing makes batch the default lane of the process endpoint
+func (svc *Service) SetAsyncProcessing(async bool) {
+	svc.batch.async = async
+}
+
+// AsyncProcessing reports whether batch is the default lane of the process endpoint
+func (svc *Service) AsyncProcessing() bool {
+	return svc.batch.async
+}
+
+// StartBatchWorkers creates the bounded batch queue and the workers draining it
+func (svc *Service) StartBatchWorkers(workers, queueSize int) {
+	if workers < 1 {
+		workers = 1
+	}
+	queue := make(chan *job, queueSize)
+	svc.batch.queue = queue
+	for i := 0; i < workers; i++ {
+		go func() {
+			for j := range queue {
+				svc.runJob(j.scope.context(context.Background()), j)
+			}
+		}()
+	}
+}
+
+// EnqueueJob hands a job to the batch workers, reporting false when the queue is full
+func (svc *Service) EnqueueJob(j *job) bool {
+	select {
+	case svc.batch.queue <- j:
+		return true
+	default:
+		return false
+	}
+}
+
+// runJob stores the receipt of a queued job, in the scope of the request that queued it, and records the
+// outcome
+func (svc *Service) runJob(ctx context.Context, j *job) {
+	svc.updateJob(j, jobProcessing, nil, nil)
+	if err := svc.saveOrBuffer(ctx, j.receipt); err != nil && !errors.Is(err, ErrReceiptBuffered) {
+		svc.ReleaseDuplicate(j.scope.tenant, j.receipt)
+		log.Printf("Failed to store batch receipt %s: %v", j.receipt.ID, err)
+		svc.updateJob(j, jobFailed, nil, err)
+		return
+	}
+	points := svc.CalculatePoints(j.receipt)
+	svc.updateJob(j, jobCompleted, &points, nil)
+}
@@ -0,0 +1,104 @@
+// Package service is the business logic between the HTTP handlers and the store: admitting, scoring
+// and storing receipts, the rules registry, loyalty, fraud and duplicate checks, and the background
+// jobs. The HTTP API lives in package handlers.
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"receipt-processor/internal/points"
+	"receipt-processor/internal/store"
+)
+
+// AdmitReceipt validates a new submission of a tenant, assigns it an ID and runs duplicate detection on it.
+// Every surface submits through it, so a receipt that fails ValidateReceipt is never stored.
+func (svc *Service) AdmitReceipt(ctx context.Context, tenant string, receipt store.Receipt) (store.Receipt, error) {
+	ctx = WithTenant(ctx, tenant)
+	if err := svc.ValidateReceipt(ctx, receipt); err != nil {
+		return receipt, err
+	}
+	// Generate a unique ID for the receipt
+	receipt.ID = uuid.New().String()
+	receipt.ShortCode = newShortCode()
+	receipt.Flags = nil
+	receipt.DuplicateOf = ""
+	receipt.Tenant = tenantField(tenant)
+	receipt.SubmittedBy, _ = store.ScopedSubmitter(ctx)
+	receipt.RulesVersion = svc.rules.ActiveFor(tenant).Version
+	receipt.State = svc.workflowFor(tenant).Initial
+	receipt.UserID = strings.TrimSpace(receipt.UserID)
+	if canonical := svc.CanonicalRetailer(receipt.Retailer); canonical != receipt.Retailer {
+		receipt.RetailerRaw, receipt.Retailer = receipt.Retailer, canonical
+	}
+	receipt.Tier = ""
+	if receipt.UserID != "" {
+		tier, err := svc.userTier(ctx, receipt.UserID)
+		if err != nil {
+			return receipt, err
+		}
+		receipt.Tier = tier
+	}
+	items := make([]store.ReceiptItem, len(receipt.Items))
+	for i, item := range receipt.Items {
+		item.Category, item.Tags = store.NormalizeCategory(item.Category), normalizeTags(item.Tags)
+		items[i] = item
+	}
+	receipt.Items = items
+	currency, rate, err := svc.ExchangeRate(ctx, receipt.Currency)
+	if err != nil {
+		return receipt, err
+	}
+	receipt.Currency, receipt.ExchangeRate = currency, 0
+	if rate != 1 {
+		receipt.ExchangeRate = rate
+	}
+	receipt.Campaigns = svc.campaignsFor(receipt)
+	svc.scoreReceipt(&receipt, svc.rules.For(receipt))
+
+	if err := svc.checkFraud(ctx, tenant, &receipt); err != nil {
+		return receipt, err
+	}
+	if err := svc.checkDuplicate(tenant, &receipt); err != nil {
+		return receipt, err
+	}
+	return receipt, nil
+}
+
+// ProcessReceipt admits the receipt and stores it. When the store is down the
+// receipt may be buffered instead, which is reported as ErrReceiptBuffered.
+func (svc *Service) ProcessReceipt(ctx context.Context, tenant string, receipt store.Receipt) (store.Receipt, error) {
+	ctx = WithTenant(ctx, tenant)
+	receipt, err := svc.AdmitReceipt(ctx, tenant, receipt)
+	if err != nil {
+		return receipt, err
+	}
+
+	if err := svc.saveOrBuffer(ctx, receipt); err != nil {
+		if !errors.Is(err, ErrReceiptBuffered) {
+			svc.ReleaseDuplicate(tenant, receipt)
+		}
+		return receipt, err
+	}
+	return receipt, nil
+}
+
+// CalculatePoints calculates the points awarded for a receipt under the rules version that scored it
+func (svc *Service) CalculatePoints(receipt store.Receipt) int {
+	return points.Calculate(svc.rules.For(receipt), receipt)
+}
+
+// scoreReceipt scores a receipt under a rules version and records the result on it: the version, the
+// awarded points, their rule-by-rule breakdown and when they were computed. The breakdown is kept so
+// the receipt's explanation stays what it was scored with, whatever happens to the rules later.
+func (svc *Service) scoreReceipt(receipt *store.Receipt, rules store.RuleConfig) {
+	explanation := points.Explain(rules, *receipt)
+	scoredAt := svc.clock().UTC()
+	receipt.RulesVersion = rules.Version
+	receipt.AwardedPoints = &explanation.Points
+	receipt.Breakdown = explanation.Breakdown
+	receipt.ScoredAt = &scoredAt
+}
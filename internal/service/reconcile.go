@@ -0,0 +1,68 @@
+package service
+
+import "context"
+
+// ReconcileRequest selects the receipts to reconcile by purchase date, both ends inclusive
+type ReconcileRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// pointsDiscrepancy is a receipt whose recomputed points differ from what it was credited
+type pointsDiscrepancy struct {
+	ReceiptID        string `json:"receiptId"`
+	PurchaseDate     string `json:"purchaseDate"`
+	RulesVersion     string `json:"rulesVersion"`
+	AwardedPoints    int    `json:"awardedPoints"`
+	RecomputedPoints int    `json:"recomputedPoints"`
+	Difference       int    `json:"difference"`
+}
+
+// reconcileReport compares credited points with points recomputed from the raw receipts
+type reconcileReport struct {
+	From             string              `json:"from"`
+	To               string              `json:"to"`
+	Checked          int                 `json:"checked"`
+	Unrecorded       int                 `json:"unrecorded"`
+	TotalAwarded     int                 `json:"totalAwarded"`
+	TotalRecomputed  int                 `json:"totalRecomputed"`
+	DiscrepancyCount int                 `json:"discrepancyCount"`
+	Discrepancies    []pointsDiscrepancy `json:"discrepancies"`
+}
+
+// ReconcilePoints recomputes the points of every receipt purchased in the range under the rules
+// version that scored it and reports the receipts whose credited points do not match. Receipts
+// stored before awarded points were recorded are counted as unrecorded.
+func (svc *Service) ReconcilePoints(ctx context.Context, from, to string) (reconcileReport, error) {
+	report := reconcileReport{From: from, To: to, Discrepancies: []pointsDiscrepancy{}}
+	list, err := svc.AllReceipts(ctx)
+	if err != nil {
+		return report, err
+	}
+	for _, receipt := range list {
+		// Dates are YYYY-MM-DD, so they compare correctly as strings
+		if receipt.PurchaseDate < from || receipt.PurchaseDate > to {
+			continue
+		}
+		if receipt.AwardedPoints == nil {
+			report.Unrecorded++
+			continue
+		}
+		report.Checked++
+		recomputed := svc.CalculatePoints(receipt)
+		report.TotalAwarded += *receipt.AwardedPoints
+		report.TotalRecomputed += recomputed
+		if recomputed != *receipt.AwardedPoints {
+			report.Discrepancies = append(report.Discrepancies, pointsDiscrepancy{
+				ReceiptID:        receipt.ID,
+				PurchaseDate:     receipt.PurchaseDate,
+				RulesVersion:     receipt.RulesVersion,
+				AwardedPoints:    *receipt.AwardedPoints,
+				RecomputedPoints: recomputed,
+				Difference:       recomputed - *receipt.AwardedPoints,
+			})
+		}
+	}
+	report.DiscrepancyCount = len(report.Discrepancies)
+	return report, nil
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"receipt-processor/internal/config"
+	"receipt-processor/internal/store"
+	"receipt-processor/scoring"
+)
+
+// Redaction modes of PII_REDACTION
+const (
+	redactionOff   = "off"
+	redactionStrip = "strip"
+	redactionHash  = "hash"
+)
+
+// The receipt fields PII_REDACT_FIELDS can redact
+const (
+	redactDescriptions = "descriptions"
+	redactRetailer     = "retailer"
+)
+
+// redactionPolicy is how receipts are redacted on their way out: to the S3 export, the webhooks, Kafka
+// and NATS, CSV and XLSX downloads and the query strings of the access log and error reports. The
+// store and the API's own reads keep the raw receipt.
+type redactionPolicy struct {
+	mode string
+	// fields are the fields mode applies to
+	fields map[string]bool
+	// key keys the hashes, so that short names cannot be found by hashing guesses
+	key []byte
+}
+
+// quoted matches the quoted names in a score's detail, like the retailer of a retailer override
+var quoted = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+
+// ConfigureRedaction reads PII_REDACTION, strip to blank the fields or hash to replace them with a keyed
+// hash that still groups equal values (default off), PII_REDACT_FIELDS, the fields to redact
+// (descriptions and retailer by default), and PII_HASH_KEY, the hash key
+func (svc *Service) ConfigureRedaction() {
+	policy := redactionPolicy{mode: strings.ToLower(os.Getenv("PII_REDACTION")), fields: map[string]bool{}}
+	switch policy.mode {
+	case redactionOff, redactionStrip, redactionHash:
+	case "":
+		policy.mode = redactionOff
+	default:
+		log.Printf("Ignoring invalid PII_REDACTION=%q, using %s", policy.mode, redactionOff)
+		policy.mode = redactionOff
+	}
+	for _, field := range config.List("PII_REDACT_FIELDS", []string{redactDescriptions, redactRetailer}) {
+		if field != redactDescriptions && field != redactRetailer {
+			log.Printf("Ignoring unknown field %q in PII_REDACT_FIELDS", field)
+			continue
+		}
+		policy.fields[field] = true
+	}
+	policy.key = []byte(os.Getenv("PII_HASH_KEY"))
+	if policy.mode == redactionHash && len(policy.key) == 0 {
+		log.Printf("PII_HASH_KEY is not set: redacted values are plain SHA-256 hashes, which can be matched by hashing guesses")
+	}
+	svc.redaction = policy
+}
+
+// redacting reports whether a field is redacted
+func (p redactionPolicy) redacting(field string) bool {
+	return p.mode != redactionOff && p.fields[field]
+}
+
+// redactValue strips or hashes one value. Hashes are of the trimmed, lowercase value, so spellings that
+// differ only in case still match.
+func (p redactionPolicy) redactValue(value string) string {
+	if value == "" || p.mode == redactionStrip {
+		return ""
+	}
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(value))))
+	return "sha256:" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// RedactReceipt returns a copy of a receipt with the redacted fields stripped or hashed. It returns the
+// receipt itself with redaction off.
+func (svc *Service) RedactReceipt(receipt store.Receipt) store.Receipt {
+	p := svc.redaction
+	if p.redacting(redactDescriptions) {
+		items := make([]store.ReceiptItem, len(receipt.Items))
+		for i, item := range receipt.Items {
+			item.ShortDescription = p.redactValue(item.ShortDescription)
+			items[i] = item
+		}
+		receipt.Items = items
+	}
+	if p.redacting(redactRetailer) {
+		receipt.Retailer, receipt.RetailerRaw = p.redactValue(receipt.Retailer), p.redactValue(receipt.RetailerRaw)
+		if len(receipt.Breakdown) > 0 {
+			breakdown := make([]scoring.RuleScore, len(receipt.Breakdown))
+			for i, score := range receipt.Breakdown {
+				// Rule 12 names the retailer whose override applied
+				if score.Rule == 12 {
+					score.Detail = quoted.ReplaceAllStringFunc(score.Detail, func(name string) string {
+						return `"` + p.redactValue(strings.Trim(name, `"`)) + `"`
+					})
+				}
+				breakdown[i] = score
+			}
+			receipt.Breakdown = breakdown
+		}
+	}
+	return receipt
+}
+
+// RedactEvent returns an event with the receipt it carries, if any, redacted for publishing outside
+func (svc *Service) RedactEvent(event Event) Event {
+	if data, ok := event.Data.(receiptProcessedData); ok {
+		data.Receipt = svc.RedactReceipt(data.Receipt)
+		event.Data = data
+	}
+	return event
+}
+
+// RedactQuery redacts the receipt filters of a URL query, retailer and the full-text q, for logging. It
+// returns the query unchanged when there is nothing to redact.
+func (svc *Service) RedactQuery(rawQuery string) string {
+	p := svc.redaction
+	if p.mode == redactionOff || rawQuery == "" {
+		return rawQuery
+	}
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rawQuery
+	}
+	changed := false
+	for name, redact := range map[string]bool{
+		"retailer": p.redacting(redactRetailer),
+		"q":        p.redacting(redactRetailer) || p.redacting(redactDescriptions),
+	} {
+		if !redact || values[name] == nil {
+			continue
+		}
+		for i, value := range values[name] {
+			values[name][i] = p.redactValue(value)
+		}
+		changed = true
+	}
+	if !changed {
+		return rawQuery
+	}
+	return values.Encode()
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"receipt-processor/internal/config"
+	"receipt-processor/internal/store"
+)
+
+// reasonReferral is the ledger reason of referral bonuses
+const reasonReferral = "referral"
+
+var (
+	ErrUnknownReferralCode = errors.New("unknown referral code")
+	ErrSelfReferral        = errors.New("users cannot refer themselves")
+	ErrAlreadyReferred     = errors.New("user was already referred")
+	ErrNotNewUser          = errors.New("only users without receipts can use a referral code")
+)
+
+// loyaltyArchive persists the points ledger, referral codes and referrals. Stores that implement it
+// keep them across restarts; otherwise they live only in memory.
+type loyaltyArchive interface {
+	SaveLedgerEntry(entry store.LedgerEntry) error
+	SaveReferralCode(userID, code string) error
+	SaveReferral(r store.Referral) error
+	LoadLoyalty() ([]store.LedgerEntry, map[string]string, []store.Referral, error)
+}
+
+// loyalty returns the store's loyalty archive, if it has one
+func (svc *Service) loyalty() (loyaltyArchive, bool) {
+	a, ok := svc.store.(loyaltyArchive)
+	return a, ok
+}
+
+// referralBook holds the referral codes and the referrals made with them
+type referralBook struct {
+	mu        sync.Mutex
+	codes     map[string]string // code -> user
+	userCodes map[string]string // user -> their code
+	byReferee map[string]*store.Referral
+	claims    map[string]bool // referees whose bonus is being credited
+
+	// Bonus points for the new user and for the user whose code they used
+	refereeBonus  int
+	referrerBonus int
+}
+
+// ConfigureReferrals sets the bonuses from REFERRAL_BONUS and REFERRER_BONUS, restores the ledger and
+// referrals from the loyalty archive and starts crediting bonuses on first receipts
+func (svc *Service) ConfigureReferrals() error {
+	book := &svc.referrals
+	book.refereeBonus = config.Int("REFERRAL_BONUS", 500)
+	book.referrerBonus = config.Int("REFERRER_BONUS", 500)
+	if a, ok := svc.loyalty(); ok {
+		entries, codes, stored, err := a.LoadLoyalty()
+		if err != nil {
+			return err
+		}
+		svc.ledger.mu.Lock()
+		svc.ledger.entries = entries
+		svc.ledger.mu.Unlock()
+		book.mu.Lock()
+		for user, code := range codes {
+			book.codes[code], book.userCodes[user] = user, code
+		}
+		for i := range stored {
+			book.byReferee[stored[i].Referee] = &stored[i]
+		}
+		book.mu.Unlock()
+	}
+	svc.SubscribeEvents(svc.rewardFirstReceipt)
+	return nil
+}
+
+// ReferralCodeFor returns a user's referral code, creating it on first use
+func (svc *Service) ReferralCodeFor(userID string) (string, bool, error) {
+	svc.referrals.mu.Lock()
+	defer svc.referrals.mu.Unlock()
+	if code, ok := svc.referrals.userCodes[userID]; ok {
+		return code, false, nil
+	}
+	code := newShortCode()
+	for svc.referrals.codes[code] != "" {
+		code = newShortCode()
+	}
+	if a, ok := svc.loyalty(); ok {
+		if err := a.SaveReferralCode(userID, code); err != nil {
+			return "", false, err
+		}
+	}
+	svc.referrals.codes[code], svc.referrals.userCodes[userID] = userID, code
+	return code, true, nil
+}
+
+// userHasReceipts reports whether any stored receipt belongs to the user
+func (svc *Service) userHasReceipts(ctx context.Context, userID string) (bool, error) {
+	list, err := svc.AllReceipts(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, receipt := range list {
+		if receipt.UserID == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RedeemReferral records that a user without receipts signed up with a referral code
+func (svc *Service) RedeemReferral(ctx context.Context, userID, rawCode string) (store.Referral, error) {
+	code, ok := normalizeShortCode(rawCode)
+	if !ok {
+		return store.Referral{}, ErrUnknownReferralCode
+	}
+	hasReceipts, err := svc.userHasReceipts(ctx, userID)
+	if err != nil {
+		return store.Referral{}, err
+	}
+
+	svc.referrals.mu.Lock()
+	defer svc.referrals.mu.Unlock()
+	referrer, ok := svc.referrals.codes[code]
+	switch {
+	case !ok:
+		return store.Referral{}, ErrUnknownReferralCode
+	case referrer == userID:
+		return store.Referral{}, ErrSelfReferral
+	case svc.referrals.byReferee[userID] != nil:
+		return store.Referral{}, ErrAlreadyReferred
+	case hasReceipts:
+		return store.Referral{}, ErrNotNewUser
+	}
+	r := store.Referral{Referee: userID, Referrer: referrer, Code: code, CreatedAt: svc.clock().UTC()}
+	if a, ok := svc.loyalty(); ok {
+		if err := a.SaveReferral(r); err != nil {
+			return store.Referral{}, err
+		}
+	}
+	svc.referrals.byReferee[userID] = &r
+	return r, nil
+}
+
+// rewardFirstReceipt credits both sides of a referral when the referee's first receipt is processed.
+// The referral is claimed on the publishing goroutine so that concurrent receipts credit it once, and
+// the ledger is written on its own goroutine; a failed write releases the claim for the next receipt.
+func (svc *Service) rewardFirstReceipt(event Event) {
+	data, ok := event.Data.(receiptProcessedData)
+	if !ok || data.Receipt.UserID == "" {
+		return
+	}
+	svc.referrals.mu.Lock()
+	r := svc.referrals.byReferee[data.Receipt.UserID]
+	if r == nil || r.RewardedAt != nil || svc.referrals.claims[r.Referee] {
+		svc.referrals.mu.Unlock()
+		return
+	}
+	svc.referrals.claims[r.Referee] = true
+	claimed := *r
+	svc.referrals.mu.Unlock()
+
+	go func() {
+		err := svc.creditReferral(claimed, store.TenantOf(data.Receipt), data.ReceiptID)
+		svc.referrals.mu.Lock()
+		defer svc.referrals.mu.Unlock()
+		delete(svc.referrals.claims, claimed.Referee)
+		if err != nil {
+			log.Printf("Referral bonus for %s not credited: %v", claimed.Referee, err)
+		}
+	}()
+}
+
+// creditReferral writes the referral bonuses to the ledger, under the tenant of the referee's first
+// receipt, and marks the referral rewarded
+func (svc *Service) creditReferral(r store.Referral, tenant, receiptID string) error {
+	rewardedAt := svc.clock().UTC()
+	r.RewardedAt = &rewardedAt
+	if a, ok := svc.loyalty(); ok {
+		if err := a.SaveReferral(r); err != nil {
+			return err
+		}
+	}
+	svc.referrals.mu.Lock()
+	svc.referrals.byReferee[r.Referee] = &r
+	svc.referrals.mu.Unlock()
+
+	if _, err := svc.creditPoints(tenant, r.Referee, svc.referrals.refereeBonus, reasonReferral, receiptID); err != nil {
+		return err
+	}
+	_, err := svc.creditPoints(tenant, r.Referrer, svc.referrals.referrerBonus, reasonReferral, receiptID)
+	return err
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"receipt-processor/scoring"
+)
+
+// retailerDictionary canonicalizes the retailer names printed on receipts ("WAL-MART #1234") into one
+// name per retailer ("Walmart") before receipts are scored, deduplicated and reported. Aliases are matched
+// on their RetailerKey, so case, punctuation, spacing and store numbers do not need their own entries.
+type retailerDictionary struct {
+	mu      sync.RWMutex
+	aliases map[string]string // alias as configured -> canonical name
+	keys    map[string]string // RetailerKey of an alias -> canonical name
+	// file is where alias changes are written back to, if anywhere
+	file string
+}
+
+// RetailerKey reduces a retailer name to what aliases and retailer overrides are matched on
+func RetailerKey(name string) string {
+	return scoring.RetailerKey(name)
+}
+
+// CanonicalRetailer returns the canonical name for a raw retailer name, or the name itself when the
+// dictionary does not know it
+func (svc *Service) CanonicalRetailer(name string) string {
+	svc.retailers.mu.RLock()
+	defer svc.retailers.mu.RUnlock()
+	if canonical, ok := svc.retailers.keys[RetailerKey(name)]; ok {
+		return canonical
+	}
+	return name
+}
+
+// set replaces the dictionary. The caller holds mu.
+func (d *retailerDictionary) set(aliases map[string]string) {
+	d.aliases = aliases
+	d.keys = make(map[string]string, len(aliases))
+	for alias, canonical := range aliases {
+		d.keys[RetailerKey(alias)] = canonical
+	}
+}
+
+// save writes the dictionary back to its file, if there is one. The caller holds mu.
+func (d *retailerDictionary) save() error {
+	if d.file == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(d.aliases, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(d.file, append(data, '\n'), 0o644)
+}
+
+// ConfigureRetailers loads the dictionary from RETAILER_ALIASES_FILE, a JSON object of alias to canonical
+// name that alias changes are written back to, or from RETAILER_ALIASES holding the same JSON inline
+func (svc *Service) ConfigureRetailers() {
+	d := &svc.retailers
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.file = os.Getenv("RETAILER_ALIASES_FILE")
+	value := os.Getenv("RETAILER_ALIASES")
+	if d.file != "" {
+		data, err := os.ReadFile(d.file)
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("Ignoring unreadable RETAILER_ALIASES_FILE: %v", err)
+		}
+		value = string(data)
+	}
+	if strings.TrimSpace(value) == "" {
+		return
+	}
+	aliases := make(map[string]string)
+	if err := json.Unmarshal([]byte(value), &aliases); err != nil {
+		log.Printf("Ignoring invalid retailer aliases: %v", err)
+		return
+	}
+	d.set(aliases)
+}
+
+// RetailerAliases returns a copy of the dictionary, alias to canonical name
+func (svc *Service) RetailerAliases() map[string]string {
+	svc.retailers.mu.RLock()
+	defer svc.retailers.mu.RUnlock()
+	aliases := make(map[string]string, len(svc.retailers.aliases))
+	for alias, canonical := range svc.retailers.aliases {
+		aliases[alias] = canonical
+	}
+	return aliases
+}
+
+// PutRetailerAlias adds an alias or points it at another canonical name, returning the canonical name it
+// had, if any. The change applies even when it cannot be written back to RETAILER_ALIASES_FILE, which is
+// the error returned.
+func (svc *Service) PutRetailerAlias(alias, canonical string) (previous string, existed bool, err error) {
+	d := &svc.retailers
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	previous, existed = d.aliases[alias]
+	aliases := make(map[string]string, len(d.aliases)+1)
+	for a, c := range d.aliases {
+		aliases[a] = c
+	}
+	aliases[alias] = canonical
+	d.set(aliases)
+	return previous, existed, d.save()
+}
+
+// DeleteRetailerAlias removes an alias, returning the canonical name it had; existed is false, and
+// nothing changes, when there is no such alias. Like PutRetailerAlias, the error is the write back only.
+func (svc *Service) DeleteRetailerAlias(alias string) (previous string, existed bool, err error) {
+	d := &svc.retailers
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	previous, existed = d.aliases[alias]
+	if !existed {
+		return "", false, nil
+	}
+	aliases := make(map[string]string, len(d.aliases))
+	for a, c := range d.aliases {
+		if a != alias {
+			aliases[a] = c
+		}
+	}
+	d.set(aliases)
+	return previous, true, d.save()
+}
+
+// RetailerAlias is one dictionary entry
+type RetailerAlias struct {
+	Alias     string `json:"alias"`
+	Canonical string `json:"canonical"`
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"receipt-processor/internal/config"
+	"receipt-processor/internal/store"
+)
+
+// The retention job deletes receipts purchased longer ago than the retention period, so long-running
+// instances don't grow without bound. Purged receipts can be appended to an archive file first, and the
+// points of approved ones are carried over to the points ledger, so users keep their balances.
+
+// reasonRetention is the ledger reason and deletion reason of the retention job
+const reasonRetention = "retention"
+
+// retentionJob is the retention settings and what the job purged since startup
+type retentionJob struct {
+	// period is how long receipts are kept after their purchase date; zero keeps them forever
+	period time.Duration
+	// archive is the file purged receipts are appended to as JSON lines, if set
+	archive string
+
+	// mu serializes purges and guards the stats below
+	mu            sync.Mutex
+	totalPurged   int
+	totalArchived int
+	last          *purgeReport
+}
+
+// RetentionStatus is the retention settings, how many receipts were purged since startup and the last run
+type RetentionStatus struct {
+	Enabled       bool         `json:"enabled"`
+	Period        string       `json:"period"`
+	Archive       string       `json:"archive"`
+	TotalPurged   int          `json:"totalPurged"`
+	TotalArchived int          `json:"totalArchived"`
+	LastRun       *purgeReport `json:"lastRun"`
+}
+
+// purgeReport describes one run of the retention job
+type purgeReport struct {
+	// Cutoff is the purchase date receipts were kept from; older ones were purged
+	Cutoff    string    `json:"cutoff"`
+	Purged    int       `json:"purged"`
+	Archived  int       `json:"archived"`
+	Points    int       `json:"pointsCarriedOver"`
+	StartedAt time.Time `json:"startedAt"`
+	Duration  string    `json:"duration"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// StartRetention reads RETENTION_PERIOD and RETENTION_ARCHIVE and, when a period is set, purges old
+// receipts now and then every interval
+func (svc *Service) StartRetention(interval time.Duration) {
+	svc.retention.mu.Lock()
+	svc.retention.period = config.Duration("RETENTION_PERIOD", 0)
+	svc.retention.archive = os.Getenv("RETENTION_ARCHIVE")
+	svc.retention.mu.Unlock()
+	if !svc.RetentionEnabled() || interval <= 0 {
+		return
+	}
+	go func() {
+		for {
+			report := svc.PurgeReceipts(context.Background(), svc.clock())
+			if report.Error != "" {
+				log.Printf("Retention purge stopped after %d receipts: %s", report.Purged, report.Error)
+			} else if report.Purged > 0 {
+				log.Printf("Retention purge deleted %d receipts purchased before %s", report.Purged, report.Cutoff)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// RetentionEnabled reports whether a retention period is set
+func (svc *Service) RetentionEnabled() bool {
+	svc.retention.mu.Lock()
+	defer svc.retention.mu.Unlock()
+	return svc.retention.period > 0
+}
+
+// RetentionStatus reports the retention settings and what the job purged since startup
+func (svc *Service) RetentionStatus() RetentionStatus {
+	job := &svc.retention
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	return RetentionStatus{
+		Enabled:       job.period > 0,
+		Period:        job.period.String(),
+		Archive:       job.archive,
+		TotalPurged:   job.totalPurged,
+		TotalArchived: job.totalArchived,
+		LastRun:       job.last,
+	}
+}
+
+// PurgeReceipts deletes the receipts purchased before the retention cutoff, archiving them first when an
+// archive is configured. A failure stops the run; the receipts it did not reach are purged next time.
+// The retention period is the same for every tenant, so a run purges every tenant's receipts.
+func (svc *Service) PurgeReceipts(ctx context.Context, now time.Time) (report purgeReport) {
+	job := &svc.retention
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	ctx = store.AllTenants(ctx)
+
+	cutoff := now.UTC().Add(-job.period)
+	report = purgeReport{Cutoff: cutoff.Format("2006-01-02"), StartedAt: now.UTC()}
+	defer func() {
+		report.Duration = svc.clock().Sub(now).Round(time.Millisecond).String()
+		job.totalPurged += report.Purged
+		job.totalArchived += report.Archived
+		last := report
+		job.last = &last
+		svc.recordPurgeMetrics(svc.clock(), report.Purged)
+	}()
+
+	list, err := svc.FindReceipts(ctx, store.Filter{To: cutoff.AddDate(0, 0, -1).Format("2006-01-02")})
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	if len(list) == 0 {
+		return report
+	}
+
+	var archive *os.File
+	if job.archive != "" {
+		file, err := os.OpenFile(job.archive, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			report.Error = err.Error()
+			return report
+		}
+		defer file.Close()
+		archive = file
+	}
+
+	for _, receipt := range list {
+		// The points are carried over before the receipt goes, so a failure keeps the receipt rather than
+		// losing its points from the balance
+		points := svc.AwardedPoints(receipt)
+		if !countsTowardBalance(receipt) {
+			points = 0
+		}
+		if points != 0 {
+			if _, err := svc.creditPoints(store.TenantOf(receipt), receipt.UserID, points, reasonRetention, receipt.ID); err != nil {
+				report.Error = fmt.Sprintf("carrying over the points of %s: %v", receipt.ID, err)
+				return report
+			}
+		}
+		if err := svc.purgeReceipt(ctx, archive, receipt, &report); err != nil {
+			if points != 0 {
+				svc.reverseRetentionCredit(receipt, points)
+			}
+			report.Error = err.Error()
+			return report
+		}
+		report.Points += points
+		svc.forgetPoints(receipt.ID)
+		svc.RecordAudit(WithTenant(ctx, store.TenantOf(receipt)), AuditReceiptDeleted, receiptSubject(receipt.ID), svc.auditSummary(receipt), nil)
+		svc.forgetDuplicate(receipt)
+		svc.publishEvent(svc.clock(), eventReceiptDeleted, receiptDeletedData{ReceiptID: receipt.ID, Reason: reasonRetention, Tenant: receipt.Tenant})
+	}
+	return report
+}
+
+// purgeReceipt archives a receipt when there is an archive and deletes it from the store
+func (svc *Service) purgeReceipt(ctx context.Context, archive io.Writer, receipt store.Receipt, report *purgeReport) error {
+	if archive != nil {
+		if err := svc.writeArchivedReceipt(archive, receipt); err != nil {
+			return err
+		}
+		report.Archived++
+	}
+	if err := svc.store.Delete(ctx, receipt.ID); err != nil {
+		return err
+	}
+	report.Purged++
+	return nil
+}
+
+// reverseRetentionCredit takes back the points carried over for a receipt the purge then failed to delete,
+// so that they are not counted twice while the receipt is still stored
+func (svc *Service) reverseRetentionCredit(receipt store.Receipt, points int) {
+	if _, err := svc.creditPoints(store.TenantOf(receipt), receipt.UserID, -points, reasonRetention, receipt.ID); err != nil {
+		log.Printf("Points of unpurged receipt %s carried over to %s twice: %v", receipt.ID, receipt.UserID, err)
+	}
+}
+
+// sealedArchiveLine is a line of the retention archive when encryption is on: the receipt's ID and its
+// JSON, sealed for that ID like the store seals it
+type sealedArchiveLine struct {
+	ID     string `json:"id"`
+	Sealed string `json:"sealed"`
+}
+
+// writeArchivedReceipt appends a receipt to the retention archive as a line of JSON, sealed when the
+// store is encrypted, so that purging a receipt does not leave it on disk in plaintext
+func (svc *Service) writeArchivedReceipt(w io.Writer, receipt store.Receipt) error {
+	data, err := json.Marshal(receipt)
+	if err != nil {
+		return err
+	}
+	if svc.archiveEnc != nil {
+		sealed, err := svc.archiveEnc.Seal(receipt.ID, data)
+		if err != nil {
+			return err
+		}
+		if data, err = json.Marshal(sealedArchiveLine{ID: receipt.ID, Sealed: string(sealed)}); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// errSealedArchiveLine reports a sealed line of the retention archive that cannot be opened
+var errSealedArchiveLine = errors.New("cannot open sealed retention archive line")
+
+// readArchivedReceipt decodes a line of the retention archive, opening it when it is sealed
+func (svc *Service) readArchivedReceipt(line []byte) (store.Receipt, error) {
+	var receipt store.Receipt
+	var sealed sealedArchiveLine
+	if err := json.Unmarshal(line, &sealed); err != nil {
+		return receipt, err
+	}
+	if sealed.Sealed != "" {
+		data, err := svc.archiveEnc.Open(sealed.ID, []byte(sealed.Sealed))
+		if err != nil {
+			return receipt, fmt.Errorf("%w %s: %v", errSealedArchiveLine, sealed.ID, err)
+		}
+		line = data
+	}
+	err := json.Unmarshal(line, &receipt)
+	return receipt, err
+}
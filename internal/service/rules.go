@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"receipt-processor/internal/points"
+	"receipt-processor/internal/store"
+)
+
+var (
+	ErrRulesExist    = errors.New("rules version already exists")
+	ErrRulesNotFound = errors.New("rules version not found")
+)
+
+// RulesEngine is the registry of rules versions receipts are scored with. Versions are shared by every
+// tenant; which one is active is per tenant, falling back to the default tenant's.
+type RulesEngine interface {
+	// Active returns the rules the default tenant's new receipts are scored with
+	Active() store.RuleConfig
+	// ActiveFor returns the rules a tenant's new receipts are scored with
+	ActiveFor(tenant string) store.RuleConfig
+	// For returns the rules version that scored a receipt, or its tenant's active rules if it is unknown
+	For(receipt store.Receipt) store.RuleConfig
+	// Version looks up a rules version
+	Version(version string) (store.RuleConfig, bool)
+	// Versions lists every rules version, sorted, and which one is active for the default tenant
+	Versions() ([]store.RuleConfig, string)
+	// Activations is the activation history of every tenant, oldest first
+	Activations() []store.RuleActivation
+	// Add archives a new, validated rules version without activating it; ErrRulesExist if it is taken
+	Add(rules store.RuleConfig) error
+	// Activate makes a rules version active for the default tenant's new receipts, and those of tenants
+	// without a version of their own; ErrRulesNotFound if there is none
+	Activate(version string) (store.RuleConfig, error)
+	// ActivateFor makes a rules version active for one tenant's new receipts
+	ActivateFor(tenant, version string) (store.RuleConfig, error)
+}
+
+// Rules returns the rules engine the service scores receipts with
+func (svc *Service) Rules() RulesEngine {
+	return svc.rules
+}
+
+// ruleRegistry is the RulesEngine of the built-in and archived rules versions. Versions and activations
+// are archived in the store when it keeps a rule archive.
+type ruleRegistry struct {
+	archive ruleArchive
+	clock   func() time.Time
+
+	mu       sync.RWMutex
+	versions map[string]store.RuleConfig
+	// active is the default tenant's version; tenantActive holds the versions tenants activated for
+	// themselves, and tenants without one score with active
+	active       string
+	tenantActive map[string]string
+	// activations is the activation history, oldest first
+	activations []store.RuleActivation
+}
+
+// NewRulesEngine creates a registry of the built-in rules versions with the default rules active, archiving
+// the versions added and activated in the store if it keeps a rule archive. A nil clock is time.Now.
+func NewRulesEngine(receipts store.ReceiptStore, clock func() time.Time) RulesEngine {
+	if clock == nil {
+		clock = time.Now
+	}
+	r := &ruleRegistry{
+		clock:        clock,
+		versions:     map[string]store.RuleConfig{points.DefaultRules.Version: points.DefaultRules, points.SpecRules.Version: points.SpecRules},
+		active:       points.DefaultRules.Version,
+		tenantActive: make(map[string]string),
+	}
+	r.archive, _ = receipts.(ruleArchive)
+	return r
+}
+
+func (r *ruleRegistry) Active() store.RuleConfig { return r.ActiveFor(DefaultTenant) }
+
+func (r *ruleRegistry) ActiveFor(tenant string) store.RuleConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.versions[r.activeVersionFor(tenant)]
+}
+
+// activeVersionFor returns a tenant's active version. The caller holds mu.
+func (r *ruleRegistry) activeVersionFor(tenant string) string {
+	if version, ok := r.tenantActive[tenant]; ok {
+		return version
+	}
+	return r.active
+}
+
+func (r *ruleRegistry) For(receipt store.Receipt) store.RuleConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if rules, ok := r.versions[receipt.RulesVersion]; ok {
+		return rules
+	}
+	return r.versions[r.activeVersionFor(store.TenantOf(receipt))]
+}
+
+func (r *ruleRegistry) Version(version string) (store.RuleConfig, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rules, ok := r.versions[version]
+	return rules, ok
+}
+
+func (r *ruleRegistry) Versions() ([]store.RuleConfig, string) {
+	r.mu.RLock()
+	versions := make([]store.RuleConfig, 0, len(r.versions))
+	for _, rules := range r.versions {
+		versions = append(versions, rules)
+	}
+	active := r.active
+	r.mu.RUnlock()
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions, active
+}
+
+func (r *ruleRegistry) Activations() []store.RuleActivation {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]store.RuleActivation(nil), r.activations...)
+}
+
+func (r *ruleRegistry) Add(rules store.RuleConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.versions[rules.Version]; exists {
+		return ErrRulesExist
+	}
+	if r.archive != nil {
+		if err := r.archive.SaveRules(rules); err != nil {
+			return err
+		}
+	}
+	r.versions[rules.Version] = rules
+	return nil
+}
+
+func (r *ruleRegistry) Activate(version string) (store.RuleConfig, error) {
+	return r.ActivateFor(DefaultTenant, version)
+}
+
+func (r *ruleRegistry) ActivateFor(tenant, version string) (store.RuleConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rules, exists := r.versions[version]
+	if !exists {
+		return rules, ErrRulesNotFound
+	}
+	activation := store.RuleActivation{Version: version, ActivatedAt: r.clock().UTC(), Tenant: tenantField(tenant)}
+	if r.archive != nil {
+		if err := r.archive.RecordActivation(activation); err != nil {
+			return rules, err
+		}
+	}
+	r.activations = append(r.activations, activation)
+	r.setActiveVersion(tenant, version)
+	return rules, nil
+}
+
+// setActiveVersion makes a version a tenant's active one. The caller holds mu.
+func (r *ruleRegistry) setActiveVersion(tenant, version string) {
+	if tenant == DefaultTenant {
+		r.active = version
+	} else {
+		r.tenantActive[tenant] = version
+	}
+}
+
+// ValidateRules rejects rule configs that cannot be applied
+func ValidateRules(rules store.RuleConfig) error {
+	if rules.Version == "" {
+		return errors.New("version is required")
+	}
+	if err := rules.Rules.Validate(); err != nil {
+		return err
+	}
+	for channel := range rules.ChannelBonuses {
+		if !KnownChannels[channel] {
+			return fmt.Errorf("unknown channel %q in channelBonuses", channel)
+		}
+	}
+	for tier := range rules.TierMultipliers {
+		if !knownTiers[tier] {
+			return fmt.Errorf("unknown tier %q in tierMultipliers", tier)
+		}
+	}
+	for category := range rules.CategoryBonuses {
+		if category != store.NormalizeCategory(category) || category == "" {
+			return fmt.Errorf("category %q in categoryBonuses must be lowercase", category)
+		}
+	}
+	return nil
+}
+
+// RecalculationReport summarizes a retroactive recalculation: how many receipts were re-scored, the point
+// totals before and after, and every receipt whose points moved
+type RecalculationReport struct {
+	Version      string              `json:"version"`
+	DryRun       bool                `json:"dryRun,omitempty"`
+	Recalculated int                 `json:"recalculated"`
+	Changed      int                 `json:"changed"`
+	PointsBefore int                 `json:"pointsBefore"`
+	PointsAfter  int                 `json:"pointsAfter"`
+	Changes      []pointsChangedData `json:"changes,omitempty"`
+}
+
+// RecalculateAll re-scores every stored receipt under the given rules version, saving the new
+// version on each receipt and publishing a points-changed event for every receipt whose points moved
+func (svc *Service) RecalculateAll(ctx context.Context, rules store.RuleConfig) (RecalculationReport, error) {
+	return svc.RescoreReceipts(ctx, rules, false)
+}
+
+// RescoreReceipts re-scores every stored receipt that another version scored under the given rules. Unless
+// it is a dry run, the receipts are saved with the new version and points and points-changed events are
+// published; a dry run only reports the diff.
+func (svc *Service) RescoreReceipts(ctx context.Context, rules store.RuleConfig, dryRun bool) (RecalculationReport, error) {
+	report := RecalculationReport{Version: rules.Version, DryRun: dryRun}
+	list, err := svc.AllReceipts(ctx)
+	if err != nil {
+		return report, err
+	}
+	for _, receipt := range list {
+		if receipt.RulesVersion == rules.Version {
+			continue
+		}
+		change, err := svc.RescoreReceipt(ctx, receipt, rules, !dryRun)
+		if err != nil {
+			return report, err
+		}
+		report.Add(change)
+	}
+	return report, nil
+}
+
+// Add counts one re-scored receipt in the report
+func (report *RecalculationReport) Add(change pointsChangedData) {
+	report.Recalculated++
+	report.PointsBefore += change.OldPoints
+	report.PointsAfter += change.NewPoints
+	if change.OldPoints != change.NewPoints {
+		report.Changed++
+		report.Changes = append(report.Changes, change)
+	}
+}
+
+// RescoreReceipt scores a receipt under the given rules against the points it was awarded. With save the
+// receipt is stored with the new version and points, and a points-changed event is published if they moved.
+func (svc *Service) RescoreReceipt(ctx context.Context, receipt store.Receipt, rules store.RuleConfig, save bool) (pointsChangedData, error) {
+	change := pointsChangedData{
+		ReceiptID:  receipt.ID,
+		UserID:     receipt.UserID,
+		Tenant:     receipt.Tenant,
+		OldVersion: receipt.RulesVersion,
+		NewVersion: rules.Version,
+		OldPoints:  svc.AwardedPoints(receipt),
+		NewPoints:  points.Calculate(rules, receipt),
+	}
+	if !save {
+		return change, nil
+	}
+	svc.scoreReceipt(&receipt, rules)
+	if err := svc.store.Save(ctx, receipt); err != nil {
+		return change, err
+	}
+	svc.cachePoints(receipt)
+	if change.OldPoints != change.NewPoints || change.OldVersion != change.NewVersion {
+		svc.RecordAudit(ctx, AuditPointsRescored, receiptSubject(receipt.ID),
+			map[string]interface{}{"rulesVersion": change.OldVersion, "points": change.OldPoints},
+			map[string]interface{}{"rulesVersion": change.NewVersion, "points": change.NewPoints})
+	}
+	if change.OldPoints != change.NewPoints {
+		svc.publishEvent(svc.clock(), eventPointsChanged, change)
+	}
+	return change, nil
+}
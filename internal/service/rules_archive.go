@@ -0,0 +1,117 @@
+package service
+
+import (
+	"time"
+
+	"receipt-processor/internal/points"
+	"receipt-processor/internal/store"
+	"receipt-processor/scoring"
+)
+
+// ruleArchive persists every rules version and every activation. Stores that implement it
+// keep the rules across restarts; otherwise the history lives only in memory.
+type ruleArchive interface {
+	SaveRules(rules store.RuleConfig) error
+	RecordActivation(activation store.RuleActivation) error
+	LoadRules() ([]store.RuleConfig, []store.RuleActivation, error)
+}
+
+// ConfigureRules restores the rules versions and activation history from the store's archive into the
+// service's registry. The first start against an empty archive records the default rules as activated now.
+func (svc *Service) ConfigureRules() error {
+	r, ok := svc.rules.(*ruleRegistry)
+	if !ok {
+		return nil
+	}
+	return r.restore()
+}
+
+// restore loads the registry from its archive, or starts the history with the default rules' activation
+// when there is no archive
+func (r *ruleRegistry) restore() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.archive == nil {
+		r.activations = []store.RuleActivation{{Version: r.active, ActivatedAt: r.clock().UTC()}}
+		return nil
+	}
+	versions, activations, err := r.archive.LoadRules()
+	if err != nil {
+		return err
+	}
+	for _, rules := range versions {
+		r.versions[rules.Version] = rules
+	}
+	if len(activations) == 0 {
+		activation := store.RuleActivation{Version: r.active, ActivatedAt: r.clock().UTC()}
+		if err := r.archive.SaveRules(points.DefaultRules); err != nil {
+			return err
+		}
+		if err := r.archive.RecordActivation(activation); err != nil {
+			return err
+		}
+		activations = append(activations, activation)
+	}
+	r.activations = activations
+	for _, activation := range activations {
+		r.setActiveVersion(activationTenant(activation), activation.Version)
+	}
+	return nil
+}
+
+// activationTenant is the tenant an activation made its version active for
+func activationTenant(activation store.RuleActivation) string {
+	if activation.Tenant == "" {
+		return DefaultTenant
+	}
+	return activation.Tenant
+}
+
+// activationAt returns the activation in effect for a tenant at a time, if it was an activation of the
+// given version: the tenant's own latest activation, or the default tenant's while it had none
+func (svc *Service) activationAt(tenant, version string, at time.Time) (store.RuleActivation, bool) {
+	activations := svc.rules.Activations()
+	var own, fallback *store.RuleActivation
+	for i := range activations {
+		if activations[i].ActivatedAt.After(at) {
+			break
+		}
+		switch activationTenant(activations[i]) {
+		case tenant:
+			own = &activations[i]
+		case DefaultTenant:
+			fallback = &activations[i]
+		}
+	}
+	current := own
+	if current == nil {
+		current = fallback
+	}
+	if current == nil || current.Version != version {
+		return store.RuleActivation{}, false
+	}
+	return *current, true
+}
+
+// scoreProvenance explains where a receipt's score came from, for audits
+type scoreProvenance struct {
+	RulesVersion string     `json:"rulesVersion"`
+	ScoredAt     *time.Time `json:"scoredAt,omitempty"`
+	// ActivatedAt is when the version became active, if it was the active one when the receipt was scored
+	ActivatedAt *time.Time       `json:"activatedAt,omitempty"`
+	Rules       store.RuleConfig `json:"rules"`
+	// Campaigns are the promotions layered on the rules when the receipt was processed
+	Campaigns []scoring.Campaign `json:"campaigns,omitempty"`
+}
+
+// ProvenanceOf describes the rules version and campaigns that scored a receipt
+func (svc *Service) ProvenanceOf(receipt store.Receipt) scoreProvenance {
+	rules := svc.rules.For(receipt)
+	provenance := scoreProvenance{RulesVersion: rules.Version, ScoredAt: receipt.ScoredAt, Rules: rules, Campaigns: receipt.Campaigns}
+	if receipt.ScoredAt != nil {
+		if activation, ok := svc.activationAt(store.TenantOf(receipt), rules.Version, *receipt.ScoredAt); ok {
+			provenance.ActivatedAt = &activation.ActivatedAt
+		}
+	}
+	return provenance
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"receipt-processor/internal/store"
+)
+
+var (
+	// ErrNoRulesFile is returned by ReloadRules when RULES_FILE is not set
+	ErrNoRulesFile = errors.New("RULES_FILE is not set")
+	// ErrInvalidRulesFile wraps why RULES_FILE was rejected: unreadable, malformed or invalid rules
+	ErrInvalidRulesFile = errors.New("invalid rules file")
+)
+
+// rulesFile is the rules config the server keeps active, from RULES_FILE; an empty path disables
+// reloading. mu serializes reloads.
+type rulesFile struct {
+	path string
+	mu   sync.Mutex
+}
+
+// RulesReload is the outcome of a successful reload: the version now active, whether it was added to the
+// archive, and whether it was activated or already the active one
+type RulesReload struct {
+	Version   string `json:"version"`
+	Added     bool   `json:"added"`
+	Activated bool   `json:"activated"`
+}
+
+// ConfigureRulesFile makes the rules version in RULES_FILE, a JSON rules config like the body of
+// POST /admin/rules, the active one. An invalid file is logged and the current rules stay active.
+func (svc *Service) ConfigureRulesFile() {
+	svc.rulesFile.path = os.Getenv("RULES_FILE")
+	if svc.rulesFile.path == "" {
+		return
+	}
+	if _, err := svc.ReloadRules(context.Background()); err != nil {
+		log.Printf("Ignoring RULES_FILE: %v", err)
+	}
+}
+
+// ReloadRules reads RULES_FILE again and swaps its rules in for the default tenant's new receipts; tenants
+// that activated rules of their own keep them. The file is validated
+// first, and a bad one is rejected with the current rules left active. A version that is not archived yet
+// is added; an archived one must have the same rules, since receipts scored by it keep being scored by it.
+func (svc *Service) ReloadRules(ctx context.Context) (RulesReload, error) {
+	if svc.rulesFile.path == "" {
+		return RulesReload{}, ErrNoRulesFile
+	}
+	svc.rulesFile.mu.Lock()
+	defer svc.rulesFile.mu.Unlock()
+	ctx = WithTenant(ctx, DefaultTenant)
+
+	data, err := os.ReadFile(svc.rulesFile.path)
+	if err != nil {
+		return RulesReload{}, fmt.Errorf("%w: %v", ErrInvalidRulesFile, err)
+	}
+	var rules store.RuleConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rules); err != nil {
+		return RulesReload{}, fmt.Errorf("%w %s: %v", ErrInvalidRulesFile, svc.rulesFile.path, err)
+	}
+	if err := ValidateRules(rules); err != nil {
+		return RulesReload{}, fmt.Errorf("%w %s: %v", ErrInvalidRulesFile, svc.rulesFile.path, err)
+	}
+
+	registry := svc.Rules()
+	reload := RulesReload{Version: rules.Version}
+	if existing, ok := registry.Version(rules.Version); ok {
+		if !sameRules(existing, rules) {
+			return RulesReload{}, fmt.Errorf("%w %s: rules version %q already exists with different rules; give the changed rules a new version",
+				ErrInvalidRulesFile, svc.rulesFile.path, rules.Version)
+		}
+	} else {
+		createdAt := svc.clock().UTC()
+		rules.CreatedAt = &createdAt
+		if err := registry.Add(rules); err != nil {
+			return RulesReload{}, err
+		}
+		reload.Added = true
+		svc.RecordAudit(ctx, AuditRulesCreated, "rules:"+rules.Version, nil, map[string]interface{}{"rules": rules.Rules, "file": svc.rulesFile.path})
+	}
+
+	previous := registry.Active().Version
+	if previous != rules.Version {
+		if _, err := registry.Activate(rules.Version); err != nil {
+			return RulesReload{}, err
+		}
+		reload.Activated = true
+		svc.RecordAudit(ctx, AuditRulesActivated, "rules:"+rules.Version,
+			map[string]interface{}{"active": previous}, map[string]interface{}{"active": rules.Version, "file": svc.rulesFile.path})
+		log.Printf("Rules version %s from %s is now active", rules.Version, svc.rulesFile.path)
+	}
+	return reload, nil
+}
+
+// sameRules compares two configs of a version by what they score with, whenever each was created
+func sameRules(a, b store.RuleConfig) bool {
+	a.CreatedAt, b.CreatedAt = nil, nil
+	x, errX := json.Marshal(a)
+	y, errY := json.Marshal(b)
+	return errX == nil && errY == nil && bytes.Equal(x, y)
+}
+
+// WatchRulesFile checks RULES_FILE for changes every interval and reloads it when its size or
+// modification time moved. Failed reloads are logged; the rules that were active stay active.
+func (svc *Service) WatchRulesFile(interval time.Duration) {
+	if svc.rulesFile.path == "" || interval <= 0 {
+		return
+	}
+	var size int64
+	var modified time.Time
+	if info, err := os.Stat(svc.rulesFile.path); err == nil {
+		size, modified = info.Size(), info.ModTime()
+	}
+	go func() {
+		for range time.Tick(interval) {
+			info, err := os.Stat(svc.rulesFile.path)
+			if err != nil || info.Size() == size && info.ModTime().Equal(modified) {
+				continue
+			}
+			size, modified = info.Size(), info.ModTime()
+			if _, err := svc.ReloadRules(context.Background()); err != nil {
+				log.Printf("Rules not reloaded, keeping version %s: %v", svc.rules.Active().Version, err)
+			}
+		}
+	}()
+}
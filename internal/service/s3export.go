@@ -0,0 +1,357 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"receipt-processor/internal/cron"
+	"receipt-processor/internal/store"
+)
+
+// The S3 export writes the receipts scored since the previous export to an S3-compatible bucket as one
+// gzipped NDJSON object per run, on a cron schedule, for downstream data lakes. The first export after
+// startup covers every stored receipt, so nothing scored while the server was down is missed; consumers
+// deduplicate by receipt id, which also picks up rescored receipts.
+
+// defaultExportSchedule runs the export at the top of every hour
+const defaultExportSchedule = "@hourly"
+
+// s3Client uploads objects to one bucket with AWS Signature Version 4, addressing it path-style
+// (endpoint/bucket/key) so it works with AWS as well as MinIO and other S3-compatible stores
+type s3Client struct {
+	Endpoint     string
+	region       string
+	Bucket       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+}
+
+// s3Export is the export's bucket and schedule, set once it is started, and where its runs got to
+type s3Export struct {
+	client *s3Client
+	expr   string
+	prefix string
+
+	// mu serializes exports and guards the state below
+	mu sync.Mutex
+	// exportedThrough is the scoredAt of the last export; zero until the first one succeeds
+	exportedThrough time.Time
+	last            *exportReport
+	next            time.Time
+}
+
+// S3ExportStatus is the export settings, the next scheduled run and the last one. Only Enabled is set
+// while the export is disabled.
+type S3ExportStatus struct {
+	Enabled         bool          `json:"enabled"`
+	Bucket          string        `json:"bucket,omitempty"`
+	Endpoint        string        `json:"endpoint,omitempty"`
+	Prefix          string        `json:"prefix,omitempty"`
+	Schedule        string        `json:"schedule,omitempty"`
+	NextRun         *time.Time    `json:"nextRun,omitempty"`
+	ExportedThrough *time.Time    `json:"exportedThrough,omitempty"`
+	LastRun         *exportReport `json:"lastRun,omitempty"`
+}
+
+// exportReport describes one run of the S3 export
+type exportReport struct {
+	Key      string `json:"key,omitempty"`
+	Receipts int    `json:"receipts"`
+	Bytes    int    `json:"bytes"`
+	// Since is the scoredAt of the previous export; the first export after startup has none
+	Since     *time.Time `json:"since,omitempty"`
+	Through   time.Time  `json:"through"`
+	StartedAt time.Time  `json:"startedAt"`
+	Duration  string     `json:"duration"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// firstEnv returns the first of the named environment variables that is set
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// StartS3Export reads the S3_EXPORT_* and S3_* settings and, when S3_EXPORT_BUCKET is set, runs the
+// export on S3_EXPORT_SCHEDULE
+func (svc *Service) StartS3Export() {
+	bucket := os.Getenv("S3_EXPORT_BUCKET")
+	if bucket == "" {
+		return
+	}
+	region := firstEnv("S3_REGION", "AWS_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := strings.TrimSuffix(os.Getenv("S3_ENDPOINT"), "/")
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	export := &svc.export
+	client := &s3Client{
+		Endpoint:     endpoint,
+		region:       region,
+		Bucket:       bucket,
+		accessKey:    firstEnv("S3_ACCESS_KEY_ID", "AWS_ACCESS_KEY_ID"),
+		secretKey:    firstEnv("S3_SECRET_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY"),
+		sessionToken: firstEnv("S3_SESSION_TOKEN", "AWS_SESSION_TOKEN"),
+		client:       &http.Client{Timeout: time.Minute},
+	}
+	prefix := strings.Trim(os.Getenv("S3_EXPORT_PREFIX"), "/")
+	if prefix == "" {
+		prefix = "receipts"
+	}
+
+	expr := os.Getenv("S3_EXPORT_SCHEDULE")
+	if expr == "" {
+		expr = defaultExportSchedule
+	}
+	schedule, err := cron.Parse(expr)
+	if err != nil {
+		log.Printf("Ignoring invalid S3_EXPORT_SCHEDULE=%q: %v", expr, err)
+		expr = defaultExportSchedule
+		schedule, _ = cron.Parse(expr)
+	}
+	export.mu.Lock()
+	export.client, export.prefix, export.expr = client, prefix, expr
+	export.mu.Unlock()
+
+	go func() {
+		for {
+			next := schedule.Next(svc.clock().UTC())
+			if next.IsZero() {
+				log.Printf("S3 export schedule %q never fires", expr)
+				return
+			}
+			export.mu.Lock()
+			export.next = next
+			export.mu.Unlock()
+			time.Sleep(time.Until(next))
+
+			report := svc.ExportReceipts(context.Background(), svc.clock())
+			if report.Error != "" {
+				log.Printf("S3 export failed, retrying its receipts next run: %s", report.Error)
+			} else if report.Receipts > 0 {
+				log.Printf("Exported %d receipts to s3://%s/%s", report.Receipts, bucket, report.Key)
+			}
+		}
+	}()
+}
+
+// S3ExportEnabled reports whether the export was started with a bucket
+func (svc *Service) S3ExportEnabled() bool {
+	svc.export.mu.Lock()
+	defer svc.export.mu.Unlock()
+	return svc.export.client != nil
+}
+
+// S3ExportStatus reports the export settings and its runs
+func (svc *Service) S3ExportStatus() S3ExportStatus {
+	export := &svc.export
+	export.mu.Lock()
+	defer export.mu.Unlock()
+	if export.client == nil {
+		return S3ExportStatus{}
+	}
+	status := S3ExportStatus{
+		Enabled:  true,
+		Bucket:   export.client.Bucket,
+		Endpoint: export.client.Endpoint,
+		Prefix:   export.prefix,
+		Schedule: export.expr,
+		LastRun:  export.last,
+	}
+	if !export.next.IsZero() {
+		next := export.next
+		status.NextRun = &next
+	}
+	if !export.exportedThrough.IsZero() {
+		through := export.exportedThrough
+		status.ExportedThrough = &through
+	}
+	return status
+}
+
+// ExportReceipts uploads the receipts scored after the previous export and up to now as one object.
+// A failed upload leaves the watermark alone, so the next run exports its receipts again. The watermark
+// covers every tenant, so every tenant's receipts are exported.
+func (svc *Service) ExportReceipts(ctx context.Context, now time.Time) (report exportReport) {
+	export := &svc.export
+	export.mu.Lock()
+	defer export.mu.Unlock()
+	ctx = store.AllTenants(ctx)
+
+	through := now.UTC()
+	report = exportReport{Through: through, StartedAt: through}
+	if !export.exportedThrough.IsZero() {
+		since := export.exportedThrough
+		report.Since = &since
+	}
+	defer func() {
+		report.Duration = svc.clock().Sub(now).Round(time.Millisecond).String()
+		last := report
+		export.last = &last
+	}()
+
+	list, err := svc.AllReceipts(ctx)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	var batch []store.Receipt
+	for _, receipt := range list {
+		if receipt.ScoredAt == nil {
+			// Receipts stored before scoring times were recorded only go out with the first export
+			if export.exportedThrough.IsZero() {
+				batch = append(batch, receipt)
+			}
+			continue
+		}
+		if receipt.ScoredAt.After(export.exportedThrough) && !receipt.ScoredAt.After(through) {
+			batch = append(batch, receipt)
+		}
+	}
+	if len(batch) == 0 {
+		export.exportedThrough = through
+		return report
+	}
+	sort.Slice(batch, func(i, j int) bool {
+		a, b := scoredTime(batch[i]), scoredTime(batch[j])
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return batch[i].ID < batch[j].ID
+	})
+
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	encoder := json.NewEncoder(zw)
+	for _, receipt := range batch {
+		if err := encoder.Encode(svc.RedactReceipt(receipt)); err != nil {
+			report.Error = err.Error()
+			return report
+		}
+	}
+	if err := zw.Close(); err != nil {
+		report.Error = err.Error()
+		return report
+	}
+
+	key := fmt.Sprintf("%s/%s/receipts-%s.ndjson.gz", export.prefix, through.Format("2006/01/02"), through.Format("20060102T150405.000Z"))
+	if err := export.client.putObject(key, body.Bytes(), "application/gzip"); err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	export.exportedThrough = through
+	report.Key, report.Receipts, report.Bytes = key, len(batch), body.Len()
+	return report
+}
+
+// scoredTime is when a receipt was scored, or the zero time for receipts stored before that was recorded
+func scoredTime(receipt store.Receipt) time.Time {
+	if receipt.ScoredAt == nil {
+		return time.Time{}
+	}
+	return *receipt.ScoredAt
+}
+
+// putObject uploads an object, signing the request with the client's credentials
+func (c *s3Client) putObject(key string, body []byte, contentType string) error {
+	target, err := url.Parse(c.Endpoint + "/" + c.Bucket + "/" + key)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	c.sign(req, body, time.Now().UTC())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("PUT %s: %s: %s", key, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// sign adds the AWS Signature Version 4 headers to a request
+func (c *s3Client) sign(req *http.Request, body []byte, now time.Time) {
+	signV4(req, body, now, c.region, "s3", c.accessKey, c.secretKey, c.sessionToken)
+}
+
+// signV4 adds the AWS Signature Version 4 headers for a service, like s3 or kms, to a request
+func signV4(req *http.Request, body []byte, now time.Time, region, service, accessKey, secretKey, sessionToken string) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if sessionToken != "" {
+		signed = append(signed, "x-amz-security-token")
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range signed {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method, req.URL.EscapedPath(), req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
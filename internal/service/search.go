@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"receipt-processor/internal/store"
+)
+
+// The search index is an in-memory inverted index from the words of retailer names and item descriptions
+// to the receipts they appear on. Like the balance cache it is kept current by receipt.processed events
+// and loaded from the store in the background on startup.
+
+// Retailer words weigh more than item words, so "target" ranks receipts from Target above receipts that
+// merely bought a target-brand item
+const (
+	retailerWeight = 3
+	itemWeight     = 1
+	// prefixWeight scores words that only start with a query term ("pep" for "pepsi")
+	prefixWeight = 0.5
+)
+
+// searchIndex is the inverted index
+type searchIndex struct {
+	mu sync.RWMutex
+	// postings maps each word to the weighted number of times it appears on each receipt id
+	postings map[string]map[string]float64
+	// terms maps each indexed receipt id to its words, so re-indexing replaces them
+	terms map[string][]string
+}
+
+// SearchWords splits text into lowercase words of letters and digits
+func SearchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// indexReceipt adds a receipt's words to the index, replacing what it indexed for the receipt before.
+// The caller holds mu.
+func (index *searchIndex) add(receipt store.Receipt) {
+	index.remove(receipt.ID)
+	weights := make(map[string]float64)
+	for _, word := range SearchWords(receipt.Retailer + " " + receipt.RetailerRaw) {
+		weights[word] += retailerWeight
+	}
+	for _, item := range receipt.Items {
+		for _, word := range SearchWords(item.ShortDescription) {
+			weights[word] += itemWeight
+		}
+	}
+	words := make([]string, 0, len(weights))
+	for word, weight := range weights {
+		if index.postings[word] == nil {
+			index.postings[word] = make(map[string]float64)
+		}
+		index.postings[word][receipt.ID] = weight
+		words = append(words, word)
+	}
+	index.terms[receipt.ID] = words
+}
+
+// remove drops a receipt from the index. The caller holds mu.
+func (index *searchIndex) remove(id string) {
+	for _, word := range index.terms[id] {
+		delete(index.postings[word], id)
+		if len(index.postings[word]) == 0 {
+			delete(index.postings, word)
+		}
+	}
+	delete(index.terms, id)
+}
+
+// apply indexes newly processed receipts and drops deleted ones
+func (index *searchIndex) apply(event Event) {
+	switch data := event.Data.(type) {
+	case receiptProcessedData:
+		index.mu.Lock()
+		index.add(data.Receipt)
+		index.mu.Unlock()
+	case receiptDeletedData:
+		index.mu.Lock()
+		index.remove(data.ReceiptID)
+		index.mu.Unlock()
+	}
+}
+
+// StartSearchIndex subscribes the index to the event bus and loads the stored receipts into it in the
+// background. Receipts that events already indexed are left alone.
+func (svc *Service) StartSearchIndex() {
+	index := &svc.search
+	svc.SubscribeEvents(index.apply)
+	go func() {
+		list, err := svc.AllReceipts(context.Background())
+		if err != nil {
+			log.Printf("Search index only covers new receipts: %v", err)
+			return
+		}
+		index.mu.Lock()
+		defer index.mu.Unlock()
+		for _, receipt := range list {
+			if _, ok := index.terms[receipt.ID]; !ok {
+				index.add(receipt)
+			}
+		}
+	}()
+}
+
+// SearchReceiptIDs ranks the receipts that match every word of the query, best first. Each word scores
+// its weight on the receipt times its inverse document frequency, so rare words count for more; words that
+// only start with a query word count for less.
+func (svc *Service) SearchReceiptIDs(q string) []string {
+	terms := SearchWords(q)
+	if len(terms) == 0 {
+		return nil
+	}
+	index := &svc.search
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+	total := float64(len(index.terms))
+
+	var scores map[string]float64
+	for _, term := range terms {
+		termScores := make(map[string]float64)
+		for word, postings := range index.postings {
+			weight := 1.0
+			if word != term {
+				if !strings.HasPrefix(word, term) {
+					continue
+				}
+				weight = prefixWeight
+			}
+			idf := math.Log(1 + total/float64(len(postings)))
+			for id, count := range postings {
+				termScores[id] = math.Max(termScores[id], weight*count*idf)
+			}
+		}
+		if scores == nil {
+			scores = termScores
+			continue
+		}
+		for id := range scores {
+			if score, ok := termScores[id]; ok {
+				scores[id] += score
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
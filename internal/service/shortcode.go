@@ -0,0 +1,39 @@
+package service
+
+import (
+	"crypto/rand"
+	"strings"
+)
+
+// shortCodeAlphabet is Crockford's base32, which leaves out I, L, O and U so codes read well over the phone
+const shortCodeAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// shortCodeLength is the length of a short code: 8 characters carry 40 random bits
+const shortCodeLength = 8
+
+// newShortCode generates a random short code, printed alongside the receipt ID for support
+func newShortCode() string {
+	var b [shortCodeLength]byte
+	rand.Read(b[:])
+	for i := range b {
+		b[i] = shortCodeAlphabet[b[i]&31]
+	}
+	return string(b[:])
+}
+
+// normalizeShortCode turns what someone typed or read out into a short code: case and dashes or
+// spaces are ignored, and the look-alikes I, L and O are read as 1, 1 and 0. It reports false
+// when the value is not a short code, e.g. a receipt UUID.
+func normalizeShortCode(value string) (string, bool) {
+	value = strings.NewReplacer("-", "", " ", "").Replace(strings.ToUpper(value))
+	value = strings.NewReplacer("I", "1", "L", "1", "O", "0").Replace(value)
+	if len(value) != shortCodeLength {
+		return "", false
+	}
+	for _, r := range value {
+		if !strings.ContainsRune(shortCodeAlphabet, r) {
+			return "", false
+		}
+	}
+	return value, true
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"receipt-processor/internal/store"
+)
+
+// SaveSnapshot snapshots the memory store, when snapshots are on
+func (svc *Service) SaveSnapshot() error {
+	if memory, ok := svc.store.(*store.Memory); ok {
+		return memory.SaveSnapshot()
+	}
+	return nil
+}
+
+// StartSnapshots writes a snapshot every interval; zero only snapshots on shutdown. Snapshots need the
+// memory backend opened with SNAPSHOT_FILE.
+func (svc *Service) StartSnapshots(interval time.Duration) {
+	memory, ok := svc.store.(*store.Memory)
+	if !ok || memory.SnapshotFile() == "" || interval <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(interval) {
+			if err := svc.SaveSnapshot(); err != nil {
+				log.Printf("Snapshot failed: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"receipt-processor/internal/store"
+	"receipt-processor/scoring"
+)
+
+// MatchesFilter reports whether a receipt passes the filter, scoring receipts stored without awarded points
+func (svc *Service) MatchesFilter(filter store.Filter, receipt store.Receipt) bool {
+	return filter.Matches(receipt) && (filter.MinPoints == nil || svc.AwardedPoints(receipt) >= *filter.MinPoints)
+}
+
+// FindReceipts returns the stored receipts matching a filter
+func (svc *Service) FindReceipts(ctx context.Context, filter store.Filter) ([]store.Receipt, error) {
+	list, err := svc.store.Find(ctx, filter)
+	if err != nil || filter.MinPoints == nil {
+		return list, err
+	}
+	matched := list[:0]
+	for _, receipt := range list {
+		if svc.MatchesFilter(filter, receipt) {
+			matched = append(matched, receipt)
+		}
+	}
+	return matched, nil
+}
+
+// Service runs the business logic against one store. The background jobs are started on it and the
+// handlers call into it, so they all see the same receipts, rules and time, and the same caches, indexes
+// and settings below.
+type Service struct {
+	store store.ReceiptStore
+	rules RulesEngine
+	clock func() time.Time
+	// archiveEnc seals the receipts of the retention archive with the keys of the store; nil leaves them
+	// in plaintext
+	archiveEnc *store.Encryption
+
+	events        eventBus
+	processedFeed *feed[ProcessedReceipt]
+	pointsFeed    *feed[PointsChange]
+	lifecycle     lifecycle
+	audit         auditLog
+	metrics       minuteMetrics
+
+	ledger       pointsLedger
+	balances     balanceCache
+	leaderboards leaderboardCache
+	referrals    referralBook
+	tiers        tierLevels
+	erasureMu    sync.Mutex
+
+	campaigns   campaignSet
+	currency    currencyConfig
+	duplicates  duplicateIndex
+	fraud       fraudCheck
+	retailers   retailerDictionary
+	ocr         ocrConfig
+	xmlMapping  xmlReceiptMapping
+	rulesFile   rulesFile
+	pointsCache *lruCache
+	search      searchIndex
+
+	buffer    outageBuffer
+	batch     batchLane
+	jobs      jobTable
+	retention retentionJob
+	export    s3Export
+	redaction redactionPolicy
+}
+
+// New creates a service backed by a store, scoring receipts with a rules engine and telling the time with a
+// clock. A nil rules engine is the registry of NewRulesEngine and a nil clock is time.Now. The retention
+// archive is sealed with the store's encryption keys, if it has any.
+func New(receipts store.ReceiptStore, rules RulesEngine, clock func() time.Time) *Service {
+	if clock == nil {
+		clock = time.Now
+	}
+	if rules == nil {
+		rules = NewRulesEngine(receipts, clock)
+	}
+	svc := &Service{store: receipts, rules: rules, clock: clock}
+	if encrypted, ok := receipts.(interface{ Encryption() *store.Encryption }); ok {
+		svc.archiveEnc = encrypted.Encryption()
+	}
+	svc.lifecycle.workflows = make(map[string]workflow)
+	svc.lifecycle.hooks = make(map[string][]func(stateChangedData))
+	svc.balances.reset()
+	svc.leaderboards.boards = make(map[leaderboardKey]leaderboard)
+	svc.referrals.codes = make(map[string]string)
+	svc.referrals.userCodes = make(map[string]string)
+	svc.referrals.byReferee = make(map[string]*store.Referral)
+	svc.referrals.claims = make(map[string]bool)
+	svc.tiers = defaultTierLevels()
+	svc.campaigns.byID = make(map[string]scoring.Campaign)
+	svc.currency = currencyConfig{base: "USD", rates: staticRates{}}
+	svc.duplicates.exact = make(map[string]map[string]string)
+	svc.duplicates.near = make(map[string]map[string][]nearDuplicateEntry)
+	svc.duplicates.totals = make(map[string]*DuplicateStats)
+	svc.fraud.submissions = make(map[string][]time.Time)
+	svc.retailers.aliases = make(map[string]string)
+	svc.retailers.keys = make(map[string]string)
+	svc.xmlMapping = defaultXMLReceiptMapping
+	svc.search.postings = make(map[string]map[string]float64)
+	svc.search.terms = make(map[string][]string)
+	svc.jobs.byID = make(map[string]*job)
+	svc.redaction = redactionPolicy{mode: redactionOff, fields: map[string]bool{}}
+
+	svc.processedFeed = newFeed(svc, processedReceipt)
+	svc.pointsFeed = newFeed(svc, pointsChange)
+	// Every transition is announced on the event bus, and so reaches webhooks, Kafka and NATS
+	svc.onTransition("*", "*", func(change stateChangedData) { svc.publishEvent(change.Time, eventStateChanged, change) })
+	return svc
+}
+
+// Now is the time on the service's clock
+func (svc *Service) Now() time.Time {
+	return svc.clock()
+}
+
+// Store returns the backend the service reads and writes through
+func (svc *Service) Store() store.ReceiptStore {
+	return svc.store
+}
+
+// OpenStore opens the backend named by STORE_BACKEND: "memory" (default) or "postgres", which
+// connects to DATABASE_URL. With encryption keys set, the receipts it persists are encrypted, and so are
+// the ones the retention job archives.
+func OpenStore() (store.ReceiptStore, error) {
+	enc, err := OpenEncryption()
+	if err != nil {
+		return nil, fmt.Errorf("encryption at rest: %w", err)
+	}
+	switch backend := os.Getenv("STORE_BACKEND"); backend {
+	case "", "memory":
+		memory := store.NewMemory()
+		memory.SetEncryption(enc)
+		if snapshotFile := os.Getenv("SNAPSHOT_FILE"); snapshotFile != "" {
+			if err := memory.RestoreSnapshot(snapshotFile); err != nil {
+				return nil, fmt.Errorf("restoring snapshot: %w", err)
+			}
+		}
+		if dir := os.Getenv("WAL_DIR"); dir != "" {
+			if err := memory.OpenWAL(dir); err != nil {
+				return nil, fmt.Errorf("opening write-ahead log: %w", err)
+			}
+		}
+		return memory, nil
+	case "postgres":
+		sqlBackend, err := store.NewSQL(os.Getenv("DATABASE_URL"))
+		if err != nil {
+			return nil, fmt.Errorf("connecting to postgres: %w", err)
+		}
+		sqlBackend.SetEncryption(enc)
+		if os.Getenv("SNAPSHOT_FILE") != "" {
+			log.Printf("Ignoring SNAPSHOT_FILE: snapshots need STORE_BACKEND=memory")
+		}
+		return sqlBackend, nil
+	default:
+		return nil, fmt.Errorf("unknown STORE_BACKEND %q", backend)
+	}
+}
+
+// storeReceipt saves a receipt through the service's store
+func (svc *Service) storeReceipt(ctx context.Context, receipt store.Receipt) error {
+	if err := svc.store.Save(ctx, receipt); err != nil {
+		return err
+	}
+	svc.cachePoints(receipt)
+	svc.RecordAudit(ctx, AuditReceiptCreated, receiptSubject(receipt.ID), nil, svc.auditSummary(receipt))
+	points := svc.CalculatePoints(receipt)
+	svc.recordReceiptMetrics(svc.clock(), points)
+	svc.publishEvent(svc.clock(), eventReceiptProcessed, receiptProcessedData{ReceiptID: receipt.ID, Points: points, Receipt: receipt})
+	return nil
+}
+
+// FindReceipt looks up a receipt by ID or short code, including receipts still waiting in the outage buffer
+func (svc *Service) FindReceipt(ctx context.Context, id string) (store.Receipt, bool, error) {
+	get := svc.store.Get
+	if code, ok := normalizeShortCode(id); ok {
+		id, get = code, svc.store.GetByShortCode
+	}
+	receipt, exists, err := get(ctx, id)
+	if err == nil && exists {
+		return receipt, true, nil
+	}
+	if buffered, ok := svc.findBufferedReceipt(id); ok && store.Visible(ctx, buffered) {
+		return buffered, true, nil
+	}
+	return receipt, exists, err
+}
+
+// AllReceipts returns every stored receipt
+func (svc *Service) AllReceipts(ctx context.Context) ([]store.Receipt, error) {
+	return svc.store.List(ctx)
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"receipt-processor/internal/store"
+)
+
+// UserTakeout is everything kept about a user in a tenant, for a data portability request
+type UserTakeout struct {
+	UserID     string    `json:"userId"`
+	Tenant     string    `json:"tenant"`
+	ExportedAt time.Time `json:"exportedAt"`
+	Balance    int       `json:"balance"`
+	// Receipts are the user's stored receipts by purchase date, and Ledger their points ledger, oldest first
+	Receipts []store.Receipt     `json:"receipts"`
+	Ledger   []store.LedgerEntry `json:"ledger"`
+	// ReferralCode is the user's own code, and Referrals the one they redeemed and the ones they made
+	ReferralCode string           `json:"referralCode,omitempty"`
+	Referrals    []store.Referral `json:"referrals"`
+}
+
+// UserTakeout collects a user's receipts, points ledger and referrals in the context's tenant
+func (svc *Service) UserTakeout(ctx context.Context, userID string) (UserTakeout, error) {
+	takeout := UserTakeout{
+		UserID:     userID,
+		Tenant:     TenantFromContext(ctx),
+		ExportedAt: svc.clock().UTC(),
+		Receipts:   []store.Receipt{},
+		Ledger:     []store.LedgerEntry{},
+		Referrals:  []store.Referral{},
+	}
+	list, err := svc.AllReceipts(ctx)
+	if err != nil {
+		return takeout, err
+	}
+	for _, receipt := range list {
+		if receipt.UserID == userID {
+			takeout.Receipts = append(takeout.Receipts, receipt)
+		}
+	}
+	sort.SliceStable(takeout.Receipts, func(i, j int) bool {
+		a, b := takeout.Receipts[i], takeout.Receipts[j]
+		if a.PurchaseDate != b.PurchaseDate {
+			return a.PurchaseDate < b.PurchaseDate
+		}
+		return a.PurchaseTime < b.PurchaseTime
+	})
+	if takeout.Balance, err = svc.UserBalance(ctx, userID); err != nil {
+		return takeout, err
+	}
+
+	tenant := tenantField(takeout.Tenant)
+	for _, entry := range svc.AllLedgerEntries() {
+		if entry.UserID == userID && entry.Tenant == tenant {
+			takeout.Ledger = append(takeout.Ledger, entry)
+		}
+	}
+
+	book := &svc.referrals
+	book.mu.Lock()
+	defer book.mu.Unlock()
+	takeout.ReferralCode = book.userCodes[userID]
+	for _, r := range book.byReferee {
+		if r.Referee == userID || r.Referrer == userID {
+			takeout.Referrals = append(takeout.Referrals, *r)
+		}
+	}
+	sort.Slice(takeout.Referrals, func(i, j int) bool { return takeout.Referrals[i].CreatedAt.Before(takeout.Referrals[j].CreatedAt) })
+	return takeout, nil
+}
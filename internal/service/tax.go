@@ -0,0 +1,33 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"receipt-processor/internal/store"
+	"receipt-processor/scoring"
+)
+
+// ErrInvalidTaxOrTip is returned for receipts whose tax or tip is malformed or more than the total
+var ErrInvalidTaxOrTip = errors.New("invalid tax or tip")
+
+// checkTaxAndTip rejects a tax or tip that is not an amount like 12.34, or that together exceed the total.
+// Both are optional; the total itself is checked by checkAmounts.
+func checkTaxAndTip(receipt store.Receipt) error {
+	var charges int64
+	for _, field := range [][2]string{{"tax", receipt.Tax}, {"tip", receipt.Tip}} {
+		if field[1] == "" {
+			continue
+		}
+		cents, err := scoring.ParseCents(field[1])
+		if err != nil {
+			return fmt.Errorf("%w: %s %q must be an amount like 12.34", ErrInvalidTaxOrTip, field[0], field[1])
+		}
+		charges += cents
+	}
+	total, err := scoring.ParseCents(receipt.Total)
+	if err == nil && charges > total {
+		return fmt.Errorf("%w: tax and tip add up to more than the total %s", ErrInvalidTaxOrTip, receipt.Total)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+
+	"receipt-processor/internal/store"
+)
+
+// DefaultTenant is used when a request does not name a tenant
+const DefaultTenant = store.DefaultTenant
+
+// WithTenant scopes the context to a tenant: the store then only reads and writes that tenant's receipts,
+// and the rules, balances and leaderboards are the tenant's own
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return store.WithTenant(ctx, tenant)
+}
+
+// TenantFromContext returns the tenant stored by WithTenant, or the default tenant
+func TenantFromContext(ctx context.Context) string {
+	if tenant, ok := store.ScopedTenant(ctx); ok {
+		return tenant
+	}
+	return DefaultTenant
+}
+
+// tenantField is what a record of a tenant stores as its tenant: empty for the default tenant, so
+// single-tenant deployments store and answer what they did before tenants existed
+func tenantField(tenant string) string {
+	if tenant == DefaultTenant {
+		return ""
+	}
+	return tenant
+}
+
+// requestScope is who asked for work the server finishes after the request is answered, like a queued job
+// or a buffered receipt: the tenant and submitter the request was scoped to, and the actor and address the
+// audit log records for it
+type requestScope struct {
+	tenant    string
+	submitter string
+	actor     string
+	ip        string
+}
+
+// scopeOf captures the scope of a request's context
+func scopeOf(ctx context.Context) requestScope {
+	submitter, _ := store.ScopedSubmitter(ctx)
+	actor, _ := ctx.Value(actorContextKey{}).(string)
+	return requestScope{tenant: TenantFromContext(ctx), submitter: submitter, actor: actor, ip: ClientIPFromContext(ctx)}
+}
+
+// context scopes ctx like the request the scope was captured from
+func (scope requestScope) context(ctx context.Context) context.Context {
+	ctx = store.WithSubmitter(WithTenant(ctx, scope.tenant), scope.submitter)
+	return WithClientIP(WithActor(ctx, scope.actor), scope.ip)
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"receipt-processor/internal/config"
+)
+
+// Loyalty tiers, lowest first
+const (
+	tierBronze = "bronze"
+	tierSilver = "silver"
+	tierGold   = "gold"
+)
+
+// knownTiers are the tiers thresholds may be set for
+var knownTiers = map[string]bool{tierBronze: true, tierSilver: true, tierGold: true}
+
+// tierLevels is how users are placed in tiers
+type tierLevels struct {
+	// thresholds are the rolling points a user needs to reach each tier
+	thresholds map[string]int
+	// windowDays is how many days of purchases, today included, count towards a user's tier
+	windowDays int
+}
+
+// defaultTierLevels are the tiers before TIER_THRESHOLDS and TIER_WINDOW_DAYS are applied
+func defaultTierLevels() tierLevels {
+	return tierLevels{thresholds: map[string]int{tierBronze: 0, tierSilver: 1000, tierGold: 5000}, windowDays: 365}
+}
+
+// ConfigureTiers loads the tier thresholds from TIER_THRESHOLDS (e.g. "silver=1000,gold=5000") and the rolling
+// window from TIER_WINDOW_DAYS
+func (svc *Service) ConfigureTiers() {
+	for _, pair := range strings.Split(os.Getenv("TIER_THRESHOLDS"), ",") {
+		tier, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		tier = strings.TrimSpace(tier)
+		points, err := strconv.Atoi(strings.TrimSpace(value))
+		if !knownTiers[tier] || err != nil || points < 0 {
+			log.Printf("Ignoring invalid TIER_THRESHOLDS entry %q", pair)
+			continue
+		}
+		svc.tiers.thresholds[tier] = points
+	}
+	if days := config.Int("TIER_WINDOW_DAYS", svc.tiers.windowDays); days > 0 {
+		svc.tiers.windowDays = days
+	}
+}
+
+// byThreshold lists the tiers from the lowest threshold up
+func (levels tierLevels) byThreshold() []string {
+	tiers := make([]string, 0, len(levels.thresholds))
+	for tier := range levels.thresholds {
+		tiers = append(tiers, tier)
+	}
+	sort.Slice(tiers, func(i, j int) bool { return levels.thresholds[tiers[i]] < levels.thresholds[tiers[j]] })
+	return tiers
+}
+
+// TierWindowStart is the first purchase date counted towards tiers
+func (svc *Service) TierWindowStart(now time.Time) string {
+	return now.AddDate(0, 0, 1-svc.tiers.windowDays).Format("2006-01-02")
+}
+
+// TierFor returns the highest tier the rolling points reach, and the next tier with the points still needed for it
+func (svc *Service) TierFor(points int) (string, string, int) {
+	tier, next, needed := tierBronze, "", 0
+	for _, t := range svc.tiers.byThreshold() {
+		if points >= svc.tiers.thresholds[t] {
+			tier = t
+		} else if next == "" {
+			next, needed = t, svc.tiers.thresholds[t]-points
+		}
+	}
+	return tier, next, needed
+}
+
+// userTier returns a user's tier from their rolling points total
+func (svc *Service) userTier(ctx context.Context, userID string) (string, error) {
+	points, err := svc.RollingPoints(ctx, userID, svc.TierWindowStart(svc.clock().UTC()))
+	if err != nil {
+		return "", err
+	}
+	tier, _, _ := svc.TierFor(points)
+	return tier, nil
+}
+
+// UserProfile is a user's standing in the loyalty program
+type UserProfile struct {
+	UserID           string `json:"userId"`
+	Balance          int    `json:"balance"`
+	Tier             string `json:"tier"`
+	RollingPoints    int    `json:"rollingPoints"`
+	RollingSince     string `json:"rollingSince"`
+	NextTier         string `json:"nextTier,omitempty"`
+	PointsToNextTier int    `json:"pointsToNextTier,omitempty"`
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// topRetailerCount is how many retailers a monthly summary lists
+const topRetailerCount = 5
+
+// retailerPoints is what a user earned at one retailer
+type retailerPoints struct {
+	Retailer string `json:"retailer"`
+	Receipts int    `json:"receipts"`
+	Points   int    `json:"points"`
+}
+
+// rulePoints is what one rule contributed to a user's points
+type rulePoints struct {
+	Rule   int `json:"rule"`
+	Points int `json:"points"`
+}
+
+// pointsSummary is a user's rewards statement for one month
+type pointsSummary struct {
+	UserID       string           `json:"userId"`
+	Month        string           `json:"month"`
+	Points       int              `json:"points"`
+	Receipts     int              `json:"receipts"`
+	TopRetailers []retailerPoints `json:"topRetailers"`
+	Breakdown    []rulePoints     `json:"breakdown"`
+}
+
+// SummarizePoints builds a user's statement for a month (YYYY-MM) from their approved receipts purchased in it
+func (svc *Service) SummarizePoints(ctx context.Context, userID, month string) (pointsSummary, error) {
+	summary := pointsSummary{UserID: userID, Month: month, TopRetailers: []retailerPoints{}, Breakdown: []rulePoints{}}
+	list, err := svc.AllReceipts(ctx)
+	if err != nil {
+		return summary, err
+	}
+
+	retailers := make(map[string]*retailerPoints)
+	rules := make(map[int]int)
+	for _, receipt := range list {
+		if receipt.UserID != userID || !countsTowardBalance(receipt) || !strings.HasPrefix(receipt.PurchaseDate, month+"-") {
+			continue
+		}
+		awarded := svc.AwardedPoints(receipt)
+		summary.Points += awarded
+		summary.Receipts++
+		retailer, ok := retailers[receipt.Retailer]
+		if !ok {
+			retailer = &retailerPoints{Retailer: receipt.Retailer}
+			retailers[receipt.Retailer] = retailer
+		}
+		retailer.Receipts++
+		retailer.Points += awarded
+		for _, score := range svc.ExplainAwardedPoints(receipt).Breakdown {
+			rules[score.Rule] += score.Points
+		}
+	}
+
+	for _, retailer := range retailers {
+		summary.TopRetailers = append(summary.TopRetailers, *retailer)
+	}
+	sort.Slice(summary.TopRetailers, func(i, j int) bool {
+		a, b := summary.TopRetailers[i], summary.TopRetailers[j]
+		if a.Points != b.Points {
+			return a.Points > b.Points
+		}
+		return a.Retailer < b.Retailer
+	})
+	if len(summary.TopRetailers) > topRetailerCount {
+		summary.TopRetailers = summary.TopRetailers[:topRetailerCount]
+	}
+	for rule, points := range rules {
+		summary.Breakdown = append(summary.Breakdown, rulePoints{Rule: rule, Points: points})
+	}
+	sort.Slice(summary.Breakdown, func(i, j int) bool { return summary.Breakdown[i].Rule < summary.Breakdown[j].Rule })
+	return summary, nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"receipt-processor/internal/store"
+	"receipt-processor/scoring"
+)
+
+// ErrInvalidAmount is returned for receipts whose total or an item price is not an amount like 12.34
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// checkAmounts rejects a total or item price that is not dollars and exactly two digits of cents, which
+// the points rules would otherwise score as zero
+func checkAmounts(receipt store.Receipt) error {
+	if _, err := scoring.ParseCents(receipt.Total); err != nil {
+		return fmt.Errorf("%w: total %q must be an amount like 12.34", ErrInvalidAmount, receipt.Total)
+	}
+	for i, item := range receipt.Items {
+		if _, err := scoring.ParseCents(item.Price); err != nil {
+			return fmt.Errorf("%w: item %d price %q must be an amount like 12.34", ErrInvalidAmount, i+1, item.Price)
+		}
+	}
+	return nil
+}
+
+// ErrInvalidReceipt is returned for receipts that fail ValidateReceipt. The error says which field is at
+// fault, and also wraps ErrInvalidAmount, ErrInvalidTaxOrTip or ErrUnsupportedCurrency where one applies.
+var ErrInvalidReceipt = errors.New("invalid receipt")
+
+// invalidReceiptError marks the reason a receipt failed validation as ErrInvalidReceipt, keeping its message
+type invalidReceiptError struct {
+	reason error
+}
+
+func (e *invalidReceiptError) Error() string { return e.reason.Error() }
+
+func (e *invalidReceiptError) Unwrap() []error { return []error{ErrInvalidReceipt, e.reason} }
+
+// ValidateReceipt checks that a receipt has every field the points rules rely on, in the expected format.
+// Its failures are ErrInvalidReceipt, but for an exchange rate that could not be fetched, which is returned
+// as is, since the receipt is not at fault. AdmitReceipt runs it on every submission.
+func (svc *Service) ValidateReceipt(ctx context.Context, receipt store.Receipt) error {
+	if err := checkReceipt(receipt); err != nil {
+		return &invalidReceiptError{err}
+	}
+	if _, _, err := svc.ExchangeRate(ctx, receipt.Currency); errors.Is(err, ErrUnsupportedCurrency) {
+		return &invalidReceiptError{err}
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkReceipt checks the fields of a receipt that need no exchange rate
+func checkReceipt(receipt store.Receipt) error {
+	if strings.TrimSpace(receipt.Retailer) == "" {
+		return errors.New("retailer is required")
+	}
+	if _, err := time.Parse("2006-01-02", receipt.PurchaseDate); err != nil {
+		return fmt.Errorf("purchaseDate %q must be YYYY-MM-DD", receipt.PurchaseDate)
+	}
+	if _, err := time.Parse("15:04", receipt.PurchaseTime); err != nil {
+		return fmt.Errorf("purchaseTime %q must be HH:MM", receipt.PurchaseTime)
+	}
+	if err := checkAmounts(receipt); err != nil {
+		return err
+	}
+	if err := checkTaxAndTip(receipt); err != nil {
+		return err
+	}
+	if len(receipt.Items) == 0 {
+		return errors.New("at least one item is required")
+	}
+	for i, item := range receipt.Items {
+		if strings.TrimSpace(item.ShortDescription) == "" {
+			return fmt.Errorf("item %d: shortDescription is required", i+1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"receipt-processor/internal/config"
+)
+
+// webhookSignatureHeader carries the HMAC-SHA256 of the timestamp, a dot and the body, keyed with
+// WEBHOOK_SECRET; webhookTimestampHeader carries the timestamp, in Unix seconds, so receivers can
+// refuse old deliveries replayed to them
+const (
+	webhookSignatureHeader = "X-Receipt-Signature"
+	webhookTimestampHeader = "X-Receipt-Timestamp"
+)
+
+// webhookURLs reads the URLs each tenant's events are delivered to: WEBHOOK_URLS for the default tenant
+// and WEBHOOK_TENANT_URLS, tenant=url pairs with several URLs separated by spaces, for the others
+func webhookURLs() map[string][]string {
+	routes := make(map[string][]string)
+	for _, url := range strings.Split(os.Getenv("WEBHOOK_URLS"), ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			routes[DefaultTenant] = append(routes[DefaultTenant], url)
+		}
+	}
+	for tenant, urls := range config.Map("WEBHOOK_TENANT_URLS") {
+		routes[tenant] = append(routes[tenant], strings.Fields(urls)...)
+	}
+	return routes
+}
+
+// webhookDelivery is one event waiting to be delivered, and the attempts already made
+type webhookDelivery struct {
+	Event    Event
+	Body     []byte
+	Attempts int
+}
+
+// webhookSender signs and posts the deliveries of every webhook URL
+type webhookSender struct {
+	svc       *Service
+	client    *http.Client
+	secret    []byte
+	attempts  int
+	baseDelay time.Duration
+	// maxBackoff caps the wait between attempts
+	maxBackoff time.Duration
+}
+
+// webhookEndpoint is one URL and the deliveries queued for it. Each URL has its own queue and workers, and
+// failed deliveries wait for their retry on a timer rather than in a worker, so a slow or failing receiver
+// only holds up its own deliveries.
+type webhookEndpoint struct {
+	sender *webhookSender
+	url    string
+	queue  chan webhookDelivery
+}
+
+// StartWebhooks subscribes the configured webhook URLs to the event bus. Each URL only receives the
+// events of its own tenant. Deliveries are signed and retried with exponential backoff. URLs without
+// WEBHOOK_SECRET are an error, since receivers could not tell deliveries from forgeries.
+func (svc *Service) StartWebhooks() error {
+	routes := webhookURLs()
+	if len(routes) == 0 {
+		return nil
+	}
+	sender := &webhookSender{
+		svc:        svc,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		secret:     []byte(os.Getenv("WEBHOOK_SECRET")),
+		attempts:   config.Int("WEBHOOK_MAX_ATTEMPTS", 5),
+		baseDelay:  config.Duration("WEBHOOK_RETRY_DELAY", time.Second),
+		maxBackoff: time.Minute,
+	}
+	if len(sender.secret) == 0 {
+		return errors.New("WEBHOOK_URLS and WEBHOOK_TENANT_URLS need WEBHOOK_SECRET to sign deliveries")
+	}
+	queueSize, workers := config.Int("WEBHOOK_QUEUE_SIZE", 1000), config.Int("WEBHOOK_WORKERS", 2)
+
+	endpoints := make(map[string][]*webhookEndpoint)
+	for tenant, urls := range routes {
+		for _, url := range urls {
+			endpoint := &webhookEndpoint{sender: sender, url: url, queue: make(chan webhookDelivery, queueSize)}
+			for i := 0; i < workers; i++ {
+				go func() {
+					for delivery := range endpoint.queue {
+						endpoint.deliver(delivery)
+					}
+				}()
+			}
+			endpoints[tenant] = append(endpoints[tenant], endpoint)
+		}
+	}
+
+	svc.SubscribeEvents(func(event Event) {
+		event = svc.RedactEvent(event)
+		body, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("Failed to encode %s event: %v", event.Type, err)
+			return
+		}
+		for _, endpoint := range endpoints[eventTenant(event)] {
+			endpoint.enqueue(webhookDelivery{Event: event, Body: body})
+		}
+	})
+	return nil
+}
+
+// enqueue queues a delivery, or drops it, logged and counted on the dashboard, when the URL's queue is full
+func (e *webhookEndpoint) enqueue(delivery webhookDelivery) {
+	select {
+	case e.queue <- delivery:
+	default:
+		log.Printf("Webhook queue of %s full, dropping %s event", e.url, delivery.Event.Type)
+		e.sender.svc.recordWebhookDropMetrics(e.sender.svc.clock())
+	}
+}
+
+// deliver makes one attempt at a delivery, and on failure queues it again after the backoff, until it runs
+// out of attempts
+func (e *webhookEndpoint) deliver(delivery webhookDelivery) {
+	delivery.Attempts++
+	err := e.sender.post(e.url, delivery.Event.Type, delivery.Body)
+	if err == nil {
+		return
+	}
+	if delivery.Attempts >= e.sender.attempts {
+		log.Printf("Giving up on %s webhook to %s after %d attempts: %v", delivery.Event.Type, e.url, delivery.Attempts, err)
+		e.sender.svc.recordWebhookDropMetrics(e.sender.svc.clock())
+		return
+	}
+	time.AfterFunc(e.sender.backoff(delivery.Attempts), func() { e.enqueue(delivery) })
+}
+
+// backoff is the wait after a number of failed attempts: WEBHOOK_RETRY_DELAY, doubled after each
+// further failure, up to maxBackoff
+func (s *webhookSender) backoff(attempts int) time.Duration {
+	delay := s.baseDelay
+	for i := 1; i < attempts && delay < s.maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, s.maxBackoff)
+}
+
+// sign returns the signature header value for a body sent at a timestamp
+func (s *webhookSender) sign(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// post makes a single delivery attempt; any non-2xx response counts as a failure
+func (s *webhookSender) post(url, eventType string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Receipt-Event", eventType)
+	// Each attempt is signed afresh, so a retry is not refused as a replay
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, s.sign(timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"receipt-processor/internal/store"
+)
+
+// xmlReceiptMapping says where each receipt field lives in an XML document. Paths are "/"-separated element
+// names below the root element, and may end in "@attr" to read an attribute. Item is the path of the
+// repeating item element; ShortDescription, Price and Category are relative to it.
+type xmlReceiptMapping struct {
+	Retailer         string `json:"retailer"`
+	PurchaseDate     string `json:"purchaseDate"`
+	PurchaseTime     string `json:"purchaseTime"`
+	Total            string `json:"total"`
+	Tax              string `json:"tax"`
+	Tip              string `json:"tip"`
+	Item             string `json:"item"`
+	ShortDescription string `json:"shortDescription"`
+	Price            string `json:"price"`
+	Category         string `json:"category"`
+}
+
+// defaultXMLReceiptMapping reads the XML spelling of the JSON receipt:
+// <receipt><retailer/>...<items><item><shortDescription/><price/></item></items></receipt>
+var defaultXMLReceiptMapping = xmlReceiptMapping{
+	Retailer:         "retailer",
+	PurchaseDate:     "purchaseDate",
+	PurchaseTime:     "purchaseTime",
+	Total:            "total",
+	Tax:              "tax",
+	Tip:              "tip",
+	Item:             "items/item",
+	ShortDescription: "shortDescription",
+	Price:            "price",
+	Category:         "category",
+}
+
+// ConfigureXMLMapping loads the element mapping from XML_RECEIPT_MAPPING, a JSON object with the fields of
+// xmlReceiptMapping. Fields left out keep their default path.
+func (svc *Service) ConfigureXMLMapping() {
+	value := os.Getenv("XML_RECEIPT_MAPPING")
+	if value == "" {
+		return
+	}
+	mapping := defaultXMLReceiptMapping
+	if err := json.Unmarshal([]byte(value), &mapping); err != nil {
+		log.Printf("Ignoring invalid XML_RECEIPT_MAPPING: %v", err)
+		return
+	}
+	svc.xmlMapping = mapping
+}
+
+// ParseXMLReceipt maps an XML document into a Receipt using the configured element mapping
+func (svc *Service) ParseXMLReceipt(data []byte) (store.Receipt, error) {
+	return ParseMappedXML(data, svc.xmlMapping)
+}
+
+// xmlNode is an element of a parsed XML document
+type xmlNode struct {
+	Name     string
+	Attrs    map[string]string
+	Text     string
+	Children []*xmlNode
+}
+
+// parseXMLTree reads a document into a tree of elements, ignoring namespaces
+func parseXMLTree(data []byte) (*xmlNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var stack []*xmlNode
+	var root *xmlNode
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{Name: t.Name.Local, Attrs: make(map[string]string)}
+			for _, attr := range t.Attr {
+				node.Attrs[attr.Name.Local] = attr.Value
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, node)
+			} else if root == nil {
+				root = node
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].Text += string(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("empty XML document")
+	}
+	return root, nil
+}
+
+// find returns every element at a "/"-separated path below the node
+func (n *xmlNode) find(path string) []*xmlNode {
+	nodes := []*xmlNode{n}
+	for _, name := range strings.Split(path, "/") {
+		if name == "" {
+			continue
+		}
+		var next []*xmlNode
+		for _, node := range nodes {
+			for _, child := range node.Children {
+				if child.Name == name {
+					next = append(next, child)
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// value returns the trimmed text (or attribute, for paths ending in "@attr") at a path below the node
+func (n *xmlNode) value(path string) string {
+	path, attr, hasAttr := strings.Cut(path, "@")
+	nodes := n.find(strings.TrimSuffix(path, "/"))
+	if len(nodes) == 0 {
+		return ""
+	}
+	if hasAttr {
+		return strings.TrimSpace(nodes[0].Attrs[attr])
+	}
+	return strings.TrimSpace(nodes[0].Text)
+}
+
+// ParseMappedXML maps an XML document into a Receipt using the element mapping
+func ParseMappedXML(data []byte, mapping xmlReceiptMapping) (store.Receipt, error) {
+	root, err := parseXMLTree(data)
+	if err != nil {
+		return store.Receipt{}, err
+	}
+	receipt := store.Receipt{
+		Retailer:     root.value(mapping.Retailer),
+		PurchaseDate: root.value(mapping.PurchaseDate),
+		PurchaseTime: root.value(mapping.PurchaseTime),
+		Total:        root.value(mapping.Total),
+		Tax:          root.value(mapping.Tax),
+		Tip:          root.value(mapping.Tip),
+	}
+	for _, item := range root.find(mapping.Item) {
+		receipt.Items = append(receipt.Items, store.ReceiptItem{
+			ShortDescription: item.value(mapping.ShortDescription),
+			Price:            item.value(mapping.Price),
+			Category:         item.value(mapping.Category),
+		})
+	}
+	return receipt, nil
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// QueryResult holds the rows of an admin query in column order
+type QueryResult struct {
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// ReadOnlyQuery runs a query inside a read-only transaction that is always rolled back
+func (s *SQL) ReadOnlyQuery(ctx context.Context, query string, args []interface{}) (QueryResult, error) {
+	var result QueryResult
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+
+	if result.Columns, err = rows.Columns(); err != nil {
+		return result, err
+	}
+	result.Rows = [][]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(result.Columns))
+		pointers := make([]interface{}, len(values))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return result, err
+		}
+		for i, value := range values {
+			if b, ok := value.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry records one mutating operation: who did what to which subject, with a summary of the
+// subject before and after. Entries are only ever appended.
+type AuditEntry struct {
+	ID      string    `json:"id"`
+	Time    time.Time `json:"time"`
+	Actor   string    `json:"actor"`
+	Action  string    `json:"action"`
+	Subject string    `json:"subject"`
+	// Tenant is the tenant the operation was made for; empty for the default tenant
+	Tenant string `json:"tenant,omitempty"`
+	// IP is the address the request came from; empty for operations the server made by itself
+	IP string `json:"ip,omitempty"`
+	// Before and After are absent for subjects that did not exist before or no longer exist after
+	Before map[string]interface{} `json:"before,omitempty"`
+	After  map[string]interface{} `json:"after,omitempty"`
+}
+
+// auditChange is the before and after of an entry, as kept in the data column
+type auditChange struct {
+	Before map[string]interface{} `json:"before,omitempty"`
+	After  map[string]interface{} `json:"after,omitempty"`
+}
+
+// SaveAuditEntry appends to the audit_log table
+func (s *SQL) SaveAuditEntry(entry AuditEntry) error {
+	data, err := json.Marshal(auditChange{entry.Before, entry.After})
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO audit_log (id, created_at, actor, ip, action, subject, tenant, data) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		entry.ID, entry.Time, entry.Actor, entry.IP, entry.Action, entry.Subject, tenantColumn(entry.Tenant), string(data))
+	if err != nil {
+		return Unavailable(err)
+	}
+	return nil
+}
+
+// LoadAudit reads the audit log, oldest first
+func (s *SQL) LoadAudit() ([]AuditEntry, error) {
+	rows, err := s.db.Query(`SELECT id, created_at, actor, ip, action, subject, tenant, data FROM audit_log ORDER BY created_at, id`)
+	if err != nil {
+		return nil, Unavailable(err)
+	}
+	defer rows.Close()
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		var data string
+		if err := rows.Scan(&entry.ID, &entry.Time, &entry.Actor, &entry.IP, &entry.Action, &entry.Subject, &entry.Tenant, &data); err != nil {
+			return nil, Unavailable(err)
+		}
+		var change auditChange
+		if err := json.Unmarshal([]byte(data), &change); err != nil {
+			return nil, err
+		}
+		entry.Before, entry.After = change.Before, change.After
+		entry.Tenant = tenantFromColumn(entry.Tenant)
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Unavailable(err)
+	}
+	return entries, nil
+}
+
+func (s *Memory) SaveAuditEntry(entry AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.record(walAudit, entry); err != nil {
+		return err
+	}
+	s.audit = append(s.audit, entry)
+	return nil
+}
+
+func (s *Memory) LoadAudit() ([]AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]AuditEntry(nil), s.audit...), nil
+}
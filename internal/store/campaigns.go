@@ -0,0 +1,54 @@
+package store
+
+import (
+	"encoding/json"
+
+	"receipt-processor/scoring"
+)
+
+// SaveCampaign inserts or replaces a campaign in the campaigns table
+func (s *SQL) SaveCampaign(campaign scoring.Campaign) error {
+	data, err := json.Marshal(campaign)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO campaigns (id, data) VALUES ($1, $2) ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data`,
+		campaign.ID, string(data))
+	if err != nil {
+		return Unavailable(err)
+	}
+	return nil
+}
+
+// DeleteCampaign removes a campaign from the campaigns table
+func (s *SQL) DeleteCampaign(id string) error {
+	if _, err := s.db.Exec(`DELETE FROM campaigns WHERE id = $1`, id); err != nil {
+		return Unavailable(err)
+	}
+	return nil
+}
+
+// LoadCampaigns reads every campaign
+func (s *SQL) LoadCampaigns() ([]scoring.Campaign, error) {
+	rows, err := s.db.Query(`SELECT data FROM campaigns`)
+	if err != nil {
+		return nil, Unavailable(err)
+	}
+	defer rows.Close()
+	var list []scoring.Campaign
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, Unavailable(err)
+		}
+		var campaign scoring.Campaign
+		if err := json.Unmarshal([]byte(data), &campaign); err != nil {
+			return nil, err
+		}
+		list = append(list, campaign)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Unavailable(err)
+	}
+	return list, nil
+}
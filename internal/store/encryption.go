@@ -0,0 +1,108 @@
+package store
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// encryptedPrefix starts every encrypted payload; its format version, the ID of its key and the base64
+// nonce and ciphertext follow, as enc:v2:<key>:<data>. The header and the ID of the record the payload
+// was sealed for are authenticated with it, so that a payload cannot be moved to another row or record
+// and read as that one.
+const (
+	encryptedPrefix = "enc:"
+	sealVersion     = "v2"
+)
+
+// ErrNoEncryptionKey is returned for an encrypted payload whose key is not configured
+var ErrNoEncryptionKey = errors.New("receipt payload is encrypted with a key that is not configured")
+
+// Encryption seals receipt payloads with AES-GCM before a persistent store writes them, so the items and
+// the rest of a receipt are not on disk in plaintext. New payloads are sealed with the current key; the
+// other keys only open payloads sealed before a rotation. Payloads stored before encryption was turned
+// on stay readable, and are sealed the next time they are written. A nil Encryption leaves payloads in
+// plaintext.
+type Encryption struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewEncryption takes AES keys of 16, 24 or 32 bytes by ID, and the ID of the one new payloads are sealed with
+func NewEncryption(keys map[string][]byte, current string) (*Encryption, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("encryption key %q is not configured", current)
+	}
+	e := &Encryption{current: current, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: %v", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: %v", id, err)
+		}
+		e.keys[id] = aead
+	}
+	return e, nil
+}
+
+// Seal encrypts the payload of the record with an ID, such as a receipt, with the current key. The
+// header and the ID are authenticated along with it, so a payload cannot be passed off as sealed with
+// another key or for another record. It fails only when no random nonce can be had.
+func (e *Encryption) Seal(id string, plaintext []byte) ([]byte, error) {
+	if e == nil {
+		return plaintext, nil
+	}
+	aead := e.keys[e.current]
+	header := encryptedPrefix + sealVersion + ":" + e.current + ":"
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generating a nonce: %v", err)
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(header+id))
+	return append([]byte(header), base64.StdEncoding.EncodeToString(sealed)...), nil
+}
+
+// Open decrypts a payload Seal sealed for the record with an ID, and returns any other one, stored in
+// plaintext, as it is
+func (e *Encryption) Open(id string, data []byte) ([]byte, error) {
+	if !encrypted(data) {
+		return data, nil
+	}
+	version, rest, ok := bytes.Cut(data[len(encryptedPrefix):], []byte(":"))
+	if !ok || string(version) != sealVersion {
+		return nil, errors.New("malformed encrypted receipt payload")
+	}
+	keyID, sealed, ok := bytes.Cut(rest, []byte(":"))
+	if !ok {
+		return nil, errors.New("malformed encrypted receipt payload")
+	}
+	var aead cipher.AEAD
+	if e != nil {
+		aead = e.keys[string(keyID)]
+	}
+	if aead == nil {
+		return nil, fmt.Errorf("%w: %q", ErrNoEncryptionKey, keyID)
+	}
+	raw, err := base64.StdEncoding.DecodeString(string(sealed))
+	if err != nil || len(raw) < aead.NonceSize() {
+		return nil, errors.New("malformed encrypted receipt payload")
+	}
+	additional := string(data[:len(data)-len(sealed)]) + id
+	plaintext, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], []byte(additional))
+	if err != nil {
+		return nil, fmt.Errorf("decrypting receipt payload %s with key %q: %v", id, keyID, err)
+	}
+	return plaintext, nil
+}
+
+// encrypted reports whether a payload was sealed by an Encryption
+func encrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptedPrefix))
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"encoding/json"
+)
+
+// UserErasure is what erasing a user on their request changes in the loyalty and audit records: their
+// ledger entries in one tenant, their referral code and the referral they redeemed go, referrals they
+// made keep a pseudonym as the referrer, and Audit replaces the stored entries with the same IDs
+type UserErasure struct {
+	// Tenant is the tenant of the ledger entries; empty for the default tenant
+	Tenant    string       `json:"tenant,omitempty"`
+	UserID    string       `json:"userId"`
+	Pseudonym string       `json:"pseudonym"`
+	Audit     []AuditEntry `json:"audit,omitempty"`
+}
+
+// EraseUser removes and anonymizes a user's records in one transaction
+func (s *SQL) EraseUser(erasure UserErasure) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return Unavailable(err)
+	}
+	defer tx.Rollback()
+	for _, statement := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{`DELETE FROM points_ledger WHERE user_id = $1 AND tenant = $2`, []interface{}{erasure.UserID, tenantColumn(erasure.Tenant)}},
+		{`DELETE FROM referral_codes WHERE user_id = $1`, []interface{}{erasure.UserID}},
+		{`DELETE FROM referrals WHERE referee = $1`, []interface{}{erasure.UserID}},
+		{`UPDATE referrals SET referrer = $2 WHERE referrer = $1`, []interface{}{erasure.UserID, erasure.Pseudonym}},
+	} {
+		if _, err := tx.Exec(statement.query, statement.args...); err != nil {
+			return Unavailable(err)
+		}
+	}
+	for _, entry := range erasure.Audit {
+		data, err := json.Marshal(auditChange{entry.Before, entry.After})
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE audit_log SET subject = $2, ip = $3, data = $4 WHERE id = $1`, entry.ID, entry.Subject, entry.IP, string(data)); err != nil {
+			return Unavailable(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Unavailable(err)
+	}
+	return nil
+}
+
+// EraseUser removes and anonymizes a user's records, logging the erasure first like other writes
+func (s *Memory) EraseUser(erasure UserErasure) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.record(walEraseUser, erasure); err != nil {
+		return err
+	}
+	kept := s.ledger[:0]
+	for _, entry := range s.ledger {
+		if entry.UserID != erasure.UserID || entry.Tenant != erasure.Tenant {
+			kept = append(kept, entry)
+		}
+	}
+	s.ledger = kept
+	delete(s.referralCodes, erasure.UserID)
+	delete(s.referrals, erasure.UserID)
+	for referee, r := range s.referrals {
+		if r.Referrer == erasure.UserID {
+			r.Referrer = erasure.Pseudonym
+			s.referrals[referee] = r
+		}
+	}
+	anonymized := make(map[string]AuditEntry, len(erasure.Audit))
+	for _, entry := range erasure.Audit {
+		anonymized[entry.ID] = entry
+	}
+	for i, entry := range s.audit {
+		if replacement, ok := anonymized[entry.ID]; ok {
+			s.audit[i] = replacement
+		}
+	}
+	return nil
+}
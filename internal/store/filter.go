@@ -0,0 +1,61 @@
+package store
+
+import (
+	"strings"
+
+	"receipt-processor/scoring"
+)
+
+// Filter selects receipts by retailer, purchase date range, channel, state, item category, total
+// range and minimum awarded points; unset fields match everything. Stores apply it in Find.
+type Filter struct {
+	Retailer string
+	From     string
+	To       string
+	Channel  string
+	State    string
+	Category string
+	// MinTotal and MaxTotal are inclusive decimal amounts compared with the total as submitted
+	MinTotal  string
+	MaxTotal  string
+	MinPoints *int
+}
+
+// Matches reports whether a receipt passes the filter. Retailers match case-insensitively. Receipts stored
+// before awarded points were recorded pass the points condition; the service scores them.
+func (f Filter) Matches(receipt Receipt) bool {
+	if f.Retailer != "" && !strings.EqualFold(strings.TrimSpace(receipt.Retailer), strings.TrimSpace(f.Retailer)) {
+		return false
+	}
+	if f.From != "" && receipt.PurchaseDate < f.From {
+		return false
+	}
+	if f.To != "" && receipt.PurchaseDate > f.To {
+		return false
+	}
+	if f.Channel != "" && receipt.Channel != f.Channel {
+		return false
+	}
+	if f.State != "" && StateOf(receipt) != f.State {
+		return false
+	}
+	if f.Category != "" && !HasCategory(receipt, f.Category) {
+		return false
+	}
+	if f.MinTotal != "" || f.MaxTotal != "" {
+		total, err := scoring.ParseCents(receipt.Total)
+		if err != nil {
+			return false
+		}
+		if min, err := scoring.DecimalCents(f.MinTotal); err == nil && total < min {
+			return false
+		}
+		if max, err := scoring.DecimalCents(f.MaxTotal); err == nil && total > max {
+			return false
+		}
+	}
+	if f.MinPoints != nil && receipt.AwardedPoints != nil && *receipt.AwardedPoints < *f.MinPoints {
+		return false
+	}
+	return true
+}
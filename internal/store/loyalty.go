@@ -0,0 +1,114 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// LedgerEntry is points credited to a user outside of a receipt's own score, such as a referral bonus
+type LedgerEntry struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"userId"`
+	Points    int       `json:"points"`
+	Reason    string    `json:"reason"`
+	ReceiptID string    `json:"receiptId,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Tenant is the tenant of the receipt that earned the credit; empty for the default tenant
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// Referral records that a new user signed up with another user's code. Both are credited once,
+// on the referee's first processed receipt.
+type Referral struct {
+	Referee    string     `json:"referee"`
+	Referrer   string     `json:"referrer"`
+	Code       string     `json:"code"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	RewardedAt *time.Time `json:"rewardedAt,omitempty"`
+}
+
+// SaveLedgerEntry appends to the points_ledger table
+func (s *SQL) SaveLedgerEntry(entry LedgerEntry) error {
+	_, err := s.db.Exec(`INSERT INTO points_ledger (id, user_id, points, reason, receipt_id, created_at, tenant) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		entry.ID, entry.UserID, entry.Points, entry.Reason, entry.ReceiptID, entry.CreatedAt, tenantColumn(entry.Tenant))
+	if err != nil {
+		return Unavailable(err)
+	}
+	return nil
+}
+
+// SaveReferralCode stores a user's code in the referral_codes table
+func (s *SQL) SaveReferralCode(userID, code string) error {
+	_, err := s.db.Exec(`INSERT INTO referral_codes (code, user_id) VALUES ($1, $2)`, code, userID)
+	if err != nil {
+		return Unavailable(err)
+	}
+	return nil
+}
+
+// SaveReferral inserts or updates a referral in the referrals table
+func (s *SQL) SaveReferral(r Referral) error {
+	_, err := s.db.Exec(`INSERT INTO referrals (referee, referrer, code, created_at, rewarded_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (referee) DO UPDATE SET rewarded_at = EXCLUDED.rewarded_at`,
+		r.Referee, r.Referrer, r.Code, r.CreatedAt, r.RewardedAt)
+	if err != nil {
+		return Unavailable(err)
+	}
+	return nil
+}
+
+// LoadLoyalty reads the ledger (oldest first), every user's referral code and every referral
+func (s *SQL) LoadLoyalty() ([]LedgerEntry, map[string]string, []Referral, error) {
+	rows, err := s.db.Query(`SELECT id, user_id, points, reason, receipt_id, created_at, tenant FROM points_ledger ORDER BY created_at, id`)
+	if err != nil {
+		return nil, nil, nil, Unavailable(err)
+	}
+	var entries []LedgerEntry
+	for rows.Next() {
+		var entry LedgerEntry
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.Points, &entry.Reason, &entry.ReceiptID, &entry.CreatedAt, &entry.Tenant); err != nil {
+			rows.Close()
+			return nil, nil, nil, Unavailable(err)
+		}
+		entry.Tenant = tenantFromColumn(entry.Tenant)
+		entries = append(entries, entry)
+	}
+	rows.Close()
+
+	rows, err = s.db.Query(`SELECT code, user_id FROM referral_codes`)
+	if err != nil {
+		return nil, nil, nil, Unavailable(err)
+	}
+	codes := make(map[string]string)
+	for rows.Next() {
+		var code, user string
+		if err := rows.Scan(&code, &user); err != nil {
+			rows.Close()
+			return nil, nil, nil, Unavailable(err)
+		}
+		codes[user] = code
+	}
+	rows.Close()
+
+	rows, err = s.db.Query(`SELECT referee, referrer, code, created_at, rewarded_at FROM referrals`)
+	if err != nil {
+		return nil, nil, nil, Unavailable(err)
+	}
+	defer rows.Close()
+	var stored []Referral
+	for rows.Next() {
+		var r Referral
+		var rewardedAt sql.NullTime
+		if err := rows.Scan(&r.Referee, &r.Referrer, &r.Code, &r.CreatedAt, &rewardedAt); err != nil {
+			return nil, nil, nil, Unavailable(err)
+		}
+		if rewardedAt.Valid {
+			r.RewardedAt = &rewardedAt.Time
+		}
+		stored = append(stored, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, nil, Unavailable(err)
+	}
+	return entries, codes, stored, nil
+}
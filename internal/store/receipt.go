@@ -0,0 +1,92 @@
+package store
+
+import (
+	"strings"
+	"time"
+
+	"receipt-processor/scoring"
+)
+
+// NormalizeCategory folds a category or tag to the lowercase form it is stored and matched in
+func NormalizeCategory(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// HasCategory reports whether any item of the receipt is in the category
+func HasCategory(receipt Receipt, category string) bool {
+	category = NormalizeCategory(category)
+	for _, item := range receipt.Items {
+		if NormalizeCategory(item.Category) == category {
+			return true
+		}
+	}
+	return false
+}
+
+// Receipt lifecycle states
+const (
+	StateSubmitted     = "submitted"
+	StatePendingReview = "pending_review"
+	StateApproved      = "approved"
+	StateRejected      = "rejected"
+	StateVoided        = "voided"
+)
+
+// StateOf returns a receipt's state; receipts stored before the lifecycle existed were approved
+func StateOf(receipt Receipt) string {
+	if receipt.State == "" {
+		return StateApproved
+	}
+	return receipt.State
+}
+
+// Receipt represents the structure of a receipt
+type Receipt struct {
+	ID           string        `json:"id,omitempty"`
+	ShortCode    string        `json:"shortCode,omitempty"`
+	Retailer     string        `json:"retailer,omitempty"`
+	PurchaseDate string        `json:"purchaseDate,omitempty"`
+	PurchaseTime string        `json:"purchaseTime,omitempty"`
+	Items        []ReceiptItem `json:"items,omitempty"`
+	Total        string        `json:"total,omitempty"`
+	Flags        []string      `json:"flags,omitempty"`
+	ContentHash  string        `json:"contentHash,omitempty"`
+	DuplicateOf  string        `json:"duplicateOf,omitempty"`
+	RulesVersion string        `json:"rulesVersion,omitempty"`
+	Channel      string        `json:"channel,omitempty"`
+	State        string        `json:"state,omitempty"`
+	// AwardedPoints is what the receipt was credited when it was processed or last recalculated
+	AwardedPoints *int `json:"awardedPoints,omitempty"`
+	// ScoredAt is when AwardedPoints was computed under RulesVersion
+	ScoredAt *time.Time `json:"scoredAt,omitempty"`
+	// Breakdown is what each rule contributed to AwardedPoints
+	Breakdown []scoring.RuleScore `json:"breakdown,omitempty"`
+	// Currency is the ISO 4217 code of the amounts; empty means the base currency
+	Currency string `json:"currency,omitempty"`
+	// ExchangeRate is the units of Currency per unit of the base currency when the receipt was admitted
+	ExchangeRate float64 `json:"exchangeRate,omitempty"`
+	// Tax and Tip are the parts of Total that are not items; both are optional
+	Tax string `json:"tax,omitempty"`
+	Tip string `json:"tip,omitempty"`
+	// UserID is the loyalty member the receipt's points are credited to, if any
+	UserID string `json:"userId,omitempty"`
+	// RetailerRaw is the retailer name as submitted, when the retailer dictionary canonicalized it
+	RetailerRaw string `json:"retailerRaw,omitempty"`
+	// Tier is the user's loyalty tier when the receipt was processed; tier multipliers apply to it
+	Tier string `json:"tier,omitempty"`
+	// Campaigns are copies of the promotions the receipt qualified for when it was processed (rule 11)
+	Campaigns []scoring.Campaign `json:"campaigns,omitempty"`
+	// Tenant is the customer the receipt belongs to; empty for the default tenant
+	Tenant string `json:"tenant,omitempty"`
+	// SubmittedBy is the actor that submitted the receipt, recorded for submitters, who may only read their own
+	SubmittedBy string `json:"submittedBy,omitempty"`
+}
+
+// ReceiptItem represents an item in the receipt
+type ReceiptItem struct {
+	ShortDescription string `json:"shortDescription,omitempty"`
+	Price            string `json:"price,omitempty"`
+	// Category and Tags can be submitted with the receipt or set later; they are stored lowercase
+	Category string   `json:"category,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
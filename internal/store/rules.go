@@ -0,0 +1,95 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"receipt-processor/scoring"
+)
+
+// RuleConfig is a named version of the points rules; receipts remember the version that scored them
+type RuleConfig struct {
+	Version string `json:"version"`
+	scoring.Rules
+	// CreatedAt is when the version was added; it is set by the server
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+}
+
+// RuleActivation records when a rules version became the active one
+type RuleActivation struct {
+	Version     string    `json:"version"`
+	ActivatedAt time.Time `json:"activatedAt"`
+	// Tenant is the tenant the version became active for. Empty is the default tenant, whose active
+	// version also applies to every tenant that never activated one of its own.
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// SaveRules stores a rules version in the rule_versions table
+func (s *SQL) SaveRules(rules RuleConfig) error {
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	createdAt := time.Now().UTC()
+	if rules.CreatedAt != nil {
+		createdAt = *rules.CreatedAt
+	}
+	_, err = s.db.Exec(`INSERT INTO rule_versions (version, data, created_at) VALUES ($1, $2, $3) ON CONFLICT (version) DO NOTHING`,
+		rules.Version, data, createdAt)
+	if err != nil {
+		return Unavailable(err)
+	}
+	return nil
+}
+
+// RecordActivation appends to the rule_activations table
+func (s *SQL) RecordActivation(activation RuleActivation) error {
+	_, err := s.db.Exec(`INSERT INTO rule_activations (version, activated_at, tenant) VALUES ($1, $2, $3)`,
+		activation.Version, activation.ActivatedAt, tenantColumn(activation.Tenant))
+	if err != nil {
+		return Unavailable(err)
+	}
+	return nil
+}
+
+// LoadRules reads every archived rules version and the activation history, oldest first
+func (s *SQL) LoadRules() ([]RuleConfig, []RuleActivation, error) {
+	rows, err := s.db.Query(`SELECT data FROM rule_versions ORDER BY created_at, version`)
+	if err != nil {
+		return nil, nil, Unavailable(err)
+	}
+	var versions []RuleConfig
+	for rows.Next() {
+		var data []byte
+		var rules RuleConfig
+		if err := rows.Scan(&data); err != nil {
+			rows.Close()
+			return nil, nil, Unavailable(err)
+		}
+		if err := json.Unmarshal(data, &rules); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		versions = append(versions, rules)
+	}
+	rows.Close()
+
+	rows, err = s.db.Query(`SELECT version, activated_at, tenant FROM rule_activations ORDER BY activated_at, id`)
+	if err != nil {
+		return nil, nil, Unavailable(err)
+	}
+	defer rows.Close()
+	var activations []RuleActivation
+	for rows.Next() {
+		var activation RuleActivation
+		var activatedAt sql.NullTime
+		if err := rows.Scan(&activation.Version, &activatedAt, &activation.Tenant); err != nil {
+			return nil, nil, Unavailable(err)
+		}
+		activation.ActivatedAt = activatedAt.Time.UTC()
+		activation.Tenant = tenantFromColumn(activation.Tenant)
+		activations = append(activations, activation)
+	}
+	return versions, activations, rows.Err()
+}
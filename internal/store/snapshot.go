@@ -0,0 +1,287 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"receipt-processor/scoring"
+)
+
+// Snapshots make the memory store survive restarts without a database: with SNAPSHOT_FILE set it is
+// written to that file periodically and on graceful shutdown, and loaded from it on startup.
+
+// snapshot is everything the memory store holds, as written to the snapshot file
+type snapshot struct {
+	SavedAt time.Time `json:"savedAt"`
+	// Changes is the store's write count, so the write-ahead log replays only later writes
+	Changes       uint64             `json:"changes"`
+	Receipts      []Receipt          `json:"receipts"`
+	Rules         []RuleConfig       `json:"rules"`
+	Activations   []RuleActivation   `json:"activations"`
+	Ledger        []LedgerEntry      `json:"ledger"`
+	ReferralCodes map[string]string  `json:"referralCodes"`
+	Referrals     []Referral         `json:"referrals"`
+	Campaigns     []scoring.Campaign `json:"campaigns"`
+	Audit         []AuditEntry       `json:"audit"`
+	// Sealed holds the receipts instead of Receipts when they are encrypted, one payload each by ID
+	Sealed map[string]string `json:"sealed,omitempty"`
+}
+
+// SnapshotFile is the file RestoreSnapshot read from and SaveSnapshot writes to; empty when snapshots are off
+func (s *Memory) SnapshotFile() string {
+	return s.snapshotFile
+}
+
+// RestoreSnapshot loads the snapshot at path into an empty memory store and snapshots the store there
+// from then on. A missing file is a first start.
+func (s *Memory) RestoreSnapshot(path string) error {
+	s.snapshotFile = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("No snapshot at %s yet; starting empty", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return err
+	}
+	for id, sealed := range snap.Sealed {
+		payload, err := s.enc.Open(id, []byte(sealed))
+		if err != nil {
+			return err
+		}
+		var receipt Receipt
+		if err := json.Unmarshal(payload, &receipt); err != nil {
+			return err
+		}
+		snap.Receipts = append(snap.Receipts, receipt)
+	}
+
+	for _, receipt := range snap.Receipts {
+		s.receipts[receipt.ID] = receipt
+		if receipt.ShortCode != "" {
+			s.shortCodes[receipt.ShortCode] = receipt.ID
+		}
+	}
+	s.rules, s.activations, s.ledger, s.audit = snap.Rules, snap.Activations, snap.Ledger, snap.Audit
+	s.changes, s.savedChanges = snap.Changes, snap.Changes
+	for user, code := range snap.ReferralCodes {
+		s.referralCodes[user] = code
+	}
+	for _, r := range snap.Referrals {
+		s.referrals[r.Referee] = r
+	}
+	for _, campaign := range snap.Campaigns {
+		s.campaigns[campaign.ID] = campaign
+	}
+	log.Printf("Restored %d receipts from the snapshot of %s", len(snap.Receipts), snap.SavedAt.Format(time.RFC3339))
+	return nil
+}
+
+// takeSnapshot copies the memory store's contents, with the number of writes they include
+func (s *Memory) takeSnapshot() (snapshot, uint64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snap := snapshot{
+		SavedAt:       time.Now().UTC(),
+		Changes:       s.changes,
+		Receipts:      make([]Receipt, 0, len(s.receipts)),
+		Rules:         append([]RuleConfig(nil), s.rules...),
+		Activations:   append([]RuleActivation(nil), s.activations...),
+		Ledger:        append([]LedgerEntry(nil), s.ledger...),
+		Audit:         append([]AuditEntry(nil), s.audit...),
+		ReferralCodes: make(map[string]string, len(s.referralCodes)),
+	}
+	for _, receipt := range s.receipts {
+		snap.Receipts = append(snap.Receipts, receipt)
+	}
+	sort.Slice(snap.Receipts, func(i, j int) bool { return snap.Receipts[i].ID < snap.Receipts[j].ID })
+	for user, code := range s.referralCodes {
+		snap.ReferralCodes[user] = code
+	}
+	for _, r := range s.referrals {
+		snap.Referrals = append(snap.Referrals, r)
+	}
+	for _, campaign := range s.campaigns {
+		snap.Campaigns = append(snap.Campaigns, campaign)
+	}
+	return snap, s.changes
+}
+
+// writes returns the store's write count
+func (s *Memory) writes() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.changes
+}
+
+// SaveSnapshot writes the store to its snapshot file, unless nothing changed since the last one, and
+// then prunes the write-ahead log segments it covers. The file is replaced atomically, so a crash
+// mid-write leaves the previous snapshot intact.
+func (s *Memory) SaveSnapshot() error {
+	if s.snapshotFile == "" {
+		return nil
+	}
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+	if s.writes() == s.savedChanges {
+		return nil
+	}
+	uncovered, err := s.rotateWAL()
+	if err != nil {
+		return err
+	}
+	snap, changes := s.takeSnapshot()
+	if s.enc != nil {
+		snap.Sealed = make(map[string]string, len(snap.Receipts))
+		for _, receipt := range snap.Receipts {
+			payload, err := json.Marshal(receipt)
+			if err != nil {
+				return err
+			}
+			sealed, err := s.enc.Seal(receipt.ID, payload)
+			if err != nil {
+				return err
+			}
+			snap.Sealed[receipt.ID] = string(sealed)
+		}
+		snap.Receipts = nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.snapshotFile), filepath.Base(s.snapshotFile)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := json.NewEncoder(tmp).Encode(snap); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.snapshotFile); err != nil {
+		return err
+	}
+	s.savedChanges = changes
+	if s.wal != nil {
+		pruneWAL(s.wal.dir, uncovered)
+	}
+	return nil
+}
+
+func (s *Memory) SaveRules(rules RuleConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, stored := range s.rules {
+		if stored.Version == rules.Version {
+			return nil
+		}
+	}
+	if err := s.record(walRules, rules); err != nil {
+		return err
+	}
+	s.rules = append(s.rules, rules)
+	return nil
+}
+
+func (s *Memory) RecordActivation(activation RuleActivation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.record(walActivation, activation); err != nil {
+		return err
+	}
+	s.activations = append(s.activations, activation)
+	return nil
+}
+
+func (s *Memory) LoadRules() ([]RuleConfig, []RuleActivation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]RuleConfig(nil), s.rules...), append([]RuleActivation(nil), s.activations...), nil
+}
+
+func (s *Memory) SaveLedgerEntry(entry LedgerEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.record(walLedger, entry); err != nil {
+		return err
+	}
+	s.ledger = append(s.ledger, entry)
+	return nil
+}
+
+func (s *Memory) SaveReferralCode(userID, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.record(walReferralCode, struct{ UserID, Code string }{userID, code}); err != nil {
+		return err
+	}
+	s.referralCodes[userID] = code
+	return nil
+}
+
+func (s *Memory) SaveReferral(r Referral) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.record(walReferral, r); err != nil {
+		return err
+	}
+	s.referrals[r.Referee] = r
+	return nil
+}
+
+func (s *Memory) LoadLoyalty() ([]LedgerEntry, map[string]string, []Referral, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	codes := make(map[string]string, len(s.referralCodes))
+	for user, code := range s.referralCodes {
+		codes[user] = code
+	}
+	var stored []Referral
+	for _, r := range s.referrals {
+		stored = append(stored, r)
+	}
+	return append([]LedgerEntry(nil), s.ledger...), codes, stored, nil
+}
+
+func (s *Memory) SaveCampaign(campaign scoring.Campaign) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.record(walCampaign, campaign); err != nil {
+		return err
+	}
+	s.campaigns[campaign.ID] = campaign
+	return nil
+}
+
+func (s *Memory) DeleteCampaign(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.record(walDeleteCampaign, id); err != nil {
+		return err
+	}
+	delete(s.campaigns, id)
+	return nil
+}
+
+func (s *Memory) LoadCampaigns() ([]scoring.Campaign, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]scoring.Campaign, 0, len(s.campaigns))
+	for _, campaign := range s.campaigns {
+		list = append(list, campaign)
+	}
+	return list, nil
+}
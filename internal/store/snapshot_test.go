@@ -0,0 +1,163 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"receipt-processor/scoring"
+)
+
+// testEncryption seals with one fixed key
+func testEncryption(t *testing.T) *Encryption {
+	t.Helper()
+	enc, err := NewEncryption(map[string][]byte{"k1": bytes.Repeat([]byte{7}, 32)}, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enc
+}
+
+// fillStore makes one write of every kind the snapshot keeps
+func fillStore(t *testing.T, s *Memory) {
+	t.Helper()
+	ctx := context.Background()
+	for _, receipt := range []Receipt{
+		{ID: "r1", ShortCode: "ABC123", Retailer: "Target", PurchaseDate: "2022-01-01", Total: "35.35"},
+		{ID: "r2", Retailer: "M&M Corner Market", PurchaseDate: "2022-03-20", Total: "9.00", Tenant: "acme"},
+	} {
+		if err := s.Save(ctx, receipt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.SaveRules(RuleConfig{Version: "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveLedgerEntry(LedgerEntry{ID: "l1", UserID: "alice", Points: 28, ReceiptID: "r1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveReferralCode("alice", "ALICE1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveCampaign(scoring.Campaign{ID: "c1", StartDate: "2022-01-01", EndDate: "2022-12-31", BonusPoints: 5}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// storeContents is what a memory store holds, for comparing two of them
+func storeContents(t *testing.T, s *Memory) map[string]interface{} {
+	t.Helper()
+	receipts, err := s.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	byCode, _, _ := s.GetByShortCode(context.Background(), "ABC123")
+	rules, activations, _ := s.LoadRules()
+	ledger, codes, referrals, _ := s.LoadLoyalty()
+	campaigns, _ := s.LoadCampaigns()
+	// Both come out of maps, in no particular order
+	sort.Slice(receipts, func(i, j int) bool { return receipts[i].ID < receipts[j].ID })
+	sort.Slice(campaigns, func(i, j int) bool { return campaigns[i].ID < campaigns[j].ID })
+	return map[string]interface{}{
+		"receipts": receipts, "byCode": byCode.ID, "rules": rules, "activations": activations,
+		"ledger": ledger, "codes": codes, "referrals": referrals, "campaigns": campaigns,
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		encrypted bool
+	}{
+		{"plaintext", false},
+		{"encrypted", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "snapshot.json")
+			var enc *Encryption
+			if tt.encrypted {
+				enc = testEncryption(t)
+			}
+			saved := NewMemory()
+			saved.SetEncryption(enc)
+			if err := saved.RestoreSnapshot(path); err != nil {
+				t.Fatalf("restoring a missing snapshot: %v", err)
+			}
+			fillStore(t, saved)
+			if err := saved.SaveSnapshot(); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := bytes.Contains(data, []byte("Corner Market")); got == tt.encrypted {
+				t.Errorf("snapshot shows the retailer in plaintext = %v, want %v", got, !tt.encrypted)
+			}
+
+			restored := NewMemory()
+			restored.SetEncryption(enc)
+			if err := restored.RestoreSnapshot(path); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := storeContents(t, restored), storeContents(t, saved); !reflect.DeepEqual(got, want) {
+				t.Errorf("restored store = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestSnapshotWrongKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	saved := NewMemory()
+	saved.SetEncryption(testEncryption(t))
+	saved.RestoreSnapshot(path)
+	fillStore(t, saved)
+	if err := saved.SaveSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewEncryption(map[string][]byte{"k1": bytes.Repeat([]byte{8}, 32)}, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := NewMemory()
+	restored.SetEncryption(other)
+	if err := restored.RestoreSnapshot(path); err == nil {
+		t.Error("snapshot sealed with another key restored")
+	}
+}
+
+func TestSnapshotSkippedWhileUnchanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	s := NewMemory()
+	s.RestoreSnapshot(path)
+	if err := s.SaveSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("empty store snapshotted: %v", err)
+	}
+	fillStore(t, s)
+	if err := s.SaveSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("unchanged store snapshotted again: %v", err)
+	}
+	matches, _ := filepath.Glob(path + ".tmp*")
+	if len(matches) > 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+}
@@ -0,0 +1,323 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	_ "github.com/lib/pq"
+)
+
+// sqlSchema creates the receipts, rules, loyalty, campaigns and audit tables. The full receipt is kept as JSON in data;
+// the scalar columns exist so admins and reports can query them directly.
+const sqlSchema = `
+CREATE TABLE IF NOT EXISTS receipts (
+	id            TEXT PRIMARY KEY,
+	retailer      TEXT NOT NULL,
+	purchase_date TEXT NOT NULL,
+	purchase_time TEXT NOT NULL,
+	total         TEXT NOT NULL,
+	rules_version TEXT NOT NULL,
+	data          TEXT NOT NULL,
+	created_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+ALTER TABLE receipts ADD COLUMN IF NOT EXISTS short_code TEXT;
+CREATE INDEX IF NOT EXISTS receipts_short_code ON receipts (short_code);
+ALTER TABLE receipts ADD COLUMN IF NOT EXISTS points INTEGER;
+CREATE INDEX IF NOT EXISTS receipts_purchase_date ON receipts (purchase_date);
+ALTER TABLE receipts ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT 'default';
+CREATE INDEX IF NOT EXISTS receipts_tenant ON receipts (tenant);
+CREATE TABLE IF NOT EXISTS rule_versions (
+	version    TEXT PRIMARY KEY,
+	data       TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL
+);
+CREATE TABLE IF NOT EXISTS rule_activations (
+	id           SERIAL PRIMARY KEY,
+	version      TEXT NOT NULL REFERENCES rule_versions (version),
+	activated_at TIMESTAMPTZ NOT NULL
+);
+ALTER TABLE rule_activations ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE rule_activations ALTER COLUMN tenant SET DEFAULT 'default';
+UPDATE rule_activations SET tenant = 'default' WHERE tenant = '';
+CREATE TABLE IF NOT EXISTS points_ledger (
+	id         TEXT PRIMARY KEY,
+	user_id    TEXT NOT NULL,
+	points     INTEGER NOT NULL,
+	reason     TEXT NOT NULL,
+	receipt_id TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL
+);
+ALTER TABLE points_ledger ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE points_ledger ALTER COLUMN tenant SET DEFAULT 'default';
+UPDATE points_ledger SET tenant = 'default' WHERE tenant = '';
+CREATE TABLE IF NOT EXISTS referral_codes (
+	code    TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL UNIQUE
+);
+CREATE TABLE IF NOT EXISTS referrals (
+	referee     TEXT PRIMARY KEY,
+	referrer    TEXT NOT NULL,
+	code        TEXT NOT NULL,
+	created_at  TIMESTAMPTZ NOT NULL,
+	rewarded_at TIMESTAMPTZ
+);
+CREATE TABLE IF NOT EXISTS campaigns (
+	id   TEXT PRIMARY KEY,
+	data TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS audit_log (
+	id         TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL,
+	actor      TEXT NOT NULL,
+	ip         TEXT NOT NULL DEFAULT '',
+	action     TEXT NOT NULL,
+	subject    TEXT NOT NULL,
+	tenant     TEXT NOT NULL DEFAULT 'default',
+	data       TEXT NOT NULL
+);
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE audit_log ALTER COLUMN tenant SET DEFAULT 'default';
+UPDATE audit_log SET tenant = 'default' WHERE tenant = '';
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS ip TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS audit_log_created_at ON audit_log (created_at)`
+
+// SQL keeps receipts in a PostgreSQL database
+type SQL struct {
+	db *sql.DB
+	// enc seals the receipt JSON in the data column; the scalar columns stay in plaintext for queries
+	enc *Encryption
+}
+
+// NewSQL connects to PostgreSQL and creates the schema if needed
+func NewSQL(dsn string) (*SQL, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqlSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQL{db: db}, nil
+}
+
+// SetEncryption seals the receipt JSON of the rows written from then on, and opens the sealed rows read
+func (s *SQL) SetEncryption(enc *Encryption) {
+	s.enc = enc
+}
+
+// Encryption returns what SetEncryption set; nil when receipts are written in plaintext
+func (s *SQL) Encryption() *Encryption {
+	return s.enc
+}
+
+// Unavailable marks a database error as a store outage
+func Unavailable(err error) error {
+	return fmt.Errorf("%w: %v", ErrUnavailable, err)
+}
+
+// failed reports a database error of a query made with ctx: the context's error when it is done, since
+// the database was then not necessarily at fault, and a store outage otherwise
+func failed(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return Unavailable(err)
+}
+
+// Save never moves a receipt between tenants: updating a stored receipt of another tenant changes no row
+// and fails with ErrWrongTenant. Under a submitter's scope, the receipts of other submitters fail with
+// ErrWrongSubmitter.
+func (s *SQL) Save(ctx context.Context, receipt Receipt) error {
+	if err := scopeError(ctx, receipt); err != nil {
+		return err
+	}
+	if _, scoped := ScopedSubmitter(ctx); scoped {
+		existing, exists, err := s.Get(WithSubmitter(ctx, ""), receipt.ID)
+		if err != nil {
+			return err
+		}
+		if exists && existing.SubmittedBy != receipt.SubmittedBy {
+			return ErrWrongSubmitter
+		}
+	}
+	data, err := json.Marshal(receipt)
+	if err != nil {
+		return err
+	}
+	if data, err = s.enc.Seal(receipt.ID, data); err != nil {
+		return err
+	}
+	// Only data is sealed. The columns beside it are what queries filter and sort on, so the retailer,
+	// purchase date and time, total, points, short code and tenant stay in plaintext at rest.
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO receipts (id, retailer, purchase_date, purchase_time, total, rules_version, data, short_code, points, tenant)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9, $10)
+		ON CONFLICT (id) DO UPDATE SET
+			retailer = EXCLUDED.retailer,
+			purchase_date = EXCLUDED.purchase_date,
+			purchase_time = EXCLUDED.purchase_time,
+			total = EXCLUDED.total,
+			rules_version = EXCLUDED.rules_version,
+			data = EXCLUDED.data,
+			short_code = EXCLUDED.short_code,
+			points = EXCLUDED.points
+		WHERE receipts.tenant = EXCLUDED.tenant`,
+		receipt.ID, receipt.Retailer, receipt.PurchaseDate, receipt.PurchaseTime, receipt.Total, receipt.RulesVersion, data, receipt.ShortCode, receipt.AwardedPoints, TenantOf(receipt))
+	if err != nil {
+		return failed(ctx, err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return ErrWrongTenant
+	}
+	return nil
+}
+
+func (s *SQL) Get(ctx context.Context, id string) (Receipt, bool, error) {
+	return s.getWhere(ctx, `id = $1`, id)
+}
+
+func (s *SQL) GetByShortCode(ctx context.Context, code string) (Receipt, bool, error) {
+	return s.getWhere(ctx, `short_code = $1`, code)
+}
+
+// getWhere loads the first receipt matching a condition on one parameter, within the context's tenant
+func (s *SQL) getWhere(ctx context.Context, condition string, arg string) (Receipt, bool, error) {
+	args := []interface{}{arg}
+	if tenant, scoped := ScopedTenant(ctx); scoped {
+		condition += ` AND tenant = $2`
+		args = append(args, tenant)
+	}
+	var id string
+	var data []byte
+	err := s.db.QueryRowContext(ctx, `SELECT id, data FROM receipts WHERE `+condition+` LIMIT 1`, args...).Scan(&id, &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Receipt{}, false, nil
+	}
+	if err != nil {
+		return Receipt{}, false, failed(ctx, err)
+	}
+	if data, err = s.enc.Open(id, data); err != nil {
+		return Receipt{}, false, err
+	}
+	var receipt Receipt
+	if err := json.Unmarshal(data, &receipt); err != nil {
+		return Receipt{}, false, err
+	}
+	// The submitter is only in the receipt JSON, so its scope is applied here rather than in the query
+	if !Visible(ctx, receipt) {
+		return Receipt{}, false, nil
+	}
+	return receipt, true, nil
+}
+
+func (s *SQL) List(ctx context.Context) ([]Receipt, error) {
+	if tenant, scoped := ScopedTenant(ctx); scoped {
+		return s.queryReceipts(ctx, `SELECT id, data FROM receipts WHERE tenant = $1 ORDER BY created_at, id`, tenant)
+	}
+	return s.queryReceipts(ctx, `SELECT id, data FROM receipts ORDER BY created_at, id`)
+}
+
+// Find pushes the tenant, retailer, purchase date, total and points conditions of the filter down to the
+// database and applies the rest, which only the receipt JSON holds, to the rows it returns. Rows stored
+// before points were recorded have no points column and are checked in Go as well.
+func (s *SQL) Find(ctx context.Context, filter Filter) ([]Receipt, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if tenant, scoped := ScopedTenant(ctx); scoped {
+		where(`tenant = $%d`, tenant)
+	}
+	if filter.Retailer != "" {
+		where(`lower(trim(retailer)) = lower(trim($%d))`, filter.Retailer)
+	}
+	if filter.From != "" {
+		where(`purchase_date >= $%d`, filter.From)
+	}
+	if filter.To != "" {
+		where(`purchase_date <= $%d`, filter.To)
+	}
+	const totalAmount = `CASE WHEN total ~ '^[0-9]+(\.[0-9]+)?$' THEN total::numeric END`
+	if filter.MinTotal != "" {
+		where(totalAmount+` >= $%d::numeric`, filter.MinTotal)
+	}
+	if filter.MaxTotal != "" {
+		where(totalAmount+` <= $%d::numeric`, filter.MaxTotal)
+	}
+	if filter.MinPoints != nil {
+		where(`(points IS NULL OR points >= $%d)`, *filter.MinPoints)
+	}
+
+	statement := `SELECT id, data FROM receipts`
+	if len(conditions) > 0 {
+		statement += ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+	list, err := s.queryReceipts(ctx, statement+` ORDER BY created_at, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	matched := list[:0]
+	for _, receipt := range list {
+		if filter.Matches(receipt) {
+			matched = append(matched, receipt)
+		}
+	}
+	return matched, nil
+}
+
+func (s *SQL) Delete(ctx context.Context, id string) error {
+	if _, scoped := ScopedSubmitter(ctx); scoped {
+		if _, exists, err := s.Get(ctx, id); err != nil || !exists {
+			return err
+		}
+	}
+	statement, args := `DELETE FROM receipts WHERE id = $1`, []interface{}{id}
+	if tenant, scoped := ScopedTenant(ctx); scoped {
+		statement, args = statement+` AND tenant = $2`, append(args, tenant)
+	}
+	if _, err := s.db.ExecContext(ctx, statement, args...); err != nil {
+		return failed(ctx, err)
+	}
+	return nil
+}
+
+// queryReceipts decodes the receipts whose id and data a query selects, leaving out those of other submitters
+// when the context is scoped to one
+func (s *SQL) queryReceipts(ctx context.Context, statement string, args ...interface{}) ([]Receipt, error) {
+	rows, err := s.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, failed(ctx, err)
+	}
+	defer rows.Close()
+
+	var list []Receipt
+	for rows.Next() {
+		var id string
+		var data []byte
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, failed(ctx, err)
+		}
+		data, err := s.enc.Open(id, data)
+		if err != nil {
+			return nil, err
+		}
+		var receipt Receipt
+		if err := json.Unmarshal(data, &receipt); err != nil {
+			return nil, err
+		}
+		if Visible(ctx, receipt) {
+			list = append(list, receipt)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, failed(ctx, err)
+	}
+	return list, nil
+}
@@ -0,0 +1,192 @@
+// Package store holds the receipt records and the backends that persist them: an in-memory store,
+// optionally snapshotted and write-ahead logged to disk, and PostgreSQL.
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"receipt-processor/scoring"
+)
+
+// ErrUnavailable is returned by a ReceiptStore whose backend cannot be reached
+var ErrUnavailable = errors.New("receipt store unavailable")
+
+// ErrNotFound is returned by operations on a receipt that is not stored
+var ErrNotFound = errors.New("receipt not found")
+
+// ReceiptStore persists processed receipts. Every method gives up with the context's error once it is
+// done, so a request that timed out or whose client left stops waiting for the backend. A context scoped
+// with WithTenant confines every method to that tenant's receipts, and one scoped with WithSubmitter to
+// the receipts of that submitter.
+type ReceiptStore interface {
+	// Save stores a receipt that already carries its ID
+	Save(ctx context.Context, receipt Receipt) error
+	// Get looks up a receipt by ID, reporting whether it exists
+	Get(ctx context.Context, id string) (Receipt, bool, error)
+	// GetByShortCode looks up a receipt by its normalized short code
+	GetByShortCode(ctx context.Context, code string) (Receipt, bool, error)
+	// List returns every stored receipt
+	List(ctx context.Context) ([]Receipt, error)
+	// Find returns the stored receipts matching a filter
+	Find(ctx context.Context, filter Filter) ([]Receipt, error)
+	// Delete removes a receipt; deleting one that is not stored is not an error
+	Delete(ctx context.Context, id string) error
+}
+
+// Memory keeps receipts in a map; it is never unavailable. It also archives rules, loyalty and
+// campaigns, so a snapshot of it carries everything the receipts refer to.
+type Memory struct {
+	mu       sync.RWMutex
+	receipts map[string]Receipt
+	// shortCodes maps short codes to receipt IDs
+	shortCodes map[string]string
+
+	rules         []RuleConfig
+	activations   []RuleActivation
+	ledger        []LedgerEntry
+	referralCodes map[string]string // user -> code
+	referrals     map[string]Referral
+	campaigns     map[string]scoring.Campaign
+	audit         []AuditEntry
+
+	// changes counts writes, so periodic snapshots are skipped while nothing changed and replaying the
+	// write-ahead log skips what the snapshot has
+	changes uint64
+	wal     *writeAheadLog
+
+	// snapshotFile is where the store is snapshotted; snapshotMu serializes snapshot writes and
+	// savedChanges is the write count of the last one written
+	snapshotFile string
+	snapshotMu   sync.Mutex
+	savedChanges uint64
+
+	// enc seals the receipts the snapshot and the write-ahead log hold; in memory they stay in plaintext
+	enc *Encryption
+}
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{
+		receipts:      make(map[string]Receipt),
+		shortCodes:    make(map[string]string),
+		referralCodes: make(map[string]string),
+		referrals:     make(map[string]Referral),
+		campaigns:     make(map[string]scoring.Campaign),
+	}
+}
+
+// SetEncryption seals the receipts written to the snapshot and the write-ahead log, and opens the sealed
+// ones read back. It must be called before RestoreSnapshot and OpenWAL.
+func (s *Memory) SetEncryption(enc *Encryption) {
+	s.enc = enc
+}
+
+// Encryption returns what SetEncryption set; nil when receipts are written in plaintext
+func (s *Memory) Encryption() *Encryption {
+	return s.enc
+}
+
+func (s *Memory) Save(ctx context.Context, receipt Receipt) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := scopeError(ctx, receipt); err != nil {
+		return err
+	}
+	if existing, ok := s.receipts[receipt.ID]; ok {
+		if TenantOf(existing) != TenantOf(receipt) {
+			return ErrWrongTenant
+		}
+		if err := scopeError(ctx, existing); err != nil {
+			return err
+		}
+	}
+	if err := s.record(walSave, receipt); err != nil {
+		return err
+	}
+	s.receipts[receipt.ID] = receipt
+	if receipt.ShortCode != "" {
+		s.shortCodes[receipt.ShortCode] = receipt.ID
+	}
+	return nil
+}
+
+func (s *Memory) Get(ctx context.Context, id string) (Receipt, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return Receipt{}, false, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	receipt, exists := s.receipts[id]
+	if !exists || !Visible(ctx, receipt) {
+		return Receipt{}, false, nil
+	}
+	return receipt, true, nil
+}
+
+func (s *Memory) GetByShortCode(ctx context.Context, code string) (Receipt, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return Receipt{}, false, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	receipt, exists := s.receipts[s.shortCodes[code]]
+	if !exists || !Visible(ctx, receipt) {
+		return Receipt{}, false, nil
+	}
+	return receipt, true, nil
+}
+
+func (s *Memory) List(ctx context.Context) ([]Receipt, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]Receipt, 0, len(s.receipts))
+	for _, receipt := range s.receipts {
+		if Visible(ctx, receipt) {
+			list = append(list, receipt)
+		}
+	}
+	return list, nil
+}
+
+func (s *Memory) Find(ctx context.Context, filter Filter) ([]Receipt, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []Receipt
+	for _, receipt := range s.receipts {
+		if Visible(ctx, receipt) && filter.Matches(receipt) {
+			list = append(list, receipt)
+		}
+	}
+	return list, nil
+}
+
+func (s *Memory) Delete(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	receipt, ok := s.receipts[id]
+	if !ok || !Visible(ctx, receipt) {
+		return nil
+	}
+	if err := s.record(walDelete, id); err != nil {
+		return err
+	}
+	if receipt.ShortCode != "" {
+		delete(s.shortCodes, receipt.ShortCode)
+	}
+	delete(s.receipts, id)
+	return nil
+}
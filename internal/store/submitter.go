@@ -0,0 +1,24 @@
+package store
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrWrongSubmitter is returned for a write, under a submitter's scope, of a receipt someone else submitted
+var ErrWrongSubmitter = errors.New("receipt was submitted by someone else")
+
+type submitterContextKey struct{}
+
+// WithSubmitter narrows the scope of a context to the receipts one submitter sent, within its tenant; an
+// empty submitter widens it to every submitter's again
+func WithSubmitter(ctx context.Context, submitter string) context.Context {
+	return context.WithValue(ctx, submitterContextKey{}, submitter)
+}
+
+// ScopedSubmitter returns the submitter a context is scoped to, and false for a context that sees the
+// receipts of every submitter
+func ScopedSubmitter(ctx context.Context) (string, bool) {
+	submitter, _ := ctx.Value(submitterContextKey{}).(string)
+	return submitter, submitter != ""
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"context"
+	"errors"
+)
+
+// DefaultTenant owns the receipts of requests that name no tenant, and every receipt stored before
+// receipts recorded their tenant
+const DefaultTenant = "default"
+
+// ErrWrongTenant is returned for a write, under a tenant's scope, of a receipt of another tenant
+var ErrWrongTenant = errors.New("receipt belongs to another tenant")
+
+type tenantContextKey struct{}
+
+// WithTenant scopes the store operations made with the context to one tenant's partition: reads only see
+// its receipts, and writes can only touch them
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	if tenant == "" {
+		tenant = DefaultTenant
+	}
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// AllTenants lifts the scope of WithTenant, for the server's own work across tenants, like retention and
+// the caches it keeps. Contexts that never had a scope see every tenant too.
+func AllTenants(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, "")
+}
+
+// ScopedTenant returns the tenant a context is scoped to, and false for a context that sees every tenant
+func ScopedTenant(ctx context.Context) (string, bool) {
+	tenant, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenant, tenant != ""
+}
+
+// TenantOf returns the tenant a receipt belongs to
+func TenantOf(receipt Receipt) string {
+	if receipt.Tenant == "" {
+		return DefaultTenant
+	}
+	return receipt.Tenant
+}
+
+// tenantColumn is the tenant column written for a record of tenant, which records of the default tenant
+// leave empty: like the receipts table, every table names the default tenant in full
+func tenantColumn(tenant string) string {
+	if tenant == "" {
+		return DefaultTenant
+	}
+	return tenant
+}
+
+// tenantFromColumn turns a tenant column back into the tenant of the record, empty for the default tenant
+func tenantFromColumn(column string) string {
+	if column == DefaultTenant {
+		return ""
+	}
+	return column
+}
+
+// Visible reports whether a receipt is in the partition a context is scoped to, and was sent by its
+// submitter if it is scoped to one
+func Visible(ctx context.Context, receipt Receipt) bool {
+	return scopeError(ctx, receipt) == nil
+}
+
+// scopeError explains why a receipt is out of a context's scope, or returns nil if it is in it
+func scopeError(ctx context.Context, receipt Receipt) error {
+	if tenant, scoped := ScopedTenant(ctx); scoped && TenantOf(receipt) != tenant {
+		return ErrWrongTenant
+	}
+	if submitter, scoped := ScopedSubmitter(ctx); scoped && receipt.SubmittedBy != submitter {
+		return ErrWrongSubmitter
+	}
+	return nil
+}
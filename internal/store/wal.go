@@ -0,0 +1,336 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"receipt-processor/scoring"
+)
+
+// The write-ahead log makes every write to the memory store durable before it is acknowledged: with
+// WAL_DIR set each write is appended to the current log segment and synced to disk before the store
+// applies it, and the segments are replayed on startup. Records carry the store's write count, so a
+// snapshot that already includes them skips them on replay, and segments a snapshot fully covers are
+// deleted once it is written.
+
+// Operations recorded in the log, one per Memory write method
+const (
+	walSave           = "save"
+	walDelete         = "delete"
+	walRules          = "rules"
+	walActivation     = "activation"
+	walLedger         = "ledger"
+	walReferralCode   = "referral_code"
+	walReferral       = "referral"
+	walCampaign       = "campaign"
+	walDeleteCampaign = "delete_campaign"
+	walAudit          = "audit"
+	walEraseUser      = "erase_user"
+)
+
+// maxWALRecordSize bounds one record when replaying
+const maxWALRecordSize = 16 << 20
+
+// walRecord is one line of a log segment
+type walRecord struct {
+	Seq uint64 `json:"seq"`
+	Op  string `json:"op"`
+	// ID is what the data of a sealed record was sealed for, see sealedID
+	ID   string          `json:"id,omitempty"`
+	Data json.RawMessage `json:"data"`
+}
+
+// writeAheadLog appends records to the newest segment file of a directory
+type writeAheadLog struct {
+	dir     string
+	segment *os.File
+	// start is the sequence number of the first record of the current segment
+	start uint64
+}
+
+// segmentName names the segment whose first record is start; names sort in sequence order
+func segmentName(start uint64) string {
+	return fmt.Sprintf("wal-%020d.log", start)
+}
+
+// walSegments lists the segments of a directory in sequence order, with their first sequence numbers
+func walSegments(dir string) ([]string, []uint64, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "wal-*.log"))
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(paths)
+	starts := make([]uint64, len(paths))
+	for i, path := range paths {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "wal-"), ".log")
+		if starts[i], err = strconv.ParseUint(name, 10, 64); err != nil {
+			return nil, nil, fmt.Errorf("unexpected log segment %s", path)
+		}
+	}
+	return paths, starts, nil
+}
+
+// OpenWAL replays the log segments in dir into the memory store on top of the restored snapshot and
+// starts logging the store's writes to a new segment
+func (s *Memory) OpenWAL(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	paths, _, err := walSegments(dir)
+	if err != nil {
+		return err
+	}
+	replayed := 0
+	for _, path := range paths {
+		n, err := s.replaySegment(path)
+		if err != nil {
+			return fmt.Errorf("replaying %s: %w", path, err)
+		}
+		replayed += n
+	}
+	if replayed > 0 {
+		log.Printf("Replayed %d writes from the write-ahead log", replayed)
+	}
+
+	s.wal = &writeAheadLog{dir: dir}
+	return s.wal.rotate(s.changes + 1)
+}
+
+// replaySegment applies the records of one segment the store does not have yet. A torn last record,
+// left by a crash in the middle of a write, is dropped: its write was never acknowledged.
+func (s *Memory) replaySegment(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), maxWALRecordSize)
+	applied := 0
+	var torn error
+	for scanner.Scan() {
+		if torn != nil {
+			return applied, torn
+		}
+		var record walRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			torn = fmt.Errorf("corrupt record after seq %d: %w", s.changes, err)
+			continue
+		}
+		if record.Seq <= s.changes {
+			continue
+		}
+		// The write methods count the write again as they apply it
+		s.changes = record.Seq - 1
+		if err := s.applyRecord(record); err != nil {
+			return applied, fmt.Errorf("record %d: %w", record.Seq, err)
+		}
+		applied++
+	}
+	if torn != nil {
+		log.Printf("Dropping the torn last record of %s: %v", path, torn)
+	}
+	return applied, scanner.Err()
+}
+
+// applyRecord repeats a logged write through the store's own write methods. It runs before the log is
+// attached, so the writes are not logged again.
+func (s *Memory) applyRecord(record walRecord) error {
+	decode := func(v interface{}) error {
+		data := record.Data
+		if bytes.HasPrefix(data, []byte(`"`+encryptedPrefix)) {
+			var sealed string
+			if err := json.Unmarshal(data, &sealed); err != nil {
+				return err
+			}
+			payload, err := s.enc.Open(record.ID, []byte(sealed))
+			if err != nil {
+				return err
+			}
+			data = payload
+		}
+		return json.Unmarshal(data, v)
+	}
+	switch record.Op {
+	case walSave:
+		var receipt Receipt
+		if err := decode(&receipt); err != nil {
+			return err
+		}
+		return s.Save(context.Background(), receipt)
+	case walDelete:
+		var id string
+		if err := decode(&id); err != nil {
+			return err
+		}
+		return s.Delete(context.Background(), id)
+	case walRules:
+		var rules RuleConfig
+		if err := decode(&rules); err != nil {
+			return err
+		}
+		return s.SaveRules(rules)
+	case walActivation:
+		var activation RuleActivation
+		if err := decode(&activation); err != nil {
+			return err
+		}
+		return s.RecordActivation(activation)
+	case walLedger:
+		var entry LedgerEntry
+		if err := decode(&entry); err != nil {
+			return err
+		}
+		return s.SaveLedgerEntry(entry)
+	case walReferralCode:
+		var code struct{ UserID, Code string }
+		if err := decode(&code); err != nil {
+			return err
+		}
+		return s.SaveReferralCode(code.UserID, code.Code)
+	case walReferral:
+		var r Referral
+		if err := decode(&r); err != nil {
+			return err
+		}
+		return s.SaveReferral(r)
+	case walCampaign:
+		var campaign scoring.Campaign
+		if err := decode(&campaign); err != nil {
+			return err
+		}
+		return s.SaveCampaign(campaign)
+	case walDeleteCampaign:
+		var id string
+		if err := decode(&id); err != nil {
+			return err
+		}
+		return s.DeleteCampaign(id)
+	case walAudit:
+		var entry AuditEntry
+		if err := decode(&entry); err != nil {
+			return err
+		}
+		return s.SaveAuditEntry(entry)
+	case walEraseUser:
+		var erasure UserErasure
+		if err := decode(&erasure); err != nil {
+			return err
+		}
+		return s.EraseUser(erasure)
+	}
+	return fmt.Errorf("unknown operation %q", record.Op)
+}
+
+// sealedID is the ID a logged record is sealed for: a saved receipt's ID, or the tenant and user of an
+// erasure
+func sealedID(data interface{}) string {
+	switch record := data.(type) {
+	case Receipt:
+		return record.ID
+	case UserErasure:
+		return record.Tenant + "/" + record.UserID
+	}
+	return ""
+}
+
+// record counts a write and, when the log is on, appends it and syncs the segment so the write survives
+// a crash before the store applies it. Saved receipts and erasures are logged sealed when encryption is
+// on. The caller holds s.mu.
+func (s *Memory) record(op string, data interface{}) error {
+	s.changes++
+	if s.wal == nil {
+		return nil
+	}
+	var id string
+	if (op == walSave || op == walEraseUser) && s.enc != nil {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			s.changes--
+			return err
+		}
+		id = sealedID(data)
+		sealed, err := s.enc.Seal(id, payload)
+		if err != nil {
+			s.changes--
+			return err
+		}
+		data = string(sealed)
+	}
+	if err := s.wal.append(walRecord{Seq: s.changes, Op: op, ID: id}, data); err != nil {
+		s.changes--
+		return Unavailable(err)
+	}
+	return nil
+}
+
+// append writes one record and syncs it to disk
+func (w *writeAheadLog) append(record walRecord, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	record.Data = raw
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := w.segment.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return w.segment.Sync()
+}
+
+// rotate starts a new segment whose first record is start
+func (w *writeAheadLog) rotate(start uint64) error {
+	segment, err := os.OpenFile(filepath.Join(w.dir, segmentName(start)), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if w.segment != nil {
+		w.segment.Close()
+	}
+	w.segment, w.start = segment, start
+	return nil
+}
+
+// rotateWAL starts a new segment before a snapshot, so every older segment only holds writes the
+// snapshot will include. It returns the new segment's first sequence number.
+func (s *Memory) rotateWAL() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.wal == nil {
+		return 0, nil
+	}
+	if s.wal.start == s.changes+1 {
+		return s.wal.start, nil
+	}
+	start := s.changes + 1
+	return start, s.wal.rotate(start)
+}
+
+// pruneWAL deletes the segments that start before a written snapshot's first uncovered write
+func pruneWAL(dir string, before uint64) {
+	paths, starts, err := walSegments(dir)
+	if err != nil {
+		log.Printf("Write-ahead log not pruned: %v", err)
+		return
+	}
+	for i, path := range paths {
+		if starts[i] < before {
+			if err := os.Remove(path); err != nil {
+				log.Printf("Write-ahead log not pruned: %v", err)
+			}
+		}
+	}
+}
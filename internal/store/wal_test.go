@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// reopen replays a WAL directory, on top of the snapshot at path when there is one, into a new store
+func reopen(t *testing.T, enc *Encryption, snapshotPath, walDir string) *Memory {
+	t.Helper()
+	s := NewMemory()
+	s.SetEncryption(enc)
+	if snapshotPath != "" {
+		if err := s.RestoreSnapshot(snapshotPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.OpenWAL(walDir); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestWALReplay(t *testing.T) {
+	tests := []struct {
+		name      string
+		encrypted bool
+	}{
+		{"plaintext", false},
+		{"encrypted", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var enc *Encryption
+			if tt.encrypted {
+				enc = testEncryption(t)
+			}
+			logged := reopen(t, enc, "", dir)
+			fillStore(t, logged)
+			if err := logged.Delete(context.Background(), "r2"); err != nil {
+				t.Fatal(err)
+			}
+
+			segments, _, _ := walSegments(dir)
+			for _, path := range segments {
+				data, _ := os.ReadFile(path)
+				if got := strings.Contains(string(data), "Target"); got == tt.encrypted {
+					t.Errorf("log shows the retailer in plaintext = %v, want %v", got, !tt.encrypted)
+				}
+			}
+
+			replayed := reopen(t, enc, "", dir)
+			if got, want := storeContents(t, replayed), storeContents(t, logged); !reflect.DeepEqual(got, want) {
+				t.Errorf("replayed store = %+v, want %+v", got, want)
+			}
+			if replayed.changes != logged.changes {
+				t.Errorf("replayed write count = %d, want %d", replayed.changes, logged.changes)
+			}
+		})
+	}
+}
+
+func TestWALTornRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		tail    string
+		wantErr bool
+	}{
+		{"torn last record", `{"seq":99,"op":"save","data":{"id":"r3","ret`, false},
+		{"corrupt record before others", "garbage\n" + `{"seq":99,"op":"delete","data":"r1"}` + "\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			logged := reopen(t, nil, "", dir)
+			fillStore(t, logged)
+			segment, err := os.OpenFile(logged.wal.segment.Name(), os.O_APPEND|os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			segment.WriteString(tt.tail)
+			segment.Close()
+
+			replayed := NewMemory()
+			err = replayed.OpenWAL(dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("OpenWAL error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got, want := storeContents(t, replayed), storeContents(t, logged); !reflect.DeepEqual(got, want) {
+				t.Errorf("replayed store = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestWALPrunedBySnapshot(t *testing.T) {
+	dir := t.TempDir()
+	walDir, snapshotPath := filepath.Join(dir, "wal"), filepath.Join(dir, "snapshot.json")
+	logged := reopen(t, nil, snapshotPath, walDir)
+	fillStore(t, logged)
+	if err := logged.SaveSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	paths, starts, _ := walSegments(walDir)
+	if len(paths) != 1 || starts[0] != logged.changes+1 {
+		t.Fatalf("segments after the snapshot start at %v, want only the one after write %d", starts, logged.changes)
+	}
+
+	// Writes after the snapshot are only in the log, and those before it only in the snapshot
+	if err := logged.SaveLedgerEntry(LedgerEntry{ID: "l2", UserID: "alice", Points: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := logged.Delete(context.Background(), "r1"); err != nil {
+		t.Fatal(err)
+	}
+	replayed := reopen(t, nil, snapshotPath, walDir)
+	if got, want := storeContents(t, replayed), storeContents(t, logged); !reflect.DeepEqual(got, want) {
+		t.Errorf("restored store = %+v, want %+v", got, want)
+	}
+
+	// A snapshot covering the replayed writes leaves nothing to replay twice
+	if err := replayed.SaveSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	again := reopen(t, nil, snapshotPath, walDir)
+	ledger, _, _, _ := again.LoadLoyalty()
+	if len(ledger) != 2 {
+		t.Errorf("ledger after a second restore has %d entries, want 2", len(ledger))
+	}
+}
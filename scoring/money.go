@@ -0,0 +1,70 @@
+package scoring
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// amountPattern is the only form receipt amounts take: dollars and exactly two digits of cents, e.g. "6.49"
+var amountPattern = regexp.MustCompile(`^\d+\.\d{2}$`)
+
+// decimalPattern is any plain decimal number, e.g. "10", "-3.5" or "12.345"
+var decimalPattern = regexp.MustCompile(`^-?\d+(\.\d+)?$`)
+
+// ParseCents parses a receipt amount like "12.34" into cents. Amounts are never parsed as floats, whose
+// rounding would make "35.35" fail to be a multiple of 0.05 or a round total compare unequal.
+func ParseCents(amount string) (int64, error) {
+	if !amountPattern.MatchString(amount) {
+		return 0, fmt.Errorf("amount %q must be like 12.34", amount)
+	}
+	return strconv.ParseInt(strings.Replace(amount, ".", "", 1), 10, 64)
+}
+
+// DecimalCents parses any decimal number, like a filter bound or a POS amount, into cents, rounding
+// half away from zero
+func DecimalCents(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if !decimalPattern.MatchString(value) {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	negative := strings.HasPrefix(value, "-")
+	whole, fraction, _ := strings.Cut(strings.TrimPrefix(value, "-"), ".")
+	fraction += "000"
+	cents, err := strconv.ParseInt(whole+fraction[:2], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	if fraction[2] >= '5' {
+		cents++
+	}
+	if negative {
+		cents = -cents
+	}
+	return cents, nil
+}
+
+// FormatCents renders cents as an amount like "12.34"
+func FormatCents(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// multiplierScale is the precision multipliers of amounts are applied at: millionths
+const multiplierScale = 1_000_000
+
+// scaleCents multiplies an amount of cents by a multiplier and returns the whole dollars of the
+// result, rounded down or, with roundUp, up. The multiplier is taken to six decimal places, so the
+// arithmetic is exact.
+func scaleCents(cents int64, multiplier float64, roundUp bool) int64 {
+	scaled, unit := cents*int64(math.Round(multiplier*multiplierScale)), int64(100*multiplierScale)
+	if roundUp && scaled > 0 {
+		return (scaled + unit - 1) / unit
+	}
+	return scaled / unit
+}
@@ -0,0 +1,93 @@
+package scoring
+
+import "testing"
+
+func TestParseCents(t *testing.T) {
+	tests := []struct {
+		amount  string
+		want    int64
+		wantErr bool
+	}{
+		{"35.35", 3535, false},
+		{"9.00", 900, false},
+		{"0.25", 25, false},
+		{"0.00", 0, false},
+		{"1.5", 0, true},
+		{"1", 0, true},
+		{"1.500", 0, true},
+		{"-1.00", 0, true},
+		{"+1.00", 0, true},
+		{" 1.00", 0, true},
+		{"1,00", 0, true},
+		{".50", 0, true},
+		{"", 0, true},
+		// A leading zero is taken as written, like the spec's pattern for totals
+		{"01.00", 100, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.amount, func(t *testing.T) {
+			got, err := ParseCents(tt.amount)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseCents(%q) = %d, %v, want %d, error %v", tt.amount, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecimalCents(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{"10", 1000, false},
+		{"12.34", 1234, false},
+		{" 12.34 ", 1234, false},
+		{"-3.5", -350, false},
+		{"12.345", 1235, false},
+		{"12.344", 1234, false},
+		{"-12.345", -1235, false},
+		{"1e3", 0, true},
+		{"abc", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := DecimalCents(tt.value)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("DecimalCents(%q) = %d, %v, want %d, error %v", tt.value, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFormatCents(t *testing.T) {
+	for cents, want := range map[int64]string{0: "0.00", 5: "0.05", 3535: "35.35", -350: "-3.50"} {
+		if got := FormatCents(cents); got != want {
+			t.Errorf("FormatCents(%d) = %q, want %q", cents, got, want)
+		}
+	}
+}
+
+func TestScaleCents(t *testing.T) {
+	tests := []struct {
+		cents      int64
+		multiplier float64
+		roundUp    bool
+		want       int64
+	}{
+		{1225, 0.2, false, 2},
+		{1225, 0.2, true, 3},
+		{1000, 0.2, true, 2},
+		{126, 0.2, true, 1},
+		{0, 0.2, true, 0},
+		// 0.1 and 0.2 are not exact as floats, which must not push an exact result over a dollar
+		{1000, 0.1, true, 1},
+		{3535, 0.2, false, 7},
+	}
+	for _, tt := range tests {
+		if got := scaleCents(tt.cents, tt.multiplier, tt.roundUp); got != tt.want {
+			t.Errorf("scaleCents(%d, %g, %v) = %d, want %d", tt.cents, tt.multiplier, tt.roundUp, got, tt.want)
+		}
+	}
+}
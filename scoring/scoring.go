@@ -0,0 +1,424 @@
+// Package scoring computes receipt points. It has no HTTP, storage or configuration dependencies:
+// a Receipt and a set of Rules go in, Points and a rule-by-rule Breakdown come out, so batch jobs
+// can score receipts exactly as the server does by importing it.
+package scoring
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Receipt is what the rules look at. Amounts are decimal strings like "12.34" in the currency the
+// rules are tuned for; converting other currencies is up to the caller.
+type Receipt struct {
+	Retailer     string `json:"retailer"`
+	PurchaseDate string `json:"purchaseDate"`
+	PurchaseTime string `json:"purchaseTime"`
+	Total        string `json:"total"`
+	Tax          string `json:"tax,omitempty"`
+	Tip          string `json:"tip,omitempty"`
+	Channel      string `json:"channel,omitempty"`
+	// Tier is the loyalty tier of the receipt's user when it was processed, if any
+	Tier  string `json:"tier,omitempty"`
+	Items []Item `json:"items"`
+	// Campaigns are the promotions the receipt may qualify for; those that apply to it are scored by rule 11
+	Campaigns []Campaign `json:"campaigns,omitempty"`
+}
+
+// Item is one line of a receipt
+type Item struct {
+	ShortDescription string `json:"shortDescription"`
+	Price            string `json:"price"`
+	Category         string `json:"category,omitempty"`
+}
+
+// What the round dollar and quarter rules score: the gross total, or the subtotal before tax and tip
+const (
+	ScoreOnTotal    = "total"
+	ScoreOnSubtotal = "subtotal"
+)
+
+// How strictly the rules follow the specification. Legacy scoring counts every byte of the retailer
+// name and the raw description length and rounds the description points down; spec scoring counts
+// only the letters and digits of the retailer name, counts the characters of trimmed descriptions and
+// rounds up.
+const (
+	ModeLegacy = "legacy"
+	ModeSpec   = "spec"
+)
+
+// Rules holds the tunable values of the points rules
+type Rules struct {
+	RetailerCharacterPoints    int     `json:"retailerCharacterPoints"`
+	RoundDollarPoints          int     `json:"roundDollarPoints"`
+	QuarterMultiplePoints      int     `json:"quarterMultiplePoints"`
+	ItemPairPoints             int     `json:"itemPairPoints"`
+	DescriptionLengthMultiple  int     `json:"descriptionLengthMultiple"`
+	DescriptionPriceMultiplier float64 `json:"descriptionPriceMultiplier"`
+	OddDayPoints               int     `json:"oddDayPoints"`
+	AfternoonPoints            int     `json:"afternoonPoints"`
+	AfternoonStart             string  `json:"afternoonStart"`
+	AfternoonEnd               string  `json:"afternoonEnd"`
+	// ChannelBonuses awards extra points to receipts submitted through a channel, e.g. {"app": 5}
+	ChannelBonuses map[string]int `json:"channelBonuses,omitempty"`
+	// CategoryBonuses awards extra points for every item in a category, e.g. {"produce": 2}
+	CategoryBonuses map[string]int `json:"categoryBonuses,omitempty"`
+	// TierMultipliers scales the points of receipts from users in a loyalty tier, e.g. {"gold": 1.5}
+	TierMultipliers map[string]float64 `json:"tierMultipliers,omitempty"`
+	// ScoreOn is what the round dollar and quarter rules score: "total" (the default) or "subtotal",
+	// the total before tax and tip
+	ScoreOn string `json:"scoreOn,omitempty"`
+	// Mode is how strictly the retailer and item description rules follow the specification: "legacy"
+	// (the default) or "spec"
+	Mode string `json:"mode,omitempty"`
+	// RetailerOverrides adjusts the points of one retailer's receipts, keyed by RetailerKey of its name
+	RetailerOverrides map[string]RetailerOverride `json:"retailerOverrides,omitempty"`
+}
+
+// RetailerOverride adjusts the points of a retailer's receipts: the points of rules 1 to 9 are scaled by
+// Multiplier and BonusPoints are added on top
+type RetailerOverride struct {
+	// Multiplier scales the points of rules 1 to 9, e.g. 1.5; 0 means no scaling
+	Multiplier  float64 `json:"multiplier,omitempty"`
+	BonusPoints int     `json:"bonusPoints,omitempty"`
+}
+
+// storeNumberPattern matches the store numbers retailers append to their name, e.g. "#1234" or "store 12"
+var storeNumberPattern = regexp.MustCompile(`(?i)(#\s*\d+|\bstore\s*(no\.?\s*)?\d+)`)
+
+// RetailerKey reduces a retailer name to what retailers are matched on: lowercase letters and digits,
+// without store numbers, so "WAL-MART #1234" and "Wal Mart" share the key "walmart"
+func RetailerKey(name string) string {
+	name = storeNumberPattern.ReplaceAllString(strings.ToLower(name), "")
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r > 127 {
+			return r
+		}
+		return -1
+	}, name)
+}
+
+// DefaultRules is the original scoring
+var DefaultRules = Rules{
+	RetailerCharacterPoints:    1,
+	RoundDollarPoints:          50,
+	QuarterMultiplePoints:      25,
+	ItemPairPoints:             5,
+	DescriptionLengthMultiple:  3,
+	DescriptionPriceMultiplier: 0.2,
+	OddDayPoints:               6,
+	AfternoonPoints:            10,
+	AfternoonStart:             "14:00",
+	AfternoonEnd:               "16:00",
+}
+
+// SpecRules is the original scoring in spec mode
+var SpecRules = func() Rules {
+	rules := DefaultRules
+	rules.Mode = ModeSpec
+	return rules
+}()
+
+// Validate rejects rules that cannot be applied
+func (rules Rules) Validate() error {
+	if rules.DescriptionLengthMultiple < 0 {
+		return errors.New("descriptionLengthMultiple must not be negative")
+	}
+	start, err := time.Parse("15:04", rules.AfternoonStart)
+	if err != nil {
+		return errors.New("afternoonStart must be HH:MM")
+	}
+	end, err := time.Parse("15:04", rules.AfternoonEnd)
+	if err != nil {
+		return errors.New("afternoonEnd must be HH:MM")
+	}
+	if !end.After(start) {
+		return errors.New("afternoonEnd must be after afternoonStart")
+	}
+	if rules.ScoreOn != "" && rules.ScoreOn != ScoreOnTotal && rules.ScoreOn != ScoreOnSubtotal {
+		return errors.New("scoreOn must be total or subtotal")
+	}
+	if rules.Mode != "" && rules.Mode != ModeLegacy && rules.Mode != ModeSpec {
+		return errors.New("mode must be legacy or spec")
+	}
+	for tier, multiplier := range rules.TierMultipliers {
+		if multiplier <= 0 {
+			return fmt.Errorf("tierMultipliers[%q] must be positive", tier)
+		}
+	}
+	for retailer, override := range rules.RetailerOverrides {
+		if key := RetailerKey(retailer); key != retailer || key == "" {
+			return fmt.Errorf("retailerOverrides key %q must be a retailer key like %q", retailer, key)
+		}
+		if override.Multiplier < 0 {
+			return fmt.Errorf("retailerOverrides[%q] multiplier must not be negative", retailer)
+		}
+	}
+	return nil
+}
+
+// Campaign is a time-bounded promotion layered on top of the rules: receipts purchased between StartDate
+// and EndDate (inclusive, YYYY-MM-DD), on one of Weekdays and from one of Retailers when those are set,
+// have their points scaled by Multiplier and get BonusPoints on top
+type Campaign struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	StartDate string   `json:"startDate"`
+	EndDate   string   `json:"endDate"`
+	Weekdays  []string `json:"weekdays,omitempty"`
+	Retailers []string `json:"retailers,omitempty"`
+	// Multiplier scales the points of rules 1 to 9, e.g. 2 for double points; 0 means no scaling
+	Multiplier  float64 `json:"multiplier,omitempty"`
+	BonusPoints int     `json:"bonusPoints,omitempty"`
+}
+
+// Validate rejects campaigns that cannot be applied
+func (c Campaign) Validate() error {
+	start, err := time.Parse("2006-01-02", c.StartDate)
+	if err != nil {
+		return errors.New("startDate must be YYYY-MM-DD")
+	}
+	end, err := time.Parse("2006-01-02", c.EndDate)
+	if err != nil {
+		return errors.New("endDate must be YYYY-MM-DD")
+	}
+	if end.Before(start) {
+		return errors.New("endDate must not be before startDate")
+	}
+	for _, day := range c.Weekdays {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("unknown weekday %q", day)
+		}
+	}
+	if c.Multiplier < 0 {
+		return errors.New("multiplier must not be negative")
+	}
+	if c.Multiplier == 0 && c.BonusPoints == 0 {
+		return errors.New("a campaign needs a multiplier or bonusPoints")
+	}
+	return nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+// Applies reports whether a receipt qualifies for the campaign
+func (c Campaign) Applies(receipt Receipt) bool {
+	purchaseDate, err := time.Parse("2006-01-02", receipt.PurchaseDate)
+	if err != nil || receipt.PurchaseDate < c.StartDate || receipt.PurchaseDate > c.EndDate {
+		return false
+	}
+	if len(c.Weekdays) > 0 && !containsFold(c.Weekdays, purchaseDate.Weekday().String()) {
+		return false
+	}
+	return len(c.Retailers) == 0 || containsFold(c.Retailers, receipt.Retailer)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// alphanumerics counts the letters and digits of any script in s
+func alphanumerics(s string) int {
+	n := 0
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			n++
+		}
+	}
+	return n
+}
+
+// RuleScore is what one rule contributed to a receipt's points, and why
+type RuleScore struct {
+	Rule   int    `json:"rule"`
+	Points int    `json:"points"`
+	Detail string `json:"detail"`
+}
+
+// Result is a receipt's points and the rule-by-rule breakdown they add up from
+type Result struct {
+	Points    int         `json:"points"`
+	Breakdown []RuleScore `json:"breakdown"`
+}
+
+// Score scores a receipt under the given rules
+func Score(rules Rules, receipt Receipt) Result {
+	result := Result{Breakdown: Explain(rules, receipt)}
+	for _, score := range result.Breakdown {
+		result.Points += score.Points
+	}
+	return result
+}
+
+// Points returns a receipt's points under the given rules
+func Points(rules Rules, receipt Receipt) int {
+	return Score(rules, receipt).Points
+}
+
+// Explain scores a receipt rule by rule under the given rules
+func Explain(rules Rules, receipt Receipt) []RuleScore {
+	var scores []RuleScore
+	add := func(rule, points int, format string, args ...interface{}) {
+		scores = append(scores, RuleScore{Rule: rule, Points: points, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	spec := rules.Mode == ModeSpec
+
+	// Rule 1: One point for every alphanumeric character in the retailer name. Legacy scoring counts
+	// every byte, so "M&M" scores 3 and "Café" 5; spec scoring counts letters and digits, 2 and 4.
+	if spec {
+		characters := alphanumerics(receipt.Retailer)
+		add(1, characters*rules.RetailerCharacterPoints, "%d alphanumeric characters in the retailer name", characters)
+	} else {
+		add(1, len(receipt.Retailer)*rules.RetailerCharacterPoints, "%d characters in the retailer name", len(receipt.Retailer))
+	}
+
+	// Rules 2 and 3 look at the gross total, or at the subtotal before tax and tip when the rules say so
+	amount, amountName := receipt.Total, "total"
+	if rules.ScoreOn == ScoreOnSubtotal {
+		amount, amountName = Subtotal(receipt), "subtotal"
+	}
+
+	// Rule 2: 50 points if the total is a round dollar amount with no cents
+	totalCents, err := ParseCents(amount)
+	switch {
+	case err != nil:
+		add(2, 0, "%s %q is not an amount", amountName, amount)
+	case totalCents%100 == 0:
+		add(2, rules.RoundDollarPoints, "%s %s is a round dollar amount", amountName, amount)
+	default:
+		add(2, 0, "%s %s has cents", amountName, amount)
+	}
+
+	// Rule 3: 25 points if the total is a multiple of 0.25
+	switch {
+	case err != nil:
+		add(3, 0, "%s %q is not an amount", amountName, amount)
+	case totalCents%25 == 0:
+		add(3, rules.QuarterMultiplePoints, "%s %s is a multiple of 0.25", amountName, amount)
+	default:
+		add(3, 0, "%s %s is not a multiple of 0.25", amountName, amount)
+	}
+
+	// Rule 4: 5 points for every two items on the receipt
+	add(4, len(receipt.Items)/2*rules.ItemPairPoints, "%d items make %d pairs", len(receipt.Items), len(receipt.Items)/2)
+
+	// Rule 5: If the length of the item description is a multiple of 3, multiply the price by 0.2. The legacy
+	// rule counts the bytes of the raw description and rounds down; the spec rule counts the characters of
+	// the trimmed description and rounds up.
+	descriptionPoints, matched := 0, 0
+	for _, item := range receipt.Items {
+		length := len(item.ShortDescription)
+		if spec {
+			length = utf8.RuneCountInString(strings.TrimSpace(item.ShortDescription))
+		}
+		if rules.DescriptionLengthMultiple > 0 && length%rules.DescriptionLengthMultiple == 0 {
+			price, _ := ParseCents(item.Price)
+			descriptionPoints += int(scaleCents(price, rules.DescriptionPriceMultiplier, spec))
+			matched++
+		}
+	}
+	add(5, descriptionPoints, "%d of %d item descriptions have a length that is a multiple of %d", matched, len(receipt.Items), rules.DescriptionLengthMultiple)
+
+	// Rule 6: 6 points if the day in the purchase date is odd
+	purchaseDate, _ := time.Parse("2006-01-02", receipt.PurchaseDate)
+	if purchaseDate.Day()%2 != 0 {
+		add(6, rules.OddDayPoints, "day %d of the purchase date is odd", purchaseDate.Day())
+	} else {
+		add(6, 0, "day %d of the purchase date is even", purchaseDate.Day())
+	}
+
+	// Rule 7: 10 points if the time of purchase is after 2:00pm and before 4:00pm
+	purchaseTime, _ := time.Parse("15:04", receipt.PurchaseTime)
+	windowStart, _ := time.Parse("15:04", rules.AfternoonStart)
+	windowEnd, _ := time.Parse("15:04", rules.AfternoonEnd)
+	if purchaseTime.After(windowStart) && purchaseTime.Before(windowEnd) {
+		add(7, rules.AfternoonPoints, "purchased at %s, between %s and %s", receipt.PurchaseTime, rules.AfternoonStart, rules.AfternoonEnd)
+	} else {
+		add(7, 0, "purchased at %s, outside %s to %s", receipt.PurchaseTime, rules.AfternoonStart, rules.AfternoonEnd)
+	}
+
+	// Rule 8: bonus points for receipts submitted through a channel the rules favor
+	if len(rules.ChannelBonuses) > 0 {
+		add(8, rules.ChannelBonuses[receipt.Channel], "submitted through the %q channel", receipt.Channel)
+	}
+
+	// Rule 9: bonus points for every item in a category the rules favor
+	if len(rules.CategoryBonuses) > 0 {
+		categoryPoints, matched := 0, 0
+		for _, item := range receipt.Items {
+			if bonus, ok := rules.CategoryBonuses[item.Category]; ok {
+				categoryPoints += bonus
+				matched++
+			}
+		}
+		add(9, categoryPoints, "%d of %d items are in bonus categories", matched, len(receipt.Items))
+	}
+
+	// Rules 10 to 12 scale the points of rules 1 to 9
+	base := 0
+	for _, score := range scores {
+		base += score.Points
+	}
+
+	// Rule 10: the points of every other rule are scaled by the multiplier of the user's loyalty tier
+	if len(rules.TierMultipliers) > 0 {
+		multiplier, ok := rules.TierMultipliers[receipt.Tier]
+		if !ok {
+			multiplier = 1
+		}
+		add(10, int(math.Round(float64(base)*(multiplier-1))), "%q tier multiplies %d points by %g", receipt.Tier, base, multiplier)
+	}
+
+	// Rule 11: every campaign the receipt qualifies for, once each
+	for _, campaign := range receipt.Campaigns {
+		if !campaign.Applies(receipt) {
+			continue
+		}
+		points := campaign.BonusPoints
+		if campaign.Multiplier > 0 {
+			points += int(math.Round(float64(base) * (campaign.Multiplier - 1)))
+		}
+		add(11, points, "campaign %q multiplies %d points by %g and adds %d", campaign.Name, base, math.Max(campaign.Multiplier, 1), campaign.BonusPoints)
+	}
+
+	// Rule 12: the override of the receipt's retailer, if the rules have one
+	key := RetailerKey(receipt.Retailer)
+	if override, ok := rules.RetailerOverrides[key]; ok {
+		points := override.BonusPoints
+		if override.Multiplier > 0 {
+			points += int(math.Round(float64(base) * (override.Multiplier - 1)))
+		}
+		add(12, points, "retailer %q override multiplies %d points by %g and adds %d", key, base, math.Max(override.Multiplier, 1), override.BonusPoints)
+	}
+
+	return scores
+}
+
+// Subtotal is the total before tax and tip
+func Subtotal(receipt Receipt) string {
+	total, err := ParseCents(receipt.Total)
+	if err != nil {
+		return receipt.Total
+	}
+	for _, charge := range []string{receipt.Tax, receipt.Tip} {
+		if cents, err := ParseCents(charge); err == nil {
+			total -= cents
+		}
+	}
+	return FormatCents(total)
+}
@@ -0,0 +1,204 @@
+package scoring
+
+import "testing"
+
+// target and cornerMarket are the examples of the specification, which scores them 28 and 109
+var (
+	target = Receipt{
+		Retailer: "Target", PurchaseDate: "2022-01-01", PurchaseTime: "13:01", Total: "35.35",
+		Items: []Item{
+			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
+			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
+			{ShortDescription: "Knorr Creamy Chicken", Price: "1.26"},
+			{ShortDescription: "Doritos Nacho Cheese", Price: "3.35"},
+			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: "12.00"},
+		},
+	}
+	cornerMarket = Receipt{
+		Retailer: "M&M Corner Market", PurchaseDate: "2022-03-20", PurchaseTime: "14:33", Total: "9.00",
+		Items: []Item{
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+		},
+	}
+)
+
+// rulePoints returns what one rule contributed to a breakdown, over all the times it applied
+func rulePoints(scores []RuleScore, rule int) int {
+	points := 0
+	for _, score := range scores {
+		if score.Rule == rule {
+			points += score.Points
+		}
+	}
+	return points
+}
+
+func TestSpecExamples(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   Rules
+		receipt Receipt
+		want    int
+	}{
+		{"target in spec mode", SpecRules, target, 28},
+		{"corner market in spec mode", SpecRules, cornerMarket, 109},
+		// Legacy scoring misses the padded Klarbrunn description and rounds Emils Cheese Pizza down
+		{"target in legacy mode", DefaultRules, target, 24},
+		// and counts the spaces and ampersand of M&M Corner Market
+		{"corner market in legacy mode", DefaultRules, cornerMarket, 112},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Score(tt.rules, tt.receipt)
+			if result.Points != tt.want {
+				t.Errorf("points = %d, want %d: %+v", result.Points, tt.want, result.Breakdown)
+			}
+		})
+	}
+}
+
+func TestMultipliersStack(t *testing.T) {
+	// Rules 10 to 12 each scale the 109 points of rules 1 to 9, so they add up rather than compound
+	doublePoints := Campaign{Name: "double", StartDate: "2022-03-01", EndDate: "2022-03-31", Multiplier: 2, BonusPoints: 5}
+	tests := []struct {
+		name      string
+		tiers     map[string]float64
+		campaigns []Campaign
+		overrides map[string]RetailerOverride
+		want      map[int]int
+		wantTotal int
+	}{
+		{
+			name:      "tier",
+			tiers:     map[string]float64{"gold": 1.5},
+			want:      map[int]int{10: 55},
+			wantTotal: 164,
+		},
+		{
+			name:      "campaign",
+			campaigns: []Campaign{doublePoints},
+			want:      map[int]int{11: 114},
+			wantTotal: 223,
+		},
+		{
+			name:      "campaign outside its dates",
+			campaigns: []Campaign{{Name: "april", StartDate: "2022-04-01", EndDate: "2022-04-30", Multiplier: 2}},
+			want:      map[int]int{},
+			wantTotal: 109,
+		},
+		{
+			name:      "retailer override",
+			overrides: map[string]RetailerOverride{"mmcornermarket": {Multiplier: 1.5, BonusPoints: 3}},
+			want:      map[int]int{12: 58},
+			wantTotal: 167,
+		},
+		{
+			name:      "all three",
+			tiers:     map[string]float64{"gold": 1.5},
+			campaigns: []Campaign{doublePoints, doublePoints},
+			overrides: map[string]RetailerOverride{"mmcornermarket": {Multiplier: 1.5, BonusPoints: 3}},
+			want:      map[int]int{10: 55, 11: 228, 12: 58},
+			wantTotal: 450,
+		},
+		{
+			name:      "tier the receipt is not in",
+			tiers:     map[string]float64{"silver": 1.2},
+			want:      map[int]int{10: 0},
+			wantTotal: 109,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := SpecRules
+			rules.TierMultipliers, rules.RetailerOverrides = tt.tiers, tt.overrides
+			receipt := cornerMarket
+			receipt.Tier, receipt.Campaigns = "gold", tt.campaigns
+			result := Score(rules, receipt)
+			for rule := 10; rule <= 12; rule++ {
+				got := rulePoints(result.Breakdown, rule)
+				if got != tt.want[rule] {
+					t.Errorf("rule %d = %d, want %d", rule, got, tt.want[rule])
+				}
+			}
+			if result.Points != tt.wantTotal {
+				t.Errorf("points = %d, want %d", result.Points, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestDescriptionRule(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		price       string
+		wantLegacy  int
+		wantSpec    int
+	}{
+		{"length a multiple of 3", "abc", "12.25", 2, 3},
+		{"round-up of an exact amount", "abc", "10.00", 2, 2},
+		{"round-up of a fraction of a cent", "abc", "0.01", 0, 1},
+		{"surrounding spaces", " abc ", "12.25", 0, 3},
+		{"surrounding tabs and newlines", "\tabc\n", "12.25", 0, 3},
+		{"inner spaces count", "a b c", "12.25", 0, 0},
+		{"padded to a multiple of 3", " abcd ", "12.25", 2, 0},
+		{"multi-byte characters", "Cafés", "12.25", 2, 0},
+		{"multi-byte characters, padded", "  Café au lait  ", "12.25", 0, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receipt := Receipt{Retailer: "Target", PurchaseDate: "2022-01-02", PurchaseTime: "10:00", Total: tt.price,
+				Items: []Item{{ShortDescription: tt.description, Price: tt.price}}}
+			if got := rulePoints(Explain(DefaultRules, receipt), 5); got != tt.wantLegacy {
+				t.Errorf("legacy rule 5 = %d, want %d", got, tt.wantLegacy)
+			}
+			if got := rulePoints(Explain(SpecRules, receipt), 5); got != tt.wantSpec {
+				t.Errorf("spec rule 5 = %d, want %d", got, tt.wantSpec)
+			}
+		})
+	}
+}
+
+func TestRetailerRule(t *testing.T) {
+	tests := []struct {
+		retailer   string
+		wantLegacy int
+		wantSpec   int
+	}{
+		{"Target", 6, 6},
+		{"M&M Corner Market", 17, 14},
+		{"Café", 5, 4},
+		{"Müller-Lüdenscheid", 20, 17},
+		{"東京ストア", 15, 5},
+		{"Straße 7", 9, 7},
+		{"!!!", 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.retailer, func(t *testing.T) {
+			receipt := Receipt{Retailer: tt.retailer, PurchaseDate: "2022-01-02", PurchaseTime: "10:00", Total: "1.10"}
+			if got := rulePoints(Explain(DefaultRules, receipt), 1); got != tt.wantLegacy {
+				t.Errorf("legacy rule 1 = %d, want %d", got, tt.wantLegacy)
+			}
+			if got := rulePoints(Explain(SpecRules, receipt), 1); got != tt.wantSpec {
+				t.Errorf("spec rule 1 = %d, want %d", got, tt.wantSpec)
+			}
+		})
+	}
+}
+
+func TestRetailerKey(t *testing.T) {
+	for name, want := range map[string]string{
+		"WAL-MART #1234":    "walmart",
+		"Wal Mart":          "walmart",
+		"Target Store 12":   "target",
+		"Café Nero":         "cafénero",
+		"M&M Corner Market": "mmcornermarket",
+	} {
+		if got := RetailerKey(name); got != want {
+			t.Errorf("RetailerKey(%q) = %q, want %q", name, got, want)
+		}
+	}
+}